@@ -0,0 +1,238 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/config"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/storage"
+)
+
+// Output formats of commands
+const (
+	OutputHuman = "human"
+	OutputJSON  = "json"
+)
+
+// Exit codes of commands, serve command exits with lifecycle codes
+const (
+	ExitOK    = 0
+	ExitError = 1
+	ExitUsage = 2
+)
+
+// errUsage - command is called with invalid arguments, usage is already printed
+var errUsage = errors.New("invalid usage")
+
+// exitCode - error of the command, which exits with given code without message
+type exitCode int
+
+func (c exitCode) Error() string {
+	return fmt.Sprintf("exit code %d", int(c))
+}
+
+// command - node of the command tree, only leaf commands have run function
+type command struct {
+	name    string
+	args    string // synopsis of flags and arguments
+	summary string
+	run     func(a *app, fs *flag.FlagSet, args []string) error
+	// commands - subcommands of the group
+	commands []*command
+}
+
+// app - state shared by commands: standard streams, global flags and config sources
+type app struct {
+	stdin          io.Reader
+	stdout, stderr io.Writer
+	environ        []string
+	configPath     string
+	output         string
+	configFlags    func() config.Source
+}
+
+// run - executes command given by arguments, returns exit code of the process;
+// server is started if command is not given.
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer, environ []string) int {
+	a := &app{stdin: stdin, stdout: stdout, stderr: stderr, environ: environ}
+	for _, kv := range environ {
+		if strings.HasPrefix(kv, AppConfigPathnameEnv+"=") {
+			a.configPath = strings.TrimPrefix(kv, AppConfigPathnameEnv+"=")
+		}
+	}
+	root := commands()
+	fs := flag.NewFlagSet("pwsrv", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { a.usage(root, "") }
+	fs.StringVar(
+		&a.configPath, "config", a.configPath,
+		fmt.Sprintf("Path to optional JSON, YAML or TOML config file, %s environment's var by default.", AppConfigPathnameEnv),
+	)
+	fs.StringVar(&a.output, "output", OutputHuman, "Output format of commands: human or json.")
+	// deprecated aliases of config commands
+	printConfig := fs.Bool("print-config", false, "Same as config check command.")
+	keyringSet := fs.String("keyring-set", "", "Same as config keyring-set command.")
+	a.configFlags = config.FlagSource(fs, defaultConfiguration())
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return ExitOK
+		}
+		return ExitUsage
+	}
+	if a.output != OutputHuman && a.output != OutputJSON {
+		fmt.Fprintf(stderr, "invalid value %q for flag -output: human or json expected\n", a.output)
+		return ExitUsage
+	}
+
+	args = fs.Args()
+	switch {
+	case *printConfig:
+		args = []string{"config", "check"}
+	case *keyringSet != "":
+		args = []string{"config", "keyring-set", *keyringSet}
+	case len(args) == 0:
+		args = []string{"serve"}
+	}
+	cmd, path := root, ""
+	for cmd.run == nil {
+		if len(args) == 0 {
+			a.usage(cmd, path)
+			return ExitUsage
+		}
+		sub := cmd.find(args[0])
+		if sub == nil {
+			fmt.Fprintf(stderr, "%s: unknown command %q\n", strings.TrimSpace("pwsrv "+path), args[0])
+			a.usage(cmd, path)
+			return ExitUsage
+		}
+		cmd, path, args = sub, strings.TrimSpace(path+" "+sub.name), args[1:]
+	}
+	path = "pwsrv " + path
+
+	cmdFlags := flag.NewFlagSet(path, flag.ContinueOnError)
+	cmdFlags.SetOutput(stderr)
+	cmdFlags.Usage = func() {
+		fmt.Fprintf(stderr, "%s\n\nUsage: %s %s\n", cmd.summary, path, cmd.args)
+		cmdFlags.PrintDefaults()
+	}
+	err := cmd.run(a, cmdFlags, args)
+	var code exitCode
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return ExitOK
+	case errors.Is(err, errUsage):
+		return ExitUsage
+	case errors.As(err, &code):
+		return int(code)
+	}
+	fmt.Fprintf(stderr, "%s: %s\n", path, err.Error())
+	return ExitError
+}
+
+// find - returns subcommand by name or nil.
+func (c *command) find(name string) *command {
+	for _, sub := range c.commands {
+		if sub.name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// usage - prints leaf commands of the group with given path and their synopsis.
+func (a *app) usage(group *command, path string) {
+	fmt.Fprintln(a.stderr, "Usage: pwsrv [-config FILE] [-output human|json] [-KEY=VALUE ...] [command]")
+	fmt.Fprintln(a.stderr, "\nCommands:")
+	w := tabwriter.NewWriter(a.stderr, 0, 4, 2, ' ', 0)
+	var list func(c *command, path string)
+	list = func(c *command, path string) {
+		if c.run != nil {
+			fmt.Fprintf(w, "  %s %s\t%s\n", path, c.args, c.summary)
+			return
+		}
+		for _, sub := range c.commands {
+			list(sub, strings.TrimSpace(path+" "+sub.name))
+		}
+	}
+	list(group, path)
+	w.Flush()
+	fmt.Fprintln(a.stderr, "\nServer is run if command is not given. Every config parameter can be overridden with flag, like -server.port=9000,")
+	fmt.Fprintln(a.stderr, "see config check command for the list of parameters.")
+}
+
+// parse - parses flags of the command and checks count of positional arguments.
+func parse(fs *flag.FlagSet, args []string, count int) error {
+	if err := fs.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return err
+		}
+		return errUsage
+	}
+	if fs.NArg() != count {
+		return usageError(fs, "%d argument(s) expected, got %d", count, fs.NArg())
+	}
+	return nil
+}
+
+// usageError - prints the problem with usage of the command.
+func usageError(fs *flag.FlagSet, format string, args ...interface{}) error {
+	fmt.Fprintf(fs.Output(), format+"\n", args...)
+	fs.Usage()
+	return errUsage
+}
+
+// config - loads configuration from the file, environment and global flags.
+func (a *app) config() (*Configuration, error) {
+	cfg := defaultConfiguration()
+	if _, err := loadConfig(cfg, a.configPath, a.environ, a.configFlags()); err != nil {
+		return nil, fmt.Errorf("unable to load config: %s", err.Error())
+	}
+	return cfg, nil
+}
+
+// openStorage - loads configuration and opens storage, which schema is checked if checkSchema is true;
+// storage reports warnings and errors only to stderr, which is not mixed with output of the command.
+func (a *app) openStorage(checkSchema bool) (storage.Interface, error) {
+	cfg, err := a.config()
+	if err != nil {
+		return nil, err
+	}
+	logger, err := logging.New(a.stderr, cfg.Log.Format, "warn")
+	if err != nil {
+		return nil, err
+	}
+	s, err := newStorage(cfg, logger, nil, false)
+	if err != nil {
+		return nil, err
+	}
+	if checkSchema {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := s.CheckSchema(ctx); err != nil {
+			s.Close()
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// print - writes v as indented JSON in json output mode,
+// otherwise calls human to write tab separated columns, which are aligned.
+func (a *app) print(v interface{}, human func(w io.Writer)) error {
+	if a.output == OutputJSON {
+		e := json.NewEncoder(a.stdout)
+		e.SetIndent("", "  ")
+		return e.Encode(v)
+	}
+	w := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	human(w)
+	return w.Flush()
+}
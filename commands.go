@@ -0,0 +1,755 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/archive"
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/config"
+	"github.com/wtask/pwsrv/internal/core"
+	"github.com/wtask/pwsrv/internal/encryption/token"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/operator"
+	"github.com/wtask/pwsrv/internal/reconcile"
+	"github.com/wtask/pwsrv/internal/storage"
+	"github.com/wtask/pwsrv/pkg/email"
+)
+
+// commands - tree of the commands of the binary.
+func commands() *command {
+	return &command{
+		name: "pwsrv",
+		commands: []*command{
+			{name: "serve", args: "[-migrate]", summary: "Run the server until SIGINT or SIGTERM.", run: serveCommand},
+			{
+				name: "migrate",
+				commands: []*command{
+					{name: "up", summary: "Migrate the database schema to the current version.", run: migrateUp},
+					{name: "down", summary: "Revert the last migration of the database schema.", run: migrateDown},
+					{name: "status", summary: "Check the database schema is up to date.", run: migrateStatus},
+				},
+			},
+			{
+				name: "user",
+				commands: []*command{
+					{
+						name:    "create",
+						args:    "-email ADDRESS -name NAME [-role ROLE] < PASSWORD",
+						summary: "Create user with password read from stdin.",
+						run:     userCreate,
+					},
+					{name: "promote", args: "-role ROLE USER", summary: "Grant the role to the user.", run: userPromote},
+					{
+						name:    "freeze",
+						args:    "[-unfreeze] USER",
+						summary: "Block login and issued tokens of the user, or unblock them.",
+						run:     userFreeze,
+					},
+					{name: "show", args: "USER", summary: "Show the user and balances of its wallets.", run: userShow},
+				},
+			},
+			{
+				name: "transfer",
+				commands: []*command{
+					{
+						name:    "list",
+						args:    "[-currency CODE] [-limit N] USER",
+						summary: "List last transfers sent or received by the user.",
+						run:     transferList,
+					},
+					{name: "show", args: "ID", summary: "Show the transfer with balances of both sides.", run: transferShow},
+				},
+			},
+			{
+				name: "data",
+				commands: []*command{
+					{
+						name:    "export",
+						args:    "[-anonymize] FILE",
+						summary: "Write users, wallets, transfers and conversions into NDJSON archive, - is stdout.",
+						run:     dataExport,
+					},
+					{
+						name:    "import",
+						args:    "FILE",
+						summary: "Create entities of the archive in empty database and verify them, - is stdin.",
+						run:     dataImport,
+					},
+				},
+			},
+			{
+				name:    "reconcile",
+				summary: "Replay transfers and conversions and verify balances of wallets, exits with 1 on discrepancies.",
+				run:     reconcileCommand,
+			},
+			{
+				name: "token",
+				commands: []*command{
+					{name: "issue", args: "[-ttl DURATION] USER", summary: "Issue authorization token of the user.", run: tokenIssue},
+					{name: "inspect", args: "TOKEN", summary: "Verify the token and show its claims.", run: tokenInspect},
+				},
+			},
+			{
+				name: "config",
+				commands: []*command{
+					{name: "check", summary: "Verify config and print effective values with their origins.", run: configCheck},
+					{
+						name:    "keyring-set",
+						args:    "NAME < SECRET",
+						summary: "Store secret read from stdin into configured keyring.",
+						run:     configKeyringSet,
+					},
+				},
+			},
+		},
+	}
+}
+
+func serveCommand(a *app, fs *flag.FlagSet, args []string) error {
+	migrate := fs.Bool("migrate", false, "Apply pending schema migrations before start, otherwise server refuses to start with them.")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	if code := serve(a, cfg, *migrate); code != ExitOK {
+		return exitCode(code)
+	}
+	return nil
+}
+
+// printMigrations - prints migrations as table or message if list is empty.
+func (a *app) printMigrations(migrations []storage.Migration, empty string) error {
+	return a.print(migrations, func(w io.Writer) {
+		if len(migrations) == 0 {
+			fmt.Fprintln(w, empty)
+			return
+		}
+		fmt.Fprintln(w, "Version\tName\tApplied")
+		for _, m := range migrations {
+			applied := "pending"
+			if m.AppliedAt != nil {
+				applied = m.AppliedAt.UTC().Format(time.RFC3339)
+			}
+			if m.Unknown {
+				applied += " (unknown)"
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", m.Version, m.Name, applied)
+		}
+	})
+}
+
+func migrateUp(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	s, err := a.openStorage(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	applied, err := s.Migrator().Up(context.Background())
+	if perr := a.printMigrations(applied, "Schema is up to date"); perr != nil {
+		return perr
+	}
+	return err
+}
+
+func migrateDown(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	s, err := a.openStorage(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	reverted, err := s.Migrator().Down(context.Background())
+	if err != nil {
+		return err
+	}
+	migrations := []storage.Migration{}
+	if reverted != nil {
+		migrations = append(migrations, *reverted)
+	}
+	return a.printMigrations(migrations, "No migrations to revert")
+}
+
+func migrateStatus(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	s, err := a.openStorage(false)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	migrations, err := s.Migrator().Status(ctx)
+	if err != nil {
+		return err
+	}
+	if err := a.printMigrations(migrations, "No migrations"); err != nil {
+		return err
+	}
+	return s.CheckSchema(ctx)
+}
+
+// userView - user presented to operators
+type userView struct {
+	*model.User
+	Role   string `json:"role"`
+	Frozen bool   `json:"frozen"`
+}
+
+func newUserView(u *model.User) userView {
+	return userView{User: u, Role: operator.RoleName(u.Role), Frozen: u.Frozen}
+}
+
+func (u userView) human(w io.Writer) {
+	fmt.Fprintf(w, "ID:\t%d\n", u.ID)
+	fmt.Fprintf(w, "Email:\t%s\n", u.Email)
+	fmt.Fprintf(w, "Name:\t%s\n", u.Name)
+	fmt.Fprintf(w, "Role:\t%s\n", u.Role)
+	fmt.Fprintf(w, "Frozen:\t%t\n", u.Frozen)
+	fmt.Fprintf(w, "Created:\t%s\n", u.CreatedAt.UTC().Format(time.RFC3339))
+	for _, wallet := range u.Wallets {
+		fmt.Fprintf(w, "Balance %s:\t%s\n", wallet.Currency, formatSum(wallet.Balance))
+	}
+}
+
+func formatSum(sum float64) string {
+	return strconv.FormatFloat(sum, 'f', -1, 64)
+}
+
+// record - appends operator's action to the audit log.
+func record(s operator.Store, action, target string, outcome model.AuditOutcome) error {
+	if _, err := s.AppendAuditEntry(audit.NewOperatorEntry(action, target, outcome)); err != nil {
+		return fmt.Errorf("unable to record audit entry: %s", err.Error())
+	}
+	return nil
+}
+
+func userCreate(a *app, fs *flag.FlagSet, args []string) error {
+	address := fs.String("email", "", "Email address used as login.")
+	name := fs.String("name", "", "Name of the user.")
+	roleName := fs.String("role", "regular", "Role of the user: regular, trusted or admin.")
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	login := email.NewAddress(*address)
+	if !login.IsValid() || login.UserName() != "" {
+		return usageError(fs, "-email must be email address")
+	}
+	if *name == "" {
+		return usageError(fs, "-name is required")
+	}
+	role, err := operator.ParseRole(*roleName)
+	if err != nil {
+		return usageError(fs, "-role must be regular, trusted or admin")
+	}
+	password, err := bufio.NewReader(a.stdin).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return fmt.Errorf("unable to read password: %s", err.Error())
+	}
+	password = strings.TrimRight(password, "\r\n")
+	if len(password) < core.MinPasswordLen {
+		return fmt.Errorf("password length must be %d or greater", core.MinPasswordLen)
+	}
+
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.OperatorStore()
+	user, err := store.CreateUser(
+		model.User{
+			Email: login.Get(),
+			Name:  *name,
+			Role:  role,
+			Wallets: []model.Wallet{
+				{Currency: model.DefaultCurrency, Balance: core.WelcomeBalance},
+			},
+		},
+		password,
+	)
+	if err != nil {
+		return errors.Join(err, record(store, audit.UserCreate, login.Get(), model.AuditFailure))
+	}
+	if err := record(store, audit.UserCreate, login.Get(), model.AuditSuccess); err != nil {
+		return err
+	}
+	view := newUserView(user)
+	return a.print(view, view.human)
+}
+
+func userPromote(a *app, fs *flag.FlagSet, args []string) error {
+	roleName := fs.String("role", "", "New role of the user: regular, trusted or admin.")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	role, err := operator.ParseRole(*roleName)
+	if err != nil {
+		return usageError(fs, "-role must be regular, trusted or admin")
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.OperatorStore()
+	user, err := operator.FindUser(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("user #%d", user.ID)
+	if user, err = store.SetUserRole(user.ID, role); err != nil {
+		return errors.Join(err, record(store, audit.UserPromote, target, model.AuditFailure))
+	}
+	if err := record(store, audit.UserPromote, target, model.AuditSuccess); err != nil {
+		return err
+	}
+	view := newUserView(user)
+	return a.print(view, view.human)
+}
+
+func userFreeze(a *app, fs *flag.FlagSet, args []string) error {
+	unfreeze := fs.Bool("unfreeze", false, "Unblock the frozen user.")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.OperatorStore()
+	user, err := operator.FindUser(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	action, target := audit.UserFreeze, fmt.Sprintf("user #%d", user.ID)
+	if *unfreeze {
+		action = audit.UserUnfreeze
+	}
+	if user, err = store.SetUserFrozen(user.ID, !*unfreeze); err != nil {
+		return errors.Join(err, record(store, action, target, model.AuditFailure))
+	}
+	if err := record(store, action, target, model.AuditSuccess); err != nil {
+		return err
+	}
+	view := newUserView(user)
+	return a.print(view, view.human)
+}
+
+func userShow(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	user, err := operator.FindUser(s.OperatorStore(), fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	view := newUserView(user)
+	return a.print(view, view.human)
+}
+
+func transferList(a *app, fs *flag.FlagSet, args []string) error {
+	currency := fs.String("currency", "", "Currency code of transfers, all currencies by default.")
+	limit := fs.Int("limit", 20, "Max number of transfers.")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *limit <= 0 {
+		return usageError(fs, "-limit must be greater than zero")
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.OperatorStore()
+	user, err := operator.FindUser(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	transfers, err := store.FindLastInternalTransfers(user.ID, model.Currency(strings.ToUpper(*currency)), *limit)
+	if err != nil {
+		return err
+	}
+	if transfers == nil {
+		transfers = []model.InternalTransfer{}
+	}
+	return a.print(transfers, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tCreated\tSender\tRecipient\tCurrency\tSum\tMemo")
+		for _, t := range transfers {
+			fmt.Fprintf(
+				w, "%d\t%s\t%d\t%d\t%s\t%s\t%s\n",
+				t.ID, t.CreatedAt.UTC().Format(time.RFC3339), t.UserID, t.RecipientID, t.Currency, formatSum(t.Sum), t.Memo,
+			)
+		}
+	})
+}
+
+func transferShow(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	id, err := strconv.ParseUint(fs.Arg(0), 10, 64)
+	if err != nil {
+		return usageError(fs, "transfer ID must be number")
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	t, err := s.OperatorStore().GetInternalTransferByID(id)
+	if err != nil {
+		return err
+	}
+	if t == nil {
+		return fmt.Errorf("transfer not found: %d", id)
+	}
+	return a.print(t, func(w io.Writer) {
+		fmt.Fprintf(w, "ID:\t%d\n", t.ID)
+		fmt.Fprintf(w, "Created:\t%s\n", t.CreatedAt.UTC().Format(time.RFC3339))
+		fmt.Fprintf(w, "Sum:\t%s %s\n", formatSum(t.Sum), t.Currency)
+		fmt.Fprintf(w, "Memo:\t%s\n", t.Memo)
+		fmt.Fprintf(
+			w, "Sender:\t#%d, balance %s -> %s\n",
+			t.UserID, formatSum(t.UserBalanceBefore), formatSum(t.UserBalanceAfter),
+		)
+		fmt.Fprintf(
+			w, "Recipient:\t#%d, balance %s -> %s\n",
+			t.RecipientID, formatSum(t.RecipientBalanceBefore), formatSum(t.RecipientBalanceAfter),
+		)
+	})
+}
+
+func reconcileCommand(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	report, err := reconcile.NewChecker(s.ReconcileStore()).Run(time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	err = a.print(report, func(w io.Writer) {
+		fmt.Fprintf(
+			w, "Checked %d wallets, %d transfers and %d conversions at %s\n\n",
+			report.Wallets, report.Transfers, report.Conversions, report.CheckedAt.Format(time.RFC3339),
+		)
+		fmt.Fprintln(w, "Currency\tOpening\tConverted in\tConverted out\tExpected\tActual")
+		for _, t := range report.Totals {
+			fmt.Fprintf(
+				w, "%s\t%s\t%s\t%s\t%s\t%s\n", t.Currency, formatSum(t.Opening),
+				formatSum(t.ConvertedIn), formatSum(t.ConvertedOut), formatSum(t.Expected), formatSum(t.Actual),
+			)
+		}
+		if len(report.Discrepancies) == 0 {
+			fmt.Fprintln(w, "\nNo discrepancies")
+			return
+		}
+		fmt.Fprintln(w, "\nKind\tUser\tCurrency\tTransfer\tConversion\tExpected\tActual")
+		for _, d := range report.Discrepancies {
+			fmt.Fprintf(
+				w, "%s\t%d\t%s\t%d\t%d\t%s\t%s\n", d.Kind, d.UserID, d.Currency,
+				d.TransferID, d.ConversionID, formatSum(d.Expected), formatSum(d.Actual),
+			)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if len(report.Discrepancies) > 0 {
+		return exitCode(ExitError)
+	}
+	return nil
+}
+
+// dataReport - result of export or import
+type dataReport struct {
+	File        string `json:"file"`
+	Anonymized  bool   `json:"anonymized"`
+	Users       int    `json:"users"`
+	Wallets     int    `json:"wallets"`
+	Transfers   int    `json:"transfers"`
+	Conversions int    `json:"conversions"`
+	Checksum    string `json:"checksum,omitempty"`
+	// Discrepancies - found by reconciliation of imported data
+	Discrepancies []reconcile.Discrepancy `json:"discrepancies,omitempty"`
+}
+
+func newDataReport(file string, anonymized bool, d *archive.Dataset) dataReport {
+	return dataReport{
+		File:        file,
+		Anonymized:  anonymized,
+		Users:       len(d.Users),
+		Wallets:     len(d.Wallets),
+		Transfers:   len(d.Transfers),
+		Conversions: len(d.Conversions),
+	}
+}
+
+func (r dataReport) human(w io.Writer) {
+	fmt.Fprintf(w, "File:\t%s\n", r.File)
+	fmt.Fprintf(w, "Anonymized:\t%t\n", r.Anonymized)
+	fmt.Fprintf(w, "Users:\t%d\n", r.Users)
+	fmt.Fprintf(w, "Wallets:\t%d\n", r.Wallets)
+	fmt.Fprintf(w, "Transfers:\t%d\n", r.Transfers)
+	fmt.Fprintf(w, "Conversions:\t%d\n", r.Conversions)
+	if r.Checksum != "" {
+		fmt.Fprintf(w, "Checksum:\t%s\n", r.Checksum)
+	}
+	for _, d := range r.Discrepancies {
+		fmt.Fprintf(
+			w, "Discrepancy:\t%s of user %d in %s, expected %s, actual %s\n",
+			d.Kind, d.UserID, d.Currency, formatSum(d.Expected), formatSum(d.Actual),
+		)
+	}
+}
+
+func dataExport(a *app, fs *flag.FlagSet, args []string) error {
+	anonymize := fs.Bool("anonymize", false, "Replace emails and names of users with ones built from IDs, disable their passwords, remove memos of transfers.")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	d, err := s.ArchiveStore().ReadDataset()
+	if err != nil {
+		return err
+	}
+	if *anonymize {
+		d = archive.Anonymize(d)
+	}
+	file, out := fs.Arg(0), a.stdout
+	if file != "-" {
+		f, err := os.Create(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	footer, err := archive.Write(out, archive.Header{CreatedAt: time.Now(), Generator: "pwsrv " + Version, Anonymized: *anonymize}, d)
+	if file != "-" && err != nil {
+		os.Remove(file)
+	}
+	if err != nil {
+		return errors.Join(err, record(s.OperatorStore(), audit.DataExport, file, model.AuditFailure))
+	}
+	if err := record(s.OperatorStore(), audit.DataExport, file, model.AuditSuccess); err != nil {
+		return err
+	}
+	if file == "-" {
+		// stdout is taken by the archive
+		return nil
+	}
+	report := newDataReport(file, *anonymize, d)
+	report.Checksum = footer.Checksum
+	return a.print(report, report.human)
+}
+
+func dataImport(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	file, in := fs.Arg(0), a.stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+	header, d, err := archive.Read(in)
+	if err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.ArchiveStore()
+	if err := store.ImportDataset(d); err != nil {
+		return errors.Join(err, record(s.OperatorStore(), audit.DataImport, file, model.AuditFailure))
+	}
+	if err := record(s.OperatorStore(), audit.DataImport, file, model.AuditSuccess); err != nil {
+		return err
+	}
+	imported, err := store.ReadDataset()
+	if err != nil {
+		return err
+	}
+	if err := archive.Verify(d, imported); err != nil {
+		return fmt.Errorf("imported data differs from the archive: %s", err.Error())
+	}
+	report := newDataReport(file, header.Anonymized, imported)
+	report.Discrepancies = reconcile.Check(imported.Ledger(), time.Now().UTC()).Discrepancies
+	if err := a.print(report, report.human); err != nil {
+		return err
+	}
+	if len(report.Discrepancies) > 0 {
+		return exitCode(ExitError)
+	}
+	return nil
+}
+
+// tokenView - issued or inspected token
+type tokenView struct {
+	Token string `json:"token,omitempty"`
+	*token.Claims
+}
+
+func (t tokenView) human(w io.Writer) {
+	if t.Token != "" {
+		fmt.Fprintf(w, "Token:\t%s\n", t.Token)
+	}
+	fmt.Fprintf(w, "User:\t%d\n", t.Subject)
+	fmt.Fprintf(w, "Issuer:\t%s\n", t.Issuer)
+	fmt.Fprintf(w, "Expires:\t%s\n", t.ExpiresAt.Format(time.RFC3339))
+	fmt.Fprintf(w, "Valid:\t%t\n", t.Valid)
+}
+
+func tokenIssue(a *app, fs *flag.FlagSet, args []string) error {
+	ttl := fs.Duration("ttl", 0, "Lifetime of the token, token.ttl parameter by default.")
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	if *ttl < 0 {
+		return usageError(fs, "-ttl must be positive duration")
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	s, err := a.openStorage(true)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+	store := s.OperatorStore()
+	user, err := operator.FindUser(store, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	target := fmt.Sprintf("user #%d", user.ID)
+	if user.Frozen {
+		return errors.Join(
+			fmt.Errorf("user #%d is frozen", user.ID),
+			record(store, audit.TokenIssue, target, model.AuditDenied),
+		)
+	}
+	if *ttl > 0 {
+		cfg.Token.TTL = ttl.String()
+	}
+	bearer := newBearer(cfg, logging.Discard())
+	issued := bearer.NewToken(user.ID)
+	claims, err := bearer.Inspect(issued)
+	if err != nil {
+		return errors.Join(err, record(store, audit.TokenIssue, target, model.AuditFailure))
+	}
+	if err := record(store, audit.TokenIssue, target, model.AuditSuccess); err != nil {
+		return err
+	}
+	view := tokenView{Token: issued, Claims: claims}
+	return a.print(view, view.human)
+}
+
+func tokenInspect(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	cfg, err := a.config()
+	if err != nil {
+		return err
+	}
+	claims, err := newBearer(cfg, logging.Discard()).Inspect(strings.TrimPrefix(fs.Arg(0), "Bearer "))
+	if err != nil {
+		return err
+	}
+	view := tokenView{Claims: claims}
+	if err := a.print(view, view.human); err != nil {
+		return err
+	}
+	if !claims.Valid {
+		return exitCode(ExitError)
+	}
+	return nil
+}
+
+// configReport - result of config check
+type configReport struct {
+	Valid  bool           `json:"valid"`
+	Error  string         `json:"error,omitempty"`
+	Values []config.Value `json:"values"`
+}
+
+func configCheck(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 0); err != nil {
+		return err
+	}
+	cfg := defaultConfiguration()
+	origins, err := loadConfig(cfg, a.configPath, a.environ, a.configFlags())
+	if origins == nil {
+		return fmt.Errorf("unable to load config: %s", err.Error())
+	}
+	report := configReport{Valid: err == nil, Values: config.Values(cfg, origins)}
+	if err != nil {
+		report.Error = err.Error()
+	}
+	if perr := a.print(report, func(w io.Writer) { config.Print(w, cfg, origins) }); perr != nil {
+		return perr
+	}
+	if err != nil {
+		return fmt.Errorf("invalid config: %s", err.Error())
+	}
+	return nil
+}
+
+func configKeyringSet(a *app, fs *flag.FlagSet, args []string) error {
+	if err := parse(fs, args, 1); err != nil {
+		return err
+	}
+	// keyring may be created before config becomes valid
+	cfg := defaultConfiguration()
+	origins, err := loadConfig(cfg, a.configPath, a.environ, a.configFlags())
+	if origins == nil {
+		return fmt.Errorf("unable to load config: %s", err.Error())
+	}
+	if err := setKeyringSecret(&cfg.Secret, fs.Arg(0), a.stdin); err != nil {
+		return fmt.Errorf("unable to store secret: %s", err.Error())
+	}
+	return nil
+}
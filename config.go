@@ -1,26 +1,105 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io/ioutil"
+	"io"
+	"net/url"
+	"os"
 	"strings"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/certs"
+	"github.com/wtask/pwsrv/internal/config"
+	"github.com/wtask/pwsrv/internal/core/middleware"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/secret"
+)
+
+// AppEnvPrefix - prefix of environment variables overriding config parameters, like PWSRV_SERVER_PORT
+const AppEnvPrefix = "PWSRV_"
+
+// AccessLogOff - value of log.access.format to disable access log
+const AccessLogOff = "off"
+
+// SocketSystemd - value of server.socket to serve sockets passed by systemd socket activation
+const SocketSystemd = "systemd"
+
+// ReconcileOff - value of reconcile.interval to disable periodic reconciliation
+const ReconcileOff = "off"
+
+// Values of secret.provider
+const (
+	SecretProviderFile    = "file"
+	SecretProviderEnv     = "env"
+	SecretProviderKeyring = "keyring"
+)
+
+// Secret names used by providers
+const (
+	SecretUserPassword = "user_password"
+	SecretAuthBearer   = "auth_bearer"
+)
+
+// Values of tracing.exporter
+const (
+	TracingOff  = "off"
+	TracingOTLP = "otlp"
+	TracingFile = "file"
 )
 
 // Configuration - application runtime parameters
 type Configuration struct {
-	Server      ServerParams `json:"server"`
-	DSN         string       `json:"dsn"`
-	StorageType string       `json:-`
-	MySQL       MySQLOptions `json:"mysql"`
-	Secret      SecretParams `json:"secret"`
+	Server      ServerParams    `json:"server"`
+	DSN         string          `json:"dsn" config:"secret"`
+	StorageType string          `json:"-"`
+	MySQL       MySQLOptions    `json:"mysql"`
+	Secret      SecretParams    `json:"secret"`
+	Token       TokenParams     `json:"token"`
+	Log         LogParams       `json:"log"`
+	Metrics     MetricsParams   `json:"metrics"`
+	Tracing     TracingParams   `json:"tracing"`
+	Reconcile   ReconcileParams `json:"reconcile"`
 }
 
 // ServerParams - application server parameters
 type ServerParams struct {
 	Address string `json:"address"`
 	Port    int    `json:"port,string"`
+	// TrustedProxies - IP addresses or CIDR networks of proxies, which X-Forwarded-For header is trusted
+	TrustedProxies []string `json:"trusted_proxies"`
+	// ShutdownTimeout - max duration of draining in-flight requests and stopping background jobs, 10s by default
+	ShutdownTimeout string `json:"shutdown_timeout"`
+	// DrainDelay - time between failing readiness probe and stopping servers on shutdown, 5s by default;
+	// it is a part of shutdown timeout
+	DrainDelay string `json:"drain_delay"`
+	// Timeouts of single request, 0 disables timeout; event streams are not limited by read and write timeouts
+	ReadHeaderTimeout string `json:"read_header_timeout"`
+	ReadTimeout       string `json:"read_timeout"`
+	WriteTimeout      string `json:"write_timeout"`
+	IdleTimeout       string `json:"idle_timeout"`
+	MaxHeaderBytes    int    `json:"max_header_bytes,string"`
+	// MaxBodyBytes - max size of request body, larger requests are rejected with 413 status
+	MaxBodyBytes int64 `json:"max_body_bytes,string"`
+	// Socket - path of Unix socket or "systemd" to serve activated sockets besides address and port;
+	// if socket is set, TCP listener is disabled with zero port
+	Socket string    `json:"socket"`
+	TLS    TLSParams `json:"tls"`
+}
+
+// TLSParams - HTTPS parameters, TLS is enabled if certificate and key files are set
+type TLSParams struct {
+	// CertFile and KeyFile - PEM files, which are reloaded when they are changed
+	CertFile   string `json:"cert_file"`
+	KeyFile    string `json:"key_file"`
+	MinVersion string `json:"min_version"` // 1.2 (default) or 1.3
+	Ciphers    string `json:"ciphers"`     // TLS 1.2 cipher policy: modern (default) or compatible
+	// RedirectPort - port of plain HTTP listener redirecting to HTTPS, off if 0
+	RedirectPort int `json:"redirect_port,string"`
+	// HSTSMaxAge - max age of Strict-Transport-Security header, like 8760h, off if empty
+	HSTSMaxAge string `json:"hsts_max_age"`
+	// ClientCAFile - CA of client certificates required for admin routes, off if empty
+	ClientCAFile string `json:"client_ca_file"`
 }
 
 // MySQLOptions - mysql connection options
@@ -29,20 +108,119 @@ type MySQLOptions struct {
 	Timeout   string `json:"connect_timeout"`
 }
 
-// SecretParams - strings used to generate sensitive data
+// SecretParams - strings used to generate sensitive data;
+// every secret is given as value, or read from *_file, or taken from provider by its name
 type SecretParams struct {
-	UserPassword string `json:"user_password"`
-	AuthBearer   string `json:"auth_bearer"`
+	UserPassword     string `json:"user_password" config:"secret"`
+	UserPasswordFile string `json:"user_password_file"`
+	AuthBearer       string `json:"auth_bearer" config:"secret"`
+	AuthBearerFile   string `json:"auth_bearer_file"`
+	// AuthBearerPrevious - replaced bearer secrets, tokens signed with them are valid until they expire
+	AuthBearerPrevious []string `json:"auth_bearer_previous" config:"secret"`
+	// Provider - file, env, keyring or empty
+	Provider string `json:"provider"`
+	// Dir - directory with file per secret for file provider, /run/secrets by default
+	Dir string `json:"dir"`
+	// EnvPrefix - prefix of variables for env provider, like APP_SECRET_USER_PASSWORD
+	EnvPrefix string `json:"env_prefix"`
+	// Keyring - encrypted keyring file for keyring provider unlocked by master key
+	Keyring       string `json:"keyring"`
+	MasterKey     string `json:"master_key" config:"secret"`
+	MasterKeyFile string `json:"master_key_file"`
+	// MinEntropy - min estimated entropy of every secret in bits
+	MinEntropy int `json:"min_entropy,string"`
 }
 
-func loadJSONConfig(filepath string) (*Configuration, error) {
-	src := []byte{}
-	src, err := ioutil.ReadFile(filepath)
-	if err != nil {
-		return nil, err
+// TokenParams - authorization tokens parameters
+type TokenParams struct {
+	TTL    string `json:"ttl"` // 1h by default
+	Issuer string `json:"issuer"`
+}
+
+// MetricsParams - Prometheus metrics endpoint parameters
+type MetricsParams struct {
+	Enabled bool   `json:"enabled"`
+	Path    string `json:"path"` // /metrics by default
+	// Address and Port - separate admin listener; if port is not set, metrics are served by API server
+	Address string `json:"address"`
+	Port    int    `json:"port,string"`
+}
+
+// TracingParams - distributed tracing parameters
+type TracingParams struct {
+	Exporter    string `json:"exporter"`     // otlp, file or off (default)
+	Endpoint    string `json:"endpoint"`     // base URL of OTLP/HTTP collector, http://localhost:4318 by default
+	Output      string `json:"output"`       // file exporter output: stdout, stderr or file path (traces.json by default)
+	ServiceName string `json:"service_name"` // pwsrv by default
+}
+
+// ReconcileParams - periodic verification of wallet balances against history of transfers
+type ReconcileParams struct {
+	Interval string `json:"interval"` // duration like 1h or off (default)
+}
+
+// LogParams - logging parameters
+type LogParams struct {
+	Level  string          `json:"level"`  // debug, info (default), warn or error
+	Format string          `json:"format"` // logfmt (default) or json
+	Output string          `json:"output"` // stderr (default), stdout or file path
+	Access AccessLogParams `json:"access"`
+}
+
+// AccessLogParams - HTTP access log parameters
+type AccessLogParams struct {
+	Format string `json:"format"` // combined (default), common, json or off
+	Output string `json:"output"` // stdout (default), stderr or file path
+}
+
+// defaultConfiguration - values of parameters, which are not set by any source.
+func defaultConfiguration() *Configuration {
+	cfg := &Configuration{}
+	cfg.Server.Port = 8000
+	cfg.Server.ShutdownTimeout = "10s"
+	cfg.Server.DrainDelay = "5s"
+	cfg.Server.ReadHeaderTimeout = "5s"
+	cfg.Server.ReadTimeout = "30s"
+	cfg.Server.WriteTimeout = "30s"
+	cfg.Server.IdleTimeout = "2m"
+	cfg.Server.MaxHeaderBytes = 64 << 10
+	cfg.Server.MaxBodyBytes = 1 << 20
+	cfg.Server.TLS.MinVersion = certs.Version12
+	cfg.Server.TLS.Ciphers = certs.CiphersModern
+	cfg.MySQL.ParseTime = true
+	cfg.Secret.Dir = "/run/secrets"
+	cfg.Secret.MinEntropy = 64
+	cfg.Token.TTL = "1h"
+	cfg.Token.Issuer = "PW demo API server"
+	cfg.Log.Level = "info"
+	cfg.Log.Format = logging.FormatLogfmt
+	cfg.Log.Output = "stderr"
+	cfg.Log.Access.Format = middleware.AccessLogCombined
+	cfg.Log.Access.Output = "stdout"
+	cfg.Metrics.Path = "/metrics"
+	cfg.Tracing.Exporter = TracingOff
+	cfg.Tracing.Endpoint = "http://localhost:4318"
+	cfg.Tracing.Output = "traces.json"
+	cfg.Tracing.ServiceName = "pwsrv"
+	cfg.Reconcile.Interval = ReconcileOff
+	return cfg
+}
+
+// loadConfig - populates configuration over its defaults from optional file (JSON, YAML or TOML),
+// then from PWSRV_* environment variables, then from command-line flags; every next layer overrides previous ones.
+// Returns origins of the values, which are available even if configuration is not valid.
+func loadConfig(cfg *Configuration, filepath string, environ []string, flags config.Source) (config.Origins, error) {
+	sources := []config.Source{}
+	if filepath != "" {
+		file, err := config.FileSource(filepath)
+		if err != nil {
+			return nil, err
+		}
+		sources = append(sources, file)
 	}
-	cfg := Configuration{}
-	if err = json.Unmarshal(src, &cfg); err != nil {
+	sources = append(sources, config.EnvSource(AppEnvPrefix, environ, config.Keys(cfg)), flags)
+	origins, err := config.Apply(cfg, sources...)
+	if err != nil {
 		return nil, err
 	}
 
@@ -50,18 +228,160 @@ func loadJSONConfig(filepath string) (*Configuration, error) {
 		// init storage type
 		cfg.StorageType = strings.ToLower(cfg.DSN[:i])
 	}
+	if err = resolveSecrets(&cfg.Secret, origins); err != nil {
+		return origins, err
+	}
 
-	if err = verifyConfig(&cfg); err != nil {
-		return nil, err
+	return origins, verifyConfig(cfg)
+}
+
+// newSecretProvider - builds configured secret provider or returns nil if it is not set.
+func newSecretProvider(params *SecretParams) (secret.Provider, error) {
+	switch params.Provider {
+	case "":
+		return nil, nil
+	case SecretProviderFile:
+		return secret.NewFileProvider(params.Dir), nil
+	case SecretProviderEnv:
+		if params.EnvPrefix == "" {
+			return nil, errors.New("config: secret.env_prefix must not be empty for env provider")
+		}
+		return secret.NewEnvProvider(params.EnvPrefix), nil
+	case SecretProviderKeyring:
+		if params.Keyring == "" {
+			return nil, errors.New("config: secret.keyring must not be empty for keyring provider")
+		}
+		masterKey, err := secretValue("secret.master_key", params.MasterKey, params.MasterKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		if masterKey == "" {
+			return nil, errors.New("config: secret.master_key or secret.master_key_file is required for keyring provider")
+		}
+		k, err := secret.OpenKeyring(params.Keyring, masterKey)
+		if err != nil {
+			return nil, fmt.Errorf("config: secret.keyring: %s", err.Error())
+		}
+		return k, nil
 	}
+	return nil, fmt.Errorf(
+		"config: secret.provider must be %q, %q, %q or empty",
+		SecretProviderFile, SecretProviderEnv, SecretProviderKeyring,
+	)
+}
 
-	return &cfg, nil
+// setKeyringSecret - stores secret read from r into configured keyring, keyring file is created if it is missing.
+func setKeyringSecret(params *SecretParams, name string, r io.Reader) error {
+	if params.Keyring == "" {
+		return errors.New("secret.keyring is not set")
+	}
+	masterKey, err := secretValue("secret.master_key", params.MasterKey, params.MasterKeyFile)
+	if err != nil {
+		return err
+	}
+	k, err := secret.OpenKeyring(params.Keyring, masterKey)
+	if errors.Is(err, os.ErrNotExist) {
+		k, err = secret.NewKeyring(), nil
+	}
+	if err != nil {
+		return err
+	}
+	value, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	k.Set(name, strings.TrimRight(string(value), "\r\n"))
+	return k.Save(params.Keyring, masterKey)
+}
+
+// secretValue - returns value or content of the file, if value is not set.
+func secretValue(key, value, file string) (string, error) {
+	if value != "" && file != "" {
+		return "", fmt.Errorf("config: both %s and %s_file are set", key, key)
+	}
+	if file == "" {
+		return value, nil
+	}
+	s, err := secret.ReadFile(file)
+	if err != nil {
+		return "", fmt.Errorf("config: %s_file: %s", key, err.Error())
+	}
+	return s, nil
+}
+
+// resolveSecrets - reads secrets, which are not set as values, from files or provider;
+// origins of resolved secrets are updated.
+func resolveSecrets(params *SecretParams, origins config.Origins) error {
+	provider, err := newSecretProvider(params)
+	if err != nil {
+		return err
+	}
+	secrets := []struct {
+		name  string
+		value *string
+		file  string
+	}{
+		{SecretUserPassword, &params.UserPassword, params.UserPasswordFile},
+		{SecretAuthBearer, &params.AuthBearer, params.AuthBearerFile},
+	}
+	for _, s := range secrets {
+		key := "secret." + s.name
+		value, err := secretValue(key, *s.value, s.file)
+		if err != nil {
+			return err
+		}
+		if s.file != "" {
+			origins[key] = "file " + s.file
+		}
+		if value == "" && provider != nil {
+			value, err = provider.Secret(s.name)
+			switch {
+			case err == secret.ErrNotFound:
+				value = ""
+			case err != nil:
+				return fmt.Errorf("config: %s: %s", key, err.Error())
+			default:
+				origins[key] = params.Provider + " provider"
+			}
+		}
+		*s.value = value
+	}
+	return nil
 }
 
 func verifyConfig(cfg *Configuration) error {
 	if cfg.Server.Port < 0 {
 		return errors.New("config: server.Port value must be greater than or equal to zero")
 	}
+	if cfg.Server.Port == 0 && cfg.Server.Socket == "" {
+		return errors.New("config: server.port must be set if server.socket is not set")
+	}
+	for _, t := range []struct{ key, value string }{
+		{"server.read_header_timeout", cfg.Server.ReadHeaderTimeout},
+		{"server.read_timeout", cfg.Server.ReadTimeout},
+		{"server.write_timeout", cfg.Server.WriteTimeout},
+		{"server.idle_timeout", cfg.Server.IdleTimeout},
+	} {
+		if timeout, err := time.ParseDuration(t.value); err != nil || timeout < 0 {
+			return fmt.Errorf("config: %s must be duration like 30s, or 0", t.key)
+		}
+	}
+	if cfg.Server.MaxHeaderBytes <= 0 || cfg.Server.MaxBodyBytes <= 0 {
+		return errors.New("config: server.max_header_bytes and server.max_body_bytes must be greater than zero")
+	}
+	if _, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		return fmt.Errorf("config: server.trusted_proxies: %s", err.Error())
+	}
+	timeout, err := time.ParseDuration(cfg.Server.ShutdownTimeout)
+	if err != nil || timeout <= 0 {
+		return errors.New("config: server.shutdown_timeout must be positive duration, like 10s")
+	}
+	if delay, err := time.ParseDuration(cfg.Server.DrainDelay); err != nil || delay < 0 || delay >= timeout {
+		return errors.New("config: server.drain_delay must be non-negative duration less than server.shutdown_timeout, like 5s")
+	}
+	if err := verifyTLS(&cfg.Server); err != nil {
+		return err
+	}
 
 	if cfg.StorageType != "mysql" {
 		return errors.New("config: invalid dsn, only mysql:// connection is supported")
@@ -79,7 +399,112 @@ func verifyConfig(cfg *Configuration) error {
 	if cfg.Secret.AuthBearer == "" {
 		return errors.New("config: secret.auth_bearer must not be empty")
 	}
+	if cfg.Secret.MinEntropy < 0 {
+		return errors.New("config: secret.min_entropy value must be greater than or equal to zero")
+	}
+	for _, s := range []struct{ key, value string }{
+		{"secret.user_password", cfg.Secret.UserPassword},
+		{"secret.auth_bearer", cfg.Secret.AuthBearer},
+	} {
+		if entropy := secret.Entropy(s.value); entropy < float64(cfg.Secret.MinEntropy) {
+			return fmt.Errorf(
+				"config: %s is too weak, estimated entropy %.0f bits is less than %d, use longer random value",
+				s.key, entropy, cfg.Secret.MinEntropy,
+			)
+		}
+	}
+
+	if ttl, err := time.ParseDuration(cfg.Token.TTL); err != nil || ttl <= 0 {
+		return errors.New("config: token.ttl must be positive duration, like 1h")
+	}
+
+	if cfg.Metrics.Path == "" {
+		cfg.Metrics.Path = "/metrics"
+	}
+	if !strings.HasPrefix(cfg.Metrics.Path, "/") {
+		return errors.New("config: metrics.path must start with /")
+	}
+	if cfg.Metrics.Port < 0 {
+		return errors.New("config: metrics.port value must be greater than or equal to zero")
+	}
+
+	switch cfg.Tracing.Exporter {
+	case "", TracingOff:
+		cfg.Tracing.Exporter = TracingOff
+	case TracingOTLP:
+		if cfg.Tracing.Endpoint == "" {
+			cfg.Tracing.Endpoint = "http://localhost:4318"
+		}
+		if u, err := url.Parse(cfg.Tracing.Endpoint); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("config: tracing.endpoint must be http(s) URL")
+		}
+	case TracingFile:
+		if cfg.Tracing.Output == "" {
+			cfg.Tracing.Output = "traces.json"
+		}
+	default:
+		return fmt.Errorf("config: tracing.exporter must be %q, %q or %q", TracingOTLP, TracingFile, TracingOff)
+	}
+	if cfg.Tracing.ServiceName == "" {
+		cfg.Tracing.ServiceName = "pwsrv"
+	}
 
+	if cfg.Reconcile.Interval == "" {
+		cfg.Reconcile.Interval = ReconcileOff
+	}
+	if cfg.Reconcile.Interval != ReconcileOff {
+		if interval, err := time.ParseDuration(cfg.Reconcile.Interval); err != nil || interval <= 0 {
+			return errors.New("config: reconcile.interval must be positive duration, like 1h, or off")
+		}
+	}
+
+	if _, err := logging.ParseLevel(cfg.Log.Level); err != nil {
+		return fmt.Errorf("config: log.level: %s", err.Error())
+	}
+	switch strings.ToLower(cfg.Log.Format) {
+	case "", logging.FormatLogfmt, logging.FormatJSON:
+	default:
+		return fmt.Errorf("config: log.format must be %q or %q", logging.FormatLogfmt, logging.FormatJSON)
+	}
+	if f := cfg.Log.Access.Format; f != "" && f != AccessLogOff && !middleware.IsAccessLogFormat(f) {
+		return fmt.Errorf(
+			"config: log.access.format must be one of %q, %q, %q or %q",
+			middleware.AccessLogCombined, middleware.AccessLogCommon, middleware.AccessLogJSON, AccessLogOff,
+		)
+	}
+
+	return nil
+}
+
+func verifyTLS(server *ServerParams) error {
+	params := server.TLS
+	if (params.CertFile == "") != (params.KeyFile == "") {
+		return errors.New("config: both server.tls.cert_file and server.tls.key_file must be set")
+	}
+	if params.CertFile == "" {
+		if params.RedirectPort != 0 || params.HSTSMaxAge != "" || params.ClientCAFile != "" {
+			return errors.New("config: server.tls.cert_file is required for redirect, HSTS and client certificates")
+		}
+		return nil
+	}
+	switch params.MinVersion {
+	case "", certs.Version12, certs.Version13:
+	default:
+		return fmt.Errorf("config: server.tls.min_version must be %q or %q", certs.Version12, certs.Version13)
+	}
+	switch params.Ciphers {
+	case "", certs.CiphersModern, certs.CiphersCompatible:
+	default:
+		return fmt.Errorf("config: server.tls.ciphers must be %q or %q", certs.CiphersModern, certs.CiphersCompatible)
+	}
+	if params.RedirectPort < 0 || (params.RedirectPort > 0 && params.RedirectPort == server.Port) {
+		return errors.New("config: server.tls.redirect_port must be positive and differ from server.port, or zero")
+	}
+	if params.HSTSMaxAge != "" {
+		if maxAge, err := time.ParseDuration(params.HSTSMaxAge); err != nil || maxAge <= 0 {
+			return errors.New("config: server.tls.hsts_max_age must be positive duration, like 8760h")
+		}
+	}
 	return nil
 }
 
@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"time"
 
+	"github.com/wtask/pwsrv/internal/health"
 	"github.com/wtask/pwsrv/internal/model"
 )
 
@@ -19,9 +20,61 @@ type (
 		GetIMTCensoredByID(id uint64) http.HandlerFunc
 		CreateIMT() http.HandlerFunc
 		RepeatIMTByID(id uint64) http.HandlerFunc
+		CreateIMTBatch() http.HandlerFunc
+		WalletList() http.HandlerFunc
+		OpenWallet() http.HandlerFunc
+		GetWalletByCurrency(currency string) http.HandlerFunc
+		ConversionList() http.HandlerFunc
+		CreateConversion() http.HandlerFunc
+		ExchangeRateList() http.HandlerFunc
+		SetExchangeRate() http.HandlerFunc
+		HoldList() http.HandlerFunc
+		GetHoldByID(id uint64) http.HandlerFunc
+		CreateHold() http.HandlerFunc
+		CaptureHoldByID(id uint64) http.HandlerFunc
+		ReleaseHoldByID(id uint64) http.HandlerFunc
+		EscrowList() http.HandlerFunc
+		GetEscrowByID(id uint64) http.HandlerFunc
+		CreateEscrow() http.HandlerFunc
+		ConfirmEscrowByID(id uint64) http.HandlerFunc
+		ReleaseEscrowByID(id uint64) http.HandlerFunc
+		DisputeEscrowByID(id uint64) http.HandlerFunc
+		AdminEscrowList() http.HandlerFunc
+		ResolveEscrowByID(id uint64) http.HandlerFunc
+		SplitList() http.HandlerFunc
+		GetSplitByID(id uint64) http.HandlerFunc
+		CreateSplit() http.HandlerFunc
+		CancelSplitByID(id uint64) http.HandlerFunc
+		PaymentRequestList() http.HandlerFunc
+		GetPaymentRequestByID(id uint64) http.HandlerFunc
+		PayPaymentRequestByID(id uint64) http.HandlerFunc
+		DeclinePaymentRequestByID(id uint64) http.HandlerFunc
+		EventStream() http.HandlerFunc
+		WebhookList() http.HandlerFunc
+		CreateWebhook() http.HandlerFunc
+		DeleteWebhookByID(id uint64) http.HandlerFunc
+		WebhookDeliveryList(id uint64) http.HandlerFunc
+		AuditLog() http.HandlerFunc
+		VerifyAuditLog() http.HandlerFunc
+		Liveness() http.HandlerFunc
+		Readiness() http.HandlerFunc
+		Status() http.HandlerFunc
 	}
 )
 
+// HeaderRequestID - header with ID of the request, which is given by client or assigned by server
+const HeaderRequestID = "X-Request-ID"
+
+// HeaderTraceID - header with ID of the trace recorded for the request
+const HeaderTraceID = "X-Trace-ID"
+
+const (
+	// BatchAtomic - all batch items are transferred within single transaction or nothing is transferred
+	BatchAtomic = "atomic"
+	// BatchBestEffort - every batch item is transferred independently
+	BatchBestEffort = "best_effort"
+)
+
 type (
 	// ErrorResponse - common error response
 	ErrorResponse struct {
@@ -29,6 +82,10 @@ type (
 		Error bool `json:"error"`
 		// Message - error message
 		Message string `json:"message,omitempty"`
+		// RequestID - ID of the failed request to find it in server logs
+		RequestID string `json:"request_id,omitempty"`
+		// TraceID - ID of the trace recorded for the failed request
+		TraceID string `json:"trace_id,omitempty"`
 	}
 
 	// LoginResponse - successfull Login response
@@ -63,12 +120,43 @@ type (
 	// RepeatIMTResponse - successfull RepeatIMT response
 	RepeatIMTResponse = IDResponse
 
+	// BatchTransferItem - single payout of the batch transfer request
+	BatchTransferItem struct {
+		RecipientID uint64  `json:"recipient_id,string"`
+		Sum         float64 `json:"sum,string"`
+		Memo        string  `json:"memo,omitempty"`
+	}
+
+	// BatchTransferRequest - JSON body of CreateIMTBatch request
+	BatchTransferRequest struct {
+		// Mode - BatchAtomic (default) or BatchBestEffort
+		Mode     string              `json:"mode"`
+		Currency string              `json:"currency"`
+		Items    []BatchTransferItem `json:"items"`
+	}
+
+	// BatchTransferResult - result of single batch item processing
+	BatchTransferResult struct {
+		RecipientID uint64 `json:"recipient_id,string"`
+		TransferID  uint64 `json:"transfer_id,string,omitempty"`
+		Error       bool   `json:"error"`
+		Message     string `json:"message,omitempty"`
+	}
+
+	// BatchTransferResponse - successfull CreateIMTBatch response, results are in order of request items
+	BatchTransferResponse struct {
+		Mode    string                `json:"mode"`
+		Results []BatchTransferResult `json:"results"`
+	}
+
 	// IMTCensored - censored internal money transfer data
 	IMTCensored struct {
 		ID            uint64    `json:"id,string"`
 		Date          time.Time `json:"date"`
 		IsCredit      bool      `json:"is_credit"`
+		Currency      string    `json:"currency"`
 		Sum           float64   `json:"sum,string"`
+		Memo          string    `json:"memo,omitempty"`
 		BalanceBefore float64   `json:"balance_before,string"`
 		BalanceAfter  float64   `json:"balance_after,string"`
 		UserID        uint64    `json:"user_id,string"`
@@ -82,4 +170,137 @@ type (
 	IMTCensoredListResponse struct {
 		Transactions []*IMTCensored `json:"transactions"`
 	}
+
+	// WalletListResponse - successfull WalletList response
+	WalletListResponse struct {
+		Wallets []model.Wallet `json:"wallets"`
+	}
+
+	// WalletResponse - successfull GetWalletByXXX and OpenWallet response
+	WalletResponse struct {
+		Wallet       *model.Wallet      `json:"wallet"`
+		Transactions []*IMTCensored     `json:"transactions,omitempty"`
+		Conversions  []model.Conversion `json:"conversions,omitempty"`
+	}
+
+	// ConversionResponse - successfull CreateConversion response
+	ConversionResponse struct {
+		Conversion *model.Conversion `json:"conversion"`
+	}
+
+	// ConversionListResponse - successfull ConversionList response
+	ConversionListResponse struct {
+		Conversions []model.Conversion `json:"conversions"`
+	}
+
+	// ExchangeRateResponse - successfull SetExchangeRate response
+	ExchangeRateResponse struct {
+		Rate *model.ExchangeRate `json:"rate"`
+	}
+
+	// ExchangeRateListResponse - successfull ExchangeRateList response
+	ExchangeRateListResponse struct {
+		Rates []model.ExchangeRate `json:"rates"`
+	}
+
+	// HoldResponse - successfull GetHoldByXXX, CreateHold, ReleaseHoldByXXX response
+	HoldResponse struct {
+		Hold *model.Hold `json:"hold"`
+	}
+
+	// HoldListResponse - successfull HoldList response
+	HoldListResponse struct {
+		Holds []model.Hold `json:"holds"`
+	}
+
+	// CaptureHoldResponse - successfull CaptureHoldByXXX response
+	CaptureHoldResponse struct {
+		Hold       *model.Hold `json:"hold"`
+		TransferID uint64      `json:"transfer_id,string"`
+	}
+
+	// EscrowResponse - successfull response of methods, which return single escrow
+	EscrowResponse struct {
+		Escrow *model.Escrow `json:"escrow"`
+	}
+
+	// EscrowListResponse - successfull EscrowList response
+	EscrowListResponse struct {
+		Escrows []model.Escrow `json:"escrows"`
+	}
+
+	// SplitParticipant - participant of the split bill and his custom share
+	SplitParticipant struct {
+		UserID uint64  `json:"user_id,string"`
+		Share  float64 `json:"share,string,omitempty"`
+	}
+
+	// CreateSplitRequest - JSON body of CreateSplit request;
+	// if no participant has custom share, total is split equally
+	// between participants and, if IncludeSelf is set, requester.
+	CreateSplitRequest struct {
+		Currency     string             `json:"currency"`
+		Total        float64            `json:"total,string"`
+		Memo         string             `json:"memo,omitempty"`
+		IncludeSelf  bool               `json:"include_self"`
+		Participants []SplitParticipant `json:"participants"`
+	}
+
+	// SplitResponse - successfull GetSplitByXXX, CreateSplit response
+	SplitResponse struct {
+		Split    *model.Split           `json:"split"`
+		Requests []model.PaymentRequest `json:"requests"`
+	}
+
+	// SplitListResponse - successfull SplitList response
+	SplitListResponse struct {
+		Splits []model.Split `json:"splits"`
+	}
+
+	// PaymentRequestResponse - successfull response of methods, which return single payment request
+	PaymentRequestResponse struct {
+		Request *model.PaymentRequest `json:"request"`
+	}
+
+	// PaymentRequestListResponse - successfull PaymentRequestList response
+	PaymentRequestListResponse struct {
+		Requests []model.PaymentRequest `json:"requests"`
+	}
+
+	// WebhookResponse - successfull CreateWebhook response
+	WebhookResponse struct {
+		Webhook *model.WebhookSubscription `json:"webhook"`
+	}
+
+	// WebhookListResponse - successfull WebhookList response
+	WebhookListResponse struct {
+		Webhooks []model.WebhookSubscription `json:"webhooks"`
+	}
+
+	// WebhookDeliveryListResponse - successfull WebhookDeliveryList response
+	WebhookDeliveryListResponse struct {
+		Deliveries []model.WebhookDelivery `json:"deliveries"`
+	}
+
+	// AuditLogResponse - successfull AuditLog response
+	AuditLogResponse struct {
+		Entries []model.AuditEntry `json:"entries"`
+	}
+
+	// AuditVerifyResponse - successfull VerifyAuditLog response
+	AuditVerifyResponse struct {
+		Valid    bool   `json:"valid"`
+		Checked  int    `json:"checked"`
+		BrokenID uint64 `json:"broken_id,string,omitempty"`
+	}
+
+	// HealthResponse - successfull Liveness and Readiness response
+	HealthResponse struct {
+		Status string `json:"status"`
+	}
+
+	// StatusResponse - successfull Status response
+	StatusResponse struct {
+		*health.Report
+	}
 )
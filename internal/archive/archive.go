@@ -0,0 +1,377 @@
+// Package archive writes users, wallets, transfers and conversions into versioned NDJSON archive
+// and reads them back, so data can be copied between databases independently of their engine.
+//
+// Every line of the archive is JSON object {"type": ..., "data": ...}. The first line is header
+// with the version of the format, the last one is footer with counts of records and SHA-256 checksum
+// of all previous lines, so truncated or edited archives are rejected.
+package archive
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/reconcile"
+)
+
+// Version - version of the archive format, archives of newer versions are not read
+const Version = 1
+
+// DisabledPasswordHash - password hash of anonymized users, no password is hashed into it,
+// so they can't log in with any password
+const DisabledPasswordHash = "!"
+
+// maxLineSize - max size of the single record
+const maxLineSize = 1 << 20
+
+// Types of records
+const (
+	TypeHeader     = "header"
+	TypeUser       = "user"
+	TypeWallet     = "wallet"
+	TypeTransfer   = "transfer"
+	TypeConversion = "conversion"
+	TypeFooter     = "footer"
+)
+
+// Header - first record of the archive
+type Header struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	// Generator - name and version of the binary, which has written the archive
+	Generator  string `json:"generator,omitempty"`
+	Anonymized bool   `json:"anonymized"`
+}
+
+// Footer - last record of the archive
+type Footer struct {
+	Users       int `json:"users"`
+	Wallets     int `json:"wallets"`
+	Transfers   int `json:"transfers"`
+	Conversions int `json:"conversions"`
+	// Checksum - hex of SHA-256 of all previous lines including their line feeds
+	Checksum string `json:"checksum"`
+}
+
+// Dataset - archived entities; wallets of users are stored separately,
+// reserved parts of wallets are not archived, because holds and escrows are not.
+type Dataset struct {
+	Users       []model.User
+	Wallets     []model.Wallet
+	Transfers   []model.InternalTransfer
+	Conversions []model.Conversion
+}
+
+// Ledger - returns wallets and history of the dataset to be reconciled.
+func (d *Dataset) Ledger() *reconcile.Ledger {
+	return &reconcile.Ledger{Wallets: d.Wallets, Transfers: d.Transfers, Conversions: d.Conversions}
+}
+
+// Store - storage of archived entities
+type Store interface {
+	// ReadDataset - reads all entities as a consistent snapshot
+	ReadDataset() (*Dataset, error)
+	// ImportDataset - creates all entities with their IDs at once, storage must have no users and history
+	ImportDataset(d *Dataset) error
+}
+
+// userRecord - user with password hash, which is hidden from API
+type userRecord struct {
+	ID           uint64         `json:"id,string"`
+	CreatedAt    time.Time      `json:"created_at"`
+	Role         model.UserRole `json:"role,string"`
+	Email        string         `json:"email"`
+	Name         string         `json:"name"`
+	PasswordHash string         `json:"password_hash"`
+	Frozen       bool           `json:"frozen"`
+}
+
+// walletRecord - wallet with IDs, which are hidden from API
+type walletRecord struct {
+	ID        uint64         `json:"id,string"`
+	CreatedAt time.Time      `json:"created_at"`
+	UserID    uint64         `json:"user_id,string"`
+	Currency  model.Currency `json:"currency"`
+	Balance   float64        `json:"balance,string"`
+}
+
+// line - single record of the archive
+type line struct {
+	Type string          `json:"type"`
+	Data json.RawMessage `json:"data"`
+}
+
+// record - encoded line of the entity
+type record struct {
+	typ  string
+	id   uint64
+	line []byte
+}
+
+func encode(typ string, id uint64, data interface{}) (record, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return record{}, err
+	}
+	b, err := json.Marshal(line{Type: typ, Data: raw})
+	return record{typ: typ, id: id, line: b}, err
+}
+
+// records - encodes entities of the dataset ordered by their type and ID, time is stored in UTC.
+func records(d *Dataset) ([]record, error) {
+	result := make([]record, 0, len(d.Users)+len(d.Wallets)+len(d.Transfers)+len(d.Conversions))
+	add := func(typ string, id uint64, data interface{}) error {
+		r, err := encode(typ, id, data)
+		if err != nil {
+			return fmt.Errorf("%s #%d: %s", typ, id, err.Error())
+		}
+		result = append(result, r)
+		return nil
+	}
+	for _, u := range d.Users {
+		err := add(TypeUser, u.ID, userRecord{
+			ID: u.ID, CreatedAt: u.CreatedAt.UTC(), Role: u.Role,
+			Email: u.Email, Name: u.Name, PasswordHash: u.PHash, Frozen: u.Frozen,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range d.Wallets {
+		err := add(TypeWallet, w.ID, walletRecord{
+			ID: w.ID, CreatedAt: w.CreatedAt.UTC(), UserID: w.UserID, Currency: w.Currency, Balance: w.Balance,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, t := range d.Transfers {
+		t.CreatedAt = t.CreatedAt.UTC()
+		if err := add(TypeTransfer, t.ID, t); err != nil {
+			return nil, err
+		}
+	}
+	for _, c := range d.Conversions {
+		c.CreatedAt = c.CreatedAt.UTC()
+		if err := add(TypeConversion, c.ID, c); err != nil {
+			return nil, err
+		}
+	}
+	order := map[string]int{TypeUser: 1, TypeWallet: 2, TypeTransfer: 3, TypeConversion: 4}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].typ != result[j].typ {
+			return order[result[i].typ] < order[result[j].typ]
+		}
+		return result[i].id < result[j].id
+	})
+	return result, nil
+}
+
+// Anonymize - returns copy of the dataset, where emails and names of users are replaced with ones built from IDs,
+// password hashes are replaced with DisabledPasswordHash and memos of transfers are removed,
+// because they are written by users.
+func Anonymize(d *Dataset) *Dataset {
+	result := &Dataset{
+		Users:       make([]model.User, len(d.Users)),
+		Wallets:     d.Wallets,
+		Transfers:   make([]model.InternalTransfer, len(d.Transfers)),
+		Conversions: d.Conversions,
+	}
+	for i, u := range d.Users {
+		id := strconv.FormatUint(u.ID, 10)
+		u.Email, u.Name, u.PHash = "user"+id+"@example.com", "User "+id, DisabledPasswordHash
+		result.Users[i] = u
+	}
+	for i, t := range d.Transfers {
+		t.Memo = ""
+		result.Transfers[i] = t
+	}
+	return result
+}
+
+// Write - writes the dataset with given header, version of the header is set to the current one.
+func Write(w io.Writer, h Header, d *Dataset) (*Footer, error) {
+	h.Version = Version
+	h.CreatedAt = h.CreatedAt.UTC()
+	head, err := encode(TypeHeader, 0, h)
+	if err != nil {
+		return nil, fmt.Errorf("archive.Write: %s", err.Error())
+	}
+	body, err := records(d)
+	if err != nil {
+		return nil, fmt.Errorf("archive.Write: %s", err.Error())
+	}
+	sum := sha256.New()
+	bw := bufio.NewWriter(w)
+	out := io.MultiWriter(bw, sum)
+	for _, r := range append([]record{head}, body...) {
+		if _, err := out.Write(append(r.line, '\n')); err != nil {
+			return nil, fmt.Errorf("archive.Write: %s", err.Error())
+		}
+	}
+	footer := &Footer{
+		Users:       len(d.Users),
+		Wallets:     len(d.Wallets),
+		Transfers:   len(d.Transfers),
+		Conversions: len(d.Conversions),
+		Checksum:    hex.EncodeToString(sum.Sum(nil)),
+	}
+	tail, err := encode(TypeFooter, 0, footer)
+	if err == nil {
+		_, err = bw.Write(append(tail.line, '\n'))
+	}
+	if err == nil {
+		err = bw.Flush()
+	}
+	if err != nil {
+		return nil, fmt.Errorf("archive.Write: %s", err.Error())
+	}
+	return footer, nil
+}
+
+// reader - state of reading the archive
+type reader struct {
+	header *Header
+	footer *Footer
+	data   *Dataset
+	sum    hash.Hash
+}
+
+// Read - reads and verifies the archive.
+func Read(r io.Reader) (*Header, *Dataset, error) {
+	rd := &reader{data: &Dataset{}, sum: sha256.New()}
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if err := rd.line(scanner.Bytes()); err != nil {
+			return nil, nil, fmt.Errorf("archive.Read: line %d: %s", n, err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("archive.Read: line %d: %s", n+1, err.Error())
+	}
+	if rd.header == nil {
+		return nil, nil, errors.New("archive.Read: archive is empty")
+	}
+	if rd.footer == nil {
+		return nil, nil, errors.New("archive.Read: archive is truncated, footer is missing")
+	}
+	return rd.header, rd.data, nil
+}
+
+func (rd *reader) line(b []byte) error {
+	if rd.footer != nil {
+		return errors.New("unexpected record after footer")
+	}
+	l := line{}
+	if err := json.Unmarshal(b, &l); err != nil {
+		return err
+	}
+	if rd.header == nil && l.Type != TypeHeader {
+		return errors.New("header is expected")
+	}
+	if l.Type == TypeFooter {
+		return rd.finish(l.Data)
+	}
+	rd.sum.Write(b)
+	rd.sum.Write([]byte{'\n'})
+	switch l.Type {
+	case TypeHeader:
+		if rd.header != nil {
+			return errors.New("duplicate header")
+		}
+		h := &Header{}
+		if err := json.Unmarshal(l.Data, h); err != nil {
+			return err
+		}
+		if h.Version < 1 || h.Version > Version {
+			return fmt.Errorf("unsupported version %d, version %d or lower is expected", h.Version, Version)
+		}
+		rd.header = h
+	case TypeUser:
+		u := userRecord{}
+		if err := json.Unmarshal(l.Data, &u); err != nil {
+			return err
+		}
+		rd.data.Users = append(rd.data.Users, model.User{
+			ID: u.ID, CreatedAt: u.CreatedAt, Role: u.Role, Email: u.Email, Name: u.Name, PHash: u.PasswordHash, Frozen: u.Frozen,
+		})
+	case TypeWallet:
+		w := walletRecord{}
+		if err := json.Unmarshal(l.Data, &w); err != nil {
+			return err
+		}
+		rd.data.Wallets = append(rd.data.Wallets, model.Wallet{
+			ID: w.ID, CreatedAt: w.CreatedAt, UserID: w.UserID, Currency: w.Currency, Balance: w.Balance, Available: w.Balance,
+		})
+	case TypeTransfer:
+		t := model.InternalTransfer{}
+		if err := json.Unmarshal(l.Data, &t); err != nil {
+			return err
+		}
+		rd.data.Transfers = append(rd.data.Transfers, t)
+	case TypeConversion:
+		c := model.Conversion{}
+		if err := json.Unmarshal(l.Data, &c); err != nil {
+			return err
+		}
+		rd.data.Conversions = append(rd.data.Conversions, c)
+	default:
+		return fmt.Errorf("unknown record type %q", l.Type)
+	}
+	return nil
+}
+
+// finish - verifies counts of records and checksum of the archive.
+func (rd *reader) finish(data json.RawMessage) error {
+	f := &Footer{}
+	if err := json.Unmarshal(data, f); err != nil {
+		return err
+	}
+	if f.Checksum != hex.EncodeToString(rd.sum.Sum(nil)) {
+		return errors.New("checksum mismatch, archive is corrupted")
+	}
+	d := rd.data
+	if f.Users != len(d.Users) || f.Wallets != len(d.Wallets) ||
+		f.Transfers != len(d.Transfers) || f.Conversions != len(d.Conversions) {
+		return errors.New("count of records differs from the footer")
+	}
+	rd.footer = f
+	return nil
+}
+
+// Verify - checks actual dataset, like one read from storage after import, has the same entities as expected one.
+func Verify(expected, actual *Dataset) error {
+	e, err := records(expected)
+	if err != nil {
+		return fmt.Errorf("archive.Verify: %s", err.Error())
+	}
+	a, err := records(actual)
+	if err != nil {
+		return fmt.Errorf("archive.Verify: %s", err.Error())
+	}
+	for i := 0; i < len(e) || i < len(a); i++ {
+		switch {
+		case i >= len(a):
+			return fmt.Errorf("archive.Verify: %s #%d is missing", e[i].typ, e[i].id)
+		case i >= len(e):
+			return fmt.Errorf("archive.Verify: unexpected %s #%d", a[i].typ, a[i].id)
+		case e[i].typ != a[i].typ || e[i].id != a[i].id:
+			return fmt.Errorf("archive.Verify: %s #%d is expected instead of %s #%d", e[i].typ, e[i].id, a[i].typ, a[i].id)
+		case string(e[i].line) != string(a[i].line):
+			return fmt.Errorf("archive.Verify: %s #%d differs", e[i].typ, e[i].id)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,120 @@
+package archive
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+var t0 = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+func testDataset() *Dataset {
+	return &Dataset{
+		Users: []model.User{
+			{ID: 2, CreatedAt: t0, Role: model.RoleRegular, Email: "jane@example.com", Name: "Jane", PHash: "hash-2", Frozen: true},
+			{ID: 1, CreatedAt: t0, Role: model.RoleAdmin, Email: "john@example.com", Name: "John", PHash: "hash-1"},
+		},
+		Wallets: []model.Wallet{
+			{ID: 1, CreatedAt: t0, UserID: 1, Currency: "PW", Balance: 400.1, Held: 100},
+			{ID: 2, CreatedAt: t0, UserID: 2, Currency: "PW", Balance: 599.9},
+		},
+		Transfers: []model.InternalTransfer{
+			{
+				ID: 1, CreatedAt: t0.Add(time.Second), UserID: 1, RecipientID: 2, Currency: "PW", Sum: 99.9, Memo: "for John's dinner",
+				UserBalanceBefore: 500, UserBalanceAfter: 400.1, RecipientBalanceBefore: 500, RecipientBalanceAfter: 599.9,
+			},
+		},
+	}
+}
+
+func TestWriteRead(t *testing.T) {
+	b := bytes.Buffer{}
+	footer, err := Write(&b, Header{CreatedAt: t0, Generator: "pwsrv test"}, testDataset())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if footer.Users != 2 || footer.Wallets != 2 || footer.Transfers != 1 || footer.Conversions != 0 {
+		t.Errorf("Unexpected footer: %+v", footer)
+	}
+	if lines := strings.Split(strings.TrimSpace(b.String()), "\n"); len(lines) != 7 ||
+		!strings.HasPrefix(lines[0], `{"type":"header","data":{"version":1,`) ||
+		!strings.HasPrefix(lines[1], `{"type":"user","data":{"id":"1",`) ||
+		!strings.Contains(lines[2], `"password_hash":"hash-2","frozen":true`) {
+		t.Errorf("Unexpected archive:\n%s", b.String())
+	}
+	h, d, err := Read(&b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Version != Version || !h.CreatedAt.Equal(t0) || h.Generator != "pwsrv test" || h.Anonymized {
+		t.Errorf("Unexpected header: %+v", h)
+	}
+	if err := Verify(testDataset(), d); err != nil {
+		t.Error(err)
+	}
+	if d.Wallets[0].Held != 0 || d.Wallets[0].Available != d.Wallets[0].Balance {
+		t.Errorf("Reserved funds are restored: %+v", d.Wallets[0])
+	}
+}
+
+func TestReadInvalid(t *testing.T) {
+	b := bytes.Buffer{}
+	if _, err := Write(&b, Header{CreatedAt: t0}, testDataset()); err != nil {
+		t.Fatal(err)
+	}
+	archive := b.String()
+	lines := strings.SplitAfter(archive, "\n")
+	cases := map[string]string{
+		"empty":            "",
+		"edited":           strings.Replace(archive, `"sum":"99.9"`, `"sum":"9.9"`, 1),
+		"truncated":        strings.Join(lines[:len(lines)-2], ""),
+		"without header":   strings.Join(lines[1:], ""),
+		"after footer":     archive + lines[1],
+		"newer version":    strings.Replace(archive, `"version":1`, `"version":2`, 1),
+		"unknown type":     strings.Replace(archive, `"type":"wallet"`, `"type":"purse"`, 1),
+		"not JSON":         archive[:len(lines[0])] + "user,1\n" + archive[len(lines[0]):],
+		"duplicate header": lines[0] + archive,
+	}
+	for name, content := range cases {
+		if _, _, err := Read(strings.NewReader(content)); err == nil {
+			t.Errorf("Invalid archive is read: %s", name)
+		}
+	}
+}
+
+func TestAnonymize(t *testing.T) {
+	source := testDataset()
+	d := Anonymize(source)
+	if d.Users[0].Email != "user2@example.com" || d.Users[0].Name != "User 2" || d.Users[0].PHash != DisabledPasswordHash ||
+		d.Users[1].Email != "user1@example.com" || d.Transfers[0].Memo != "" || d.Transfers[0].Sum != 99.9 {
+		t.Errorf("Unexpected anonymized dataset: %+v", d)
+	}
+	if source.Users[0].Email != "jane@example.com" || source.Users[0].PHash != "hash-2" || source.Transfers[0].Memo == "" {
+		t.Error("Source dataset is changed")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	cases := map[string]func(d *Dataset){
+		"missing user":     func(d *Dataset) { d.Users = d.Users[:1] },
+		"unexpected":       func(d *Dataset) { d.Conversions = append(d.Conversions, model.Conversion{ID: 1}) },
+		"changed balance":  func(d *Dataset) { d.Wallets[1].Balance = 600 },
+		"changed hash":     func(d *Dataset) { d.Users[1].PHash = "" },
+		"changed transfer": func(d *Dataset) { d.Transfers[0].RecipientBalanceAfter = 600 },
+	}
+	for name, change := range cases {
+		d := testDataset()
+		change(d)
+		if err := Verify(testDataset(), d); err == nil {
+			t.Errorf("Difference is not found: %s", name)
+		}
+	}
+	d := testDataset()
+	d.Transfers[0].CreatedAt = d.Transfers[0].CreatedAt.In(time.FixedZone("UTC+3", 3*60*60))
+	if err := Verify(testDataset(), d); err != nil {
+		t.Errorf("Time zone is not ignored: %s", err.Error())
+	}
+}
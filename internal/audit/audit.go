@@ -0,0 +1,124 @@
+// Package audit builds entries of the append-only audit log
+// and chains them with SHA-256 hashes to make tampering detectable.
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// Audited actions
+const (
+	UserLogin          = "user.login"
+	UserRegister       = "user.register"
+	TransferCreate     = "transfer.create"
+	TransferBatch      = "transfer.batch"
+	TransferRepeat     = "transfer.repeat"
+	AccessDenied       = "access.denied"
+	AccessUnauthorized = "access.unauthorized"
+)
+
+// Actions of operators performed with command line tools
+const (
+	UserCreate   = "user.create"
+	UserPromote  = "user.promote"
+	UserFreeze   = "user.freeze"
+	UserUnfreeze = "user.unfreeze"
+	TokenIssue   = "token.issue"
+	DataExport   = "data.export"
+	DataImport   = "data.import"
+)
+
+// OperatorAgent - user agent of entries recorded by command line tools
+const OperatorAgent = "pwsrv-cli"
+
+// Recorder - appends entries to the audit log;
+// implementation is responsible to fill the hash chain in the order of appending.
+type Recorder interface {
+	AppendAuditEntry(e model.AuditEntry) (*model.AuditEntry, error)
+}
+
+// Filter - conditions to query the audit log, zero values are ignored
+type Filter struct {
+	ActorID  uint64
+	Action   string
+	Outcome  model.AuditOutcome
+	Since    time.Time
+	Until    time.Time
+	BeforeID uint64
+}
+
+// NewEntry - builds entry describing the action performed with the request.
+func NewEntry(r *http.Request, actorID uint64, action, target string, outcome model.AuditOutcome) model.AuditEntry {
+	return model.AuditEntry{
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		ActorID:   actorID,
+		Action:    action,
+		Target:    target,
+		ClientIP:  ClientIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: r.Header.Get(api.HeaderRequestID),
+		Outcome:   outcome,
+	}
+}
+
+// NewOperatorEntry - builds entry describing the action performed by operator with command line tools;
+// operator has no user ID, so actor is zero.
+func NewOperatorEntry(action, target string, outcome model.AuditOutcome) model.AuditEntry {
+	return model.AuditEntry{
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Action:    action,
+		Target:    target,
+		UserAgent: OperatorAgent,
+		Outcome:   outcome,
+	}
+}
+
+// ClientIP - returns IP address of the remote side of the request.
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Hash - calculates hash of the entry chained with the previous one.
+// Entry ID is not hashed as it is assigned by storage, the chain order defines it instead.
+// Creation time is hashed with seconds precision, which is kept by storage.
+func Hash(prevHash string, e *model.AuditEntry) string {
+	h := sha256.New()
+	fmt.Fprintf(
+		h,
+		"%q\n%d\n%d\n%q\n%q\n%q\n%q\n%q\n%q",
+		prevHash,
+		e.CreatedAt.Unix(),
+		e.ActorID,
+		e.Action,
+		e.Target,
+		e.ClientIP,
+		e.UserAgent,
+		e.RequestID,
+		e.Outcome,
+	)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Verify - checks the sequence of entries is a valid part of the chain following the entry with given hash.
+// Returns index of the first broken entry or -1 if chain is valid.
+func Verify(prevHash string, entries []model.AuditEntry) int {
+	for i := range entries {
+		if entries[i].PrevHash != prevHash || entries[i].Hash != Hash(prevHash, &entries[i]) {
+			return i
+		}
+		prevHash = entries[i].Hash
+	}
+	return -1
+}
@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func chain(entries []model.AuditEntry) {
+	prev := ""
+	for i := range entries {
+		entries[i].PrevHash = prev
+		entries[i].Hash = Hash(prev, &entries[i])
+		prev = entries[i].Hash
+	}
+}
+
+func TestNewEntry(t *testing.T) {
+	r := httptest.NewRequest("POST", "/login/", nil)
+	r.RemoteAddr = "10.0.0.1:54321"
+	r.Header.Set("User-Agent", "test-agent")
+	r.Header.Set(api.HeaderRequestID, "req-1")
+	e := NewEntry(r, 7, UserLogin, "user@example.com", model.AuditSuccess)
+	if e.ActorID != 7 || e.Action != UserLogin || e.Target != "user@example.com" || e.Outcome != model.AuditSuccess {
+		t.Errorf("Unexpected entry: %+v", e)
+	}
+	if e.ClientIP != "10.0.0.1" || e.UserAgent != "test-agent" || e.RequestID != "req-1" {
+		t.Errorf("Unexpected request details: %+v", e)
+	}
+	if e.CreatedAt.Nanosecond() != 0 {
+		t.Errorf("Creation time is not truncated to seconds: %s", e.CreatedAt)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	r := httptest.NewRequest("POST", "/money/transfers/", nil)
+	entries := []model.AuditEntry{
+		NewEntry(r, 1, UserLogin, "a@example.com", model.AuditSuccess),
+		NewEntry(r, 1, TransferCreate, "user #2", model.AuditSuccess),
+		NewEntry(r, 2, AccessDenied, "GET /admin/audit/", model.AuditDenied),
+	}
+	chain(entries)
+	if broken := Verify("", entries); broken != -1 {
+		t.Fatalf("Valid chain is broken at %d", broken)
+	}
+	if broken := Verify(entries[0].Hash, entries[1:]); broken != -1 {
+		t.Errorf("Valid part of the chain is broken at %d", broken)
+	}
+
+	changed := append([]model.AuditEntry{}, entries...)
+	changed[1].Outcome = model.AuditFailure
+	if broken := Verify("", changed); broken != 1 {
+		t.Errorf("Changed entry is not detected, broken at %d", broken)
+	}
+
+	removed := []model.AuditEntry{entries[0], entries[2]}
+	if broken := Verify("", removed); broken != 1 {
+		t.Errorf("Removed entry is not detected, broken at %d", broken)
+	}
+}
@@ -0,0 +1,28 @@
+// Package background runs periodic maintenance jobs of the server.
+package background
+
+import (
+	"context"
+	"time"
+)
+
+// Job - periodic job, receives the time of the tick
+type Job func(now time.Time)
+
+// Run - calls the job every interval until the context is done.
+// Blocks the caller, so usually is launched in a separate goroutine.
+func Run(ctx context.Context, interval time.Duration, job Job) {
+	if job == nil || interval <= 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			job(now)
+		}
+	}
+}
@@ -0,0 +1,47 @@
+package background
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRunStopsWithContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	ticks := make(chan time.Time, 10)
+	done := make(chan struct{})
+	go func() {
+		Run(ctx, time.Millisecond, func(now time.Time) {
+			select {
+			case ticks <- now:
+			default:
+			}
+		})
+		close(done)
+	}()
+	select {
+	case <-ticks:
+	case <-time.After(time.Second):
+		t.Fatalf("Job was not called")
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Run did not return after context cancellation")
+	}
+}
+
+func TestRunIgnoresInvalidArgs(t *testing.T) {
+	done := make(chan struct{})
+	go func() {
+		Run(context.Background(), 0, func(time.Time) {})
+		Run(context.Background(), time.Millisecond, nil)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Run blocks with invalid arguments")
+	}
+}
@@ -0,0 +1,157 @@
+// Package certs builds TLS configuration of the server and keeps its certificate up to date with files on disk.
+package certs
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/logging"
+)
+
+// TLS versions
+const (
+	Version12 = "1.2"
+	Version13 = "1.3"
+)
+
+// Cipher policies, they apply to TLS 1.2 only as TLS 1.3 suites are not configurable
+const (
+	// CiphersModern - ECDHE key exchange with AEAD ciphers only
+	CiphersModern = "modern"
+	// CiphersCompatible - secure cipher suites enabled by Go by default
+	CiphersCompatible = "compatible"
+)
+
+var modernCiphers = []uint16{
+	tls.TLS_ECDHE_ECDSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_AES_128_GCM_SHA256,
+	tls.TLS_ECDHE_ECDSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_RSA_WITH_AES_256_GCM_SHA384,
+	tls.TLS_ECDHE_ECDSA_WITH_CHACHA20_POLY1305_SHA256,
+	tls.TLS_ECDHE_RSA_WITH_CHACHA20_POLY1305_SHA256,
+}
+
+// Config - returns server TLS configuration with given min version and cipher policy,
+// certificate is taken from the reloader.
+func Config(r *Reloader, minVersion, ciphers string) (*tls.Config, error) {
+	if r == nil {
+		return nil, errors.New("certs.Config: reloader is nil")
+	}
+	cfg := &tls.Config{GetCertificate: r.GetCertificate}
+	switch minVersion {
+	case "", Version12:
+		cfg.MinVersion = tls.VersionTLS12
+	case Version13:
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("certs.Config: unsupported TLS version %q", minVersion)
+	}
+	switch ciphers {
+	case "", CiphersModern:
+		cfg.CipherSuites = modernCiphers
+	case CiphersCompatible:
+	default:
+		return nil, fmt.Errorf("certs.Config: unknown cipher policy %q", ciphers)
+	}
+	return cfg, nil
+}
+
+// WithClientCA - requests client certificates signed by CA from PEM file;
+// connections without certificate are accepted, so certificate is required by handlers.
+func WithClientCA(cfg *tls.Config, caFile string) error {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return fmt.Errorf("certs.WithClientCA: %s", err.Error())
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return fmt.Errorf("certs.WithClientCA: no certificates found in %s", caFile)
+	}
+	cfg.ClientCAs, cfg.ClientAuth = pool, tls.VerifyClientCertIfGiven
+	return nil
+}
+
+// Reloader - keeps certificate and key pair loaded from PEM files
+type Reloader struct {
+	certFile, keyFile string
+	logger            *slog.Logger
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate
+	certPEM []byte
+	keyPEM  []byte
+}
+
+// NewReloader - loads certificate and key pair from files; logger is optional.
+func NewReloader(certFile, keyFile string, l *slog.Logger) (*Reloader, error) {
+	if l == nil {
+		l = logging.Discard()
+	}
+	r := &Reloader{certFile: certFile, keyFile: keyFile, logger: l}
+	if _, err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload - loads certificate again if content of any file has changed since the last load;
+// returns true if certificate is replaced. Current certificate is kept on error.
+func (r *Reloader) Reload() (bool, error) {
+	certPEM, err := os.ReadFile(r.certFile)
+	if err != nil {
+		return false, fmt.Errorf("certs.Reload: %s", err.Error())
+	}
+	keyPEM, err := os.ReadFile(r.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("certs.Reload: %s", err.Error())
+	}
+	r.mu.RLock()
+	unchanged := r.cert != nil && bytes.Equal(certPEM, r.certPEM) && bytes.Equal(keyPEM, r.keyPEM)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		return false, fmt.Errorf("certs.Reload: %s", err.Error())
+	}
+	r.mu.Lock()
+	r.cert, r.certPEM, r.keyPEM = &cert, certPEM, keyPEM
+	r.mu.Unlock()
+	return true, nil
+}
+
+// Run - checks files every interval until the context is done.
+func (r *Reloader) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			reloaded, err := r.Reload()
+			switch {
+			case err != nil:
+				r.logger.Error("Certificate reload failed, current certificate is kept", "error", err)
+			case reloaded:
+				r.logger.Info("Certificate reloaded", "cert_file", r.certFile)
+			}
+		}
+	}
+}
+
+// GetCertificate - implements tls.Config.GetCertificate.
+func (r *Reloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
@@ -0,0 +1,138 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// writeKeyPair - writes self-signed certificate with given serial number and its key.
+func writeKeyPair(t *testing.T, certFile, keyFile string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serial - returns serial number of the certificate presented by server.
+func serial(t *testing.T, addr string) int64 {
+	conn, err := tls.Dial("tcp", addr, &tls.Config{InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	return conn.ConnectionState().PeerCertificates[0].SerialNumber.Int64()
+}
+
+func TestReloader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if _, err := NewReloader(certFile, keyFile, nil); err == nil {
+		t.Fatal("Missing files are loaded")
+	}
+	writeKeyPair(t, certFile, keyFile, 1)
+	r, err := NewReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Config(r, Version12, CiphersModern)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.(*tls.Conn).Handshake()
+			conn.Close()
+		}
+	}()
+	addr := l.Addr().String()
+	if s := serial(t, addr); s != 1 {
+		t.Fatalf("Unexpected certificate: %d", s)
+	}
+
+	if reloaded, err := r.Reload(); reloaded || err != nil {
+		t.Errorf("Unchanged certificate is reloaded: %v, %v", reloaded, err)
+	}
+	writeKeyPair(t, certFile, keyFile, 2)
+	if reloaded, err := r.Reload(); !reloaded || err != nil {
+		t.Errorf("Changed certificate is not reloaded: %v, %v", reloaded, err)
+	}
+	if s := serial(t, addr); s != 2 {
+		t.Errorf("Certificate is not replaced: %d", s)
+	}
+
+	if err := os.WriteFile(keyFile, []byte("broken"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.Reload(); err == nil {
+		t.Errorf("Broken key is loaded")
+	}
+	if s := serial(t, addr); s != 2 {
+		t.Errorf("Certificate is not kept after failed reload: %d", s)
+	}
+}
+
+func TestConfig(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	writeKeyPair(t, certFile, keyFile, 1)
+	r, err := NewReloader(certFile, keyFile, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := Config(r, Version13, CiphersCompatible)
+	if err != nil || cfg.MinVersion != tls.VersionTLS13 || cfg.CipherSuites != nil {
+		t.Errorf("Unexpected config: %+v, %v", cfg, err)
+	}
+	for _, c := range [][2]string{{"1.1", CiphersModern}, {Version12, "weak"}} {
+		if _, err := Config(r, c[0], c[1]); err == nil {
+			t.Errorf("Unsupported config is accepted: %v", c)
+		}
+	}
+
+	if err := WithClientCA(cfg, keyFile); err == nil {
+		t.Errorf("CA is loaded from key file")
+	}
+	if err := WithClientCA(cfg, certFile); err != nil || cfg.ClientAuth != tls.VerifyClientCertIfGiven {
+		t.Errorf("Client CA is not configured: %v", err)
+	}
+}
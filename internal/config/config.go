@@ -0,0 +1,331 @@
+// Package config populates configuration struct from layered sources:
+// defaults, optional JSON/YAML/TOML file, environment variables and command-line flags.
+//
+// Every parameter is addressed with dotted key built from json tags of the struct fields,
+// like "server.port". Fields tagged with `config:"secret"` are redacted on printing.
+package config
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Default - name of the source of values, which are not overridden by any other source
+const Default = "default"
+
+// Source - named set of parameter values by dotted keys
+type Source struct {
+	Name   string
+	Values map[string]interface{}
+	// Refs - optional origins of the values more exact than source name, like name of environment variable
+	Refs map[string]string
+}
+
+// Origins - name of the source, which value was applied, by parameter key
+type Origins map[string]string
+
+// field - leaf parameter of the configuration struct
+type field struct {
+	key    string
+	value  reflect.Value
+	secret bool
+}
+
+// fields - lists parameters of the struct in order of declaration.
+func fields(dst interface{}) []field {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		panic(errors.New("config: pointer to struct expected"))
+	}
+	return structFields(v.Elem(), "")
+}
+
+func structFields(v reflect.Value, prefix string) []field {
+	list := []field{}
+	for i := 0; i < v.NumField(); i++ {
+		sf := v.Type().Field(i)
+		name := strings.Split(sf.Tag.Get("json"), ",")[0]
+		if name == "-" || sf.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = strings.ToLower(sf.Name)
+		}
+		key := prefix + name
+		if sf.Type.Kind() == reflect.Struct {
+			list = append(list, structFields(v.Field(i), key+".")...)
+			continue
+		}
+		list = append(list, field{key: key, value: v.Field(i), secret: sf.Tag.Get("config") == "secret"})
+	}
+	return list
+}
+
+// Keys - returns keys of all parameters of the struct.
+func Keys(dst interface{}) []string {
+	list := fields(dst)
+	keys := make([]string, len(list))
+	for i, f := range list {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// Apply - sets values of sources to the struct, every next source overrides previous ones.
+// Returns origins of all parameters, parameters which are not set have Default origin.
+func Apply(dst interface{}, sources ...Source) (Origins, error) {
+	byKey, origins := map[string]field{}, Origins{}
+	for _, f := range fields(dst) {
+		byKey[f.key], origins[f.key] = f, Default
+	}
+	for _, src := range sources {
+		for key, raw := range src.Values {
+			f, ok := byKey[key]
+			if !ok {
+				return nil, fmt.Errorf("config: %s: unknown parameter %q", src.Name, key)
+			}
+			if err := set(f.value, raw); err != nil {
+				return nil, fmt.Errorf("config: %s: %s: %s", src.Name, key, err.Error())
+			}
+			origins[key] = src.Name
+			if ref, ok := src.Refs[key]; ok {
+				origins[key] = ref
+			}
+		}
+	}
+	return origins, nil
+}
+
+// set - assigns raw value given as string or parsed from file.
+func set(v reflect.Value, raw interface{}) error {
+	if raw == nil {
+		v.Set(reflect.Zero(v.Type()))
+		return nil
+	}
+	switch v.Kind() {
+	case reflect.String:
+		switch raw := raw.(type) {
+		case []interface{}, map[string]interface{}:
+			return errors.New("string expected")
+		default:
+			v.SetString(fmt.Sprint(raw))
+		}
+	case reflect.Bool:
+		switch raw := raw.(type) {
+		case bool:
+			v.SetBool(raw)
+		case string:
+			b, err := strconv.ParseBool(raw)
+			if err != nil {
+				return errors.New("boolean expected")
+			}
+			v.SetBool(b)
+		default:
+			return errors.New("boolean expected")
+		}
+	case reflect.Int, reflect.Int64, reflect.Int32:
+		var s string
+		switch raw := raw.(type) {
+		case string:
+			s = raw
+		case json.Number:
+			s = raw.String()
+		case int:
+			s = strconv.Itoa(raw)
+		case int64:
+			s = strconv.FormatInt(raw, 10)
+		case float64:
+			s = strconv.FormatFloat(raw, 'f', -1, 64)
+		default:
+			return errors.New("integer expected")
+		}
+		i, err := strconv.ParseInt(strings.TrimSpace(s), 10, v.Type().Bits())
+		if err != nil {
+			return errors.New("integer expected")
+		}
+		v.SetInt(i)
+	case reflect.Slice:
+		if v.Type().Elem().Kind() != reflect.String {
+			return fmt.Errorf("unsupported type %s", v.Type())
+		}
+		list := []string{}
+		switch raw := raw.(type) {
+		case string:
+			// comma-separated list given by env or flag
+			for _, item := range strings.Split(raw, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					list = append(list, item)
+				}
+			}
+		case []interface{}:
+			for _, item := range raw {
+				switch item.(type) {
+				case []interface{}, map[string]interface{}, nil:
+					return errors.New("list of strings expected")
+				}
+				list = append(list, fmt.Sprint(item))
+			}
+		default:
+			return errors.New("list expected")
+		}
+		v.Set(reflect.ValueOf(list))
+	default:
+		return fmt.Errorf("unsupported type %s", v.Type())
+	}
+	return nil
+}
+
+// FileSource - reads values from JSON, YAML or TOML file, format is chosen by file extension.
+func FileSource(path string) (Source, error) {
+	src := Source{Name: "file " + path}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return src, fmt.Errorf("config: %s", err.Error())
+	}
+	var tree map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".json":
+		d := json.NewDecoder(strings.NewReader(string(data)))
+		d.UseNumber()
+		err = d.Decode(&tree)
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &tree)
+	case ".toml":
+		err = toml.Unmarshal(data, &tree)
+	default:
+		return src, fmt.Errorf("config: %s: unsupported file format %q", src.Name, ext)
+	}
+	if err != nil {
+		return src, fmt.Errorf("config: %s: %s", src.Name, err.Error())
+	}
+	src.Values = map[string]interface{}{}
+	flatten(tree, "", src.Values)
+	return src, nil
+}
+
+func flatten(tree map[string]interface{}, prefix string, dst map[string]interface{}) {
+	for k, v := range tree {
+		if sub, ok := v.(map[string]interface{}); ok {
+			flatten(sub, prefix+k+".", dst)
+			continue
+		}
+		dst[prefix+k] = v
+	}
+}
+
+// EnvName - returns name of environment variable for the key, like PREFIX_SERVER_PORT for server.port.
+func EnvName(prefix, key string) string {
+	return prefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// EnvSource - takes values of given keys from environment variables (in form of os.Environ) having prefix;
+// lists are given as comma-separated values.
+func EnvSource(prefix string, environ []string, keys []string) Source {
+	env := map[string]string{}
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+	src := Source{Name: "env", Values: map[string]interface{}{}, Refs: map[string]string{}}
+	for _, key := range keys {
+		name := EnvName(prefix, key)
+		if v, ok := env[name]; ok {
+			src.Values[key], src.Refs[key] = v, "env "+name
+		}
+	}
+	return src
+}
+
+// FlagSource - registers flag for every parameter of the struct, like -server.port;
+// returns function to take values of flags set on command line after parsing.
+func FlagSource(fs *flag.FlagSet, dst interface{}) func() Source {
+	src := Source{Name: "flag", Values: map[string]interface{}{}, Refs: map[string]string{}}
+	for _, f := range fields(dst) {
+		key, usage := f.key, fmt.Sprintf("overrides %s parameter", f.key)
+		setter := func(v string) error {
+			src.Values[key], src.Refs[key] = v, "flag -"+key
+			return nil
+		}
+		if f.value.Kind() == reflect.Bool {
+			fs.BoolFunc(key, usage, setter)
+		} else {
+			fs.Func(key, usage, setter)
+		}
+	}
+	return func() Source {
+		return src
+	}
+}
+
+// Diff - returns keys of parameters having different values in two structs of the same type.
+func Diff(a, b interface{}) []string {
+	keys := []string{}
+	bf := fields(b)
+	for i, f := range fields(a) {
+		if !reflect.DeepEqual(f.value.Interface(), bf[i].value.Interface()) {
+			keys = append(keys, f.key)
+		}
+	}
+	return keys
+}
+
+// Value - effective value of the parameter with its origin
+type Value struct {
+	Key    string      `json:"key"`
+	Value  interface{} `json:"value"`
+	Origin string      `json:"origin"`
+}
+
+// Redacted - value printed instead of secrets
+const Redacted = "******"
+
+// Values - returns effective values of parameters with their origins, secrets are redacted.
+func Values(dst interface{}, origins Origins) []Value {
+	values := []Value{}
+	for _, f := range fields(dst) {
+		v := Value{Key: f.key, Value: f.value.Interface(), Origin: origins[f.key]}
+		switch {
+		case f.secret && !f.value.IsZero():
+			v.Value = Redacted
+		case f.value.Kind() == reflect.Slice && f.value.IsNil():
+			v.Value = reflect.MakeSlice(f.value.Type(), 0, 0).Interface()
+		}
+		if v.Origin == "" {
+			v.Origin = Default
+		}
+		values = append(values, v)
+	}
+	return values
+}
+
+// Print - writes effective values of parameters with their origins, secrets are redacted.
+func Print(w io.Writer, dst interface{}, origins Origins) error {
+	for _, v := range Values(dst, origins) {
+		value := ""
+		if rv := reflect.ValueOf(v.Value); rv.Kind() == reflect.String {
+			value = strconv.Quote(rv.String())
+		} else {
+			b, err := json.Marshal(v.Value)
+			if err != nil {
+				return err
+			}
+			value = string(b)
+		}
+		if _, err := fmt.Fprintf(w, "%s = %s # %s\n", v.Key, value, v.Origin); err != nil {
+			return err
+		}
+	}
+	return nil
+}
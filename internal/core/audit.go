@@ -0,0 +1,122 @@
+package core
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	DefaultAuditListSize = 100
+	MaxAuditListSize     = 1000
+)
+
+// audit - appends entry about action performed with the request into the audit log.
+func (s *service) audit(r *http.Request, actorID uint64, action, target string, outcome model.AuditOutcome) {
+	if _, err := s.repo(r).AppendAuditEntry(audit.NewEntry(r, actorID, action, target, outcome)); err != nil {
+		s.logger(r).Error("Repository error", "method", "AppendAuditEntry", "error", err)
+	}
+}
+
+// auditFilter - reads filter of the audit log from query string, returns error message for invalid value.
+func auditFilter(r *http.Request) (audit.Filter, int, string) {
+	q, f, limit := r.URL.Query(), audit.Filter{}, DefaultAuditListSize
+	var err error
+	if v := q.Get("actor_id"); v != "" {
+		if f.ActorID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return f, 0, "Invalid actor ID"
+		}
+	}
+	f.Action = q.Get("action")
+	f.Outcome = model.AuditOutcome(q.Get("outcome"))
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, 0, "Invalid since, RFC 3339 time expected"
+		}
+	}
+	if v := q.Get("until"); v != "" {
+		if f.Until, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, 0, "Invalid until, RFC 3339 time expected"
+		}
+	}
+	if v := q.Get("before_id"); v != "" {
+		if f.BeforeID, err = strconv.ParseUint(v, 10, 64); err != nil {
+			return f, 0, "Invalid before ID"
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > MaxAuditListSize {
+			return f, 0, "Invalid limit"
+		}
+	}
+	return f, limit, ""
+}
+
+// AuditLog - admin queries the audit log with filters, the latest entries go first.
+func (s *service) AuditLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		filter, limit, msg := auditFilter(r)
+		if msg != "" {
+			reply.BadRequest(msg)(w, r)
+			return
+		}
+		entries, err := s.repo(r).FindAuditEntries(filter, limit)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindAuditEntries", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.AuditLogResponse{Entries: entries})(w, r)
+	}
+}
+
+// VerifyAuditLog - admin checks hash chain of the whole audit log.
+func (s *service) VerifyAuditLog() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		res := api.AuditVerifyResponse{Valid: true}
+		lastID, lastHash := uint64(0), ""
+		for {
+			entries, err := s.repo(r).ReadAuditChain(lastID, MaxAuditListSize)
+			if err != nil {
+				s.logger(r).Error("Repository error", "method", "ReadAuditChain", "error", err)
+				reply.InternalServerError("Cannot complete request")(w, r)
+				return
+			}
+			if broken := audit.Verify(lastHash, entries); broken >= 0 {
+				res.Valid = false
+				res.Checked += broken
+				res.BrokenID = entries[broken].ID
+				break
+			}
+			res.Checked += len(entries)
+			if len(entries) < MaxAuditListSize {
+				break
+			}
+			lastID, lastHash = entries[len(entries)-1].ID, entries[len(entries)-1].Hash
+		}
+		reply.OK(&res)(w, r)
+	}
+}
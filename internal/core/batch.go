@@ -0,0 +1,157 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	// MaxBatchSize - max number of items in the single batch transfer
+	MaxBatchSize = 500
+)
+
+// batchOrders - validates batch request of the sender and converts its items into transfer orders;
+// returns non-empty message for the invalid request.
+func batchOrders(senderID uint64, req *api.BatchTransferRequest) ([]model.TransferOrder, string) {
+	if req.Mode == "" {
+		req.Mode = api.BatchAtomic
+	}
+	if req.Mode != api.BatchAtomic && req.Mode != api.BatchBestEffort {
+		return nil, fmt.Sprintf("Batch mode must be %q or %q", api.BatchAtomic, api.BatchBestEffort)
+	}
+	if req.Currency == "" {
+		req.Currency = string(model.DefaultCurrency)
+	}
+	if !model.Currency(req.Currency).IsValid() {
+		return nil, "Invalid currency"
+	}
+	if len(req.Items) == 0 {
+		return nil, "Batch is empty"
+	}
+	if len(req.Items) > MaxBatchSize {
+		return nil, fmt.Sprintf("Batch size must not exceed %d", MaxBatchSize)
+	}
+	orders := make([]model.TransferOrder, len(req.Items))
+	for i, item := range req.Items {
+		if item.RecipientID == 0 || item.RecipientID == senderID {
+			return nil, fmt.Sprintf("Item %d: invalid recipient ID", i)
+		}
+		if item.Sum <= 0.0 {
+			return nil, fmt.Sprintf("Item %d: incorrect sum", i)
+		}
+		if len(item.Memo) > MaxMemoLen {
+			return nil, fmt.Sprintf("Item %d: memo length must not exceed %d", i, MaxMemoLen)
+		}
+		orders[i] = model.TransferOrder{RecipientID: item.RecipientID, Sum: item.Sum, Memo: item.Memo}
+	}
+	return orders, ""
+}
+
+// CreateIMTBatch - makes one-to-many transfers from JSON list of items.
+func (s *service) CreateIMTBatch() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleTrusted {
+			s.m.transferFailed(TransferFailedForbidden)
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		req := api.BatchTransferRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			reply.BadRequest("Can't parse batch data")(w, r)
+			return
+		}
+		orders, msg := batchOrders(authUser.ID, &req)
+		if msg != "" {
+			reply.BadRequest(msg)(w, r)
+			return
+		}
+
+		// validate recipients up front
+		ids, known := []uint64{}, map[uint64]bool{}
+		for _, o := range orders {
+			if _, ok := known[o.RecipientID]; !ok {
+				known[o.RecipientID] = false
+				ids = append(ids, o.RecipientID)
+			}
+		}
+		recipients, err := s.repo(r).FindUsersByIDs(ids)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindUsersByIDs", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		for _, u := range recipients {
+			known[u.ID] = true
+		}
+		for i, o := range orders {
+			if !known[o.RecipientID] {
+				reply.Conflict(fmt.Sprintf("Item %d: recipient not found", i))(w, r)
+				return
+			}
+		}
+
+		currency := model.Currency(req.Currency)
+		wallet := authUser.Wallet(currency)
+		if wallet == nil {
+			reply.Conflict(fmt.Sprintf("No %s wallet", currency))(w, r)
+			return
+		}
+		results := make([]api.BatchTransferResult, len(orders))
+		if req.Mode == api.BatchAtomic {
+			total := 0.0
+			for _, o := range orders {
+				total += o.Sum
+			}
+			if wallet.Available-total < 0.0 {
+				s.m.transferFailed(TransferFailedInsufficientFunds)
+				s.audit(r, authUser.ID, audit.TransferBatch, fmt.Sprintf("%d transfers", len(orders)), model.AuditFailure)
+				reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, currency))(w, r)
+				return
+			}
+			transfers, err := s.repo(r).CreateInternalTransferBatch(authUser.ID, currency, orders)
+			if err != nil {
+				s.logger(r).Warn("Repository error", "method", "CreateInternalTransferBatch", "error", err)
+				s.m.transferFailed(TransferFailedRejected)
+				s.audit(r, authUser.ID, audit.TransferBatch, fmt.Sprintf("%d transfers", len(orders)), model.AuditFailure)
+				reply.Conflict("Cannot complete batch transfer")(w, r)
+				return
+			}
+			s.audit(r, authUser.ID, audit.TransferBatch, fmt.Sprintf("%d transfers", len(orders)), model.AuditSuccess)
+			for i := range transfers {
+				s.notifyTransfer(s.repo(r), &transfers[i])
+				results[i] = api.BatchTransferResult{
+					RecipientID: transfers[i].RecipientID,
+					TransferID:  transfers[i].ID,
+				}
+			}
+		} else {
+			for i, o := range orders {
+				results[i].RecipientID = o.RecipientID
+				transfer, err := s.repo(r).CreateInternalTransfer(authUser.ID, o.RecipientID, currency, o.Sum, o.Memo)
+				if err != nil {
+					s.logger(r).Warn("Repository error", "method", "CreateInternalTransfer", "error", err)
+					s.m.transferFailed(TransferFailedRejected)
+					s.audit(r, authUser.ID, audit.TransferCreate, fmt.Sprintf("user #%d", o.RecipientID), model.AuditFailure)
+					results[i].Error = true
+					results[i].Message = fmt.Sprintf("Cannot transfer money to #%d", o.RecipientID)
+					continue
+				}
+				s.audit(r, authUser.ID, audit.TransferCreate, fmt.Sprintf("transfer #%d", transfer.ID), model.AuditSuccess)
+				s.notifyTransfer(s.repo(r), transfer)
+				results[i].TransferID = transfer.ID
+			}
+		}
+		reply.OK(&api.BatchTransferResponse{Mode: req.Mode, Results: results})(w, r)
+	}
+}
@@ -0,0 +1,67 @@
+package core
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func TestBatchOrders(t *testing.T) {
+	tooLarge := make([]api.BatchTransferItem, MaxBatchSize+1)
+	for i := range tooLarge {
+		tooLarge[i] = api.BatchTransferItem{RecipientID: 2, Sum: 1}
+	}
+	cases := []struct {
+		req      api.BatchTransferRequest
+		valid    bool
+		mode     string
+		currency string
+	}{
+		{api.BatchTransferRequest{Items: []api.BatchTransferItem{{RecipientID: 2, Sum: 1}}},
+			true, api.BatchAtomic, string(model.DefaultCurrency)},
+		{api.BatchTransferRequest{
+			Mode:     api.BatchBestEffort,
+			Currency: "USD",
+			Items:    []api.BatchTransferItem{{RecipientID: 2, Sum: 1}, {RecipientID: 3, Sum: 2, Memo: "salary"}},
+		}, true, api.BatchBestEffort, "USD"},
+		{api.BatchTransferRequest{Mode: "unknown", Items: []api.BatchTransferItem{{RecipientID: 2, Sum: 1}}},
+			false, "", ""},
+		{api.BatchTransferRequest{Currency: "usd", Items: []api.BatchTransferItem{{RecipientID: 2, Sum: 1}}},
+			false, "", ""},
+		{api.BatchTransferRequest{}, false, "", ""},
+		{api.BatchTransferRequest{Items: tooLarge}, false, "", ""},
+		// sender is recipient
+		{api.BatchTransferRequest{Items: []api.BatchTransferItem{{RecipientID: 1, Sum: 1}}}, false, "", ""},
+		{api.BatchTransferRequest{Items: []api.BatchTransferItem{{RecipientID: 0, Sum: 1}}}, false, "", ""},
+		{api.BatchTransferRequest{Items: []api.BatchTransferItem{{RecipientID: 2, Sum: 0}}}, false, "", ""},
+		{api.BatchTransferRequest{Items: []api.BatchTransferItem{{RecipientID: 2, Sum: -1}}}, false, "", ""},
+		{api.BatchTransferRequest{
+			Items: []api.BatchTransferItem{{RecipientID: 2, Sum: 1, Memo: fmt.Sprintf("%0256d", 0)}},
+		}, false, "", ""},
+	}
+	for i, c := range cases {
+		orders, msg := batchOrders(1, &c.req)
+		if c.valid != (msg == "") {
+			t.Errorf("Case %d: unexpected validation message %q", i, msg)
+			continue
+		}
+		if !c.valid {
+			continue
+		}
+		if c.req.Mode != c.mode || c.req.Currency != c.currency {
+			t.Errorf("Case %d: unexpected mode %q or currency %q", i, c.req.Mode, c.req.Currency)
+		}
+		if len(orders) != len(c.req.Items) {
+			t.Errorf("Case %d: unexpected number of orders %d", i, len(orders))
+			continue
+		}
+		for j, o := range orders {
+			item := c.req.Items[j]
+			if o.RecipientID != item.RecipientID || o.Sum != item.Sum || o.Memo != item.Memo {
+				t.Errorf("Case %d: unexpected order %v for item %v", i, o, item)
+			}
+		}
+	}
+}
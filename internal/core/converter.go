@@ -5,8 +5,8 @@ import (
 	"github.com/wtask/pwsrv/internal/model"
 )
 
-// censorInternalTransfer - converts model into response item format
-func censorInternalTransfer(memberID uint64, t *model.InternalTransfer) *api.IMTCensored {
+// CensorInternalTransfer - converts model into response item format from member point of view.
+func CensorInternalTransfer(memberID uint64, t *model.InternalTransfer) *api.IMTCensored {
 	if t == nil {
 		return nil
 	}
@@ -26,7 +26,9 @@ func censorInternalTransfer(memberID uint64, t *model.InternalTransfer) *api.IMT
 		ID:            t.ID,
 		Date:          t.CreatedAt,
 		IsCredit:      isCredit,
+		Currency:      string(t.Currency),
 		Sum:           sum,
+		Memo:          t.Memo,
 		BalanceBefore: balanceBefore,
 		BalanceAfter:  balanceAfter,
 		UserID:        userID,
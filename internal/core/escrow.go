@@ -0,0 +1,288 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	// DefaultEscrowTTL - time to the escrow deadline if it is not specified by the client
+	DefaultEscrowTTL = 14 * 24 * time.Hour
+	// MaxEscrowTTL - longest allowed time to the escrow deadline
+	MaxEscrowTTL = 90 * 24 * time.Hour
+)
+
+func (s *service) EscrowList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		escrows, err := s.repo(r).FindLastEscrows(authUser.ID, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastEscrows", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.EscrowListResponse{Escrows: escrows})(w, r)
+	}
+}
+
+func (s *service) GetEscrowByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		escrow, err := s.repo(r).GetEscrowByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetEscrowByID", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		if escrow == nil {
+			reply.Conflict("Escrow not found")(w, r)
+			return
+		}
+		if escrow.UserID != authUser.ID &&
+			escrow.RecipientID != authUser.ID &&
+			authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		reply.OK(&api.EscrowResponse{Escrow: escrow})(w, r)
+	}
+}
+
+func (s *service) CreateEscrow() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleTrusted {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		recipientID, err := strconv.ParseUint(r.Form.Get("recipient_id"), 10, 64)
+		if err != nil || recipientID == 0 || recipientID == authUser.ID {
+			reply.BadRequest("Invalid recipient ID")(w, r)
+			return
+		}
+		if recipient, _ := s.repo(r).GetUserByID(recipientID); recipient == nil {
+			reply.Conflict("Recipient not found")(w, r)
+			return
+		}
+		sum, err := strconv.ParseFloat(r.Form.Get("sum"), 10)
+		if err != nil || sum <= 0.0 {
+			reply.BadRequest("Incorrect sum")(w, r)
+			return
+		}
+		currency, ok := formCurrency(r, "currency")
+		if !ok {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		ttl := DefaultEscrowTTL
+		if v := r.Form.Get("ttl"); v != "" {
+			sec, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || sec == 0 || time.Duration(sec)*time.Second > MaxEscrowTTL {
+				reply.BadRequest(fmt.Sprintf("TTL must be between 1 and %d seconds", MaxEscrowTTL/time.Second))(w, r)
+				return
+			}
+			ttl = time.Duration(sec) * time.Second
+		}
+		onDeadline := model.EscrowCompleted
+		if v := r.Form.Get("on_deadline"); v != "" {
+			onDeadline = model.EscrowStatus(v)
+			if !onDeadline.IsFinal() {
+				reply.BadRequest(
+					fmt.Sprintf("Deadline rule must be %q or %q", model.EscrowCompleted, model.EscrowRefunded),
+				)(w, r)
+				return
+			}
+		}
+		wallet := authUser.Wallet(currency)
+		if wallet == nil {
+			reply.Conflict(fmt.Sprintf("No %s wallet", currency))(w, r)
+			return
+		}
+		if wallet.Available-sum < 0.0 {
+			reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, currency))(w, r)
+			return
+		}
+		escrow, err := s.repo(r).CreateEscrow(model.Escrow{
+			UserID:      authUser.ID,
+			RecipientID: recipientID,
+			Currency:    currency,
+			Sum:         sum,
+			Memo:        r.Form.Get("memo"),
+			Deadline:    time.Now().Add(ttl),
+			OnDeadline:  onDeadline,
+		})
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "CreateEscrow", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot create escrow for #%d", recipientID))(w, r)
+			return
+		}
+		s.notifyBalance(s.repo(r), escrow.UserID, escrow.Currency)
+		reply.OK(&api.EscrowResponse{Escrow: escrow})(w, r)
+	}
+}
+
+// changeEscrow - returns handler to move pending escrow into the next status on behalf of one of parties;
+// sender and recipient flags select which of parties is allowed to act.
+func (s *service) changeEscrow(id uint64, next model.EscrowStatus, sender, recipient bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		escrow, err := s.repo(r).GetEscrowByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetEscrowByID", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if escrow == nil {
+			reply.Conflict("Escrow not found")(w, r)
+			return
+		}
+		if !(sender && escrow.UserID == authUser.ID) &&
+			!(recipient && escrow.RecipientID == authUser.ID) {
+			reply.Forbidden("Insufficient authority to change escrow")(w, r)
+			return
+		}
+		if escrow.Status != model.EscrowPending {
+			reply.Conflict(fmt.Sprintf("Escrow is %s", escrow.Status))(w, r)
+			return
+		}
+		escrow, err = s.repo(r).ChangeEscrowStatus(escrow.ID, next, authUser.ID, r.Form.Get("note"))
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "ChangeEscrowStatus", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot change escrow #%d", id))(w, r)
+			return
+		}
+		s.notifySettledEscrow(s.repo(r), escrow)
+		reply.OK(&api.EscrowResponse{Escrow: escrow})(w, r)
+	}
+}
+
+// ConfirmEscrowByID - sender confirms delivery, funds go to the recipient.
+func (s *service) ConfirmEscrowByID(id uint64) http.HandlerFunc {
+	return s.changeEscrow(id, model.EscrowCompleted, true, false)
+}
+
+// ReleaseEscrowByID - recipient releases funds back to the sender.
+func (s *service) ReleaseEscrowByID(id uint64) http.HandlerFunc {
+	return s.changeEscrow(id, model.EscrowRefunded, false, true)
+}
+
+// DisputeEscrowByID - any party opens dispute, deadline rule is not applied to disputed escrow.
+func (s *service) DisputeEscrowByID(id uint64) http.HandlerFunc {
+	return s.changeEscrow(id, model.EscrowDisputed, true, true)
+}
+
+func (s *service) AdminEscrowList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		status := model.EscrowDisputed
+		if v := r.URL.Query().Get("status"); v != "" {
+			status = model.EscrowStatus(v)
+		}
+		escrows, err := s.repo(r).FindEscrowsByStatus(status, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindEscrowsByStatus", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.EscrowListResponse{Escrows: escrows})(w, r)
+	}
+}
+
+// ResolveEscrowByID - admin decides disputed escrow in favor of the recipient (completed) or sender (refunded).
+func (s *service) ResolveEscrowByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		outcome := model.EscrowStatus(r.Form.Get("outcome"))
+		if !outcome.IsFinal() {
+			reply.BadRequest(
+				fmt.Sprintf("Outcome must be %q or %q", model.EscrowCompleted, model.EscrowRefunded),
+			)(w, r)
+			return
+		}
+		escrow, err := s.repo(r).GetEscrowByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetEscrowByID", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if escrow == nil {
+			reply.Conflict("Escrow not found")(w, r)
+			return
+		}
+		if escrow.Status != model.EscrowDisputed {
+			reply.Conflict(fmt.Sprintf("Escrow is %s", escrow.Status))(w, r)
+			return
+		}
+		escrow, err = s.repo(r).ChangeEscrowStatus(escrow.ID, outcome, authUser.ID, r.Form.Get("note"))
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "ChangeEscrowStatus", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot resolve escrow #%d", id))(w, r)
+			return
+		}
+		s.notifySettledEscrow(s.repo(r), escrow)
+		reply.OK(&api.EscrowResponse{Escrow: escrow})(w, r)
+	}
+}
+
+// notifySettledEscrow - publishes balance changes of the parties, if escrow is settled.
+func (s *service) notifySettledEscrow(repo Repository, e *model.Escrow) {
+	switch e.Status {
+	case model.EscrowCompleted:
+		transfer, err := repo.GetInternalTransferByID(e.TransferID)
+		if err == nil {
+			s.notifyTransfer(repo, transfer)
+		}
+	case model.EscrowRefunded:
+		s.notifyBalance(repo, e.UserID, e.Currency)
+	}
+}
@@ -0,0 +1,121 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/notify"
+)
+
+const (
+	// EventTransferDebited - money has been transferred from the user
+	EventTransferDebited = "transfer.debited"
+	// EventTransferCredited - money has been transferred to the user
+	EventTransferCredited = "transfer.credited"
+	// EventBalanceChanged - balance or available funds of the user's wallet have been changed
+	EventBalanceChanged = "balance.changed"
+
+	// eventStreamHeartbeat - interval to send comments into idle stream to keep connection alive
+	eventStreamHeartbeat = 15 * time.Second
+)
+
+// notifyTransfer - publishes committed transfer to both parties.
+func (s *service) notifyTransfer(repo Repository, t *model.InternalTransfer) {
+	if t == nil {
+		return
+	}
+	s.m.transferCreated(t)
+	s.e.Publish(t.UserID, EventTransferDebited, CensorInternalTransfer(t.UserID, t))
+	s.e.Publish(t.RecipientID, EventTransferCredited, CensorInternalTransfer(t.RecipientID, t))
+	s.notifyBalance(repo, t.UserID, t.Currency)
+	s.notifyBalance(repo, t.RecipientID, t.Currency)
+}
+
+// notifyBalance - publishes actual state of the user's wallet.
+func (s *service) notifyBalance(repo Repository, userID uint64, currency model.Currency) {
+	wallets, err := repo.GetUserWallets(userID)
+	if err != nil {
+		return
+	}
+	for i := range wallets {
+		if wallets[i].Currency == currency {
+			s.e.Publish(userID, EventBalanceChanged, &wallets[i])
+			return
+		}
+	}
+}
+
+// EventStream - streams events of the authorized user as Server-Sent Events;
+// the client can resume stream with Last-Event-ID header (or last_event_id query param),
+// if some of missed events are lost or were published before restart, the "reset" event is sent first.
+func (s *service) EventStream() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			reply.InternalServerError("Streaming is not supported")(w, r)
+			return
+		}
+		lastEventID := r.Header.Get("Last-Event-ID")
+		if lastEventID == "" {
+			lastEventID = r.URL.Query().Get("last_event_id")
+		}
+		sub, ok := s.e.Subscribe(authUser.ID, lastEventID)
+		if !ok {
+			reply.ServiceUnavailable()(w, r)
+			return
+		}
+		defer sub.Close()
+
+		w.Header().Set("Content-Type", "text/event-stream; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+		w.Header().Set("X-Accel-Buffering", "no")
+		// stream is not limited by read and write timeouts of the server
+		rc := http.NewResponseController(w)
+		rc.SetReadDeadline(time.Time{})
+		rc.SetWriteDeadline(time.Time{})
+		w.WriteHeader(http.StatusOK)
+		if !sub.Complete {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+		for _, e := range sub.Replay {
+			writeEvent(w, &e)
+		}
+		flusher.Flush()
+
+		heartbeat := time.NewTicker(eventStreamHeartbeat)
+		defer heartbeat.Stop()
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": heartbeat\n\n")
+			case e, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+				writeEvent(w, &e)
+			}
+			flusher.Flush()
+		}
+	}
+}
+
+// writeEvent - writes event in text/event-stream format.
+func writeEvent(w http.ResponseWriter, e *notify.Event) {
+	data := e.Data
+	if !json.Valid(data) {
+		data = json.RawMessage("null")
+	}
+	fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", e.StreamID(), e.Type, data)
+}
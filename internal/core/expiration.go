@@ -0,0 +1,44 @@
+package core
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Expirer - background job, which expires holds and escrows after their deadline
+// and publishes changed balances (and transfers of completed escrows) to the owners.
+type Expirer struct {
+	s *service
+}
+
+// NewExpirer - creates expiration job over the given repository.
+func NewExpirer(r Repository, e EventBus, m *Metrics) (*Expirer, error) {
+	if r == nil {
+		return nil, errors.New("NewExpirer(): Repository is nil")
+	}
+	if e == nil {
+		return nil, errors.New("NewExpirer(): EventBus is nil")
+	}
+	if m == nil {
+		return nil, errors.New("NewExpirer(): Metrics is nil")
+	}
+	return &Expirer{s: &service{r: r, e: e, m: m}}, nil
+}
+
+// Run - expires overdue holds and escrows, suitable to be used as background job;
+// items expired before the failure are notified too.
+func (x *Expirer) Run(now time.Time) error {
+	holds, holdErr := x.s.r.ExpireHolds(now)
+	for _, h := range holds {
+		x.s.notifyBalance(x.s.r, h.UserID, h.Currency)
+	}
+	escrows, escrowErr := x.s.r.ExpireEscrows(now)
+	for i := range escrows {
+		x.s.notifySettledEscrow(x.s.r, &escrows[i])
+	}
+	if err := errors.Join(holdErr, escrowErr); err != nil {
+		return fmt.Errorf("core.Expirer.Run: %w", err)
+	}
+	return nil
+}
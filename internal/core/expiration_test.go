@@ -0,0 +1,72 @@
+package core
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/metrics"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/notify"
+)
+
+// expiringRepository - expires fixed items, the first hold fails
+type expiringRepository struct {
+	Repository
+}
+
+func (er *expiringRepository) ExpireHolds(now time.Time) ([]model.Hold, error) {
+	return []model.Hold{{ID: 2, UserID: 1, Currency: "PW"}}, errors.New("hold #1: deadlock")
+}
+
+func (er *expiringRepository) ExpireEscrows(now time.Time) ([]model.Escrow, error) {
+	return []model.Escrow{
+		{ID: 1, UserID: 1, RecipientID: 2, Currency: "USD", Status: model.EscrowRefunded},
+		{ID: 2, UserID: 3, RecipientID: 2, Currency: "PW", Status: model.EscrowCompleted, TransferID: 7},
+	}, nil
+}
+
+func (er *expiringRepository) GetUserWallets(userID uint64) ([]model.Wallet, error) {
+	return []model.Wallet{
+		{UserID: userID, Currency: "PW", Balance: 100},
+		{UserID: userID, Currency: "USD", Balance: 10},
+	}, nil
+}
+
+func (er *expiringRepository) GetInternalTransferByID(transferID uint64) (*model.InternalTransfer, error) {
+	return &model.InternalTransfer{ID: transferID, UserID: 3, RecipientID: 2, Currency: "PW", Sum: 5}, nil
+}
+
+func TestExpirerNotifies(t *testing.T) {
+	bus := notify.NewBus(100, 100)
+	x, err := NewExpirer(&expiringRepository{}, bus, NewMetrics(metrics.NewRegistry()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[uint64][]string{
+		1: {EventBalanceChanged, EventBalanceChanged},
+		2: {EventTransferCredited, EventBalanceChanged},
+		3: {EventTransferDebited, EventBalanceChanged},
+	}
+	subscriptions := map[uint64]*notify.Subscription{}
+	for userID := range expected {
+		s, _ := bus.Subscribe(userID, "")
+		defer s.Close()
+		subscriptions[userID] = s
+	}
+	if err = x.Run(time.Now()); err == nil {
+		t.Error("Error of hold expiration is not returned")
+	}
+	for userID, events := range expected {
+		for _, kind := range events {
+			select {
+			case e := <-subscriptions[userID].Events():
+				if e.Type != kind {
+					t.Errorf("User #%d got %s event, expected %s", userID, e.Type, kind)
+				}
+			default:
+				t.Errorf("User #%d did not get %s event", userID, kind)
+			}
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package core
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/health"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// HealthMonitor - reports readiness and detailed status of the server
+type HealthMonitor interface {
+	Ready(ctx context.Context) error
+	Status(ctx context.Context) *health.Report
+}
+
+// Liveness - process is alive and serves requests.
+func (s *service) Liveness() http.HandlerFunc {
+	return reply.OK(&api.HealthResponse{Status: health.StatusOK})
+}
+
+// Readiness - server is not shutting down and its dependencies are available.
+func (s *service) Readiness() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := s.h.Ready(r.Context()); err != nil {
+			s.logger(r).Warn("Server is not ready", "error", err)
+			reply.ServiceUnavailable()(w, r)
+			return
+		}
+		reply.OK(&api.HealthResponse{Status: health.StatusOK})(w, r)
+	}
+}
+
+// Status - admin gets version, build info, uptime and results of dependency checks.
+func (s *service) Status() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		reply.OK(&api.StatusResponse{Report: s.h.Status(r.Context())})(w, r)
+	}
+}
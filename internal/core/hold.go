@@ -0,0 +1,204 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	// DefaultHoldTTL - hold lifetime if it is not specified by the client
+	DefaultHoldTTL = 7 * 24 * time.Hour
+	// MaxHoldTTL - longest allowed hold lifetime
+	MaxHoldTTL = 30 * 24 * time.Hour
+)
+
+func (s *service) HoldList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		holds, err := s.repo(r).FindLastHolds(authUser.ID, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastHolds", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.HoldListResponse{Holds: holds})(w, r)
+	}
+}
+
+func (s *service) GetHoldByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		hold, err := s.repo(r).GetHoldByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetHoldByID", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		if hold == nil {
+			reply.Conflict("Hold not found")(w, r)
+			return
+		}
+		if hold.UserID != authUser.ID && hold.RecipientID != authUser.ID {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		reply.OK(&api.HoldResponse{Hold: hold})(w, r)
+	}
+}
+
+func (s *service) CreateHold() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleTrusted {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		recipientID, err := strconv.ParseUint(r.Form.Get("recipient_id"), 10, 64)
+		if err != nil || recipientID == 0 || recipientID == authUser.ID {
+			reply.BadRequest("Invalid recipient ID")(w, r)
+			return
+		}
+		if recipient, _ := s.repo(r).GetUserByID(recipientID); recipient == nil {
+			reply.Conflict("Recipient not found")(w, r)
+			return
+		}
+		sum, err := strconv.ParseFloat(r.Form.Get("sum"), 10)
+		if err != nil || sum <= 0.0 {
+			reply.BadRequest("Incorrect sum")(w, r)
+			return
+		}
+		currency, ok := formCurrency(r, "currency")
+		if !ok {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		ttl := DefaultHoldTTL
+		if v := r.Form.Get("ttl"); v != "" {
+			sec, err := strconv.ParseUint(v, 10, 32)
+			if err != nil || sec == 0 || time.Duration(sec)*time.Second > MaxHoldTTL {
+				reply.BadRequest(fmt.Sprintf("TTL must be between 1 and %d seconds", MaxHoldTTL/time.Second))(w, r)
+				return
+			}
+			ttl = time.Duration(sec) * time.Second
+		}
+		wallet := authUser.Wallet(currency)
+		if wallet == nil {
+			reply.Conflict(fmt.Sprintf("No %s wallet", currency))(w, r)
+			return
+		}
+		if wallet.Available-sum < 0.0 {
+			reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, currency))(w, r)
+			return
+		}
+		hold, err := s.repo(r).CreateHold(authUser.ID, recipientID, currency, sum, time.Now().Add(ttl))
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "CreateHold", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot hold money for #%d", recipientID))(w, r)
+			return
+		}
+		s.notifyBalance(s.repo(r), hold.UserID, hold.Currency)
+		reply.OK(&api.HoldResponse{Hold: hold})(w, r)
+	}
+}
+
+// CaptureHoldByID - transfers held funds to the recipient, only recipient is allowed to capture;
+// optional sum allows partial capture, the rest of reserved sum is released.
+func (s *service) CaptureHoldByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		hold, err := s.repo(r).GetHoldByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetHoldByID", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if hold == nil {
+			reply.Conflict("Hold not found")(w, r)
+			return
+		}
+		if hold.RecipientID != authUser.ID {
+			reply.Forbidden("Insufficient authority to capture hold")(w, r)
+			return
+		}
+		sum := hold.Sum
+		if v := r.Form.Get("sum"); v != "" {
+			sum, err = strconv.ParseFloat(v, 10)
+			if err != nil || sum <= 0.0 || sum > hold.Sum {
+				reply.BadRequest("Incorrect sum")(w, r)
+				return
+			}
+		}
+		hold, transfer, err := s.repo(r).CaptureHold(hold.ID, sum)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "CaptureHold", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot capture hold #%d", id))(w, r)
+			return
+		}
+		s.notifyTransfer(s.repo(r), transfer)
+		reply.OK(&api.CaptureHoldResponse{Hold: hold, TransferID: transfer.ID})(w, r)
+	}
+}
+
+// ReleaseHoldByID - cancels the hold, both the user and recipient are allowed to release it;
+// the user gets funds back when hold is released or expired.
+func (s *service) ReleaseHoldByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		hold, err := s.repo(r).GetHoldByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetHoldByID", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if hold == nil {
+			reply.Conflict("Hold not found")(w, r)
+			return
+		}
+		if hold.UserID != authUser.ID && hold.RecipientID != authUser.ID {
+			reply.Forbidden("Insufficient authority to release hold")(w, r)
+			return
+		}
+		hold, err = s.repo(r).ReleaseHold(hold.ID)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "ReleaseHold", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot release hold #%d", id))(w, r)
+			return
+		}
+		s.notifyBalance(s.repo(r), hold.UserID, hold.Currency)
+		reply.OK(&api.HoldResponse{Hold: hold})(w, r)
+	}
+}
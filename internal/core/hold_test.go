@@ -0,0 +1,69 @@
+package core
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/core/middleware"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/metrics"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/notify"
+)
+
+// holdRepository - keeps the single hold of user #1 for recipient #2
+type holdRepository struct {
+	Repository
+	hold model.Hold
+}
+
+func (hr *holdRepository) GetUserByID(userID uint64) (*model.User, error) {
+	return &model.User{ID: userID}, nil
+}
+
+func (hr *holdRepository) GetUserWallets(userID uint64) ([]model.Wallet, error) {
+	return []model.Wallet{{UserID: userID, Currency: "PW", Balance: 100}}, nil
+}
+
+func (hr *holdRepository) GetHoldByID(holdID uint64) (*model.Hold, error) {
+	h := hr.hold
+	return &h, nil
+}
+
+func (hr *holdRepository) ReleaseHold(holdID uint64) (*model.Hold, error) {
+	hr.hold.Status = model.HoldReleased
+	h := hr.hold
+	return &h, nil
+}
+
+// fixedUser - discovers the same user from any token
+type fixedUser uint64
+
+func (u fixedUser) DiscoverUserID(token string) (uint64, bool) {
+	return uint64(u), true
+}
+
+func TestReleaseHold(t *testing.T) {
+	cases := []struct {
+		userID uint64
+		status int
+	}{
+		{1, http.StatusOK},
+		{2, http.StatusOK},
+		{3, http.StatusForbidden},
+	}
+	for _, c := range cases {
+		repo := &holdRepository{hold: model.Hold{ID: 5, UserID: 1, RecipientID: 2, Currency: "PW", Status: model.HoldActive}}
+		s := &service{r: repo, e: notify.NewBus(10, 10), l: logging.Discard(), m: NewMetrics(metrics.NewRegistry())}
+		h := middleware.AuthorizationTryout(fixedUser(c.userID))(s.ReleaseHoldByID(5))
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest("POST", "/money/holds/5/release/", nil))
+		if w.Code != c.status {
+			t.Errorf("User #%d: unexpected status %d, expected %d", c.userID, w.Code, c.status)
+		}
+		if released := repo.hold.Status == model.HoldReleased; released != (c.status == http.StatusOK) {
+			t.Errorf("User #%d: unexpected hold status %s", c.userID, repo.hold.Status)
+		}
+	}
+}
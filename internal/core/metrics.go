@@ -0,0 +1,96 @@
+package core
+
+import (
+	"github.com/wtask/pwsrv/internal/metrics"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// Reasons of failed transfers
+const (
+	TransferFailedInvalid           = "invalid_request"
+	TransferFailedForbidden         = "forbidden"
+	TransferFailedNoRecipient       = "recipient_not_found"
+	TransferFailedNoWallet          = "no_wallet"
+	TransferFailedInsufficientFunds = "insufficient_funds"
+	TransferFailedRejected          = "rejected"
+)
+
+// Metrics - instruments of the HTTP service
+type Metrics struct {
+	requests         *metrics.HistogramVec
+	panics           *metrics.CounterVec
+	logins           *metrics.CounterVec
+	registrations    *metrics.CounterVec
+	transfers        *metrics.CounterVec
+	transferFailures *metrics.CounterVec
+	transferAmount   *metrics.CounterVec
+}
+
+// NewMetrics - creates instruments of the service in the registry.
+func NewMetrics(r *metrics.Registry) *Metrics {
+	return &Metrics{
+		requests: r.NewHistogramVec(
+			"pwsrv_http_request_duration_seconds",
+			"Duration of HTTP requests by route template, method and status.",
+			metrics.DefaultBuckets,
+			"route", "method", "status",
+		),
+		panics: r.NewCounterVec(
+			"pwsrv_http_panics_total",
+			"Number of panics recovered in HTTP handlers by route template.",
+			"route",
+		),
+		logins: r.NewCounterVec(
+			"pwsrv_logins_total",
+			"Number of login attempts by outcome.",
+			"outcome",
+		),
+		registrations: r.NewCounterVec(
+			"pwsrv_registrations_total",
+			"Number of registration attempts by outcome.",
+			"outcome",
+		),
+		transfers: r.NewCounterVec(
+			"pwsrv_transfers_created_total",
+			"Number of created transfers by currency.",
+			"currency",
+		),
+		transferFailures: r.NewCounterVec(
+			"pwsrv_transfers_failed_total",
+			"Number of failed transfer attempts by reason.",
+			"reason",
+		),
+		transferAmount: r.NewCounterVec(
+			"pwsrv_transfer_amount_total",
+			"Sum of created transfers by currency.",
+			"currency",
+		),
+	}
+}
+
+// Requests - histogram of HTTP requests duration.
+func (m *Metrics) Requests() *metrics.HistogramVec {
+	return m.requests
+}
+
+// Panics - counter of recovered panics.
+func (m *Metrics) Panics() *metrics.CounterVec {
+	return m.panics
+}
+
+func (m *Metrics) login(outcome model.AuditOutcome) {
+	m.logins.Inc(string(outcome))
+}
+
+func (m *Metrics) registration(outcome model.AuditOutcome) {
+	m.registrations.Inc(string(outcome))
+}
+
+func (m *Metrics) transferCreated(t *model.InternalTransfer) {
+	m.transfers.Inc(string(t.Currency))
+	m.transferAmount.Add(t.Sum, string(t.Currency))
+}
+
+func (m *Metrics) transferFailed(reason string) {
+	m.transferFailures.Inc(reason)
+}
@@ -0,0 +1,165 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+)
+
+// Formats of the access log
+const (
+	// AccessLogCommon - Apache common log format
+	AccessLogCommon = "common"
+	// AccessLogCombined - Apache combined log format
+	AccessLogCombined = "combined"
+	// AccessLogJSON - one JSON object per request with all known details
+	AccessLogJSON = "json"
+)
+
+// accessDetails - details of the request known only inside the router,
+// they are supplied by AccessDetails middleware for the access log
+type accessDetails struct {
+	route  string
+	userID uint64
+}
+
+// accessRecord - JSON record of the access log
+type accessRecord struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"request_id,omitempty"`
+	ClientIP  string    `json:"client_ip"`
+	UserID    uint64    `json:"user_id,omitempty"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route,omitempty"`
+	URI       string    `json:"uri"`
+	Proto     string    `json:"proto"`
+	Status    int       `json:"status"`
+	Bytes     int64     `json:"bytes"`
+	Latency   float64   `json:"latency_ms"`
+	Referer   string    `json:"referer,omitempty"`
+	UserAgent string    `json:"user_agent,omitempty"`
+}
+
+// IsAccessLogFormat - checks the access log format is supported.
+func IsAccessLogFormat(format string) bool {
+	return format == AccessLogCommon || format == AccessLogCombined || format == AccessLogJSON
+}
+
+// AccessLog - generates middleware which writes a record about every request into the writer.
+// It must wrap the router, which uses AccessDetails middleware to supply route template and user ID.
+func AccessLog(w io.Writer, format string) func(http.Handler) http.Handler {
+	if w == nil {
+		panic(errors.New("middleware.AccessLog: writer is nil"))
+	}
+	if !IsAccessLogFormat(format) {
+		panic(fmt.Errorf("middleware.AccessLog: unsupported format %q", format))
+	}
+	mu := sync.Mutex{}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			details := &accessDetails{}
+			sw := &statusWriter{ResponseWriter: rw}
+			next.ServeHTTP(sw, r.WithContext(context.WithValue(r.Context(), accessDetailsKey, details)))
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			rec := accessRecord{
+				Time:      start,
+				RequestID: r.Header.Get(api.HeaderRequestID),
+				ClientIP:  ClientIP(r, nil),
+				UserID:    details.userID,
+				Method:    r.Method,
+				Route:     details.route,
+				URI:       r.RequestURI,
+				Proto:     r.Proto,
+				Status:    sw.status,
+				Bytes:     sw.bytes,
+				Latency:   float64(time.Since(start).Microseconds()) / 1000,
+				Referer:   r.Referer(),
+				UserAgent: r.UserAgent(),
+			}
+			line := formatAccessRecord(format, &rec)
+			mu.Lock()
+			io.WriteString(w, line)
+			mu.Unlock()
+		})
+	}
+}
+
+// AccessDetails - generates router middleware which supplies the access log with route template and user ID.
+func AccessDetails() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if details, ok := r.Context().Value(accessDetailsKey).(*accessDetails); ok {
+				if route := mux.CurrentRoute(r); route != nil {
+					details.route, _ = route.GetPathTemplate()
+				}
+				details.userID, _ = DiscoverUserID(r)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func formatAccessRecord(format string, rec *accessRecord) string {
+	if format == AccessLogJSON {
+		b, err := json.Marshal(rec)
+		if err != nil {
+			return ""
+		}
+		return string(b) + "\n"
+	}
+	user := "-"
+	if rec.UserID != 0 {
+		user = strconv.FormatUint(rec.UserID, 10)
+	}
+	size := "-"
+	if rec.Bytes > 0 {
+		size = strconv.FormatInt(rec.Bytes, 10)
+	}
+	line := fmt.Sprintf(
+		"%s - %s [%s] \"%s %s %s\" %d %s",
+		rec.ClientIP,
+		user,
+		rec.Time.Format("02/Jan/2006:15:04:05 -0700"),
+		escapeAccessValue(rec.Method),
+		escapeAccessValue(rec.URI),
+		escapeAccessValue(rec.Proto),
+		rec.Status,
+		size,
+	)
+	if format == AccessLogCombined {
+		line += fmt.Sprintf(" \"%s\" \"%s\"", escapeAccessValue(rec.Referer), escapeAccessValue(rec.UserAgent))
+	}
+	return line + "\n"
+}
+
+// escapeAccessValue - escapes quotes, backslashes and non-printable characters in the way Apache does.
+func escapeAccessValue(s string) string {
+	b := strings.Builder{}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			fmt.Fprintf(&b, "\\x%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,103 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+)
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := RequestID()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = r.Header.Get(api.HeaderRequestID)
+	}))
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(api.HeaderRequestID, "client-id.1")
+	h.ServeHTTP(w, r)
+	if seen != "client-id.1" || w.Header().Get(api.HeaderRequestID) != "client-id.1" {
+		t.Errorf("Valid request ID is not propagated: %q, %q", seen, w.Header().Get(api.HeaderRequestID))
+	}
+
+	w, r = httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil)
+	r.Header.Set(api.HeaderRequestID, "bad id\n")
+	h.ServeHTTP(w, r)
+	if len(seen) != 32 || seen != w.Header().Get(api.HeaderRequestID) {
+		t.Errorf("Request ID is not generated: %q, %q", seen, w.Header().Get(api.HeaderRequestID))
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	trusted, err := ParseTrustedProxies([]string{"10.0.0.0/8", "192.168.1.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		remote, forwarded, expected string
+	}{
+		{"203.0.113.5:1234", "", "203.0.113.5"},
+		// untrusted peer can not spoof the client
+		{"203.0.113.5:1234", "198.51.100.1", "203.0.113.5"},
+		{"10.1.2.3:1234", "198.51.100.1", "198.51.100.1"},
+		// the last untrusted hop is the client, values before it are given by the client
+		{"10.1.2.3:1234", "1.1.1.1, 198.51.100.1, 192.168.1.1", "198.51.100.1"},
+		{"10.1.2.3:1234", "garbage, 10.0.0.2", "10.0.0.2"},
+		{"10.1.2.3:1234", "", "10.1.2.3"},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = c.remote
+		if c.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", c.forwarded)
+		}
+		if actual := ClientIP(r, trusted); actual != c.expected {
+			t.Errorf("Unexpected client IP for %q via %q: %q, expected %q", c.forwarded, c.remote, actual, c.expected)
+		}
+	}
+	if _, err := ParseTrustedProxies([]string{"10.0.0.0/33"}); err == nil {
+		t.Error("Invalid network is accepted")
+	}
+}
+
+func TestAccessLog(t *testing.T) {
+	router := mux.NewRouter()
+	router.Use(AccessDetails())
+	router.NewRoute().
+		Path("/users/{id:[0-9]+}/").
+		HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusConflict)
+			w.Write([]byte("conflict"))
+		})
+
+	buf := bytes.Buffer{}
+	h := AccessLog(&buf, AccessLogJSON)(router)
+	r := httptest.NewRequest("GET", "/users/7/?x=1", nil)
+	r.Header.Set(api.HeaderRequestID, "abc")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	rec := accessRecord{}
+	if err := json.Unmarshal(buf.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Route != "/users/{id:[0-9]+}/" || rec.URI != "/users/7/?x=1" || rec.Status != http.StatusConflict ||
+		rec.Bytes != 8 || rec.RequestID != "abc" || rec.ClientIP != "192.0.2.1" {
+		t.Errorf("Unexpected JSON record: %+v", rec)
+	}
+
+	buf.Reset()
+	h = AccessLog(&buf, AccessLogCombined)(router)
+	r = httptest.NewRequest("GET", "/missing", nil)
+	r.Header.Set("User-Agent", `agent "quoted"`)
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	line := buf.String()
+	if !strings.HasPrefix(line, "192.0.2.1 - - [") ||
+		!strings.HasSuffix(line, `] "GET /missing HTTP/1.1" 404 19 "" "agent \"quoted\""`+"\n") {
+		t.Errorf("Unexpected combined record: %q", line)
+	}
+}
@@ -0,0 +1,41 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// AuditDenied - generates middleware which appends to audit log every request of the authenticated user
+// rejected with Unauthorized or Forbidden status. Anonymous requests are not recorded,
+// so garbage tokens can not flood the hash chain; they are still seen in access log and request metrics.
+func AuditDenied(rec audit.Recorder) func(http.Handler) http.Handler {
+	if rec == nil {
+		panic(errors.New("middleware.AuditDenied: audit.Recorder is nil"))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			action := ""
+			switch sw.status {
+			case http.StatusUnauthorized:
+				action = audit.AccessUnauthorized
+			case http.StatusForbidden:
+				action = audit.AccessDenied
+			default:
+				return
+			}
+			userID, ok := DiscoverUserID(r)
+			if !ok || userID == 0 {
+				return
+			}
+			_, err := rec.AppendAuditEntry(audit.NewEntry(r, userID, action, r.Method+" "+r.URL.Path, model.AuditDenied))
+			if err != nil {
+				Logger(r).Error("Audit error", "error", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,58 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+type memoryRecorder struct {
+	entries []model.AuditEntry
+}
+
+func (r *memoryRecorder) AppendAuditEntry(e model.AuditEntry) (*model.AuditEntry, error) {
+	r.entries = append(r.entries, e)
+	return &e, nil
+}
+
+func TestAuditDenied(t *testing.T) {
+	cases := []struct {
+		userID uint64
+		status int
+		action string
+	}{
+		{0, http.StatusUnauthorized, ""},
+		{0, http.StatusForbidden, ""},
+		{7, http.StatusOK, ""},
+		{7, http.StatusNotFound, ""},
+		{7, http.StatusUnauthorized, audit.AccessUnauthorized},
+		{7, http.StatusForbidden, audit.AccessDenied},
+	}
+	for _, c := range cases {
+		rec := &memoryRecorder{}
+		h := AuditDenied(rec)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(c.status)
+		}))
+		r := httptest.NewRequest("GET", "/admin/audit/", nil)
+		if c.userID > 0 {
+			r = r.WithContext(context.WithValue(r.Context(), userIDKey, c.userID))
+		}
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if c.action == "" {
+			if len(rec.entries) != 0 {
+				t.Errorf("User #%d, status %d: unexpected audit entries %+v", c.userID, c.status, rec.entries)
+			}
+			continue
+		}
+		if len(rec.entries) != 1 ||
+			rec.entries[0].ActorID != c.userID ||
+			rec.entries[0].Action != c.action ||
+			rec.entries[0].Outcome != model.AuditDenied {
+			t.Errorf("User #%d, status %d: unexpected audit entries %+v", c.userID, c.status, rec.entries)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/core/reply"
+)
+
+// MaxBodySize - generates middleware which rejects requests having body larger than limit
+// with "413. Request entity too large" response. Body of unknown length is read in advance
+// up to the limit, so handlers never get a partial body.
+func MaxBodySize(limit int64) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch {
+			case r.ContentLength > limit:
+				reply.RequestEntityTooLarge()(w, r)
+				return
+			case r.ContentLength < 0 && r.Body != nil && r.Body != http.NoBody:
+				body, err := io.ReadAll(io.LimitReader(r.Body, limit+1))
+				if err != nil {
+					reply.BadRequest("Can't read request body")(w, r)
+					return
+				}
+				if int64(len(body)) > limit {
+					w.Header().Set("Connection", "close")
+					reply.RequestEntityTooLarge()(w, r)
+					return
+				}
+				r.Body, r.ContentLength = io.NopCloser(bytes.NewReader(body)), int64(len(body))
+			case r.Body != nil:
+				r.Body = http.MaxBytesReader(w, r.Body, limit)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,39 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMaxBodySize(t *testing.T) {
+	var received string
+	h := MaxBodySize(8)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := io.ReadAll(r.Body)
+		received = string(b)
+	}))
+	cases := []struct {
+		body          string
+		contentLength int64
+		status        int
+	}{
+		{"12345678", 8, http.StatusOK},
+		{"123456789", 9, http.StatusRequestEntityTooLarge},
+		{"12345678", -1, http.StatusOK},
+		{"123456789", -1, http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		received = ""
+		w, r := httptest.NewRecorder(), httptest.NewRequest("POST", "/", strings.NewReader(c.body))
+		r.ContentLength = c.contentLength
+		h.ServeHTTP(w, r)
+		if w.Code != c.status {
+			t.Errorf("Unexpected status for %q (%d): %d", c.body, c.contentLength, w.Code)
+		}
+		if c.status == http.StatusOK && received != c.body {
+			t.Errorf("Body is not passed: %q", received)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/tracing"
+)
+
+// RequestLogger - generates middleware which supplies request context with logger
+// having request ID, trace ID and authorized user ID fields.
+func RequestLogger(l *slog.Logger) func(http.Handler) http.Handler {
+	if l == nil {
+		panic(errors.New("middleware.RequestLogger: logger is nil"))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			rl := l
+			if requestID := r.Header.Get(api.HeaderRequestID); requestID != "" {
+				rl = rl.With("request_id", requestID)
+			}
+			if span := tracing.SpanFromContext(r.Context()); span != nil {
+				sc := span.Context()
+				rl = rl.With("trace_id", sc.TraceID.String(), "span_id", sc.SpanID.String())
+			}
+			if userID, ok := DiscoverUserID(r); ok {
+				rl = rl.With("user_id", userID)
+			}
+			next.ServeHTTP(w, r.WithContext(logging.WithContext(r.Context(), rl)))
+		})
+	}
+}
+
+// Logger - returns logger of the request supplied by RequestLogger or discarding one.
+func Logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context(), logging.Discard())
+}
@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/metrics"
+)
+
+// Metrics - generates router middleware which observes duration of requests
+// into histogram labeled with route template, method and status.
+func Metrics(h *metrics.HistogramVec) func(http.Handler) http.Handler {
+	if h == nil {
+		panic(errors.New("middleware.Metrics: histogram is nil"))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r)
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			route := ""
+			if current := mux.CurrentRoute(r); current != nil {
+				route, _ = current.GetPathTemplate()
+			}
+			h.Observe(time.Since(start).Seconds(), route, r.Method, strconv.Itoa(sw.status))
+		})
+	}
+}
@@ -14,6 +14,7 @@ type contextKey int
 const (
 	_ contextKey = iota
 	userIDKey
+	accessDetailsKey
 )
 
 type (
@@ -22,8 +23,6 @@ type (
 	}
 )
 
-// TODO Add SupplyRecovery middleware to handle panics inside end-points.
-
 // AuthorizationTryout - generates middleware which attempts to supply user from Authorization header.
 func AuthorizationTryout(b TokenDiscoverer) func(http.Handler) http.Handler {
 	if b == nil {
@@ -0,0 +1,61 @@
+package middleware
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/metrics"
+)
+
+// SupplyRecovery - generates middleware which recovers panics inside end-points;
+// the panic is logged with stack and counted by route template,
+// client gets JSON error response if nothing was written yet, otherwise the response is aborted.
+func SupplyRecovery(l *slog.Logger, panics *metrics.CounterVec) func(http.Handler) http.Handler {
+	if l == nil {
+		panic(errors.New("middleware.SupplyRecovery: logger is nil"))
+	}
+	if panics == nil {
+		panic(errors.New("middleware.SupplyRecovery: counter is nil"))
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: w}
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+				if v == http.ErrAbortHandler {
+					// intentional abort, http.Server handles it silently
+					panic(v)
+				}
+				route := ""
+				if current := mux.CurrentRoute(r); current != nil {
+					route, _ = current.GetPathTemplate()
+				}
+				panics.Inc(route)
+				l.Error(
+					"Panic recovered",
+					"request_id", r.Header.Get(api.HeaderRequestID),
+					"method", r.Method,
+					"route", route,
+					"panic", fmt.Sprint(v),
+					"stack", string(debug.Stack()),
+				)
+				if sw.status != 0 {
+					// response is partially sent, abort it to not look like complete one
+					panic(http.ErrAbortHandler)
+				}
+				reply.InternalServerError("Cannot complete request now")(sw, r)
+			}()
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
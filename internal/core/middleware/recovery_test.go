@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/metrics"
+)
+
+func TestSupplyRecovery(t *testing.T) {
+	logs := bytes.Buffer{}
+	reg := metrics.NewRegistry()
+	panics := reg.NewCounterVec("panics_total", "Panics.", "route")
+	r := mux.NewRouter()
+	r.Use(SupplyRecovery(slog.New(slog.NewJSONHandler(&logs, nil)), panics))
+	r.Path("/fail/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var m map[string]int
+		m["boom"]++
+	})
+	r.Path("/partial/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("{"))
+		panic("boom")
+	})
+
+	w, req := httptest.NewRecorder(), httptest.NewRequest("GET", "/fail/", nil)
+	req.Header.Set(api.HeaderRequestID, "req-1")
+	w.Header().Set(api.HeaderRequestID, "req-1")
+	r.ServeHTTP(w, req)
+	e := api.ErrorResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil || w.Code != http.StatusInternalServerError || !e.Error || e.RequestID != "req-1" {
+		t.Errorf("Unexpected response %d: %+v", w.Code, e)
+	}
+	if !strings.Contains(logs.String(), `"request_id":"req-1"`) || !strings.Contains(logs.String(), "assignment to entry in nil map") ||
+		!strings.Contains(logs.String(), "TestSupplyRecovery") {
+		t.Errorf("Panic is not logged with stack: %s", logs.String())
+	}
+
+	func() {
+		defer func() {
+			if v := recover(); v != http.ErrAbortHandler {
+				t.Errorf("Partial response is not aborted: %v", v)
+			}
+		}()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/partial/", nil))
+	}()
+
+	buf := bytes.Buffer{}
+	reg.WriteTo(&buf)
+	if !strings.Contains(buf.String(), `panics_total{route="/fail/"} 1`) || !strings.Contains(buf.String(), `panics_total{route="/partial/"} 1`) {
+		t.Errorf("Panics are not counted: %s", buf.String())
+	}
+}
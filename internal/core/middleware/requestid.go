@@ -0,0 +1,53 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/api"
+)
+
+// MaxRequestIDLen - longer request ID given by client is replaced with generated one
+const MaxRequestIDLen = 128
+
+// RequestID - generates middleware which propagates valid X-Request-ID of the request or assigns new one;
+// ID is set both to the request and response headers.
+func RequestID() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(api.HeaderRequestID)
+			if !isValidRequestID(id) {
+				id = newRequestID()
+				r.Header.Set(api.HeaderRequestID, id)
+			}
+			w.Header().Set(api.HeaderRequestID, id)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// isValidRequestID - accepts non-empty ID of letters, digits and "-_.:" only,
+// so it is safe to write it into logs.
+func isValidRequestID(id string) bool {
+	if id == "" || len(id) > MaxRequestIDLen {
+		return false
+	}
+	for _, c := range id {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(b)
+}
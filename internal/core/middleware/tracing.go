@@ -0,0 +1,60 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/tracing"
+)
+
+// Tracing - generates router middleware which records server span of every request,
+// continuing the trace given with traceparent header. ID of the trace is returned in X-Trace-ID header.
+// Nil tracer disables tracing.
+func Tracing(t *tracing.Tracer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if t == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			if parent, ok := tracing.ParseTraceparent(r.Header.Get(tracing.HeaderTraceparent)); ok {
+				ctx = tracing.ContextWithRemote(ctx, parent)
+			}
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				route, _ = current.GetPathTemplate()
+			}
+			ctx, span := t.Start(ctx, r.Method+" "+route, tracing.SpanKindServer)
+			defer span.End()
+			span.SetAttribute("http.request.method", r.Method)
+			span.SetAttribute("http.route", route)
+			span.SetAttribute("url.path", r.URL.Path)
+			if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+				span.SetAttribute("client.address", host)
+			}
+			if requestID := r.Header.Get(api.HeaderRequestID); requestID != "" {
+				span.SetAttribute("http.request.header.x-request-id", requestID)
+			}
+			w.Header().Set(api.HeaderTraceID, span.Context().TraceID.String())
+
+			sw := &statusWriter{ResponseWriter: w}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+			if sw.status == 0 {
+				sw.status = http.StatusOK
+			}
+			span.SetAttribute("http.response.status_code", sw.status)
+			if sw.status >= http.StatusInternalServerError {
+				span.SetError(statusError(sw.status))
+			}
+		})
+	}
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
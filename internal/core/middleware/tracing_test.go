@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/tracing"
+)
+
+func TestTracing(t *testing.T) {
+	buf := bytes.Buffer{}
+	tracer := tracing.NewTracer(tracing.NewFileExporter(&buf, "test"))
+	r := mux.NewRouter()
+	r.Use(Tracing(tracer))
+	r.Path("/users/{id}/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if tracing.SpanFromContext(r.Context()) == nil {
+			t.Error("Span is not in the request context")
+		}
+		reply.InternalServerError("Failed")(w, r)
+	})
+
+	w, req := httptest.NewRecorder(), httptest.NewRequest("GET", "/users/1/", nil)
+	req.Header.Set(tracing.HeaderTraceparent, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	r.ServeHTTP(w, req)
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if w.Header().Get(api.HeaderTraceID) != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Trace is not continued: %q", w.Header().Get(api.HeaderTraceID))
+	}
+	e := api.ErrorResponse{}
+	if err := json.NewDecoder(w.Body).Decode(&e); err != nil || e.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Error response has no trace ID: %+v", e)
+	}
+	if !strings.Contains(buf.String(), `"name":"GET /users/{id}/"`) || !strings.Contains(buf.String(), `"code":2`) {
+		t.Errorf("Unexpected span: %s", buf.String())
+	}
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/core/reply"
+)
+
+// StrictTransportSecurity - generates middleware which sets HSTS header to responses of TLS requests,
+// so browsers use HTTPS only for given duration.
+func StrictTransportSecurity(maxAge time.Duration) func(http.Handler) http.Handler {
+	value := fmt.Sprintf("max-age=%d", int64(maxAge.Seconds()))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS != nil {
+				w.Header().Set("Strict-Transport-Security", value)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientCertificateRequired - generates middleware which rejects requests without verified client certificate
+// with Forbidden status.
+func ClientCertificateRequired() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.TLS == nil || len(r.TLS.VerifiedChains) == 0 {
+				reply.Forbidden("Client certificate required")(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
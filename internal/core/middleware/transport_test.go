@@ -0,0 +1,32 @@
+package middleware
+
+import (
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTransportSecurity(t *testing.T) {
+	h := StrictTransportSecurity(24 * time.Hour)(ClientCertificateRequired()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})))
+
+	w, r := httptest.NewRecorder(), httptest.NewRequest("GET", "http://localhost/admin/", nil)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Strict-Transport-Security") != "" {
+		t.Errorf("Unexpected response of plain HTTP request: %d, %q", w.Code, w.Header().Get("Strict-Transport-Security"))
+	}
+
+	w, r = httptest.NewRecorder(), httptest.NewRequest("GET", "https://localhost/admin/", nil)
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusForbidden || w.Header().Get("Strict-Transport-Security") != "max-age=86400" {
+		t.Errorf("Unexpected response without client certificate: %d, %q", w.Code, w.Header().Get("Strict-Transport-Security"))
+	}
+
+	w, r = httptest.NewRecorder(), httptest.NewRequest("GET", "https://localhost/admin/", nil)
+	r.TLS.VerifiedChains = [][]*x509.Certificate{{{}}}
+	h.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		t.Errorf("Request with client certificate is rejected: %d", w.Code)
+	}
+}
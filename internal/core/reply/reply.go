@@ -10,32 +10,37 @@ import (
 
 // ServiceUnavailable - returns http-handler to make "503. Service unavailable" error response.
 func ServiceUnavailable() http.HandlerFunc {
-	return jsonContent(http.StatusServiceUnavailable, &api.ErrorResponse{true, "Service unavailable"})
+	return jsonContent(http.StatusServiceUnavailable, &api.ErrorResponse{Error: true, Message: "Service unavailable"})
 }
 
 // BadRequest - returns http-handler to make bad request (400) response with custom error messsage.
 func BadRequest(msg string) http.HandlerFunc {
-	return jsonContent(http.StatusBadRequest, &api.ErrorResponse{true, msg})
+	return jsonContent(http.StatusBadRequest, &api.ErrorResponse{Error: true, Message: msg})
 }
 
 // Unauthorized - returns http-handler to make "401. Unauthorized" error response.
 func Unauthorized() http.HandlerFunc {
-	return jsonContent(http.StatusUnauthorized, &api.ErrorResponse{true, "Unauthorized"})
+	return jsonContent(http.StatusUnauthorized, &api.ErrorResponse{Error: true, Message: "Unauthorized"})
 }
 
 // Forbidden - returns http-handler to make forbidden (403) error response.
 func Forbidden(msg string) http.HandlerFunc {
-	return jsonContent(http.StatusForbidden, &api.ErrorResponse{true, msg})
+	return jsonContent(http.StatusForbidden, &api.ErrorResponse{Error: true, Message: msg})
+}
+
+// RequestEntityTooLarge - returns http-handler to make "413. Request entity too large" error response.
+func RequestEntityTooLarge() http.HandlerFunc {
+	return jsonContent(http.StatusRequestEntityTooLarge, &api.ErrorResponse{Error: true, Message: "Request entity too large"})
 }
 
 // Conflict - returns http-handler to make conflict (409) response with custom error message.
 func Conflict(msg string) http.HandlerFunc {
-	return jsonContent(http.StatusConflict, &api.ErrorResponse{true, msg})
+	return jsonContent(http.StatusConflict, &api.ErrorResponse{Error: true, Message: msg})
 }
 
 // InternalServerError - returns http-handler to make server error (500) response with custom error message.
 func InternalServerError(msg string) http.HandlerFunc {
-	return jsonContent(http.StatusInternalServerError, &api.ErrorResponse{true, msg})
+	return jsonContent(http.StatusInternalServerError, &api.ErrorResponse{Error: true, Message: msg})
 }
 
 // OK - returns a handler to reply the successful (200) request processing.
@@ -44,10 +49,20 @@ func OK(data interface{}) http.HandlerFunc {
 }
 
 // jsonContent - returns http handler to respond any given data with specified http-status code.
+// Error response is supplied with request and trace IDs, if they were assigned for the response.
 func jsonContent(status int, data interface{}) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		content := data
+		if e, ok := data.(*api.ErrorResponse); ok {
+			requestID, traceID := w.Header().Get(api.HeaderRequestID), w.Header().Get(api.HeaderTraceID)
+			if requestID != "" || traceID != "" {
+				withID := *e
+				withID.RequestID, withID.TraceID = requestID, traceID
+				content = &withID
+			}
+		}
 		w.Header().Set("Content-Type", "application/json; charset=utf-8")
 		w.WriteHeader(status)
-		json.NewEncoder(w).Encode(&data)
+		json.NewEncoder(w).Encode(&content)
 	}
 }
@@ -2,34 +2,63 @@ package core
 
 import (
 	"errors"
+	"log/slog"
 	"net/http"
 	"strconv"
 
 	"github.com/wtask/pwsrv/internal/core/reply"
 
 	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/audit"
 	"github.com/wtask/pwsrv/internal/core/middleware"
+	"github.com/wtask/pwsrv/internal/tracing"
 
 	"github.com/gorilla/mux"
 )
 
-// NewRouter - initializes router and returns http.Handler interface based on it.
-func NewRouter(service api.HTTPService, d middleware.TokenDiscoverer) http.Handler {
+// NewRouter - initializes router and returns http.Handler interface based on it;
+// tracer is optional, nil tracer disables tracing of requests.
+func NewRouter(service api.HTTPService, d middleware.TokenDiscoverer, rec audit.Recorder, l *slog.Logger, m *Metrics, t *tracing.Tracer) http.Handler {
 	if service == nil {
 		panic(errors.New("core.NewRouter: api.HTTPService is nil"))
 	}
 	if d == nil {
 		panic(errors.New("core.NewRouter: middleware.TokenDiscoverer is nil"))
 	}
+	if rec == nil {
+		panic(errors.New("core.NewRouter: audit.Recorder is nil"))
+	}
+	if l == nil {
+		panic(errors.New("core.NewRouter: logger is nil"))
+	}
+	if m == nil {
+		panic(errors.New("core.NewRouter: Metrics is nil"))
+	}
 
 	r := mux.NewRouter()
+	r.Use(middleware.SupplyRecovery(l, m.Panics()))
+	r.Use(middleware.Tracing(t))
+	r.Use(middleware.Metrics(m.Requests()))
 	r.Use(middleware.AuthorizationTryout(d))
+	r.Use(middleware.AccessDetails())
+	r.Use(middleware.RequestLogger(l))
+	r.Use(middleware.AuditDenied(rec))
 
 	r.NewRoute().
 		Path("/").
 		Methods("OPTIONS").
 		HandlerFunc(service.Options())
 
+	r.NewRoute().
+		Path("/healthz").
+		Methods("GET"). // liveness probe
+		HandlerFunc(service.Liveness())
+
+	r.NewRoute().
+		Path("/readyz").
+		Methods("GET"). // readiness probe
+		HandlerFunc(service.Readiness())
+
 	r.NewRoute().
 		Path("/login/").
 		Methods("POST").
@@ -40,6 +69,41 @@ func NewRouter(service api.HTTPService, d middleware.TokenDiscoverer) http.Handl
 		Methods("POST").
 		HandlerFunc(service.Register())
 
+	{
+		events := r.PathPrefix("/events/").Subrouter()
+		events.Use(middleware.AuthorizationRequired())
+
+		events.NewRoute().
+			Path("/").
+			Methods("GET"). // Server-Sent Events stream of authorized user
+			HandlerFunc(service.EventStream())
+	}
+
+	{
+		webhooks := r.PathPrefix("/webhooks/").Subrouter()
+		webhooks.Use(middleware.AuthorizationRequired())
+
+		webhooks.NewRoute().
+			Path("/").
+			Methods("POST").
+			HandlerFunc(service.CreateWebhook())
+
+		webhooks.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.WebhookList())
+
+		webhooks.NewRoute().
+			Path("/{id:[0-9]+}/").
+			Methods("DELETE").
+			HandlerFunc(withID(service.DeleteWebhookByID))
+
+		webhooks.NewRoute().
+			Path("/{id:[0-9]+}/deliveries/").
+			Methods("GET"). // delivery log
+			HandlerFunc(withID(service.WebhookDeliveryList))
+	}
+
 	{
 		users := r.PathPrefix("/users/").Subrouter()
 		users.Use(middleware.AuthorizationRequired())
@@ -69,6 +133,11 @@ func NewRouter(service api.HTTPService, d middleware.TokenDiscoverer) http.Handl
 			Methods("POST"). // create internal money transfer (IMT)
 			HandlerFunc(service.CreateIMT())
 
+		transfers.NewRoute().
+			Path("/batch/").
+			Methods("POST"). // create IMT for every item of JSON list
+			HandlerFunc(service.CreateIMTBatch())
+
 		transfers.NewRoute().
 			Path("/").
 			Methods("GET"). // get list of IMT
@@ -85,6 +154,201 @@ func NewRouter(service api.HTTPService, d middleware.TokenDiscoverer) http.Handl
 			HandlerFunc(withID(service.GetIMTCensoredByID))
 	}
 
+	{
+		wallets := r.PathPrefix("/money/wallets/").Subrouter()
+		wallets.Use(middleware.AuthorizationRequired())
+
+		wallets.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.WalletList())
+
+		wallets.NewRoute().
+			Path("/").
+			Methods("POST"). // open new wallet
+			HandlerFunc(service.OpenWallet())
+
+		wallets.NewRoute().
+			Path("/{currency:[A-Z]+}/").
+			Methods("GET"). // wallet balance and history
+			HandlerFunc(withString("currency", service.GetWalletByCurrency))
+	}
+
+	{
+		holds := r.PathPrefix("/money/holds/").Subrouter()
+		holds.Use(middleware.AuthorizationRequired())
+
+		holds.NewRoute().
+			Path("/").
+			Methods("POST"). // reserve funds for recipient
+			HandlerFunc(service.CreateHold())
+
+		holds.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.HoldList())
+
+		holds.NewRoute().
+			Path("/{id:[0-9]+}/").
+			Methods("GET").
+			HandlerFunc(withID(service.GetHoldByID))
+
+		holds.NewRoute().
+			Path("/{id:[0-9]+}/capture/").
+			Methods("POST"). // recipient only: transfer reserved funds
+			HandlerFunc(withID(service.CaptureHoldByID))
+
+		holds.NewRoute().
+			Path("/{id:[0-9]+}/release/").
+			Methods("POST"). // payer or recipient: cancel reservation
+			HandlerFunc(withID(service.ReleaseHoldByID))
+	}
+
+	{
+		escrows := r.PathPrefix("/money/escrows/").Subrouter()
+		escrows.Use(middleware.AuthorizationRequired())
+
+		escrows.NewRoute().
+			Path("/").
+			Methods("POST"). // put money in escrow for recipient
+			HandlerFunc(service.CreateEscrow())
+
+		escrows.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.EscrowList())
+
+		escrows.NewRoute().
+			Path("/{id:[0-9]+}/").
+			Methods("GET").
+			HandlerFunc(withID(service.GetEscrowByID))
+
+		escrows.NewRoute().
+			Path("/{id:[0-9]+}/confirm/").
+			Methods("POST"). // sender only: confirm delivery
+			HandlerFunc(withID(service.ConfirmEscrowByID))
+
+		escrows.NewRoute().
+			Path("/{id:[0-9]+}/release/").
+			Methods("POST"). // recipient only: return money to sender
+			HandlerFunc(withID(service.ReleaseEscrowByID))
+
+		escrows.NewRoute().
+			Path("/{id:[0-9]+}/dispute/").
+			Methods("POST"). // any party: open dispute
+			HandlerFunc(withID(service.DisputeEscrowByID))
+	}
+
+	{
+		splits := r.PathPrefix("/money/splits/").Subrouter()
+		splits.Use(middleware.AuthorizationRequired())
+
+		splits.NewRoute().
+			Path("/").
+			Methods("POST"). // split total between participants
+			HandlerFunc(service.CreateSplit())
+
+		splits.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.SplitList())
+
+		splits.NewRoute().
+			Path("/{id:[0-9]+}/").
+			Methods("GET"). // split with settlement status of every participant
+			HandlerFunc(withID(service.GetSplitByID))
+
+		splits.NewRoute().
+			Path("/{id:[0-9]+}/cancel/").
+			Methods("POST"). // requester only
+			HandlerFunc(withID(service.CancelSplitByID))
+	}
+
+	{
+		requests := r.PathPrefix("/money/requests/").Subrouter()
+		requests.Use(middleware.AuthorizationRequired())
+
+		requests.NewRoute().
+			Path("/").
+			Methods("GET"). // incoming payment requests
+			HandlerFunc(service.PaymentRequestList())
+
+		requests.NewRoute().
+			Path("/{id:[0-9]+}/").
+			Methods("GET").
+			HandlerFunc(withID(service.GetPaymentRequestByID))
+
+		requests.NewRoute().
+			Path("/{id:[0-9]+}/pay/").
+			Methods("POST"). // payer only
+			HandlerFunc(withID(service.PayPaymentRequestByID))
+
+		requests.NewRoute().
+			Path("/{id:[0-9]+}/decline/").
+			Methods("POST"). // payer only
+			HandlerFunc(withID(service.DeclinePaymentRequestByID))
+	}
+
+	{
+		conversions := r.PathPrefix("/money/conversions/").Subrouter()
+		conversions.Use(middleware.AuthorizationRequired())
+
+		conversions.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.ConversionList())
+
+		conversions.NewRoute().
+			Path("/").
+			Methods("POST"). // convert funds between own wallets
+			HandlerFunc(service.CreateConversion())
+	}
+
+	{
+		rates := r.PathPrefix("/money/rates/").Subrouter()
+		rates.Use(middleware.AuthorizationRequired())
+
+		rates.NewRoute().
+			Path("/").
+			Methods("GET").
+			HandlerFunc(service.ExchangeRateList())
+
+		rates.NewRoute().
+			Path("/").
+			Methods("POST"). // admin only: set exchange rate
+			HandlerFunc(service.SetExchangeRate())
+	}
+
+	{
+		admin := r.PathPrefix("/admin/").Subrouter()
+		admin.Use(middleware.AuthorizationRequired())
+
+		admin.NewRoute().
+			Path("/escrows/").
+			Methods("GET"). // escrows by status, disputed by default
+			HandlerFunc(service.AdminEscrowList())
+
+		admin.NewRoute().
+			Path("/escrows/{id:[0-9]+}/resolve/").
+			Methods("POST").
+			HandlerFunc(withID(service.ResolveEscrowByID))
+
+		admin.NewRoute().
+			Path("/audit/").
+			Methods("GET"). // audit log filtered by actor_id, action, outcome, since, until, before_id
+			HandlerFunc(service.AuditLog())
+
+		admin.NewRoute().
+			Path("/audit/verify/").
+			Methods("GET"). // check hash chain of the audit log
+			HandlerFunc(service.VerifyAuditLog())
+
+		admin.NewRoute().
+			Path("/status/").
+			Methods("GET"). // version, build info, uptime and dependency checks
+			HandlerFunc(service.Status())
+	}
+
 	return r
 }
 
@@ -3,16 +3,21 @@ package core
 import (
 	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
+	"time"
 
+	"github.com/wtask/pwsrv/internal/audit"
 	"github.com/wtask/pwsrv/internal/core/middleware"
 
 	"github.com/wtask/pwsrv/internal/core/reply"
 
 	"github.com/wtask/pwsrv/pkg/email"
 
+	"github.com/wtask/pwsrv/internal/logging"
 	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/notify"
 
 	"github.com/wtask/pwsrv/internal/api"
 )
@@ -23,39 +28,119 @@ type (
 		GetUserByEmailAndPassword(address, password string) (*model.User, error)
 		CreateUser(user model.User, password string) (*model.User, error)
 		FindUsersHavePrefix(prefix string, limit int) ([]model.User, error)
-		CreateInternalTransfer(userID, recipientID uint64, sum float64) (*model.InternalTransfer, error)
+		FindUsersByIDs(ids []uint64) ([]model.User, error)
+		CreateInternalTransfer(
+			userID, recipientID uint64,
+			currency model.Currency,
+			sum float64,
+			memo string,
+		) (*model.InternalTransfer, error)
+		CreateInternalTransferBatch(
+			userID uint64,
+			currency model.Currency,
+			orders []model.TransferOrder,
+		) ([]model.InternalTransfer, error)
 		RepeatInternalTransfer(transferID uint64) (*model.InternalTransfer, error)
 		GetInternalTransferByID(transferID uint64) (*model.InternalTransfer, error)
-		FindLastInternalTransfers(userID uint64, limit int) ([]model.InternalTransfer, error)
+		FindLastInternalTransfers(userID uint64, currency model.Currency, limit int) ([]model.InternalTransfer, error)
+		GetUserWallets(userID uint64) ([]model.Wallet, error)
+		CreateWallet(userID uint64, currency model.Currency) (*model.Wallet, error)
+		GetExchangeRates() ([]model.ExchangeRate, error)
+		SetExchangeRate(from, to model.Currency, rate float64) (*model.ExchangeRate, error)
+		ConvertFunds(userID uint64, from, to model.Currency, sum float64) (*model.Conversion, error)
+		FindLastConversions(userID uint64, currency model.Currency, limit int) ([]model.Conversion, error)
+		CreateHold(
+			userID, recipientID uint64,
+			currency model.Currency,
+			sum float64,
+			expiresAt time.Time,
+		) (*model.Hold, error)
+		GetHoldByID(holdID uint64) (*model.Hold, error)
+		FindLastHolds(userID uint64, limit int) ([]model.Hold, error)
+		CaptureHold(holdID uint64, sum float64) (*model.Hold, *model.InternalTransfer, error)
+		ReleaseHold(holdID uint64) (*model.Hold, error)
+		ExpireHolds(now time.Time) ([]model.Hold, error)
+		CreateEscrow(e model.Escrow) (*model.Escrow, error)
+		GetEscrowByID(escrowID uint64) (*model.Escrow, error)
+		FindLastEscrows(userID uint64, limit int) ([]model.Escrow, error)
+		FindEscrowsByStatus(status model.EscrowStatus, limit int) ([]model.Escrow, error)
+		ChangeEscrowStatus(escrowID uint64, status model.EscrowStatus, actorID uint64, note string) (*model.Escrow, error)
+		ExpireEscrows(now time.Time) ([]model.Escrow, error)
+		CreateSplit(split model.Split, requests []model.PaymentRequest) (*model.Split, []model.PaymentRequest, error)
+		GetSplitByID(splitID uint64) (*model.Split, error)
+		FindLastSplits(userID uint64, limit int) ([]model.Split, error)
+		CancelSplit(splitID uint64) (*model.Split, error)
+		GetPaymentRequestByID(requestID uint64) (*model.PaymentRequest, error)
+		FindPaymentRequestsBySplit(splitID uint64) ([]model.PaymentRequest, error)
+		FindLastPaymentRequests(payerID uint64, limit int) ([]model.PaymentRequest, error)
+		PayPaymentRequest(requestID uint64) (*model.PaymentRequest, *model.InternalTransfer, error)
+		DeclinePaymentRequest(requestID uint64) (*model.PaymentRequest, error)
+		CreateWebhookSubscription(sub model.WebhookSubscription) (*model.WebhookSubscription, error)
+		GetWebhookSubscriptionByID(subscriptionID uint64) (*model.WebhookSubscription, error)
+		FindWebhookSubscriptions(userID uint64) ([]model.WebhookSubscription, error)
+		DeactivateWebhookSubscription(subscriptionID uint64) error
+		FindLastWebhookDeliveries(subscriptionID uint64, limit int) ([]model.WebhookDelivery, error)
+		AppendAuditEntry(e model.AuditEntry) (*model.AuditEntry, error)
+		FindAuditEntries(f audit.Filter, limit int) ([]model.AuditEntry, error)
+		ReadAuditChain(afterID uint64, limit int) ([]model.AuditEntry, error)
 	}
 
 	TokenProvider interface {
 		NewToken(userID uint64) string
 	}
+
+	// EventBus - delivers events to connected users
+	EventBus interface {
+		Publish(userID uint64, kind string, data interface{})
+		Subscribe(userID uint64, lastEventID string) (*notify.Subscription, bool)
+	}
 )
 
 // service - HTTPService interface implementation
 type service struct {
 	r Repository
 	b TokenProvider
+	e EventBus
+	l *slog.Logger
+	m *Metrics
+	h HealthMonitor
 }
 
 // NewHTTPService - builds api.HTTPService interface implementation.
-func NewHTTPService(r Repository, b TokenProvider) (api.HTTPService, error) {
+func NewHTTPService(r Repository, b TokenProvider, e EventBus, l *slog.Logger, m *Metrics, h HealthMonitor) (api.HTTPService, error) {
 	if r == nil {
 		return nil, errors.New("NewHTTPService(): Repository is nil")
 	}
 	if b == nil {
 		return nil, errors.New("NewHTTPService(): TokenProvider is nil")
 	}
+	if e == nil {
+		return nil, errors.New("NewHTTPService(): EventBus is nil")
+	}
+	if l == nil {
+		return nil, errors.New("NewHTTPService(): logger is nil")
+	}
+	if m == nil {
+		return nil, errors.New("NewHTTPService(): Metrics is nil")
+	}
+	if h == nil {
+		return nil, errors.New("NewHTTPService(): HealthMonitor is nil")
+	}
 	return &service{
 		r: r,
 		b: b,
+		e: e,
+		l: l,
+		m: m,
+		h: h,
 	}, nil
 }
 
 const (
 	MinPasswordLen = 5
+	MaxMemoLen     = 255
+	// WelcomeBalance - balance of default currency wallet of new user
+	WelcomeBalance = 500.0
 )
 
 func (s *service) Options() http.HandlerFunc {
@@ -78,25 +163,35 @@ func (s *service) Login() http.HandlerFunc {
 			reply.BadRequest("Invalid login, valid email address expected")(w, r)
 			return
 		}
-		user, err := s.r.GetUserByEmailAndPassword(a.Get(), password)
+		user, err := s.repo(r).GetUserByEmailAndPassword(a.Get(), password)
 		if err != nil {
-			// TODO log repo error
+			s.logger(r).Error("Repository error", "method", "GetUserByEmailAndPassword", "error", err)
 			reply.InternalServerError("Cannot complete request now")(w, r)
 			return
 		}
 		if user == nil {
+			s.m.login(model.AuditFailure)
+			s.audit(r, 0, audit.UserLogin, a.Get(), model.AuditFailure)
 			reply.Conflict("Unable to authorize with given credentials")(w, r)
 			return
 
 		}
+		if user.Frozen {
+			s.m.login(model.AuditDenied)
+			s.audit(r, user.ID, audit.UserLogin, a.Get(), model.AuditDenied)
+			reply.Forbidden("User is frozen")(w, r)
+			return
+		}
 		token := s.b.NewToken(user.ID)
 		if token == "" {
-			// TODO log bearer error
+			s.logger(r).Error("Bearer error", "reason", "empty token", "subject", user.ID)
 			reply.InternalServerError("Cannot prepare authorization token now")(w, r)
 			return
 		}
+		s.m.login(model.AuditSuccess)
+		s.audit(r, user.ID, audit.UserLogin, a.Get(), model.AuditSuccess)
 
-		reply.OK(&api.LoginResponse{fmt.Sprintf("Bearer %s", token)})(w, r)
+		reply.OK(&api.LoginResponse{Auth: fmt.Sprintf("Bearer %s", token)})(w, r)
 	}
 }
 
@@ -126,21 +221,28 @@ func (s *service) Register() http.HandlerFunc {
 			reply.BadRequest("Required name is empty")(w, r)
 			return
 		}
-		user, err := s.r.CreateUser(
+		user, err := s.repo(r).CreateUser(
 			model.User{
-				Email:   login,
-				Name:    name,
-				Role:    model.RoleRegular,
-				Balance: 500.0,
+				Email: login,
+				Name:  name,
+				Role:  model.RoleRegular,
+				Wallets: []model.Wallet{
+					{Currency: model.DefaultCurrency, Balance: WelcomeBalance},
+				},
 			},
 			password,
 		)
 		if err != nil || user == nil {
+			s.logger(r).Error("Repository error", "method", "CreateUser", "error", err)
+			s.m.registration(model.AuditFailure)
+			s.audit(r, 0, audit.UserRegister, login, model.AuditFailure)
 			reply.InternalServerError("Cannot complete request")(w, r)
 			return
 		}
+		s.m.registration(model.AuditSuccess)
+		s.audit(r, user.ID, audit.UserRegister, login, model.AuditSuccess)
 		token := s.b.NewToken(user.ID)
-		reply.OK(&api.RegisterResponse{fmt.Sprintf("Bearer %s", token)})(w, r)
+		reply.OK(&api.RegisterResponse{Auth: fmt.Sprintf("Bearer %s", token)})(w, r)
 	}
 }
 
@@ -163,8 +265,9 @@ func (s *service) UserListHavePrefix(prefix string) http.HandlerFunc {
 			return
 		}
 
-		list, err := s.r.FindUsersHavePrefix(prefix, 100)
+		list, err := s.repo(r).FindUsersHavePrefix(prefix, 100)
 		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindUsersHavePrefix", "error", err)
 			reply.InternalServerError("Cannot complete request now")(w, r)
 			return
 		}
@@ -188,8 +291,9 @@ func (s *service) GetUserByID(id uint64) http.HandlerFunc {
 				reply.Forbidden("Insufficient authority to complete request")(w, r)
 				return
 			}
-			user, err := s.r.GetUserByID(id)
+			user, err := s.repo(r).GetUserByID(id)
 			if err != nil {
+				s.logger(r).Error("Repository error", "method", "GetUserByID", "error", err)
 				reply.InternalServerError("Cannot complete request now")(w, r)
 				return
 			}
@@ -222,14 +326,20 @@ func (s *service) IMTCensoredList() http.HandlerFunc {
 			reply.Unauthorized()(w, r)
 			return
 		}
-		transfers, err := s.r.FindLastInternalTransfers(authUser.ID, 100)
+		currency := model.Currency(r.URL.Query().Get("currency"))
+		if currency != "" && !currency.IsValid() {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		transfers, err := s.repo(r).FindLastInternalTransfers(authUser.ID, currency, 100)
 		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastInternalTransfers", "error", err)
 			reply.InternalServerError("Cannot complete request")(w, r)
 			return
 		}
 		censored := make([]*api.IMTCensored, len(transfers))
 		for i := range transfers {
-			censored[i] = censorInternalTransfer(authUser.ID, &transfers[i])
+			censored[i] = CensorInternalTransfer(authUser.ID, &transfers[i])
 		}
 		reply.OK(&api.IMTCensoredListResponse{Transactions: censored})(w, r)
 	}
@@ -242,8 +352,9 @@ func (s *service) GetIMTCensoredByID(id uint64) http.HandlerFunc {
 			reply.Unauthorized()(w, r)
 			return
 		}
-		transfer, err := s.r.GetInternalTransferByID(id)
+		transfer, err := s.repo(r).GetInternalTransferByID(id)
 		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetInternalTransferByID", "error", err)
 			reply.InternalServerError("Cannot complete request")(w, r)
 			return
 		}
@@ -256,7 +367,7 @@ func (s *service) GetIMTCensoredByID(id uint64) http.HandlerFunc {
 			return
 		}
 		reply.OK(&api.GetIMTCensoredResponse{
-			Transaction: censorInternalTransfer(authUser.ID, transfer),
+			Transaction: CensorInternalTransfer(authUser.ID, transfer),
 		})(w, r)
 	}
 }
@@ -269,39 +380,70 @@ func (s *service) CreateIMT() http.HandlerFunc {
 			return
 		}
 		if authUser.Role < model.RoleTrusted {
+			s.m.transferFailed(TransferFailedForbidden)
 			reply.Forbidden("Insufficient authority to complete request")(w, r)
 			return
 		}
 		if err := r.ParseForm(); err != nil {
+			s.m.transferFailed(TransferFailedInvalid)
 			reply.BadRequest("Can't parse post data")(w, r)
 			return
 		}
 		recipientID, err := strconv.ParseUint(r.Form.Get("recipient_id"), 10, 64)
 		if err != nil || recipientID == 0 || recipientID == authUser.ID {
+			s.m.transferFailed(TransferFailedInvalid)
 			reply.BadRequest("Invalid recipient ID")(w, r)
 			return
 		}
-		if recipient, _ := s.r.GetUserByID(recipientID); recipient == nil {
+		if recipient, _ := s.repo(r).GetUserByID(recipientID); recipient == nil {
+			s.m.transferFailed(TransferFailedNoRecipient)
 			reply.Conflict("Recipient not found")(w, r)
 			return
 		}
 
 		sum, err := strconv.ParseFloat(r.Form.Get("sum"), 10)
 		if err != nil || sum <= 0.0 {
+			s.m.transferFailed(TransferFailedInvalid)
 			reply.BadRequest("Incorrect sum")(w, r)
 			return
 		}
 
-		if authUser.Balance-sum < 0.0 {
-			reply.Conflict(fmt.Sprintf("Insufficient funds (%f)", authUser.Balance))(w, r)
+		currency, ok := formCurrency(r, "currency")
+		if !ok {
+			s.m.transferFailed(TransferFailedInvalid)
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		wallet := authUser.Wallet(currency)
+		if wallet == nil {
+			s.m.transferFailed(TransferFailedNoWallet)
+			reply.Conflict(fmt.Sprintf("No %s wallet", currency))(w, r)
+			return
+		}
+		if wallet.Available-sum < 0.0 {
+			s.m.transferFailed(TransferFailedInsufficientFunds)
+			s.audit(r, authUser.ID, audit.TransferCreate, fmt.Sprintf("user #%d", recipientID), model.AuditFailure)
+			reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, currency))(w, r)
+			return
+		}
+
+		memo := r.Form.Get("memo")
+		if len(memo) > MaxMemoLen {
+			s.m.transferFailed(TransferFailedInvalid)
+			reply.BadRequest(fmt.Sprintf("Memo length must not exceed %d", MaxMemoLen))(w, r)
 			return
 		}
 
-		transfer, err := s.r.CreateInternalTransfer(authUser.ID, recipientID, sum)
+		transfer, err := s.repo(r).CreateInternalTransfer(authUser.ID, recipientID, currency, sum, memo)
 		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "CreateInternalTransfer", "error", err)
+			s.m.transferFailed(TransferFailedRejected)
+			s.audit(r, authUser.ID, audit.TransferCreate, fmt.Sprintf("user #%d", recipientID), model.AuditFailure)
 			reply.Conflict(fmt.Sprintf("Cannot transfer money to #%d", recipientID))(w, r)
 			return
 		}
+		s.audit(r, authUser.ID, audit.TransferCreate, fmt.Sprintf("transfer #%d", transfer.ID), model.AuditSuccess)
+		s.notifyTransfer(s.repo(r), transfer)
 		reply.OK(&api.CreateIMTResponse{ID: transfer.ID})(w, r)
 	}
 }
@@ -317,8 +459,9 @@ func (s *service) RepeatIMTByID(id uint64) http.HandlerFunc {
 			reply.BadRequest("Invalid transfer ID")(w, r)
 			return
 		}
-		transfer, err := s.r.GetInternalTransferByID(id)
+		transfer, err := s.repo(r).GetInternalTransferByID(id)
 		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetInternalTransferByID", "error", err)
 			reply.InternalServerError("Cannot complete request now")(w, r)
 			return
 		}
@@ -327,26 +470,51 @@ func (s *service) RepeatIMTByID(id uint64) http.HandlerFunc {
 			return
 		}
 		if transfer.UserID != authUser.ID {
+			s.m.transferFailed(TransferFailedForbidden)
 			reply.Forbidden("Insufficient authority to repeat transfer")(w, r)
 			return
 		}
-		newTransfer, err := s.r.RepeatInternalTransfer(transfer.ID)
+		newTransfer, err := s.repo(r).RepeatInternalTransfer(transfer.ID)
 		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "RepeatInternalTransfer", "error", err)
+			s.m.transferFailed(TransferFailedRejected)
+			s.audit(r, authUser.ID, audit.TransferRepeat, fmt.Sprintf("transfer #%d", id), model.AuditFailure)
 			reply.Conflict(fmt.Sprintf("Cannot repeat transfer #%d", id))(w, r)
 			return
 		}
+		s.audit(r, authUser.ID, audit.TransferRepeat, fmt.Sprintf("transfer #%d", newTransfer.ID), model.AuditSuccess)
+		s.notifyTransfer(s.repo(r), newTransfer)
 		reply.OK(&api.RepeatIMTResponse{ID: newTransfer.ID})(w, r)
 	}
 }
 
+// formCurrency - reads currency code from the parsed form,
+// default currency is used if the form value is empty.
+func formCurrency(r *http.Request, key string) (model.Currency, bool) {
+	c := model.Currency(r.Form.Get(key))
+	if c == "" {
+		return model.DefaultCurrency, true
+	}
+	return c, c.IsValid()
+}
+
 func (s *service) authorize(r *http.Request) (auth *model.User, ok bool) {
 	userID, ok := middleware.DiscoverUserID(r)
 	if !ok || userID == 0 {
 		return nil, false
 	}
-	user, err := s.r.GetUserByID(userID)
+	user, err := s.repo(r).GetUserByID(userID)
 	if err != nil {
+		s.logger(r).Error("Repository error", "method", "GetUserByID", "error", err)
+		return nil, false
+	}
+	if user == nil || user.Frozen {
 		return nil, false
 	}
 	return user, true
 }
+
+// logger - returns logger of the request or service logger.
+func (s *service) logger(r *http.Request) *slog.Logger {
+	return logging.FromContext(r.Context(), s.l)
+}
@@ -0,0 +1,364 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	// MaxSplitParticipants - max number of participants of the single split bill
+	MaxSplitParticipants = 50
+)
+
+// splitRequests - validates split request of the requester and calculates payment requests of participants;
+// returns non-empty message for the invalid request.
+// Equal shares are calculated in cents, the remainder is spread over first participants.
+func splitRequests(requesterID uint64, req *api.CreateSplitRequest) ([]model.PaymentRequest, string) {
+	if req.Currency == "" {
+		req.Currency = string(model.DefaultCurrency)
+	}
+	if !model.Currency(req.Currency).IsValid() {
+		return nil, "Invalid currency"
+	}
+	if req.Total <= 0.0 {
+		return nil, "Incorrect total"
+	}
+	if len(req.Memo) > MaxMemoLen {
+		return nil, fmt.Sprintf("Memo length must not exceed %d", MaxMemoLen)
+	}
+	n := len(req.Participants)
+	if n == 0 || n > MaxSplitParticipants {
+		return nil, fmt.Sprintf("Number of participants must be between 1 and %d", MaxSplitParticipants)
+	}
+	custom := false
+	seen := map[uint64]bool{}
+	for i, p := range req.Participants {
+		if p.UserID == 0 || p.UserID == requesterID || seen[p.UserID] {
+			return nil, fmt.Sprintf("Participant %d: invalid or duplicate user ID", i)
+		}
+		seen[p.UserID] = true
+		if p.Share < 0.0 {
+			return nil, fmt.Sprintf("Participant %d: incorrect share", i)
+		}
+		custom = custom || p.Share > 0.0
+	}
+
+	requests := make([]model.PaymentRequest, n)
+	if custom {
+		sum := 0.0
+		for i, p := range req.Participants {
+			if p.Share <= 0.0 {
+				return nil, fmt.Sprintf("Participant %d: share is required", i)
+			}
+			sum += p.Share
+			requests[i] = model.PaymentRequest{PayerID: p.UserID, Sum: p.Share, Memo: req.Memo}
+		}
+		const epsilon = 0.005
+		if sum > req.Total+epsilon || (!req.IncludeSelf && math.Abs(sum-req.Total) > epsilon) {
+			return nil, "Shares do not match total"
+		}
+		return requests, ""
+	}
+
+	parts := int64(n)
+	if req.IncludeSelf {
+		parts++
+	}
+	cents := int64(math.Round(req.Total * 100))
+	base, rest := cents/parts, cents%parts
+	if base == 0 {
+		return nil, "Total is too small to split"
+	}
+	for i, p := range req.Participants {
+		share := base
+		if int64(i) < rest {
+			share++
+		}
+		requests[i] = model.PaymentRequest{PayerID: p.UserID, Sum: float64(share) / 100, Memo: req.Memo}
+	}
+	return requests, ""
+}
+
+func (s *service) SplitList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		splits, err := s.repo(r).FindLastSplits(authUser.ID, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastSplits", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.SplitListResponse{Splits: splits})(w, r)
+	}
+}
+
+func (s *service) GetSplitByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		split, err := s.repo(r).GetSplitByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetSplitByID", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		if split == nil {
+			reply.Conflict("Split not found")(w, r)
+			return
+		}
+		requests, err := s.repo(r).FindPaymentRequestsBySplit(split.ID)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindPaymentRequestsBySplit", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		allowed := split.UserID == authUser.ID
+		for i := 0; !allowed && i < len(requests); i++ {
+			allowed = requests[i].PayerID == authUser.ID
+		}
+		if !allowed {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		split.Status = splitStatus(split.Status, requests)
+		reply.OK(&api.SplitResponse{Split: split, Requests: requests})(w, r)
+	}
+}
+
+// splitStatus - status of the open split by its payment requests; splits declined
+// before the declined status was introduced are stored as open.
+func splitStatus(status model.SplitStatus, requests []model.PaymentRequest) model.SplitStatus {
+	if status != model.SplitOpen || len(requests) == 0 {
+		return status
+	}
+	declined := false
+	for _, pr := range requests {
+		switch pr.Status {
+		case model.PaymentRequestPending:
+			return status
+		case model.PaymentRequestDeclined:
+			declined = true
+		}
+	}
+	if declined {
+		return model.SplitDeclined
+	}
+	return model.SplitSettled
+}
+
+// CreateSplit - splits total between participants and sends payment request to each of them.
+func (s *service) CreateSplit() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		req := api.CreateSplitRequest{}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			reply.BadRequest("Can't parse split data")(w, r)
+			return
+		}
+		requests, msg := splitRequests(authUser.ID, &req)
+		if msg != "" {
+			reply.BadRequest(msg)(w, r)
+			return
+		}
+		ids := make([]uint64, len(requests))
+		for i := range requests {
+			ids[i] = requests[i].PayerID
+		}
+		participants, err := s.repo(r).FindUsersByIDs(ids)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindUsersByIDs", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if len(participants) != len(ids) {
+			reply.Conflict("Participant not found")(w, r)
+			return
+		}
+		split, requests, err := s.repo(r).CreateSplit(
+			model.Split{
+				UserID:   authUser.ID,
+				Currency: model.Currency(req.Currency),
+				Total:    req.Total,
+				Memo:     req.Memo,
+			},
+			requests,
+		)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "CreateSplit", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		reply.OK(&api.SplitResponse{Split: split, Requests: requests})(w, r)
+	}
+}
+
+func (s *service) CancelSplitByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		split, err := s.repo(r).GetSplitByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetSplitByID", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if split == nil {
+			reply.Conflict("Split not found")(w, r)
+			return
+		}
+		if split.UserID != authUser.ID {
+			reply.Forbidden("Insufficient authority to cancel split")(w, r)
+			return
+		}
+		if split.Status != model.SplitOpen {
+			reply.Conflict(fmt.Sprintf("Split is %s", split.Status))(w, r)
+			return
+		}
+		split, err = s.repo(r).CancelSplit(split.ID)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "CancelSplit", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot cancel split #%d", id))(w, r)
+			return
+		}
+		requests, err := s.repo(r).FindPaymentRequestsBySplit(split.ID)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindPaymentRequestsBySplit", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.SplitResponse{Split: split, Requests: requests})(w, r)
+	}
+}
+
+func (s *service) PaymentRequestList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		requests, err := s.repo(r).FindLastPaymentRequests(authUser.ID, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastPaymentRequests", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.PaymentRequestListResponse{Requests: requests})(w, r)
+	}
+}
+
+func (s *service) GetPaymentRequestByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		pr, err := s.repo(r).GetPaymentRequestByID(id)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetPaymentRequestByID", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		if pr == nil {
+			reply.Conflict("Payment request not found")(w, r)
+			return
+		}
+		if pr.PayerID != authUser.ID && pr.RequesterID != authUser.ID {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		reply.OK(&api.PaymentRequestResponse{Request: pr})(w, r)
+	}
+}
+
+// pendingPaymentRequest - returns pending payment request addressed to the authorized user
+// or replies an error and returns nil.
+func (s *service) pendingPaymentRequest(id uint64, w http.ResponseWriter, r *http.Request) (*model.User, *model.PaymentRequest) {
+	authUser, ok := s.authorize(r)
+	if !ok {
+		reply.Unauthorized()(w, r)
+		return nil, nil
+	}
+	pr, err := s.repo(r).GetPaymentRequestByID(id)
+	if err != nil {
+		s.logger(r).Error("Repository error", "method", "GetPaymentRequestByID", "error", err)
+		reply.InternalServerError("Cannot complete request now")(w, r)
+		return nil, nil
+	}
+	if pr == nil {
+		reply.Conflict("Payment request not found")(w, r)
+		return nil, nil
+	}
+	if pr.PayerID != authUser.ID {
+		reply.Forbidden("Insufficient authority to respond payment request")(w, r)
+		return nil, nil
+	}
+	if pr.Status != model.PaymentRequestPending {
+		reply.Conflict(fmt.Sprintf("Payment request is %s", pr.Status))(w, r)
+		return nil, nil
+	}
+	return authUser, pr
+}
+
+func (s *service) PayPaymentRequestByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, pr := s.pendingPaymentRequest(id, w, r)
+		if pr == nil {
+			return
+		}
+		wallet := authUser.Wallet(pr.Currency)
+		if wallet == nil {
+			reply.Conflict(fmt.Sprintf("No %s wallet", pr.Currency))(w, r)
+			return
+		}
+		if wallet.Available-pr.Sum < 0.0 {
+			reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, pr.Currency))(w, r)
+			return
+		}
+		pr, transfer, err := s.repo(r).PayPaymentRequest(pr.ID)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "PayPaymentRequest", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot pay request #%d", id))(w, r)
+			return
+		}
+		s.notifyTransfer(s.repo(r), transfer)
+		reply.OK(&api.PaymentRequestResponse{Request: pr})(w, r)
+	}
+}
+
+func (s *service) DeclinePaymentRequestByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		_, pr := s.pendingPaymentRequest(id, w, r)
+		if pr == nil {
+			return
+		}
+		pr, err := s.repo(r).DeclinePaymentRequest(pr.ID)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "DeclinePaymentRequest", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot decline request #%d", id))(w, r)
+			return
+		}
+		reply.OK(&api.PaymentRequestResponse{Request: pr})(w, r)
+	}
+}
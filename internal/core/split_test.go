@@ -0,0 +1,130 @@
+package core
+
+import (
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func TestSplitRequests(t *testing.T) {
+	cases := []struct {
+		req    api.CreateSplitRequest
+		shares []float64
+	}{
+		{
+			api.CreateSplitRequest{Total: 90, Participants: []api.SplitParticipant{{UserID: 2}, {UserID: 3}}},
+			[]float64{45, 45},
+		},
+		{
+			api.CreateSplitRequest{
+				Total:        90,
+				IncludeSelf:  true,
+				Participants: []api.SplitParticipant{{UserID: 2}, {UserID: 3}},
+			},
+			[]float64{30, 30},
+		},
+		{
+			// remainder of cents goes to first participants
+			api.CreateSplitRequest{Total: 1, Participants: []api.SplitParticipant{{UserID: 2}, {UserID: 3}, {UserID: 4}}},
+			[]float64{0.34, 0.33, 0.33},
+		},
+		{
+			api.CreateSplitRequest{
+				Total:        100,
+				Participants: []api.SplitParticipant{{UserID: 2, Share: 70}, {UserID: 3, Share: 30}},
+			},
+			[]float64{70, 30},
+		},
+		{
+			// requester pays the rest
+			api.CreateSplitRequest{
+				Total:        100,
+				IncludeSelf:  true,
+				Participants: []api.SplitParticipant{{UserID: 2, Share: 10}, {UserID: 3, Share: 20}},
+			},
+			[]float64{10, 20},
+		},
+		// invalid requests
+		{api.CreateSplitRequest{Total: 100}, nil},
+		{api.CreateSplitRequest{Total: 0, Participants: []api.SplitParticipant{{UserID: 2}}}, nil},
+		{api.CreateSplitRequest{Currency: "pw", Total: 1, Participants: []api.SplitParticipant{{UserID: 2}}}, nil},
+		{api.CreateSplitRequest{Total: 1, Participants: []api.SplitParticipant{{UserID: 1}}}, nil},
+		{api.CreateSplitRequest{Total: 1, Participants: []api.SplitParticipant{{UserID: 2}, {UserID: 2}}}, nil},
+		{api.CreateSplitRequest{Total: 0.01, Participants: []api.SplitParticipant{{UserID: 2}, {UserID: 3}}}, nil},
+		{
+			// shares exceed total
+			api.CreateSplitRequest{
+				Total:        100,
+				IncludeSelf:  true,
+				Participants: []api.SplitParticipant{{UserID: 2, Share: 70}, {UserID: 3, Share: 40}},
+			},
+			nil,
+		},
+		{
+			// shares must match total if requester is not a participant
+			api.CreateSplitRequest{
+				Total:        100,
+				Participants: []api.SplitParticipant{{UserID: 2, Share: 70}, {UserID: 3, Share: 20}},
+			},
+			nil,
+		},
+		{
+			// custom shares must be given for every participant
+			api.CreateSplitRequest{
+				Total:        100,
+				Participants: []api.SplitParticipant{{UserID: 2, Share: 100}, {UserID: 3}},
+			},
+			nil,
+		},
+	}
+	for i, c := range cases {
+		requests, msg := splitRequests(1, &c.req)
+		if c.shares == nil {
+			if msg == "" {
+				t.Errorf("Case %d: expected validation error", i)
+			}
+			continue
+		}
+		if msg != "" {
+			t.Errorf("Case %d: unexpected validation error %q", i, msg)
+			continue
+		}
+		if len(requests) != len(c.shares) {
+			t.Errorf("Case %d: unexpected number of requests %d", i, len(requests))
+			continue
+		}
+		for j, pr := range requests {
+			if pr.PayerID != c.req.Participants[j].UserID || pr.Sum != c.shares[j] {
+				t.Errorf("Case %d: unexpected request %d: payer #%d, sum %f", i, j, pr.PayerID, pr.Sum)
+			}
+		}
+	}
+}
+
+func TestSplitStatus(t *testing.T) {
+	requests := func(statuses ...model.PaymentRequestStatus) []model.PaymentRequest {
+		prs := []model.PaymentRequest{}
+		for _, s := range statuses {
+			prs = append(prs, model.PaymentRequest{Status: s})
+		}
+		return prs
+	}
+	cases := []struct {
+		status   model.SplitStatus
+		requests []model.PaymentRequest
+		expected model.SplitStatus
+	}{
+		{model.SplitOpen, requests(model.PaymentRequestPending, model.PaymentRequestDeclined), model.SplitOpen},
+		{model.SplitOpen, requests(model.PaymentRequestPaid, model.PaymentRequestDeclined), model.SplitDeclined},
+		{model.SplitOpen, requests(model.PaymentRequestDeclined), model.SplitDeclined},
+		{model.SplitOpen, requests(model.PaymentRequestPaid, model.PaymentRequestPaid), model.SplitSettled},
+		{model.SplitDeclined, requests(model.PaymentRequestPaid, model.PaymentRequestDeclined), model.SplitDeclined},
+		{model.SplitCancelled, requests(model.PaymentRequestPaid, model.PaymentRequestCancelled), model.SplitCancelled},
+	}
+	for i, c := range cases {
+		if status := splitStatus(c.status, c.requests); status != c.expected {
+			t.Errorf("Case %d: unexpected status %q, expected %q", i, status, c.expected)
+		}
+	}
+}
@@ -0,0 +1,417 @@
+package core
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/tracing"
+)
+
+// ContextRepository - Repository which can be bound to the context of the request,
+// so its calls are traced within the request trace.
+type ContextRepository interface {
+	Repository
+	WithContext(ctx context.Context) Repository
+}
+
+// repo - returns repository bound to the context of the request if it is supported.
+func (s *service) repo(r *http.Request) Repository {
+	if cr, ok := s.r.(ContextRepository); ok {
+		return cr.WithContext(r.Context())
+	}
+	return s.r
+}
+
+// TraceRepository - wraps repository to record span of every call;
+// repository is returned as is if tracer is nil.
+func TraceRepository(r Repository, t *tracing.Tracer) Repository {
+	if r == nil || t == nil {
+		return r
+	}
+	return &tracedRepository{next: r, t: t, ctx: context.Background()}
+}
+
+// tracedRepository - ContextRepository implementation recording span of every call
+type tracedRepository struct {
+	next Repository
+	t    *tracing.Tracer
+	ctx  context.Context
+}
+
+func (tr *tracedRepository) WithContext(ctx context.Context) Repository {
+	bound := *tr
+	bound.ctx = ctx
+	return &bound
+}
+
+// start - starts span of the method and returns repository to call, which is bound to the span if possible.
+func (tr *tracedRepository) start(method string) (Repository, *tracing.Span) {
+	ctx, span := tr.t.Start(tr.ctx, "Repository."+method, tracing.SpanKindInternal)
+	if cr, ok := tr.next.(ContextRepository); ok {
+		return cr.WithContext(ctx), span
+	}
+	return tr.next, span
+}
+
+func (tr *tracedRepository) GetUserByID(userID uint64) (*model.User, error) {
+	next, span := tr.start("GetUserByID")
+	r0, err := next.GetUserByID(userID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetUserByEmailAndPassword(address, password string) (*model.User, error) {
+	next, span := tr.start("GetUserByEmailAndPassword")
+	r0, err := next.GetUserByEmailAndPassword(address, password)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateUser(user model.User, password string) (*model.User, error) {
+	next, span := tr.start("CreateUser")
+	r0, err := next.CreateUser(user, password)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindUsersHavePrefix(prefix string, limit int) ([]model.User, error) {
+	next, span := tr.start("FindUsersHavePrefix")
+	r0, err := next.FindUsersHavePrefix(prefix, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindUsersByIDs(ids []uint64) ([]model.User, error) {
+	next, span := tr.start("FindUsersByIDs")
+	r0, err := next.FindUsersByIDs(ids)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateInternalTransfer(userID, recipientID uint64, currency model.Currency, sum float64, memo string) (*model.InternalTransfer, error) {
+	next, span := tr.start("CreateInternalTransfer")
+	r0, err := next.CreateInternalTransfer(userID, recipientID, currency, sum, memo)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateInternalTransferBatch(userID uint64, currency model.Currency, orders []model.TransferOrder) ([]model.InternalTransfer, error) {
+	next, span := tr.start("CreateInternalTransferBatch")
+	r0, err := next.CreateInternalTransferBatch(userID, currency, orders)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) RepeatInternalTransfer(transferID uint64) (*model.InternalTransfer, error) {
+	next, span := tr.start("RepeatInternalTransfer")
+	r0, err := next.RepeatInternalTransfer(transferID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetInternalTransferByID(transferID uint64) (*model.InternalTransfer, error) {
+	next, span := tr.start("GetInternalTransferByID")
+	r0, err := next.GetInternalTransferByID(transferID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastInternalTransfers(userID uint64, currency model.Currency, limit int) ([]model.InternalTransfer, error) {
+	next, span := tr.start("FindLastInternalTransfers")
+	r0, err := next.FindLastInternalTransfers(userID, currency, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetUserWallets(userID uint64) ([]model.Wallet, error) {
+	next, span := tr.start("GetUserWallets")
+	r0, err := next.GetUserWallets(userID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateWallet(userID uint64, currency model.Currency) (*model.Wallet, error) {
+	next, span := tr.start("CreateWallet")
+	r0, err := next.CreateWallet(userID, currency)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetExchangeRates() ([]model.ExchangeRate, error) {
+	next, span := tr.start("GetExchangeRates")
+	r0, err := next.GetExchangeRates()
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) SetExchangeRate(from, to model.Currency, rate float64) (*model.ExchangeRate, error) {
+	next, span := tr.start("SetExchangeRate")
+	r0, err := next.SetExchangeRate(from, to, rate)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) ConvertFunds(userID uint64, from, to model.Currency, sum float64) (*model.Conversion, error) {
+	next, span := tr.start("ConvertFunds")
+	r0, err := next.ConvertFunds(userID, from, to, sum)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastConversions(userID uint64, currency model.Currency, limit int) ([]model.Conversion, error) {
+	next, span := tr.start("FindLastConversions")
+	r0, err := next.FindLastConversions(userID, currency, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateHold(userID, recipientID uint64, currency model.Currency, sum float64, expiresAt time.Time) (*model.Hold, error) {
+	next, span := tr.start("CreateHold")
+	r0, err := next.CreateHold(userID, recipientID, currency, sum, expiresAt)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetHoldByID(holdID uint64) (*model.Hold, error) {
+	next, span := tr.start("GetHoldByID")
+	r0, err := next.GetHoldByID(holdID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastHolds(userID uint64, limit int) ([]model.Hold, error) {
+	next, span := tr.start("FindLastHolds")
+	r0, err := next.FindLastHolds(userID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CaptureHold(holdID uint64, sum float64) (*model.Hold, *model.InternalTransfer, error) {
+	next, span := tr.start("CaptureHold")
+	r0, r1, err := next.CaptureHold(holdID, sum)
+	span.SetError(err)
+	span.End()
+	return r0, r1, err
+}
+
+func (tr *tracedRepository) ReleaseHold(holdID uint64) (*model.Hold, error) {
+	next, span := tr.start("ReleaseHold")
+	r0, err := next.ReleaseHold(holdID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) ExpireHolds(now time.Time) ([]model.Hold, error) {
+	next, span := tr.start("ExpireHolds")
+	r0, err := next.ExpireHolds(now)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateEscrow(e model.Escrow) (*model.Escrow, error) {
+	next, span := tr.start("CreateEscrow")
+	r0, err := next.CreateEscrow(e)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetEscrowByID(escrowID uint64) (*model.Escrow, error) {
+	next, span := tr.start("GetEscrowByID")
+	r0, err := next.GetEscrowByID(escrowID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastEscrows(userID uint64, limit int) ([]model.Escrow, error) {
+	next, span := tr.start("FindLastEscrows")
+	r0, err := next.FindLastEscrows(userID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindEscrowsByStatus(status model.EscrowStatus, limit int) ([]model.Escrow, error) {
+	next, span := tr.start("FindEscrowsByStatus")
+	r0, err := next.FindEscrowsByStatus(status, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) ChangeEscrowStatus(escrowID uint64, status model.EscrowStatus, actorID uint64, note string) (*model.Escrow, error) {
+	next, span := tr.start("ChangeEscrowStatus")
+	r0, err := next.ChangeEscrowStatus(escrowID, status, actorID, note)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) ExpireEscrows(now time.Time) ([]model.Escrow, error) {
+	next, span := tr.start("ExpireEscrows")
+	r0, err := next.ExpireEscrows(now)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateSplit(split model.Split, requests []model.PaymentRequest) (*model.Split, []model.PaymentRequest, error) {
+	next, span := tr.start("CreateSplit")
+	r0, r1, err := next.CreateSplit(split, requests)
+	span.SetError(err)
+	span.End()
+	return r0, r1, err
+}
+
+func (tr *tracedRepository) GetSplitByID(splitID uint64) (*model.Split, error) {
+	next, span := tr.start("GetSplitByID")
+	r0, err := next.GetSplitByID(splitID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastSplits(userID uint64, limit int) ([]model.Split, error) {
+	next, span := tr.start("FindLastSplits")
+	r0, err := next.FindLastSplits(userID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CancelSplit(splitID uint64) (*model.Split, error) {
+	next, span := tr.start("CancelSplit")
+	r0, err := next.CancelSplit(splitID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetPaymentRequestByID(requestID uint64) (*model.PaymentRequest, error) {
+	next, span := tr.start("GetPaymentRequestByID")
+	r0, err := next.GetPaymentRequestByID(requestID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindPaymentRequestsBySplit(splitID uint64) ([]model.PaymentRequest, error) {
+	next, span := tr.start("FindPaymentRequestsBySplit")
+	r0, err := next.FindPaymentRequestsBySplit(splitID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindLastPaymentRequests(payerID uint64, limit int) ([]model.PaymentRequest, error) {
+	next, span := tr.start("FindLastPaymentRequests")
+	r0, err := next.FindLastPaymentRequests(payerID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) PayPaymentRequest(requestID uint64) (*model.PaymentRequest, *model.InternalTransfer, error) {
+	next, span := tr.start("PayPaymentRequest")
+	r0, r1, err := next.PayPaymentRequest(requestID)
+	span.SetError(err)
+	span.End()
+	return r0, r1, err
+}
+
+func (tr *tracedRepository) DeclinePaymentRequest(requestID uint64) (*model.PaymentRequest, error) {
+	next, span := tr.start("DeclinePaymentRequest")
+	r0, err := next.DeclinePaymentRequest(requestID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) CreateWebhookSubscription(sub model.WebhookSubscription) (*model.WebhookSubscription, error) {
+	next, span := tr.start("CreateWebhookSubscription")
+	r0, err := next.CreateWebhookSubscription(sub)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) GetWebhookSubscriptionByID(subscriptionID uint64) (*model.WebhookSubscription, error) {
+	next, span := tr.start("GetWebhookSubscriptionByID")
+	r0, err := next.GetWebhookSubscriptionByID(subscriptionID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindWebhookSubscriptions(userID uint64) ([]model.WebhookSubscription, error) {
+	next, span := tr.start("FindWebhookSubscriptions")
+	r0, err := next.FindWebhookSubscriptions(userID)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) DeactivateWebhookSubscription(subscriptionID uint64) error {
+	next, span := tr.start("DeactivateWebhookSubscription")
+	err := next.DeactivateWebhookSubscription(subscriptionID)
+	span.SetError(err)
+	span.End()
+	return err
+}
+
+func (tr *tracedRepository) FindLastWebhookDeliveries(subscriptionID uint64, limit int) ([]model.WebhookDelivery, error) {
+	next, span := tr.start("FindLastWebhookDeliveries")
+	r0, err := next.FindLastWebhookDeliveries(subscriptionID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) AppendAuditEntry(e model.AuditEntry) (*model.AuditEntry, error) {
+	next, span := tr.start("AppendAuditEntry")
+	r0, err := next.AppendAuditEntry(e)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) FindAuditEntries(f audit.Filter, limit int) ([]model.AuditEntry, error) {
+	next, span := tr.start("FindAuditEntries")
+	r0, err := next.FindAuditEntries(f, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
+
+func (tr *tracedRepository) ReadAuditChain(afterID uint64, limit int) ([]model.AuditEntry, error) {
+	next, span := tr.start("ReadAuditChain")
+	r0, err := next.ReadAuditChain(afterID, limit)
+	span.SetError(err)
+	span.End()
+	return r0, err
+}
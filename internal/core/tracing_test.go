@@ -0,0 +1,28 @@
+package core
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+)
+
+// contextRepository - records context the repository is bound to
+type contextRepository struct {
+	Repository
+	ctx context.Context
+}
+
+func (cr *contextRepository) WithContext(ctx context.Context) Repository {
+	return &contextRepository{ctx: ctx}
+}
+
+func TestRepositoryBinding(t *testing.T) {
+	type key struct{}
+	r := httptest.NewRequest("GET", "/", nil)
+	r = r.WithContext(context.WithValue(r.Context(), key{}, "request"))
+	s := &service{r: &contextRepository{}}
+	bound, ok := s.repo(r).(*contextRepository)
+	if !ok || bound.ctx == nil || bound.ctx.Value(key{}) != "request" {
+		t.Errorf("Repository is not bound to the request context")
+	}
+}
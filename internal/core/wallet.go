@@ -0,0 +1,208 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func (s *service) WalletList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		reply.OK(&api.WalletListResponse{Wallets: authUser.Wallets})(w, r)
+	}
+}
+
+func (s *service) OpenWallet() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		currency := model.Currency(r.Form.Get("currency"))
+		if !currency.IsValid() {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		if authUser.Wallet(currency) != nil {
+			reply.Conflict(fmt.Sprintf("%s wallet already exists", currency))(w, r)
+			return
+		}
+		wallet, err := s.repo(r).CreateWallet(authUser.ID, currency)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "CreateWallet", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		reply.OK(&api.WalletResponse{Wallet: wallet})(w, r)
+	}
+}
+
+func (s *service) GetWalletByCurrency(currency string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		c := model.Currency(currency)
+		if !c.IsValid() {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		wallet := authUser.Wallet(c)
+		if wallet == nil {
+			reply.Conflict("Wallet not found")(w, r)
+			return
+		}
+		transfers, err := s.repo(r).FindLastInternalTransfers(authUser.ID, c, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastInternalTransfers", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		conversions, err := s.repo(r).FindLastConversions(authUser.ID, c, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastConversions", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		censored := make([]*api.IMTCensored, len(transfers))
+		for i := range transfers {
+			censored[i] = CensorInternalTransfer(authUser.ID, &transfers[i])
+		}
+		reply.OK(&api.WalletResponse{
+			Wallet:       wallet,
+			Transactions: censored,
+			Conversions:  conversions,
+		})(w, r)
+	}
+}
+
+func (s *service) ConversionList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		currency := model.Currency(r.URL.Query().Get("currency"))
+		if currency != "" && !currency.IsValid() {
+			reply.BadRequest("Invalid currency")(w, r)
+			return
+		}
+		conversions, err := s.repo(r).FindLastConversions(authUser.ID, currency, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastConversions", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.ConversionListResponse{Conversions: conversions})(w, r)
+	}
+}
+
+func (s *service) CreateConversion() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		from, to := model.Currency(r.Form.Get("from")), model.Currency(r.Form.Get("to"))
+		if !from.IsValid() || !to.IsValid() || from == to {
+			reply.BadRequest("Invalid currency pair")(w, r)
+			return
+		}
+		sum, err := strconv.ParseFloat(r.Form.Get("sum"), 10)
+		if err != nil || sum <= 0.0 {
+			reply.BadRequest("Incorrect sum")(w, r)
+			return
+		}
+		wallet := authUser.Wallet(from)
+		if wallet == nil {
+			reply.Conflict(fmt.Sprintf("No %s wallet", from))(w, r)
+			return
+		}
+		if wallet.Available-sum < 0.0 {
+			reply.Conflict(fmt.Sprintf("Insufficient funds (%f %s)", wallet.Available, from))(w, r)
+			return
+		}
+		conversion, err := s.repo(r).ConvertFunds(authUser.ID, from, to, sum)
+		if err != nil {
+			s.logger(r).Warn("Repository error", "method", "ConvertFunds", "error", err)
+			reply.Conflict(fmt.Sprintf("Cannot convert %s to %s", from, to))(w, r)
+			return
+		}
+		s.notifyBalance(s.repo(r), authUser.ID, from)
+		s.notifyBalance(s.repo(r), authUser.ID, to)
+		reply.OK(&api.ConversionResponse{Conversion: conversion})(w, r)
+	}
+}
+
+func (s *service) ExchangeRateList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := s.authorize(r); !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		rates, err := s.repo(r).GetExchangeRates()
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "GetExchangeRates", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.ExchangeRateListResponse{Rates: rates})(w, r)
+	}
+}
+
+func (s *service) SetExchangeRate() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if authUser.Role < model.RoleAdmin {
+			reply.Forbidden("Insufficient authority to complete request")(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		from, to := model.Currency(r.Form.Get("from")), model.Currency(r.Form.Get("to"))
+		if !from.IsValid() || !to.IsValid() || from == to {
+			reply.BadRequest("Invalid currency pair")(w, r)
+			return
+		}
+		rate, err := strconv.ParseFloat(r.Form.Get("rate"), 10)
+		if err != nil || rate <= 0.0 {
+			reply.BadRequest("Incorrect rate")(w, r)
+			return
+		}
+		xr, err := s.repo(r).SetExchangeRate(from, to, rate)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "SetExchangeRate", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		reply.OK(&api.ExchangeRateResponse{Rate: xr})(w, r)
+	}
+}
@@ -0,0 +1,175 @@
+package core
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/wtask/pwsrv/internal/api"
+	"github.com/wtask/pwsrv/internal/core/reply"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/webhook"
+)
+
+const (
+	// MinWebhookSecretLen - min length of the secret to sign webhook payloads
+	MinWebhookSecretLen = 16
+	// MaxWebhooks - max number of active webhook subscriptions per user
+	MaxWebhooks = 10
+)
+
+// WebhookEvents - event types available for webhook subscriptions
+var WebhookEvents = []string{EventTransferDebited, EventTransferCredited}
+
+// webhookEvents - validates comma separated list of event types and returns it normalized;
+// all available events are returned for the empty list.
+func webhookEvents(list string) (string, bool) {
+	if strings.TrimSpace(list) == "" {
+		return strings.Join(WebhookEvents, ","), true
+	}
+	events := []string{}
+	for _, e := range strings.Split(list, ",") {
+		e = strings.TrimSpace(e)
+		known := false
+		for _, available := range WebhookEvents {
+			known = known || e == available
+		}
+		if !known {
+			return "", false
+		}
+		events = append(events, e)
+	}
+	return strings.Join(events, ","), true
+}
+
+func (s *service) WebhookList() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		subs, err := s.repo(r).FindWebhookSubscriptions(authUser.ID)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindWebhookSubscriptions", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.WebhookListResponse{Webhooks: subs})(w, r)
+	}
+}
+
+// CreateWebhook - subscribes given URL to events of the authorized user,
+// payloads are signed with given secret. URL must point to the public host,
+// resolved addresses are checked again at the moment of delivery.
+func (s *service) CreateWebhook() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authUser, ok := s.authorize(r)
+		if !ok {
+			reply.Unauthorized()(w, r)
+			return
+		}
+		if err := r.ParseForm(); err != nil {
+			reply.BadRequest("Can't parse post data")(w, r)
+			return
+		}
+		u, err := url.Parse(r.Form.Get("url"))
+		if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			reply.BadRequest("Invalid URL, absolute http(s) URL required")(w, r)
+			return
+		}
+		if !webhook.PublicHost(u.Hostname()) {
+			reply.BadRequest("Invalid URL, public host required")(w, r)
+			return
+		}
+		events, ok := webhookEvents(r.Form.Get("events"))
+		if !ok {
+			reply.BadRequest(fmt.Sprintf("Supported events: %s", strings.Join(WebhookEvents, ", ")))(w, r)
+			return
+		}
+		secret := r.Form.Get("secret")
+		if len(secret) < MinWebhookSecretLen {
+			reply.BadRequest(fmt.Sprintf("Secret length must be %d or greater", MinWebhookSecretLen))(w, r)
+			return
+		}
+		subs, err := s.repo(r).FindWebhookSubscriptions(authUser.ID)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindWebhookSubscriptions", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		if len(subs) >= MaxWebhooks {
+			reply.Conflict(fmt.Sprintf("Too many webhooks, max %d allowed", MaxWebhooks))(w, r)
+			return
+		}
+		sub, err := s.repo(r).CreateWebhookSubscription(model.WebhookSubscription{
+			UserID: authUser.ID,
+			URL:    u.String(),
+			Events: events,
+			Secret: secret,
+		})
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "CreateWebhookSubscription", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		reply.OK(&api.WebhookResponse{Webhook: sub})(w, r)
+	}
+}
+
+// ownWebhook - returns webhook subscription of the authorized user or replies an error and returns nil.
+func (s *service) ownWebhook(id uint64, w http.ResponseWriter, r *http.Request) *model.WebhookSubscription {
+	authUser, ok := s.authorize(r)
+	if !ok {
+		reply.Unauthorized()(w, r)
+		return nil
+	}
+	sub, err := s.repo(r).GetWebhookSubscriptionByID(id)
+	if err != nil {
+		s.logger(r).Error("Repository error", "method", "GetWebhookSubscriptionByID", "error", err)
+		reply.InternalServerError("Cannot complete request now")(w, r)
+		return nil
+	}
+	if sub == nil {
+		reply.Conflict("Webhook not found")(w, r)
+		return nil
+	}
+	if sub.UserID != authUser.ID {
+		reply.Forbidden("Insufficient authority to complete request")(w, r)
+		return nil
+	}
+	return sub
+}
+
+func (s *service) DeleteWebhookByID(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub := s.ownWebhook(id, w, r)
+		if sub == nil {
+			return
+		}
+		if err := s.repo(r).DeactivateWebhookSubscription(sub.ID); err != nil {
+			s.logger(r).Error("Repository error", "method", "DeactivateWebhookSubscription", "error", err)
+			reply.InternalServerError("Cannot complete request now")(w, r)
+			return
+		}
+		sub.Active = false
+		reply.OK(&api.WebhookResponse{Webhook: sub})(w, r)
+	}
+}
+
+func (s *service) WebhookDeliveryList(id uint64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		sub := s.ownWebhook(id, w, r)
+		if sub == nil {
+			return
+		}
+		deliveries, err := s.repo(r).FindLastWebhookDeliveries(sub.ID, 100)
+		if err != nil {
+			s.logger(r).Error("Repository error", "method", "FindLastWebhookDeliveries", "error", err)
+			reply.InternalServerError("Cannot complete request")(w, r)
+			return
+		}
+		reply.OK(&api.WebhookDeliveryListResponse{Deliveries: deliveries})(w, r)
+	}
+}
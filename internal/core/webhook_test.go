@@ -0,0 +1,23 @@
+package core
+
+import "testing"
+
+func TestWebhookEvents(t *testing.T) {
+	cases := []struct {
+		list, expected string
+		valid          bool
+	}{
+		{"", "transfer.debited,transfer.credited", true},
+		{"  ", "transfer.debited,transfer.credited", true},
+		{"transfer.credited", "transfer.credited", true},
+		{" transfer.credited , transfer.debited ", "transfer.credited,transfer.debited", true},
+		{"transfer.credited,unknown", "", false},
+		{"transfer.credited,", "", false},
+	}
+	for _, c := range cases {
+		events, ok := webhookEvents(c.list)
+		if ok != c.valid || events != c.expected {
+			t.Errorf("Unexpected result for %q: %q, %t", c.list, events, ok)
+		}
+	}
+}
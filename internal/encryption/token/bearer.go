@@ -1,19 +1,36 @@
 package token
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/wtask/pwsrv/internal/core"
 	"github.com/wtask/pwsrv/internal/core/middleware"
 	"github.com/wtask/pwsrv/internal/encryption/hasher"
+	"github.com/wtask/pwsrv/internal/logging"
 )
 
 // AuthBearer - common internal interface to create and validate authorization tokens
 type AuthBearer interface {
 	middleware.TokenDiscoverer
 	core.TokenProvider
+	// Reconfigure - atomically applies options to the running bearer
+	Reconfigure(options ...bearerOption)
+	// Inspect - returns claims of the token having valid signature
+	Inspect(token string) (*Claims, error)
+}
+
+// Claims - content of the token for operators
+type Claims struct {
+	Subject   uint64    `json:"sub,string"`
+	Issuer    string    `json:"iss"`
+	ExpiresAt time.Time `json:"exp"`
+	// Valid - token is not expired and is issued by the bearer, so it is accepted
+	Valid bool `json:"valid"`
 }
 
 type (
@@ -24,10 +41,13 @@ type (
 	}
 
 	bearer struct {
+		mu           sync.RWMutex
 		ttl          time.Duration
 		issuer       string
 		timeProvider func() time.Time
 		signer       hasher.StringHasher
+		verifiers    []hasher.StringHasher // previous signers, tokens are verified only
+		logger       *slog.Logger
 	}
 
 	bearerOption func(*bearer)
@@ -42,6 +62,9 @@ func NewMD5DigestBearer(options ...bearerOption) AuthBearer {
 	if b.timeProvider == nil {
 		b.timeProvider = defaultTimeProvider
 	}
+	if b.logger == nil {
+		b.logger = logging.Discard()
+	}
 	return b
 }
 
@@ -64,6 +87,17 @@ func WithSignatureSecret(secret string) bearerOption {
 	}
 }
 
+// WithVerificationSecrets - initialize bearer with previous signature secrets,
+// tokens signed with them are still valid until they expire, but new tokens are not signed.
+func WithVerificationSecrets(secrets ...string) bearerOption {
+	return func(b *bearer) {
+		b.verifiers = make([]hasher.StringHasher, 0, len(secrets))
+		for _, s := range secrets {
+			b.verifiers = append(b.verifiers, hasher.NewMD5DigestHasher(s))
+		}
+	}
+}
+
 // WithTTL - initialize bearer with TTL value.
 func WithTTL(ttl time.Duration) bearerOption {
 	return func(b *bearer) {
@@ -78,6 +112,13 @@ func WithIssuer(issuer string) bearerOption {
 	}
 }
 
+// WithLogger - initialize bearer with logger to report token errors.
+func WithLogger(l *slog.Logger) bearerOption {
+	return func(b *bearer) {
+		b.logger = l
+	}
+}
+
 func defaultTimeProvider() time.Time {
 	return time.Now()
 }
@@ -89,11 +130,23 @@ func withTimeProvider(p func() time.Time) bearerOption {
 	}
 }
 
+// Reconfigure - applies options to the bearer, which is used concurrently.
+func (b *bearer) Reconfigure(options ...bearerOption) {
+	if b == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.alter(options...)
+}
+
 // NewToken - return new token with given subject or empty string in case of error.
 func (b *bearer) NewToken(userID uint64) string {
 	if b == nil {
 		return ""
 	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	t := b.timeProvider().UTC()
 	p := payload{
 		UserID:         userID,
@@ -102,10 +155,12 @@ func (b *bearer) NewToken(userID uint64) string {
 	}
 	b64 := encodeJSONB64(&p)
 	if b64 == "" {
+		b.logger.Error("Bearer error", "reason", "cannot encode payload", "subject", userID)
 		return ""
 	}
 	sig := b.signer.Hash(b64)
 	if sig == "" {
+		b.logger.Error("Bearer error", "reason", "cannot sign payload", "subject", userID)
 		return ""
 	}
 	return fmt.Sprintf("%s.%s", b64, sig)
@@ -121,7 +176,7 @@ func (b *bearer) assertToken(token string) *payload {
 		parts[1] == "" {
 		return nil
 	}
-	if parts[1] != b.signer.Hash(parts[0]) {
+	if !b.verify(parts[0], parts[1]) {
 		return nil
 	}
 	p := &payload{}
@@ -131,11 +186,26 @@ func (b *bearer) assertToken(token string) *payload {
 	return p
 }
 
+// verify - checks signature is made by current or any of previous signers.
+func (b *bearer) verify(data, sig string) bool {
+	if sig == b.signer.Hash(data) {
+		return true
+	}
+	for _, v := range b.verifiers {
+		if sig == v.Hash(data) {
+			return true
+		}
+	}
+	return false
+}
+
 // DiscoverUserID - middleware.AuthBearer implementation.
 func (b *bearer) DiscoverUserID(token string) (uint64, bool) {
 	if b == nil {
 		return 0, false
 	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
 	p := b.assertToken(token)
 	if p == nil {
 		return 0, false
@@ -144,3 +214,23 @@ func (b *bearer) DiscoverUserID(token string) (uint64, bool) {
 		b.issuer == p.Issuer
 	return p.UserID, ok
 }
+
+// Inspect - returns claims of the token signed with current or previous secret, expired tokens are inspected too.
+func (b *bearer) Inspect(token string) (*Claims, error) {
+	if b == nil {
+		return nil, errors.New("token.Inspect: bearer is nil")
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	p := b.assertToken(token)
+	if p == nil {
+		return nil, errors.New("token.Inspect: malformed token or invalid signature")
+	}
+	expiresAt := time.Unix(p.ExpirationTime, 0).UTC()
+	return &Claims{
+		Subject:   p.UserID,
+		Issuer:    p.Issuer,
+		ExpiresAt: expiresAt,
+		Valid:     b.timeProvider().UTC().Before(expiresAt) && b.issuer == p.Issuer,
+	}, nil
+}
@@ -121,3 +121,63 @@ func TestBearerEncryption(t *testing.T) {
 		t.Errorf("Bearer without secret does not use signature part of the token")
 	}
 }
+
+func TestBearerReconfigure(t *testing.T) {
+	now := time.Now()
+	bearer := NewMD5DigestBearer(
+		WithSignatureSecret("old"),
+		WithTTL(10*time.Second),
+		WithIssuer("token-test"),
+		withTimeProvider(func() time.Time { return now }),
+	)
+	old := bearer.NewToken(1)
+
+	bearer.Reconfigure(WithSignatureSecret("new"), WithVerificationSecrets("old"), WithTTL(time.Minute))
+	if _, ok := bearer.DiscoverUserID(old); !ok {
+		t.Errorf("Token signed with previous secret is not valid")
+	}
+	token := bearer.NewToken(1)
+	if strings.Split(token, ".")[1] == strings.Split(old, ".")[1] {
+		t.Errorf("New token is signed with previous secret")
+	}
+	bearer.Reconfigure(WithVerificationSecrets())
+	if _, ok := bearer.DiscoverUserID(old); ok {
+		t.Errorf("Token signed with dropped secret is still valid")
+	}
+	now = now.Add(30 * time.Second)
+	if _, ok := bearer.DiscoverUserID(token); !ok {
+		t.Errorf("New TTL is not applied")
+	}
+	bearer.Reconfigure(WithIssuer("another"))
+	if _, ok := bearer.DiscoverUserID(token); ok {
+		t.Errorf("Token of previous issuer is still valid")
+	}
+}
+
+func TestBearerInspect(t *testing.T) {
+	now := time.Now()
+	bearer := NewMD5DigestBearer(
+		WithSignatureSecret("secret"),
+		WithTTL(time.Minute),
+		WithIssuer("token-test"),
+		withTimeProvider(func() time.Time { return now }),
+	)
+	token := bearer.NewToken(7)
+	claims, err := bearer.Inspect(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != 7 || claims.Issuer != "token-test" || !claims.Valid ||
+		claims.ExpiresAt.Unix() != now.Add(time.Minute).Unix() {
+		t.Errorf("Unexpected claims: %+v", claims)
+	}
+	now = now.Add(2 * time.Minute)
+	if claims, err := bearer.Inspect(token); err != nil || claims.Valid {
+		t.Errorf("Expired token is not inspected or is valid: %+v, %v", claims, err)
+	}
+	for _, invalid := range []string{"", "broken", token + "x"} {
+		if _, err := bearer.Inspect(invalid); err == nil {
+			t.Errorf("Invalid token is inspected: %q", invalid)
+		}
+	}
+}
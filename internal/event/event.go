@@ -0,0 +1,272 @@
+// Package event provides domain events stream: storage writes events into the outbox
+// atomically with the state change, dispatcher reads the outbox in order and delivers events
+// to in-process subscribers at least once, tracking offset of every subscriber.
+// Failed events are retried with backoff and finally dead-lettered, so one bad event
+// does not stop the subscriber; handled events are pruned after retention period.
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+const (
+	// UserRegistered - new user has been created, payload is model.User
+	UserRegistered = "user.registered"
+	// TransferCreated - internal transfer has been committed, payload is model.InternalTransfer
+	TransferCreated = "transfer.created"
+)
+
+// Event - domain event
+type Event struct {
+	// ID - position of the event in the outbox
+	ID        uint64
+	Type      string
+	CreatedAt time.Time
+	Payload   json.RawMessage
+}
+
+// Decode - unmarshals event payload into v.
+func (e *Event) Decode(v interface{}) error {
+	return json.Unmarshal(e.Payload, v)
+}
+
+// Offset - position of the subscriber in the outbox and state of the event following it,
+// which the subscriber failed to handle
+type Offset struct {
+	// EventID - ID of the last handled event
+	EventID uint64
+	// FailedEventID - ID of the event, which failed to be handled, attempts are counted for it only
+	FailedEventID uint64
+	Attempts      int
+	RetryAt       time.Time
+	LastError     string
+}
+
+// Store - outbox and subscribers' offsets
+type Store interface {
+	// ReadEvents - returns up to limit events following the given ID in order of IDs.
+	ReadEvents(afterID uint64, limit int) ([]Event, error)
+	GetEventOffset(subscriber string) (Offset, error)
+	SaveEventOffset(subscriber string, o Offset) error
+	// DeadLetterEvent - keeps the event, which the subscriber failed to handle, for manual processing
+	// and moves offset of the subscriber past it within a single transaction.
+	DeadLetterEvent(subscriber string, e *Event, attempts int, reason string) error
+	// PruneEvents - removes events created before the given time, which are handled by all of subscribers;
+	// returns number of removed events.
+	PruneEvents(before time.Time, subscribers []string) (int, error)
+}
+
+// Handler - processes event; if error is returned, the event will be delivered again.
+type Handler func(e *Event) error
+
+type subscriber struct {
+	name    string
+	handler Handler
+}
+
+// Dispatcher - delivers outbox events to subscribers
+type Dispatcher struct {
+	mu          sync.Mutex
+	store       Store
+	batchSize   int
+	subscribers []subscriber
+	gapTimeout  time.Duration
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+	retention   time.Duration
+	// closedGaps - ID of the last event, all gaps before which are either filled or rolled back
+	closedGaps uint64
+}
+
+type dispatcherOption func(*Dispatcher)
+
+// WithGapTimeout - sets max time to wait for the missing event preceding the stored one.
+// IDs of the outbox are allocated on insert, but become visible on commit, so the event
+// of the long transaction may appear after the following ones; if it does not appear in time,
+// its transaction is considered rolled back.
+func WithGapTimeout(timeout time.Duration) dispatcherOption {
+	return func(d *Dispatcher) {
+		d.gapTimeout = timeout
+	}
+}
+
+// WithRetries - sets max number of attempts to handle the event and backoff interval,
+// which is doubled after every failure until it reaches max value;
+// the event is dead-lettered after the last failed attempt.
+func WithRetries(maxAttempts int, backoff, maxBackoff time.Duration) dispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts, d.backoff, d.maxBackoff = maxAttempts, backoff, maxBackoff
+	}
+}
+
+// WithRetention - sets time to keep handled events in the outbox, zero disables pruning.
+func WithRetention(retention time.Duration) dispatcherOption {
+	return func(d *Dispatcher) {
+		d.retention = retention
+	}
+}
+
+// NewDispatcher - creates dispatcher of events from the given store.
+func NewDispatcher(store Store, batchSize int, options ...dispatcherOption) *Dispatcher {
+	if store == nil {
+		panic(errors.New("event.NewDispatcher: Store is nil"))
+	}
+	if batchSize < 1 {
+		batchSize = 100
+	}
+	d := &Dispatcher{
+		store:       store,
+		batchSize:   batchSize,
+		gapTimeout:  time.Minute,
+		maxAttempts: 10,
+		backoff:     time.Second,
+		maxBackoff:  time.Hour,
+		retention:   7 * 24 * time.Hour,
+	}
+	for _, o := range options {
+		if o != nil {
+			o(d)
+		}
+	}
+	return d
+}
+
+// Subscribe - registers handler under the unique name, which is used to track its offset.
+// New subscriber receives all events stored in the outbox.
+func (d *Dispatcher) Subscribe(name string, h Handler) {
+	if name == "" || h == nil {
+		panic(errors.New("event.Subscribe: name is empty or handler is nil"))
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	for _, s := range d.subscribers {
+		if s.name == name {
+			panic(fmt.Errorf("event.Subscribe: subscriber %q is already registered", name))
+		}
+	}
+	d.subscribers = append(d.subscribers, subscriber{name: name, handler: h})
+}
+
+// Backoff - returns delay before the next attempt after given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// Dispatch - delivers next batch of events to every subscriber, suitable to be used as background job.
+// Subscriber's offset is moved after every handled event, so failed event
+// and all following ones will be delivered to that subscriber again after backoff,
+// until the event is dead-lettered. Offset is not moved over the missing event,
+// until it appears or gap timeout is exceeded.
+// Returns number of delivered events and the first error.
+func (d *Dispatcher) Dispatch(now time.Time) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delivered := 0
+	var failure error
+	for _, s := range d.subscribers {
+		n, err := d.deliver(s, now)
+		delivered += n
+		if err != nil && failure == nil {
+			failure = fmt.Errorf("event.Dispatch: %s: %s", s.name, err.Error())
+		}
+	}
+	return delivered, failure
+}
+
+func (d *Dispatcher) deliver(s subscriber, now time.Time) (int, error) {
+	offset, err := d.store.GetEventOffset(s.name)
+	if err != nil {
+		return 0, err
+	}
+	if now.Before(offset.RetryAt) {
+		return 0, nil
+	}
+	events, err := d.store.ReadEvents(offset.EventID, d.batchSize)
+	if err != nil {
+		return 0, err
+	}
+	d.closeGaps(events, now)
+	for i := range events {
+		e := &events[i]
+		if e.ID != offset.EventID+1 && e.ID > d.closedGaps {
+			// missing event may be not committed yet
+			return i, nil
+		}
+		if err = s.handler(e); err != nil {
+			return i, d.fail(s.name, offset, e, err, now)
+		}
+		offset = Offset{EventID: e.ID}
+		if err = d.store.SaveEventOffset(s.name, offset); err != nil {
+			return i + 1, err
+		}
+	}
+	return len(events), nil
+}
+
+// closeGaps - remembers the last event, which is stored longer than gap timeout: IDs missing before it
+// are allocated even earlier, so their transactions are rolled back and nobody waits for them again.
+// Events may be stored by instances with different clocks, so the last of such events is looked for.
+func (d *Dispatcher) closeGaps(events []Event, now time.Time) {
+	for i := len(events) - 1; i >= 0 && events[i].ID > d.closedGaps; i-- {
+		if now.Sub(events[i].CreatedAt) >= d.gapTimeout {
+			d.closedGaps = events[i].ID
+			return
+		}
+	}
+}
+
+// fail - postpones the next attempt to handle the event or dead-letters it, if attempts are exhausted.
+func (d *Dispatcher) fail(subscriber string, offset Offset, e *Event, cause error, now time.Time) error {
+	failure := fmt.Errorf("event #%d: %s", e.ID, cause.Error())
+	attempts := 1
+	if offset.FailedEventID == e.ID {
+		attempts = offset.Attempts + 1
+	}
+	reason := cause.Error()
+	if len(reason) > 1024 {
+		reason = reason[:1024]
+	}
+	if attempts >= d.maxAttempts {
+		if err := d.store.DeadLetterEvent(subscriber, e, attempts, reason); err != nil {
+			return fmt.Errorf("%s, dead-lettering failed: %s", failure.Error(), err.Error())
+		}
+		return fmt.Errorf("%s, dead-lettered after %d attempts", failure.Error(), attempts)
+	}
+	offset.FailedEventID, offset.Attempts = e.ID, attempts
+	offset.RetryAt, offset.LastError = now.Add(d.Backoff(attempts)), reason
+	if err := d.store.SaveEventOffset(subscriber, offset); err != nil {
+		return fmt.Errorf("%s, saving attempt failed: %s", failure.Error(), err.Error())
+	}
+	return failure
+}
+
+// Prune - removes events older than retention period, which are handled by all subscribers,
+// suitable to be used as background job. Returns number of removed events.
+func (d *Dispatcher) Prune(now time.Time) (int, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.retention <= 0 || len(d.subscribers) == 0 {
+		return 0, nil
+	}
+	names := make([]string, len(d.subscribers))
+	for i, s := range d.subscribers {
+		names[i] = s.name
+	}
+	n, err := d.store.PruneEvents(now.Add(-d.retention), names)
+	if err != nil {
+		return n, fmt.Errorf("event.Prune: %s", err.Error())
+	}
+	return n, nil
+}
@@ -0,0 +1,303 @@
+package event
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+type memoryStore struct {
+	events      []Event
+	offsets     map[string]Offset
+	deadLetters map[string][]uint64
+}
+
+func (s *memoryStore) ReadEvents(afterID uint64, limit int) ([]Event, error) {
+	events := []Event{}
+	for _, e := range s.events {
+		if e.ID > afterID && len(events) < limit {
+			events = append(events, e)
+		}
+	}
+	return events, nil
+}
+
+func (s *memoryStore) GetEventOffset(subscriber string) (Offset, error) {
+	return s.offsets[subscriber], nil
+}
+
+func (s *memoryStore) SaveEventOffset(subscriber string, o Offset) error {
+	s.offsets[subscriber] = o
+	return nil
+}
+
+func (s *memoryStore) DeadLetterEvent(subscriber string, e *Event, attempts int, reason string) error {
+	s.deadLetters[subscriber] = append(s.deadLetters[subscriber], e.ID)
+	s.offsets[subscriber] = Offset{EventID: e.ID}
+	return nil
+}
+
+func (s *memoryStore) PruneEvents(before time.Time, subscribers []string) (int, error) {
+	kept := []Event{}
+	for _, e := range s.events {
+		handled := true
+		for _, name := range subscribers {
+			handled = handled && s.offsets[name].EventID >= e.ID
+		}
+		if !handled || !e.CreatedAt.Before(before) {
+			kept = append(kept, e)
+		}
+	}
+	pruned := len(s.events) - len(kept)
+	s.events = kept
+	return pruned, nil
+}
+
+// newMemoryStore - creates store with n old events, which IDs have gaps
+func newMemoryStore(n int) *memoryStore {
+	s := &memoryStore{offsets: map[string]Offset{}, deadLetters: map[string][]uint64{}}
+	for i := 1; i <= n; i++ {
+		s.events = append(s.events, Event{ID: uint64(i * 10), Type: TransferCreated, Payload: []byte(`{}`)})
+	}
+	return s
+}
+
+func TestDispatchInOrder(t *testing.T) {
+	store := newMemoryStore(5)
+	d := NewDispatcher(store, 2)
+	received := map[string][]uint64{}
+	for _, name := range []string{"first", "second"} {
+		name := name
+		d.Subscribe(name, func(e *Event) error {
+			received[name] = append(received[name], e.ID)
+			return nil
+		})
+	}
+	total := 0
+	for i := 0; i < 4; i++ {
+		n, err := d.Dispatch(time.Now())
+		if err != nil {
+			t.Fatalf("Unexpected dispatch error %v", err)
+		}
+		total += n
+	}
+	if total != 10 {
+		t.Errorf("Unexpected number of delivered events %d", total)
+	}
+	for _, name := range []string{"first", "second"} {
+		ids := received[name]
+		if len(ids) != 5 {
+			t.Errorf("Subscriber %q: unexpected events %v", name, ids)
+			continue
+		}
+		for i, id := range ids {
+			if id != uint64((i+1)*10) {
+				t.Errorf("Subscriber %q: unexpected order of events %v", name, ids)
+				break
+			}
+		}
+		if store.offsets[name].EventID != 50 {
+			t.Errorf("Subscriber %q: unexpected offset %+v", name, store.offsets[name])
+		}
+	}
+}
+
+func TestRedeliveryAfterFailure(t *testing.T) {
+	store := newMemoryStore(3)
+	d := NewDispatcher(store, 10, WithRetries(3, time.Minute, time.Hour))
+	fail := true
+	received := []uint64{}
+	d.Subscribe("flaky", func(e *Event) error {
+		received = append(received, e.ID)
+		if e.ID == 20 && fail {
+			fail = false
+			return errors.New("temporary failure")
+		}
+		return nil
+	})
+	healthy := 0
+	d.Subscribe("healthy", func(e *Event) error {
+		healthy++
+		return nil
+	})
+	now := time.Now()
+	if n, err := d.Dispatch(now); err == nil || n != 4 {
+		t.Errorf("Expected dispatch error and 4 delivered events, got %d, %v", n, err)
+	}
+	if o := store.offsets["flaky"]; o.EventID != 10 || o.FailedEventID != 20 || o.Attempts != 1 ||
+		!o.RetryAt.Equal(now.Add(time.Minute)) || o.LastError != "temporary failure" {
+		t.Errorf("Unexpected offset %+v after failure", o)
+	}
+	// retry is not due yet
+	if n, err := d.Dispatch(now.Add(30 * time.Second)); err != nil || n != 0 {
+		t.Fatalf("Unexpected dispatch before retry %d, %v", n, err)
+	}
+	if _, err := d.Dispatch(now.Add(time.Minute)); err != nil {
+		t.Fatalf("Unexpected dispatch error %v", err)
+	}
+	expected := []uint64{10, 20, 20, 30}
+	if len(received) != len(expected) {
+		t.Fatalf("Unexpected deliveries %v", received)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Errorf("Unexpected deliveries %v, expected %v", received, expected)
+			break
+		}
+	}
+	// healthy subscriber has received all events during the first dispatching
+	if healthy != 3 || store.offsets["healthy"].EventID != 30 {
+		t.Errorf("Failure of one subscriber affects other one: %d events, offset %+v", healthy, store.offsets["healthy"])
+	}
+	if o := store.offsets["flaky"]; o != (Offset{EventID: 30}) {
+		t.Errorf("Failure is not reset after success: %+v", o)
+	}
+}
+
+func TestDeadLetter(t *testing.T) {
+	store := newMemoryStore(3)
+	d := NewDispatcher(store, 10, WithRetries(3, time.Second, time.Second))
+	received := []uint64{}
+	d.Subscribe("strict", func(e *Event) error {
+		received = append(received, e.ID)
+		if e.ID == 20 {
+			return errors.New("malformed payload")
+		}
+		return nil
+	})
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		d.Dispatch(now.Add(time.Duration(i) * time.Second))
+	}
+	expected := []uint64{10, 20, 20, 20, 30}
+	if len(received) != len(expected) {
+		t.Fatalf("Unexpected deliveries %v, expected %v", received, expected)
+	}
+	for i := range expected {
+		if received[i] != expected[i] {
+			t.Fatalf("Unexpected deliveries %v, expected %v", received, expected)
+		}
+	}
+	if dl := store.deadLetters["strict"]; len(dl) != 1 || dl[0] != 20 || store.offsets["strict"].EventID != 30 {
+		t.Errorf("Unexpected dead letters %v, offset %+v", dl, store.offsets["strict"])
+	}
+}
+
+func TestWaitForMissingEvent(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(0)
+	store.events = []Event{
+		{ID: 1, CreatedAt: now.Add(-time.Second)},
+		{ID: 3, CreatedAt: now.Add(-time.Second)},
+	}
+	d := NewDispatcher(store, 10, WithGapTimeout(time.Minute))
+	received := []uint64{}
+	d.Subscribe("ordered", func(e *Event) error {
+		received = append(received, e.ID)
+		return nil
+	})
+	if n, _ := d.Dispatch(now); n != 1 || store.offsets["ordered"].EventID != 1 {
+		t.Fatalf("Offset is moved over the missing event: %d, %+v", n, store.offsets["ordered"])
+	}
+	// transaction of event #2 is committed later
+	store.events = []Event{store.events[0], {ID: 2, CreatedAt: now.Add(-2 * time.Second)}, store.events[1]}
+	if n, _ := d.Dispatch(now); n != 2 {
+		t.Fatalf("Unexpected number of delivered events %d", n)
+	}
+	// event #4 is rolled back, event #5 is delivered after timeout only
+	store.events = append(store.events, Event{ID: 5, CreatedAt: now})
+	if n, _ := d.Dispatch(now.Add(30 * time.Second)); n != 0 {
+		t.Errorf("Event is delivered before gap timeout")
+	}
+	if n, _ := d.Dispatch(now.Add(time.Minute)); n != 1 {
+		t.Errorf("Event is not delivered after gap timeout")
+	}
+	if len(received) != 4 || received[1] != 2 || received[2] != 3 || received[3] != 5 {
+		t.Errorf("Unexpected deliveries %v", received)
+	}
+}
+
+func TestConsecutiveGaps(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(0)
+	// events #2 and #4 are rolled back
+	store.events = []Event{{ID: 1, CreatedAt: now}, {ID: 3, CreatedAt: now}, {ID: 5, CreatedAt: now}}
+	d := NewDispatcher(store, 10, WithGapTimeout(time.Minute))
+	received := []uint64{}
+	d.Subscribe("ordered", func(e *Event) error {
+		received = append(received, e.ID)
+		return nil
+	})
+	if n, _ := d.Dispatch(now.Add(30 * time.Second)); n != 1 {
+		t.Fatalf("Unexpected number of delivered events %d", n)
+	}
+	// both gaps are waited for once
+	if n, _ := d.Dispatch(now.Add(time.Minute)); n != 2 {
+		t.Fatalf("Events are not delivered after gap timeout: %d", n)
+	}
+
+	// event #7 is stored by instance with clock ahead, #8 is missing before #9 stored later,
+	// so #6 and #8 are allocated more than a minute ago
+	store.events = append(store.events,
+		Event{ID: 7, CreatedAt: now.Add(2 * time.Minute)},
+		Event{ID: 9, CreatedAt: now.Add(30 * time.Second)},
+	)
+	if n, _ := d.Dispatch(now.Add(90 * time.Second)); n != 2 {
+		t.Errorf("Rolled back events are waited for: %d", n)
+	}
+	// the same gaps are not waited for by other subscribers
+	late := 0
+	d.Subscribe("late", func(e *Event) error {
+		late++
+		return nil
+	})
+	if n, _ := d.Dispatch(now.Add(90 * time.Second)); n != 5 || late != 5 {
+		t.Errorf("Late subscriber waits for rolled back events: %d", n)
+	}
+	if len(received) != 5 || received[1] != 3 || received[2] != 5 || received[3] != 7 || received[4] != 9 {
+		t.Errorf("Unexpected deliveries %v", received)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	now := time.Now()
+	store := newMemoryStore(0)
+	for i := 1; i <= 4; i++ {
+		store.events = append(store.events, Event{ID: uint64(i), CreatedAt: now.Add(-time.Duration(5-i) * time.Hour)})
+	}
+	d := NewDispatcher(store, 10, WithRetention(90*time.Minute))
+	if n, err := d.Prune(now); err != nil || n != 0 {
+		t.Errorf("Events are pruned without subscribers: %d, %v", n, err)
+	}
+	d.Subscribe("first", func(*Event) error { return nil })
+	d.Subscribe("second", func(*Event) error { return nil })
+	store.offsets["first"] = Offset{EventID: 4}
+	store.offsets["second"] = Offset{EventID: 1}
+	// events #1-#3 are old enough, but only #1 is handled by both subscribers
+	if n, err := d.Prune(now); err != nil || n != 1 || store.events[0].ID != 2 {
+		t.Errorf("Unexpected pruning %d, %v", n, err)
+	}
+}
+
+func TestSubscribeValidation(t *testing.T) {
+	d := NewDispatcher(newMemoryStore(0), 0)
+	d.Subscribe("name", func(*Event) error { return nil })
+	cases := []struct {
+		name    string
+		handler Handler
+	}{
+		{"", func(*Event) error { return nil }},
+		{"other", nil},
+		{"name", func(*Event) error { return nil }},
+	}
+	for _, c := range cases {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("Expected panic for subscriber %q", c.name)
+				}
+			}()
+			d.Subscribe(c.name, c.handler)
+		}()
+	}
+}
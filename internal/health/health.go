@@ -0,0 +1,168 @@
+// Package health reports liveness, readiness and detailed status of the server and its dependencies.
+package health
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ErrDraining - server is shutting down and must not get new requests
+var ErrDraining = errors.New("server is shutting down")
+
+// CheckTimeout - max duration of single dependency check
+const CheckTimeout = 3 * time.Second
+
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusDraining = "draining"
+)
+
+// Check - named check of the server dependency
+type Check struct {
+	Name string
+	Run  func(ctx context.Context) error
+}
+
+// CheckResult - result of the dependency check
+type CheckResult struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+	Latency string `json:"latency"`
+}
+
+// BuildInfo - details of the server binary
+type BuildInfo struct {
+	GoVersion string `json:"go_version"`
+	Module    string `json:"module,omitempty"`
+	Revision  string `json:"revision,omitempty"`
+	Time      string `json:"time,omitempty"`
+	Modified  bool   `json:"modified,omitempty"`
+}
+
+// Report - detailed status of the server
+type Report struct {
+	Status    string        `json:"status"`
+	Version   string        `json:"version"`
+	Build     BuildInfo     `json:"build"`
+	StartedAt time.Time     `json:"started_at"`
+	Uptime    string        `json:"uptime"`
+	Checks    []CheckResult `json:"checks"`
+}
+
+// Monitor - runs dependency checks and tracks shutdown of the server
+type Monitor struct {
+	version  string
+	build    BuildInfo
+	started  time.Time
+	checks   []Check
+	draining int32
+}
+
+// NewMonitor - builds monitor of the server with given version.
+func NewMonitor(version string, checks ...Check) *Monitor {
+	for _, c := range checks {
+		if c.Name == "" || c.Run == nil {
+			panic(errors.New("health.NewMonitor: check has no name or function"))
+		}
+	}
+	return &Monitor{
+		version: version,
+		build:   readBuildInfo(),
+		started: time.Now(),
+		checks:  checks,
+	}
+}
+
+// Drain - marks server is shutting down, so it becomes not ready.
+func (m *Monitor) Drain() {
+	atomic.StoreInt32(&m.draining, 1)
+}
+
+// Draining - returns true if server is shutting down.
+func (m *Monitor) Draining() bool {
+	return atomic.LoadInt32(&m.draining) == 1
+}
+
+// Ready - returns nil if server is not shutting down and all of its dependencies are available,
+// otherwise returns the reason.
+func (m *Monitor) Ready(ctx context.Context) error {
+	if m.Draining() {
+		return ErrDraining
+	}
+	for _, r := range m.run(ctx) {
+		if r.Status != StatusOK {
+			return errors.New(r.Name + ": " + r.Error)
+		}
+	}
+	return nil
+}
+
+// Status - returns detailed report of the server.
+func (m *Monitor) Status(ctx context.Context) *Report {
+	report := &Report{
+		Status:    StatusOK,
+		Version:   m.version,
+		Build:     m.build,
+		StartedAt: m.started,
+		Uptime:    time.Since(m.started).Truncate(time.Second).String(),
+		Checks:    m.run(ctx),
+	}
+	for _, r := range report.Checks {
+		if r.Status != StatusOK {
+			report.Status = StatusFailed
+		}
+	}
+	if m.Draining() {
+		report.Status = StatusDraining
+	}
+	return report
+}
+
+// run - runs all checks concurrently, results are in order of checks.
+func (m *Monitor) run(ctx context.Context) []CheckResult {
+	results := make([]CheckResult, len(m.checks))
+	wg := sync.WaitGroup{}
+	for i, c := range m.checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, CheckTimeout)
+			defer cancel()
+			start := time.Now()
+			err := c.Run(ctx)
+			results[i] = CheckResult{Name: c.Name, Status: StatusOK, Latency: time.Since(start).String()}
+			if err != nil {
+				results[i].Status, results[i].Error = StatusFailed, err.Error()
+			}
+		}(i, c)
+	}
+	wg.Wait()
+	return results
+}
+
+func readBuildInfo() BuildInfo {
+	b := BuildInfo{GoVersion: runtime.Version()}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Module = info.Main.Path
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			b.Revision = s.Value
+		case "vcs.time":
+			b.Time = s.Value
+		case "vcs.modified":
+			b.Modified = s.Value == "true"
+		}
+	}
+	return b
+}
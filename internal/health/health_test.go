@@ -0,0 +1,43 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestMonitor(t *testing.T) {
+	dbErr := error(nil)
+	m := NewMonitor(
+		"1.0.0",
+		Check{Name: "database", Run: func(ctx context.Context) error { return dbErr }},
+		Check{Name: "schema", Run: func(ctx context.Context) error { return nil }},
+	)
+	if err := m.Ready(context.Background()); err != nil {
+		t.Errorf("Server is not ready: %s", err)
+	}
+	report := m.Status(context.Background())
+	if report.Status != StatusOK || report.Version != "1.0.0" || report.Build.GoVersion == "" || len(report.Checks) != 2 {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	dbErr = errors.New("connection refused")
+	if err := m.Ready(context.Background()); err == nil || err.Error() != "database: connection refused" {
+		t.Errorf("Unexpected readiness error: %v", err)
+	}
+	report = m.Status(context.Background())
+	if report.Status != StatusFailed ||
+		report.Checks[0].Status != StatusFailed || report.Checks[0].Error != "connection refused" ||
+		report.Checks[1].Name != "schema" || report.Checks[1].Status != StatusOK {
+		t.Errorf("Unexpected report: %+v", report)
+	}
+
+	dbErr = nil
+	m.Drain()
+	if err := m.Ready(context.Background()); err != ErrDraining {
+		t.Errorf("Draining server is ready: %v", err)
+	}
+	if report = m.Status(context.Background()); report.Status != StatusDraining {
+		t.Errorf("Unexpected status of draining server: %s", report.Status)
+	}
+}
@@ -0,0 +1,259 @@
+// Package lifecycle runs components of the server and stops them in reverse order
+// on termination signal, cancellation of the context or failure of any component.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/logging"
+)
+
+// Exit codes of the process returned by Run
+const (
+	ExitOK         = 0 // stopped by signal or context
+	ExitRunFailed  = 1 // any component failed to run
+	ExitStopFailed = 3 // components were not stopped in time or stopped with an error
+)
+
+// DefaultTimeout - max duration of the shutdown
+const DefaultTimeout = 10 * time.Second
+
+// Component - part of the server; both functions are optional
+type Component struct {
+	Name string
+	// Run - blocks until component is stopped, error initiates shutdown of the server
+	Run func() error
+	// Stop - makes Run return, must respect deadline of the context
+	Stop func(ctx context.Context) error
+}
+
+// Lifecycle - ordered components of the server
+type Lifecycle struct {
+	components []Component
+	signals    []os.Signal
+	timeout    time.Duration
+	logger     *slog.Logger
+}
+
+type lifecycleOption func(*Lifecycle)
+
+// New - creates lifecycle, which stops on SIGINT and SIGTERM within DefaultTimeout by default.
+func New(options ...lifecycleOption) *Lifecycle {
+	lc := (&Lifecycle{}).alter(options...)
+	if lc.signals == nil {
+		lc.signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	if lc.timeout <= 0 {
+		lc.timeout = DefaultTimeout
+	}
+	if lc.logger == nil {
+		lc.logger = logging.Discard()
+	}
+	return lc
+}
+
+func (lc *Lifecycle) alter(options ...lifecycleOption) *Lifecycle {
+	if lc == nil {
+		return nil
+	}
+	for _, o := range options {
+		if o != nil {
+			o(lc)
+		}
+	}
+	return lc
+}
+
+// WithSignals - initialize lifecycle with signals to stop on, overrides SIGINT and SIGTERM.
+func WithSignals(signals ...os.Signal) lifecycleOption {
+	return func(lc *Lifecycle) {
+		lc.signals = append([]os.Signal{}, signals...)
+	}
+}
+
+// WithTimeout - initialize lifecycle with max duration of stopping all components.
+func WithTimeout(timeout time.Duration) lifecycleOption {
+	return func(lc *Lifecycle) {
+		lc.timeout = timeout
+	}
+}
+
+// WithLogger - initialize lifecycle with logger to report start and stop of the server.
+func WithLogger(l *slog.Logger) lifecycleOption {
+	return func(lc *Lifecycle) {
+		lc.logger = l
+	}
+}
+
+// Add - appends component, components are stopped in reverse order of adding.
+func (lc *Lifecycle) Add(c Component) {
+	lc.components = append(lc.components, c)
+}
+
+// Run - runs all components and waits for signal, done context or failure of any component,
+// then stops components in reverse order within timeout. Returns exit code of the process.
+func (lc *Lifecycle) Run(ctx context.Context) int {
+	sig := make(chan os.Signal, 1)
+	if len(lc.signals) > 0 {
+		signal.Notify(sig, lc.signals...)
+		defer signal.Stop(sig)
+	}
+
+	failed := make(chan error, len(lc.components))
+	running := sync.WaitGroup{}
+	for _, c := range lc.components {
+		if c.Run == nil {
+			continue
+		}
+		running.Add(1)
+		go func(c Component) {
+			defer running.Done()
+			if err := c.Run(); err != nil {
+				failed <- fmt.Errorf("%s: %w", c.Name, err)
+			}
+		}(c)
+	}
+	lc.logger.Info("Server is running")
+
+	code := ExitOK
+	select {
+	case s := <-sig:
+		lc.logger.Info("Server is shutting down", "signal", s.String())
+	case <-ctx.Done():
+		lc.logger.Info("Server is shutting down", "reason", ctx.Err())
+	case err := <-failed:
+		lc.logger.Error("Server component failed", "error", err)
+		code = ExitRunFailed
+	}
+
+	shutdown, cancel := context.WithTimeout(context.Background(), lc.timeout)
+	defer cancel()
+	for i := len(lc.components) - 1; i >= 0; i-- {
+		c := lc.components[i]
+		if c.Stop == nil {
+			continue
+		}
+		if err := c.Stop(shutdown); err != nil {
+			lc.logger.Error("Server component stopped with an error", "component", c.Name, "error", err)
+			if code == ExitOK {
+				code = ExitStopFailed
+			}
+			continue
+		}
+		lc.logger.Debug("Server component stopped", "component", c.Name)
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-shutdown.Done():
+		lc.logger.Error("Server components are not stopped in time", "timeout", lc.timeout.String())
+		if code == ExitOK {
+			code = ExitStopFailed
+		}
+	}
+	if code == ExitOK {
+		lc.logger.Info("Server successfully stopped")
+	}
+	return code
+}
+
+// Server - component serving HTTP requests on the listener or on the address of the server if listener is nil;
+// requests are served over TLS (and HTTP/2) if the server has TLS config with certificate.
+// In-flight requests are drained on stop.
+func Server(name string, s *http.Server, l net.Listener) Component {
+	return Component{
+		Name: name,
+		Run: func() error {
+			var err error
+			switch {
+			case s.TLSConfig != nil && l != nil:
+				err = s.ServeTLS(l, "", "")
+			case s.TLSConfig != nil:
+				err = s.ListenAndServeTLS("", "")
+			case l != nil:
+				err = s.Serve(l)
+			default:
+				err = s.ListenAndServe()
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				return nil
+			}
+			return err
+		},
+		Stop: func(ctx context.Context) error {
+			s.SetKeepAlivesEnabled(false)
+			return s.Shutdown(ctx)
+		},
+	}
+}
+
+// Drain - component marking the server as not ready on stop and waiting for the delay, so load balancers
+// notice failed readiness probe and stop sending new requests before servers added earlier are stopped;
+// waiting is limited by the shutdown timeout.
+func Drain(name string, notReady func(), delay time.Duration) Component {
+	return Component{
+		Name: name,
+		Stop: func(ctx context.Context) error {
+			notReady()
+			if delay <= 0 {
+				return nil
+			}
+			t := time.NewTimer(delay)
+			defer t.Stop()
+			select {
+			case <-t.C:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		},
+	}
+}
+
+// Worker - component running the function until it is stopped, the context of the function is canceled on stop.
+func Worker(name string, run func(ctx context.Context)) Component {
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	return Component{
+		Name: name,
+		Run: func() error {
+			defer close(done)
+			run(ctx)
+			return nil
+		},
+		Stop: func(deadline context.Context) error {
+			cancel()
+			select {
+			case <-done:
+				return nil
+			case <-deadline.Done():
+				return deadline.Err()
+			}
+		},
+	}
+}
+
+// Closer - component closing resource on stop, like storage.
+func Closer(name string, close func() error) Component {
+	return Component{
+		Name: name,
+		Stop: func(context.Context) error {
+			return close()
+		},
+	}
+}
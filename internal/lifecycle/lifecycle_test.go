@@ -0,0 +1,220 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func listen(t *testing.T) net.Listener {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+func TestServerDrainsRequests(t *testing.T) {
+	started := make(chan struct{})
+	server := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			time.Sleep(200 * time.Millisecond)
+			io.WriteString(w, "done")
+		}),
+	}
+	l := listen(t)
+	url := "http://" + l.Addr().String() + "/"
+
+	lc := New(WithSignals())
+	lc.Add(Server("api", server, l))
+	ctx, cancel := context.WithCancel(context.Background())
+	code := make(chan int, 1)
+	go func() {
+		code <- lc.Run(ctx)
+	}()
+
+	response := make(chan string, 1)
+	go func() {
+		resp, err := http.Get(url)
+		if err != nil {
+			response <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		response <- string(b)
+	}()
+	select {
+	case <-started:
+	case <-time.After(time.Second):
+		t.Fatal("Request is not started")
+	}
+	cancel()
+	if r := <-response; r != "done" {
+		t.Errorf("In-flight request is not completed: %s", r)
+	}
+	if c := <-code; c != ExitOK {
+		t.Errorf("Unexpected exit code: %d", c)
+	}
+	if _, err := http.Get(url); err == nil {
+		t.Errorf("Server accepts requests after stop")
+	}
+}
+
+func TestDrainDelay(t *testing.T) {
+	l := listen(t)
+	url := "http://" + l.Addr().String() + "/"
+	lc := New(WithSignals())
+	lc.Add(Server("api", &http.Server{Handler: http.NotFoundHandler()}, l))
+	draining := make(chan struct{})
+	lc.Add(Drain("readiness", func() { close(draining) }, 200*time.Millisecond))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	code := make(chan int, 1)
+	go func() {
+		code <- lc.Run(ctx)
+	}()
+	cancel()
+	<-draining
+	// new requests are still served, while load balancers notice the server is not ready
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("Server does not accept requests during drain delay: %s", err.Error())
+	}
+	resp.Body.Close()
+	select {
+	case c := <-code:
+		t.Fatalf("Server is stopped before drain delay with code %d", c)
+	case <-time.After(100 * time.Millisecond):
+	}
+	if c := <-code; c != ExitOK {
+		t.Errorf("Unexpected exit code: %d", c)
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	lc := New(WithSignals(), WithTimeout(50*time.Millisecond))
+	lc.Add(Drain("readiness", func() {}, time.Second))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if code := lc.Run(ctx); code != ExitStopFailed {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Timeout is not respected")
+	}
+}
+
+func TestStopOrder(t *testing.T) {
+	mu := sync.Mutex{}
+	stopped := []string{}
+	stop := func(name string) func(context.Context) error {
+		return func(context.Context) error {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+			return nil
+		}
+	}
+	worked := make(chan struct{})
+	lc := New(WithSignals())
+	lc.Add(Component{Name: "storage", Stop: stop("storage")})
+	lc.Add(Worker("jobs", func(ctx context.Context) {
+		close(worked)
+		<-ctx.Done()
+		stop("jobs")(ctx)
+	}))
+	lc.Add(Component{Name: "server", Stop: stop("server")})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		<-worked
+		cancel()
+	}()
+	if code := lc.Run(ctx); code != ExitOK {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if s := strings.Join(stopped, " "); s != "server jobs storage" {
+		t.Errorf("Unexpected stop order: %s", s)
+	}
+}
+
+func TestRunFailure(t *testing.T) {
+	busy := listen(t)
+	defer busy.Close()
+	closed := false
+	lc := New(WithSignals())
+	lc.Add(Closer("storage", func() error {
+		closed = true
+		return nil
+	}))
+	lc.Add(Server("api", &http.Server{Addr: busy.Addr().String()}, nil))
+	if code := lc.Run(context.Background()); code != ExitRunFailed {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if !closed {
+		t.Errorf("Storage is not closed after failure")
+	}
+}
+
+func TestStopTimeout(t *testing.T) {
+	lc := New(WithSignals(), WithTimeout(50*time.Millisecond))
+	lc.Add(Worker("stuck", func(context.Context) {
+		time.Sleep(time.Second)
+	}))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	start := time.Now()
+	if code := lc.Run(ctx); code != ExitStopFailed {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+	if time.Since(start) > 500*time.Millisecond {
+		t.Errorf("Timeout is not respected")
+	}
+}
+
+func TestStopError(t *testing.T) {
+	lc := New(WithSignals())
+	lc.Add(Closer("storage", func() error { return errors.New("close failed") }))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if code := lc.Run(ctx); code != ExitStopFailed {
+		t.Errorf("Unexpected exit code: %d", code)
+	}
+}
+
+func TestSignal(t *testing.T) {
+	running := make(chan struct{})
+	lc := New(WithSignals(syscall.SIGHUP))
+	lc.Add(Worker("jobs", func(ctx context.Context) {
+		close(running)
+		<-ctx.Done()
+	}))
+	go func() {
+		<-running
+		p, _ := os.FindProcess(os.Getpid())
+		p.Signal(syscall.SIGHUP)
+	}()
+	code := make(chan int, 1)
+	go func() {
+		code <- lc.Run(context.Background())
+	}()
+	select {
+	case c := <-code:
+		if c != ExitOK {
+			t.Errorf("Unexpected exit code: %d", c)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Server is not stopped on signal")
+	}
+}
@@ -0,0 +1,68 @@
+// Package listener opens Unix sockets and takes sockets passed by systemd socket activation.
+package listener
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// systemdFirstFD - first file descriptor passed by systemd, SD_LISTEN_FDS_START
+const systemdFirstFD = 3
+
+// Unix - listens on Unix socket, stale socket file left by previous process is removed;
+// socket file is removed when listener is closed.
+func Unix(path string) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil {
+		if fi.Mode()&os.ModeSocket == 0 {
+			return nil, fmt.Errorf("listener.Unix: %s exists and is not a socket", path)
+		}
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("listener.Unix: %s", err.Error())
+		}
+	}
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, fmt.Errorf("listener.Unix: %s", err.Error())
+	}
+	return l, nil
+}
+
+// Systemd - returns listeners passed by systemd socket activation (LISTEN_PID and LISTEN_FDS variables),
+// the variables are unset so child processes do not inherit them.
+func Systemd() ([]net.Listener, error) {
+	pid, fds := os.Getenv("LISTEN_PID"), os.Getenv("LISTEN_FDS")
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+	if pid != strconv.Itoa(os.Getpid()) {
+		return nil, errors.New("listener.Systemd: sockets are not passed to the process")
+	}
+	n, err := strconv.Atoi(fds)
+	if err != nil || n < 1 {
+		return nil, fmt.Errorf("listener.Systemd: invalid LISTEN_FDS %q", fds)
+	}
+	listeners := make([]net.Listener, 0, n)
+	for i := 0; i < n; i++ {
+		name := "LISTEN_FD_" + strconv.Itoa(systemdFirstFD+i)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		f := os.NewFile(uintptr(systemdFirstFD+i), name)
+		// listener gets its own duplicate of the descriptor
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			for _, l := range listeners {
+				l.Close()
+			}
+			return nil, fmt.Errorf("listener.Systemd: %s: %s", name, err.Error())
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
@@ -0,0 +1,56 @@
+package listener
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "pwsrv.sock")
+	l, err := Unix(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	// stale socket is replaced by the next process
+	l.(*net.UnixListener).SetUnlinkOnClose(false)
+	l.Close()
+	l, err = Unix(path)
+	if err != nil {
+		t.Fatalf("Stale socket is not replaced: %v", err)
+	}
+	l.Close()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Socket file is not removed on close")
+	}
+
+	if err := os.WriteFile(path, []byte("data"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unix(path); err == nil {
+		t.Errorf("Regular file is replaced with socket")
+	}
+}
+
+func TestSystemd(t *testing.T) {
+	t.Setenv("LISTEN_PID", "1")
+	t.Setenv("LISTEN_FDS", "1")
+	if _, err := Systemd(); err == nil {
+		t.Errorf("Sockets of another process are taken")
+	}
+	if os.Getenv("LISTEN_FDS") != "" {
+		t.Errorf("Variables are not unset")
+	}
+	t.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	t.Setenv("LISTEN_FDS", "0")
+	if _, err := Systemd(); err == nil {
+		t.Errorf("Empty list of sockets is accepted")
+	}
+}
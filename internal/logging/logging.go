@@ -0,0 +1,109 @@
+// Package logging builds structured leveled loggers
+// and carries request-scoped logger within the context.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	// FormatJSON - one JSON object per record
+	FormatJSON = "json"
+	// FormatLogfmt - one line of key=value pairs per record
+	FormatLogfmt = "logfmt"
+)
+
+type contextKey int
+
+const (
+	_ contextKey = iota
+	loggerKey
+)
+
+// ParseLevel - converts level name (debug, info, warn, error) into slog.Level, empty name means info.
+func ParseLevel(name string) (slog.Level, error) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "", "info":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+	return slog.LevelInfo, fmt.Errorf("logging: unknown level %q", name)
+}
+
+// New - creates logger writing records of given format and level into the writer,
+// empty format means logfmt.
+func New(w io.Writer, format, level string) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	return NewWithLeveler(w, format, lvl)
+}
+
+// NewWithLeveler - creates logger like New, which level is changed at runtime with slog.LevelVar.
+func NewWithLeveler(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	if w == nil {
+		return nil, fmt.Errorf("logging: writer is nil")
+	}
+	options := &slog.HandlerOptions{Level: level}
+	switch strings.ToLower(format) {
+	case FormatJSON:
+		return slog.New(slog.NewJSONHandler(w, options)), nil
+	case "", FormatLogfmt:
+		return slog.New(slog.NewTextHandler(w, options)), nil
+	}
+	return nil, fmt.Errorf("logging: unknown format %q", format)
+}
+
+// Open - returns writer for the output, which is "stderr", "stdout" or path of the file to append records;
+// empty output means stderr.
+func Open(output string) (io.WriteCloser, error) {
+	switch output {
+	case "", "stderr":
+		return nopCloser{os.Stderr}, nil
+	case "stdout":
+		return nopCloser{os.Stdout}, nil
+	}
+	f, err := os.OpenFile(output, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0640)
+	if err != nil {
+		return nil, fmt.Errorf("logging: %s", err.Error())
+	}
+	return f, nil
+}
+
+// nopCloser - standard stream, which must not be closed with the logger
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
+}
+
+// Discard - returns logger which drops all records.
+func Discard() *slog.Logger {
+	return slog.New(slog.DiscardHandler)
+}
+
+// WithContext - returns copy of the context carrying the logger.
+func WithContext(ctx context.Context, l *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, l)
+}
+
+// FromContext - returns logger from the context or fallback if context has no logger.
+func FromContext(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if l, ok := ctx.Value(loggerKey).(*slog.Logger); ok && l != nil {
+		return l
+	}
+	return fallback
+}
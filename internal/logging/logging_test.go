@@ -0,0 +1,88 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	cases := map[string]slog.Level{
+		"":      slog.LevelInfo,
+		"debug": slog.LevelDebug,
+		"INFO":  slog.LevelInfo,
+		"warn":  slog.LevelWarn,
+		"error": slog.LevelError,
+	}
+	for name, expected := range cases {
+		if actual, err := ParseLevel(name); err != nil || actual != expected {
+			t.Errorf("Unexpected level for %q: %s, %v", name, actual, err)
+		}
+	}
+	if _, err := ParseLevel("verbose"); err == nil {
+		t.Error("Unknown level is accepted")
+	}
+}
+
+func TestNew(t *testing.T) {
+	buf := bytes.Buffer{}
+	l, err := New(&buf, FormatJSON, "warn")
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Info("skipped")
+	l.Warn("written", "user_id", 1)
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Unexpected records: %q", buf.String())
+	}
+	record := map[string]interface{}{}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatal(err)
+	}
+	if record["msg"] != "written" || record["level"] != "WARN" || record["user_id"] != 1.0 {
+		t.Errorf("Unexpected record: %v", record)
+	}
+
+	buf.Reset()
+	if l, err = New(&buf, FormatLogfmt, "info"); err != nil {
+		t.Fatal(err)
+	}
+	l.Info("written", "request_id", "abc")
+	if !strings.Contains(buf.String(), `msg=written request_id=abc`) {
+		t.Errorf("Unexpected logfmt record: %q", buf.String())
+	}
+
+	if _, err := New(&buf, "xml", "info"); err == nil {
+		t.Error("Unknown format is accepted")
+	}
+}
+
+func TestContext(t *testing.T) {
+	fallback := Discard()
+	if FromContext(context.Background(), fallback) != fallback {
+		t.Error("Fallback is expected for empty context")
+	}
+	l := Discard().With("request_id", "abc")
+	if FromContext(WithContext(context.Background(), l), fallback) != l {
+		t.Error("Logger is not found in context")
+	}
+}
+
+func TestNewWithLeveler(t *testing.T) {
+	buf := bytes.Buffer{}
+	level := new(slog.LevelVar)
+	l, err := NewWithLeveler(&buf, FormatLogfmt, level)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Debug("skipped")
+	level.Set(slog.LevelDebug)
+	l.With("component", "storage").Debug("written")
+	if out := buf.String(); strings.Contains(out, "skipped") || !strings.Contains(out, "written") {
+		t.Errorf("Level is not changed: %q", out)
+	}
+}
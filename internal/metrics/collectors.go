@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bufio"
+	"database/sql"
+	"fmt"
+	"runtime"
+)
+
+// writeSingle - writes family of single unlabeled sample.
+func writeSingle(w *bufio.Writer, name, help, kind string, value float64) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %s\n", name, escapeHelp(help), name, kind, name, formatValue(value))
+}
+
+// runtimeCollector - Go runtime stats, memory stats are read once per exposition
+type runtimeCollector struct{}
+
+// RegisterRuntime - registers Go runtime stats.
+func (r *Registry) RegisterRuntime() {
+	r.register(runtimeCollector{})
+}
+
+func (runtimeCollector) name() string {
+	return "go_"
+}
+
+func (runtimeCollector) write(w *bufio.Writer) {
+	ms := runtime.MemStats{}
+	runtime.ReadMemStats(&ms)
+	writeSingle(w, "go_gc_cycles_total", "Number of completed GC cycles.", "counter", float64(ms.NumGC))
+	writeSingle(w, "go_gc_pause_seconds_total", "Total GC pause duration.", "counter", float64(ms.PauseTotalNs)/1e9)
+	writeSingle(w, "go_goroutines", "Number of goroutines that currently exist.", "gauge", float64(runtime.NumGoroutine()))
+	writeSingle(w, "go_gomaxprocs", "Number of OS threads executing Go code simultaneously.", "gauge", float64(runtime.GOMAXPROCS(0)))
+	fmt.Fprintf(
+		w,
+		"# HELP go_info Information about the Go environment.\n# TYPE go_info gauge\ngo_info{version=\"%s\"} 1\n",
+		escapeLabel(runtime.Version()),
+	)
+	writeSingle(w, "go_memstats_alloc_bytes", "Bytes of allocated heap objects.", "gauge", float64(ms.Alloc))
+	writeSingle(w, "go_memstats_alloc_bytes_total", "Cumulative bytes allocated for heap objects.", "counter", float64(ms.TotalAlloc))
+	writeSingle(w, "go_memstats_heap_inuse_bytes", "Bytes in in-use heap spans.", "gauge", float64(ms.HeapInuse))
+	writeSingle(w, "go_memstats_heap_objects", "Number of allocated heap objects.", "gauge", float64(ms.HeapObjects))
+	writeSingle(w, "go_memstats_sys_bytes", "Bytes of memory obtained from the OS.", "gauge", float64(ms.Sys))
+}
+
+// dbCollector - connection pool stats of the database
+type dbCollector struct {
+	prefix string
+	stats  func() sql.DBStats
+}
+
+// RegisterDBStats - registers connection pool stats returned by the function, names of metrics start with prefix.
+func (r *Registry) RegisterDBStats(prefix string, stats func() sql.DBStats) {
+	if !isValidName(prefix) {
+		panic(fmt.Errorf("metrics: invalid prefix %q", prefix))
+	}
+	r.register(&dbCollector{prefix: prefix, stats: stats})
+}
+
+func (c *dbCollector) name() string {
+	return c.prefix
+}
+
+func (c *dbCollector) write(w *bufio.Writer) {
+	s := c.stats()
+	p := c.prefix
+	writeSingle(w, p+"max_open_connections", "Maximum number of open connections to the database.", "gauge", float64(s.MaxOpenConnections))
+	writeSingle(w, p+"open_connections", "Number of established connections both in use and idle.", "gauge", float64(s.OpenConnections))
+	writeSingle(w, p+"in_use_connections", "Number of connections currently in use.", "gauge", float64(s.InUse))
+	writeSingle(w, p+"idle_connections", "Number of idle connections.", "gauge", float64(s.Idle))
+	writeSingle(w, p+"wait_count_total", "Total number of connections waited for.", "counter", float64(s.WaitCount))
+	writeSingle(w, p+"wait_duration_seconds_total", "Total time blocked waiting for a new connection.", "counter", s.WaitDuration.Seconds())
+	writeSingle(w, p+"max_idle_closed_total", "Total number of connections closed due to idle limit.", "counter", float64(s.MaxIdleClosed))
+	writeSingle(w, p+"max_lifetime_closed_total", "Total number of connections closed due to lifetime limit.", "counter", float64(s.MaxLifetimeClosed))
+}
@@ -0,0 +1,310 @@
+// Package metrics implements counters, gauges and histograms
+// exposed in Prometheus text exposition format (version 0.0.4).
+package metrics
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ContentType - content type of the Prometheus text exposition format
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// DefaultBuckets - upper bounds of histogram buckets suitable for request latency in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// family - group of samples with common name, help and type
+type family interface {
+	name() string
+	write(w *bufio.Writer)
+}
+
+// Registry - set of metric families to expose
+type Registry struct {
+	mu       sync.Mutex
+	families []family
+	names    map[string]bool
+}
+
+// NewRegistry - creates empty registry.
+func NewRegistry() *Registry {
+	return &Registry{names: map[string]bool{}}
+}
+
+// register - adds family into registry, panics if the name is already registered.
+func (r *Registry) register(f family) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.names[f.name()] {
+		panic(fmt.Errorf("metrics: %q is already registered", f.name()))
+	}
+	r.names[f.name()] = true
+	r.families = append(r.families, f)
+}
+
+// WriteTo - writes all registered families in text exposition format.
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	families := append([]family{}, r.families...)
+	r.mu.Unlock()
+	sort.Slice(families, func(i, j int) bool { return families[i].name() < families[j].name() })
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range families {
+		f.write(bw)
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// Handler - returns http-handler exposing the registry.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		r.WriteTo(w)
+	})
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// vec - values of the family indexed by label values
+type vec struct {
+	fname  string
+	help   string
+	kind   string
+	labels []string
+	mu     sync.Mutex
+	keys   []string
+	values map[string][]string
+}
+
+func newVec(name, help, kind string, labels []string) vec {
+	if !isValidName(name) {
+		panic(fmt.Errorf("metrics: invalid name %q", name))
+	}
+	for _, l := range labels {
+		if !isValidName(l) || l == "le" {
+			panic(fmt.Errorf("metrics: invalid label %q of %q", l, name))
+		}
+	}
+	return vec{fname: name, help: help, kind: kind, labels: labels, values: map[string][]string{}}
+}
+
+func (v *vec) name() string {
+	return v.fname
+}
+
+// key - returns key of label values, panics if number of values is wrong;
+// must be called under lock, registers new key.
+func (v *vec) key(values []string) (string, bool) {
+	if len(values) != len(v.labels) {
+		panic(fmt.Errorf("metrics: %q expects %d label values, got %d", v.fname, len(v.labels), len(values)))
+	}
+	k := strings.Join(values, "\xff")
+	if _, ok := v.values[k]; ok {
+		return k, false
+	}
+	v.keys = append(v.keys, k)
+	v.values[k] = append([]string{}, values...)
+	return k, true
+}
+
+// header - writes HELP and TYPE lines.
+func (v *vec) header(w *bufio.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", v.fname, escapeHelp(v.help), v.fname, v.kind)
+}
+
+// labelPairs - formats labels of the key with optional extra pair.
+func (v *vec) labelPairs(k string, extraName, extraValue string) string {
+	pairs := []string{}
+	for i, value := range v.values[k] {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, v.labels[i], escapeLabel(value)))
+	}
+	if extraName != "" {
+		pairs = append(pairs, fmt.Sprintf(`%s="%s"`, extraName, extraValue))
+	}
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// sortedKeys - keys in order of label values to produce stable output.
+func (v *vec) sortedKeys() []string {
+	keys := append([]string{}, v.keys...)
+	sort.Strings(keys)
+	return keys
+}
+
+// CounterVec - counters partitioned by label values
+type CounterVec struct {
+	vec
+	counts map[string]float64
+}
+
+// NewCounterVec - creates and registers counter family.
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{vec: newVec(name, help, "counter", labels), counts: map[string]float64{}}
+	r.register(c)
+	return c
+}
+
+// Add - increases counter with given label values, panics on negative delta.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(errors.New("metrics: counter can not decrease"))
+	}
+	c.mu.Lock()
+	k, _ := c.key(values)
+	c.counts[k] += delta
+	c.mu.Unlock()
+}
+
+// Inc - increases counter with given label values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+func (c *CounterVec) write(w *bufio.Writer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.header(w)
+	for _, k := range c.sortedKeys() {
+		fmt.Fprintf(w, "%s%s %s\n", c.fname, c.labelPairs(k, "", ""), formatValue(c.counts[k]))
+	}
+}
+
+// HistogramVec - histograms partitioned by label values
+type HistogramVec struct {
+	vec
+	buckets []float64
+	counts  map[string][]uint64
+	sums    map[string]float64
+	totals  map[string]uint64
+}
+
+// NewHistogramVec - creates and registers histogram family with given upper bounds of buckets.
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	b := append([]float64{}, buckets...)
+	sort.Float64s(b)
+	h := &HistogramVec{
+		vec:     newVec(name, help, "histogram", labels),
+		buckets: b,
+		counts:  map[string][]uint64{},
+		sums:    map[string]float64{},
+		totals:  map[string]uint64{},
+	}
+	r.register(h)
+	return h
+}
+
+// Observe - adds observation into histogram with given label values.
+func (h *HistogramVec) Observe(value float64, values ...string) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	k, created := h.key(values)
+	if created {
+		h.counts[k] = make([]uint64, len(h.buckets))
+	}
+	for i, upper := range h.buckets {
+		if value <= upper {
+			h.counts[k][i]++
+		}
+	}
+	h.sums[k] += value
+	h.totals[k]++
+}
+
+func (h *HistogramVec) write(w *bufio.Writer) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.header(w)
+	for _, k := range h.sortedKeys() {
+		for i, upper := range h.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, h.labelPairs(k, "le", formatValue(upper)), h.counts[k][i])
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.fname, h.labelPairs(k, "le", "+Inf"), h.totals[k])
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.fname, h.labelPairs(k, "", ""), formatValue(h.sums[k]))
+		fmt.Fprintf(w, "%s_count%s %d\n", h.fname, h.labelPairs(k, "", ""), h.totals[k])
+	}
+}
+
+// funcFamily - single sample calculated on every exposition
+type funcFamily struct {
+	vec
+	f func() float64
+}
+
+// NewGaugeFunc - registers gauge, which value is returned by the function.
+func (r *Registry) NewGaugeFunc(name, help string, f func() float64) {
+	r.register(&funcFamily{vec: newVec(name, help, "gauge", nil), f: f})
+}
+
+// NewCounterFunc - registers counter, which value is returned by the function.
+func (r *Registry) NewCounterFunc(name, help string, f func() float64) {
+	r.register(&funcFamily{vec: newVec(name, help, "counter", nil), f: f})
+}
+
+func (g *funcFamily) write(w *bufio.Writer) {
+	g.header(w)
+	fmt.Fprintf(w, "%s %s\n", g.fname, formatValue(g.f()))
+}
+
+func isValidName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == ':':
+		case c >= '0' && c <= '9' && i > 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+func escapeHelp(s string) string {
+	return helpEscaper.Replace(s)
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(s string) string {
+	return labelEscaper.Replace(s)
+}
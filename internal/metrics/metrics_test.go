@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"bytes"
+	"database/sql"
+	"strings"
+	"testing"
+)
+
+func exposition(t *testing.T, r *Registry) string {
+	buf := bytes.Buffer{}
+	if _, err := r.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestCounterVec(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("pwsrv_logins_total", "Number of login attempts.", "outcome")
+	c.Inc("success")
+	c.Inc("failure")
+	c.Add(2, "success")
+	expected := `# HELP pwsrv_logins_total Number of login attempts.
+# TYPE pwsrv_logins_total counter
+pwsrv_logins_total{outcome="failure"} 1
+pwsrv_logins_total{outcome="success"} 3
+`
+	if actual := exposition(t, r); actual != expected {
+		t.Errorf("Unexpected exposition:\n%s", actual)
+	}
+}
+
+func TestHistogramVec(t *testing.T) {
+	r := NewRegistry()
+	h := r.NewHistogramVec("latency_seconds", "Latency.", []float64{1, 0.1}, "route")
+	h.Observe(0.05, `/a"b\`)
+	h.Observe(0.5, `/a"b\`)
+	h.Observe(5, `/a"b\`)
+	expected := `# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{route="/a\"b\\",le="0.1"} 1
+latency_seconds_bucket{route="/a\"b\\",le="1"} 2
+latency_seconds_bucket{route="/a\"b\\",le="+Inf"} 3
+latency_seconds_sum{route="/a\"b\\"} 5.55
+latency_seconds_count{route="/a\"b\\"} 3
+`
+	if actual := exposition(t, r); actual != expected {
+		t.Errorf("Unexpected exposition:\n%s", actual)
+	}
+}
+
+func TestCollectors(t *testing.T) {
+	r := NewRegistry()
+	r.NewGaugeFunc("pwsrv_up", "Server is up.", func() float64 { return 1 })
+	r.RegisterRuntime()
+	r.RegisterDBStats("pwsrv_db_", func() sql.DBStats { return sql.DBStats{OpenConnections: 3} })
+	actual := exposition(t, r)
+	for _, line := range []string{"\npwsrv_up 1\n", "\npwsrv_db_open_connections 3\n", "\ngo_goroutines "} {
+		if !strings.Contains(actual, line) {
+			t.Errorf("Exposition has no %q:\n%s", line, actual)
+		}
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Duplicate registration is accepted")
+		}
+	}()
+	r := NewRegistry()
+	r.NewCounterVec("requests_total", "Requests.")
+	r.NewCounterVec("requests_total", "Requests.")
+}
@@ -0,0 +1,41 @@
+package model
+
+import (
+	"time"
+)
+
+// AuditOutcome - result of the audited action
+type AuditOutcome string
+
+const (
+	// AuditSuccess - action was completed
+	AuditSuccess AuditOutcome = "success"
+	// AuditFailure - action was rejected, for example because of wrong credentials or insufficient funds
+	AuditFailure AuditOutcome = "failure"
+	// AuditDenied - actor has no authority to perform the action
+	AuditDenied AuditOutcome = "denied"
+)
+
+// AuditEntry - append-only record of security- or money-relevant action.
+// Every entry is chained with the previous one via hash, so changing or removing entries is detectable.
+type AuditEntry struct {
+	ID        uint64       `gorm:"primary_key" json:"id,string"`
+	CreatedAt time.Time    `gorm:"not null;default:current_timestamp;index" json:"created_at"`
+	ActorID   uint64       `gorm:"not null;index" json:"actor_id,string"`
+	Action    string       `gorm:"type:varchar(64);not null;index" json:"action"`
+	Target    string       `gorm:"not null;default:''" json:"target,omitempty"`
+	ClientIP  string       `gorm:"type:varchar(64);not null;default:''" json:"client_ip"`
+	UserAgent string       `gorm:"not null;default:''" json:"user_agent,omitempty"`
+	RequestID string       `gorm:"type:varchar(64);not null;default:''" json:"request_id,omitempty"`
+	Outcome   AuditOutcome `gorm:"type:varchar(16);not null;index" json:"outcome"`
+	PrevHash  string       `gorm:"type:char(64);not null;default:''" json:"prev_hash"`
+	Hash      string       `gorm:"type:char(64);not null" json:"hash"`
+}
+
+// AuditChainHead - single row pointing to the last entry of the audit log,
+// locking it serializes appending entries to the chain.
+type AuditChainHead struct {
+	ID      uint64 `gorm:"primary_key;auto_increment:false"`
+	EntryID uint64 `gorm:"not null"`
+	Hash    string `gorm:"type:char(64);not null;default:''"`
+}
@@ -0,0 +1,21 @@
+package model
+
+import (
+	"time"
+)
+
+// Conversion - log of conversions between wallets of the same user
+type Conversion struct {
+	ID                uint64    `gorm:"primary_key" json:"id,string"`
+	CreatedAt         time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UserID            uint64    `gorm:"not null;index" json:"user_id,string"`
+	From              Currency  `gorm:"column:from_currency;type:varchar(8);not null" json:"from"`
+	To                Currency  `gorm:"column:to_currency;type:varchar(8);not null" json:"to"`
+	Rate              float64   `gorm:"not null" json:"rate,string"`
+	Sum               float64   `gorm:"not null" json:"sum,string"`
+	Result            float64   `gorm:"not null" json:"result,string"`
+	FromBalanceBefore float64   `gorm:"not null" json:"from_balance_before,string"`
+	FromBalanceAfter  float64   `gorm:"not null" json:"from_balance_after,string"`
+	ToBalanceBefore   float64   `gorm:"not null" json:"to_balance_before,string"`
+	ToBalanceAfter    float64   `gorm:"not null" json:"to_balance_after,string"`
+}
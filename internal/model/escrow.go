@@ -0,0 +1,61 @@
+package model
+
+import (
+	"time"
+)
+
+// EscrowStatus - state of the escrow transfer
+type EscrowStatus string
+
+const (
+	// EscrowPending - funds of the sender are reserved and wait for the settlement
+	EscrowPending EscrowStatus = "pending"
+	// EscrowDisputed - one of parties has opened a dispute, admin decision is required
+	EscrowDisputed EscrowStatus = "disputed"
+	// EscrowCompleted - funds were transferred to the recipient
+	EscrowCompleted EscrowStatus = "completed"
+	// EscrowRefunded - funds were returned to the sender
+	EscrowRefunded EscrowStatus = "refunded"
+)
+
+// escrowTransitions - allowed changes of escrow status
+var escrowTransitions = map[EscrowStatus][]EscrowStatus{
+	EscrowPending:  {EscrowDisputed, EscrowCompleted, EscrowRefunded},
+	EscrowDisputed: {EscrowCompleted, EscrowRefunded},
+}
+
+// CanBecome - checks the escrow in the current status is allowed to move into the next one.
+func (s EscrowStatus) CanBecome(next EscrowStatus) bool {
+	for _, allowed := range escrowTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// IsFinal - checks escrow in the status is settled.
+func (s EscrowStatus) IsFinal() bool {
+	return s == EscrowCompleted || s == EscrowRefunded
+}
+
+// Escrow - transfer which sits in escrow until it is confirmed by the sender,
+// released back by the recipient, resolved by admin or deadline passes.
+type Escrow struct {
+	ID          uint64       `gorm:"primary_key" json:"id,string"`
+	CreatedAt   time.Time    `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time    `gorm:"not null;default:current_timestamp on update current_timestamp" json:"updated_at"`
+	UserID      uint64       `gorm:"not null;index" json:"user_id,string"`
+	RecipientID uint64       `gorm:"not null;index" json:"recipient_id,string"`
+	Currency    Currency     `gorm:"type:varchar(8);not null" json:"currency"`
+	Sum         float64      `gorm:"not null" json:"sum,string"`
+	Memo        string       `gorm:"not null;default:''" json:"memo,omitempty"`
+	Status      EscrowStatus `gorm:"type:varchar(16);not null;index" json:"status"`
+	Deadline    time.Time    `gorm:"not null;index" json:"deadline"`
+	// OnDeadline - status, which escrow gets automatically when deadline passes (completed or refunded)
+	OnDeadline EscrowStatus `gorm:"type:varchar(16);not null" json:"on_deadline"`
+	DisputedBy uint64       `gorm:"not null;default:'0'" json:"disputed_by,string,omitempty"`
+	ResolvedBy uint64       `gorm:"not null;default:'0'" json:"resolved_by,string,omitempty"`
+	Note       string       `gorm:"not null;default:''" json:"note,omitempty"`
+	TransferID uint64       `gorm:"not null;default:'0'" json:"transfer_id,string,omitempty"`
+}
@@ -0,0 +1,28 @@
+package model
+
+import "testing"
+
+func TestEscrowTransitions(t *testing.T) {
+	cases := []struct {
+		from, to EscrowStatus
+		expected bool
+	}{
+		{EscrowPending, EscrowDisputed, true},
+		{EscrowPending, EscrowCompleted, true},
+		{EscrowPending, EscrowRefunded, true},
+		{EscrowDisputed, EscrowCompleted, true},
+		{EscrowDisputed, EscrowRefunded, true},
+		{EscrowPending, EscrowPending, false},
+		{EscrowDisputed, EscrowPending, false},
+		{EscrowDisputed, EscrowDisputed, false},
+		{EscrowCompleted, EscrowRefunded, false},
+		{EscrowRefunded, EscrowCompleted, false},
+		{EscrowCompleted, EscrowDisputed, false},
+		{"unknown", EscrowCompleted, false},
+	}
+	for _, c := range cases {
+		if c.from.CanBecome(c.to) != c.expected {
+			t.Errorf("Unexpected transition %s -> %s, expected %t", c.from, c.to, c.expected)
+		}
+	}
+}
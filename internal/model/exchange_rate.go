@@ -0,0 +1,15 @@
+package model
+
+import (
+	"time"
+)
+
+// ExchangeRate - admin maintained rate to convert funds between currencies:
+// 1 unit of From currency costs Rate units of To currency.
+type ExchangeRate struct {
+	ID        uint64    `gorm:"primary_key" json:"-"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp on update current_timestamp" json:"updated_at"`
+	From      Currency  `gorm:"column:from_currency;type:varchar(8);not null;unique_index:exchange_rate_pair" json:"from"`
+	To        Currency  `gorm:"column:to_currency;type:varchar(8);not null;unique_index:exchange_rate_pair" json:"to"`
+	Rate      float64   `gorm:"not null" json:"rate,string"`
+}
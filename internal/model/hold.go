@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+)
+
+// HoldStatus - state of the hold
+type HoldStatus string
+
+const (
+	// HoldActive - funds are reserved
+	HoldActive HoldStatus = "active"
+	// HoldCaptured - funds were transferred to the recipient, rest of reserved sum is released
+	HoldCaptured HoldStatus = "captured"
+	// HoldReleased - reservation was cancelled before capture
+	HoldReleased HoldStatus = "released"
+	// HoldExpired - reservation was not captured in time
+	HoldExpired HoldStatus = "expired"
+)
+
+// Hold - funds of the user reserved for the recipient to be captured later
+type Hold struct {
+	ID          uint64     `gorm:"primary_key" json:"id,string"`
+	CreatedAt   time.Time  `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time  `gorm:"not null;default:current_timestamp on update current_timestamp" json:"updated_at"`
+	UserID      uint64     `gorm:"not null;index" json:"user_id,string"`
+	RecipientID uint64     `gorm:"not null;index" json:"recipient_id,string"`
+	Currency    Currency   `gorm:"type:varchar(8);not null" json:"currency"`
+	Sum         float64    `gorm:"not null" json:"sum,string"`
+	Captured    float64    `gorm:"not null;default:'0'" json:"captured,string"`
+	Status      HoldStatus `gorm:"type:varchar(16);not null;index" json:"status"`
+	ExpiresAt   time.Time  `gorm:"not null;index" json:"expires_at"`
+	TransferID  uint64     `gorm:"not null;default:'0'" json:"transfer_id,string,omitempty"`
+}
@@ -10,7 +10,9 @@ type InternalTransfer struct {
 	CreatedAt   time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
 	UserID      uint64    `gorm:"not null;index" json:"user_id,string"`
 	RecipientID uint64    `gorm:"not null;index" json:"recipient_id,string"`
+	Currency    Currency  `gorm:"type:varchar(8);not null;index" json:"currency"`
 	Sum         float64   `gorm:"not null" json:"sum,string"`
+	Memo        string    `gorm:"not null;default:''" json:"memo,omitempty"`
 	// balances have `omitempty` because may are 2 kind of replies:
 	// sender must not see receiver's balance
 	// receiver must not see sender's balance
@@ -19,3 +21,10 @@ type InternalTransfer struct {
 	RecipientBalanceBefore float64 `gorm:"not null" json:"recipient_balance_before,string,omitempty"`
 	RecipientBalanceAfter  float64 `gorm:"not null" json:"recipient_balance_after,string,omitempty"`
 }
+
+// TransferOrder - single item of the batch transfer
+type TransferOrder struct {
+	RecipientID uint64
+	Sum         float64
+	Memo        string
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"time"
+)
+
+// OutboxEvent - domain event stored atomically with the state change
+type OutboxEvent struct {
+	ID        uint64    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp;index"`
+	Type      string    `gorm:"type:varchar(64);not null"`
+	Payload   string    `gorm:"type:text;not null"`
+}
+
+// EventOffset - ID of the last outbox event processed by the subscriber
+// and failed attempts to process the next one
+type EventOffset struct {
+	Subscriber    string    `gorm:"type:varchar(64);primary_key"`
+	UpdatedAt     time.Time `gorm:"not null;default:current_timestamp on update current_timestamp"`
+	EventID       uint64    `gorm:"not null"`
+	FailedEventID uint64    `gorm:"not null;default:'0'"`
+	Attempts      int       `gorm:"not null;default:'0'"`
+	RetryAt       *time.Time
+	LastError     string `gorm:"type:varchar(1024);not null;default:''"`
+}
+
+// EventDeadLetter - outbox event, which the subscriber failed to process, kept for manual processing
+type EventDeadLetter struct {
+	ID         uint64    `gorm:"primary_key"`
+	CreatedAt  time.Time `gorm:"not null;default:current_timestamp"`
+	Subscriber string    `gorm:"type:varchar(64);not null;unique_index:event_dead_letter_event"`
+	EventID    uint64    `gorm:"not null;unique_index:event_dead_letter_event"`
+	Type       string    `gorm:"type:varchar(64);not null"`
+	Payload    string    `gorm:"type:text;not null"`
+	Attempts   int       `gorm:"not null"`
+	Reason     string    `gorm:"type:varchar(1024);not null"`
+}
@@ -0,0 +1,60 @@
+package model
+
+import (
+	"time"
+)
+
+// SplitStatus - overall settlement state of the split bill
+type SplitStatus string
+
+const (
+	// SplitOpen - some of payment requests are not paid yet
+	SplitOpen SplitStatus = "open"
+	// SplitSettled - every participant has paid his share
+	SplitSettled SplitStatus = "settled"
+	// SplitCancelled - requester has cancelled the split, unpaid requests are cancelled too
+	SplitCancelled SplitStatus = "cancelled"
+	// SplitDeclined - no payment requests are pending, but some participants have declined their share
+	SplitDeclined SplitStatus = "declined"
+)
+
+// Split - shared cost which requester splits between participants
+type Split struct {
+	ID        uint64      `gorm:"primary_key" json:"id,string"`
+	CreatedAt time.Time   `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time   `gorm:"not null;default:current_timestamp on update current_timestamp" json:"updated_at"`
+	UserID    uint64      `gorm:"not null;index" json:"user_id,string"`
+	Currency  Currency    `gorm:"type:varchar(8);not null" json:"currency"`
+	Total     float64     `gorm:"not null" json:"total,string"`
+	Memo      string      `gorm:"not null;default:''" json:"memo,omitempty"`
+	Status    SplitStatus `gorm:"type:varchar(16);not null;index" json:"status"`
+}
+
+// PaymentRequestStatus - state of the payment request
+type PaymentRequestStatus string
+
+const (
+	// PaymentRequestPending - payer has not responded yet
+	PaymentRequestPending PaymentRequestStatus = "pending"
+	// PaymentRequestPaid - payer has transferred requested sum
+	PaymentRequestPaid PaymentRequestStatus = "paid"
+	// PaymentRequestDeclined - payer has refused to pay
+	PaymentRequestDeclined PaymentRequestStatus = "declined"
+	// PaymentRequestCancelled - requester has withdrawn the request
+	PaymentRequestCancelled PaymentRequestStatus = "cancelled"
+)
+
+// PaymentRequest - request of the user to pay him the sum
+type PaymentRequest struct {
+	ID          uint64               `gorm:"primary_key" json:"id,string"`
+	CreatedAt   time.Time            `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt   time.Time            `gorm:"not null;default:current_timestamp on update current_timestamp" json:"updated_at"`
+	SplitID     uint64               `gorm:"not null;default:'0';index" json:"split_id,string,omitempty"`
+	RequesterID uint64               `gorm:"not null;index" json:"requester_id,string"`
+	PayerID     uint64               `gorm:"not null;index" json:"payer_id,string"`
+	Currency    Currency             `gorm:"type:varchar(8);not null" json:"currency"`
+	Sum         float64              `gorm:"not null" json:"sum,string"`
+	Memo        string               `gorm:"not null;default:''" json:"memo,omitempty"`
+	Status      PaymentRequestStatus `gorm:"type:varchar(16);not null;index" json:"status"`
+	TransferID  uint64               `gorm:"not null;default:'0'" json:"transfer_id,string,omitempty"`
+}
@@ -13,7 +13,22 @@ type User struct {
 	Email     string    `gorm:"not null;unique_index" json:"email"`
 	Name      string    `gorm:"not null;index" json:"name"`
 	PHash     string    `gorm:"not null" json:"-"`
-	Balance   float64   `gorm:"not null;default:'0'" json:"balance,string"`
+	// Frozen - user is blocked by operator, so can't log in and use issued tokens
+	Frozen  bool     `gorm:"not null;default:false" json:"frozen,omitempty"`
+	Wallets []Wallet `gorm:"foreignkey:UserID" json:"wallets"`
+}
+
+// Wallet - returns user's wallet for given currency or nil if user has no such wallet.
+func (u *User) Wallet(currency Currency) *Wallet {
+	if u == nil {
+		return nil
+	}
+	for i := range u.Wallets {
+		if u.Wallets[i].Currency == currency {
+			return &u.Wallets[i]
+		}
+	}
+	return nil
 }
 
 // UserRole - simple roles enumeration
@@ -25,4 +40,6 @@ const (
 	RoleRegular
 	// RoleTrusted - verified user
 	RoleTrusted
+	// RoleAdmin - user who maintains server-wide settings
+	RoleAdmin
 )
@@ -0,0 +1,45 @@
+package model
+
+import (
+	"time"
+)
+
+// Currency - currency code
+type Currency string
+
+const (
+	// DefaultCurrency - Parrot Wings, the currency of new users and of transfers without explicit currency
+	DefaultCurrency Currency = "PW"
+)
+
+// IsValid - checks currency code consists of 2-8 uppercase latin letters.
+func (c Currency) IsValid() bool {
+	if len(c) < 2 || len(c) > 8 {
+		return false
+	}
+	for _, r := range c {
+		if r < 'A' || r > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// Wallet - user's balance in a single currency;
+// Balance is a ledger balance, Available is a part of the Balance which is not reserved by holds.
+type Wallet struct {
+	ID        uint64    `gorm:"primary_key" json:"-"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp on update current_timestamp" json:"-"`
+	UserID    uint64    `gorm:"not null;unique_index:wallet_user_currency" json:"-"`
+	Currency  Currency  `gorm:"type:varchar(8);not null;unique_index:wallet_user_currency" json:"currency"`
+	Balance   float64   `gorm:"not null;default:'0'" json:"balance,string"`
+	Held      float64   `gorm:"not null;default:'0'" json:"held,string"`
+	Available float64   `gorm:"-" json:"available,string"`
+}
+
+// AfterFind - gorm callback to calculate available balance.
+func (w *Wallet) AfterFind() error {
+	w.Available = w.Balance - w.Held
+	return nil
+}
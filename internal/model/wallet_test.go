@@ -0,0 +1,43 @@
+package model
+
+import "testing"
+
+func TestCurrencyValidation(t *testing.T) {
+	cases := []struct {
+		currency Currency
+		expected bool
+	}{
+		{"PW", true},
+		{"USD", true},
+		{"BITCOINS", true},
+		{"", false},
+		{"P", false},
+		{"usd", false},
+		{"US1", false},
+		{"U$D", false},
+		{"TOOLONGCODE", false},
+	}
+	for _, c := range cases {
+		if c.currency.IsValid() != c.expected {
+			t.Errorf("Unexpected validation result for %q, expected %t", c.currency, c.expected)
+		}
+	}
+}
+
+func TestUserWallet(t *testing.T) {
+	u := &User{
+		Wallets: []Wallet{
+			{Currency: DefaultCurrency, Balance: 500.0},
+			{Currency: "USD", Balance: 1.0},
+		},
+	}
+	if w := u.Wallet("USD"); w == nil || w.Balance != 1.0 {
+		t.Errorf("Unexpected wallet %v", w)
+	}
+	if w := u.Wallet("EUR"); w != nil {
+		t.Errorf("Unexpected wallet %v, nil expected", w)
+	}
+	if w := (*User)(nil).Wallet(DefaultCurrency); w != nil {
+		t.Errorf("Unexpected wallet %v of nil user", w)
+	}
+}
@@ -0,0 +1,58 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// WebhookSubscription - user's endpoint to be notified about events
+type WebhookSubscription struct {
+	ID        uint64    `gorm:"primary_key" json:"id,string"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp" json:"created_at"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp on update current_timestamp" json:"-"`
+	UserID    uint64    `gorm:"not null;index" json:"user_id,string"`
+	URL       string    `gorm:"type:varchar(2048);not null" json:"url"`
+	// Events - comma separated list of event types
+	Events string `gorm:"not null" json:"events"`
+	// Secret - key to sign payloads with HMAC, never replied back
+	Secret string `gorm:"not null" json:"-"`
+	Active bool   `gorm:"not null;default:'1'" json:"active"`
+}
+
+// Subscribed - checks subscription includes given event type.
+func (s *WebhookSubscription) Subscribed(event string) bool {
+	for _, e := range strings.Split(s.Events, ",") {
+		if strings.TrimSpace(e) == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDeliveryStatus - state of the webhook delivery
+type WebhookDeliveryStatus string
+
+const (
+	// WebhookPending - delivery is waiting for the first or next attempt
+	WebhookPending WebhookDeliveryStatus = "pending"
+	// WebhookDelivered - receiver has accepted the payload
+	WebhookDelivered WebhookDeliveryStatus = "delivered"
+	// WebhookFailed - all attempts are exhausted
+	WebhookFailed WebhookDeliveryStatus = "failed"
+)
+
+// WebhookDelivery - queued payload for the subscription and log of its delivery attempts
+type WebhookDelivery struct {
+	ID             uint64                `gorm:"primary_key" json:"id,string"`
+	CreatedAt      time.Time             `gorm:"not null;default:current_timestamp" json:"created_at"`
+	SubscriptionID uint64                `gorm:"not null;unique_index:webhook_delivery_event" json:"subscription_id,string"`
+	EventID        uint64                `gorm:"not null;unique_index:webhook_delivery_event" json:"event_id,string"`
+	Event          string                `gorm:"not null" json:"event"`
+	Payload        string                `gorm:"type:text;not null" json:"payload"`
+	Status         WebhookDeliveryStatus `gorm:"type:varchar(16);not null;index:webhook_delivery_due" json:"status"`
+	Attempts       int                   `gorm:"not null;default:'0'" json:"attempts"`
+	NextAttemptAt  time.Time             `gorm:"not null;index:webhook_delivery_due" json:"next_attempt_at"`
+	LastAttemptAt  *time.Time            `json:"last_attempt_at,omitempty"`
+	ResponseStatus int                   `gorm:"not null;default:'0'" json:"response_status,omitempty"`
+	LastError      string                `gorm:"type:varchar(1024);not null;default:''" json:"last_error,omitempty"`
+}
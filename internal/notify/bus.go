@@ -0,0 +1,204 @@
+// Package notify delivers real-time events to subscribed users.
+package notify
+
+import (
+	"encoding/json"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event - notification addressed to the user
+type Event struct {
+	// ID - sequence number of the event, unique for the bus lifetime
+	ID uint64
+	// Epoch - identifies the bus, sequence numbers start again with the new bus after restart of the process
+	Epoch     string
+	UserID    uint64
+	Type      string
+	CreatedAt time.Time
+	Data      json.RawMessage
+}
+
+// StreamID - ID of the event for clients, which is unique across restarts: epoch and sequence number.
+func (e *Event) StreamID() string {
+	return e.Epoch + "-" + strconv.FormatUint(e.ID, 10)
+}
+
+// Subscription - user's stream of events
+type Subscription struct {
+	// Replay - buffered events missed by the subscriber since its last event
+	Replay []Event
+	// Complete - flag, false if some of missed events have been already evicted from the buffer
+	Complete bool
+
+	userID uint64
+	events chan Event
+	bus    *Bus
+	once   sync.Once
+}
+
+// Events - returns channel of new events; it is closed when the subscription is closed,
+// the bus is closed or the subscriber is too slow to read events.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Close - cancels the subscription.
+func (s *Subscription) Close() {
+	s.bus.unsubscribe(s)
+}
+
+func (s *Subscription) stop() {
+	s.once.Do(func() { close(s.events) })
+}
+
+// Bus - in-process event bus, keeps bounded buffer of last events for replay.
+type Bus struct {
+	mu       sync.Mutex
+	epoch    string
+	seq      uint64
+	buffer   []Event
+	next     int
+	capacity int
+	queue    int
+	subs     map[uint64]map[*Subscription]struct{}
+	closed   bool
+}
+
+// NewBus - creates bus which keeps up to bufferSize last events for replay
+// and queues up to queueSize events per subscriber.
+func NewBus(bufferSize, queueSize int) *Bus {
+	if bufferSize < 1 {
+		bufferSize = 1
+	}
+	if queueSize < 1 {
+		queueSize = 1
+	}
+	return &Bus{
+		epoch:    strconv.FormatInt(time.Now().UnixNano(), 36),
+		buffer:   make([]Event, 0, bufferSize),
+		capacity: bufferSize,
+		queue:    queueSize,
+		subs:     map[uint64]map[*Subscription]struct{}{},
+	}
+}
+
+// Publish - sends event with JSON encoded data to every subscription of the user.
+func (b *Bus) Publish(userID uint64, kind string, data interface{}) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.seq++
+	e := Event{ID: b.seq, Epoch: b.epoch, UserID: userID, Type: kind, CreatedAt: time.Now().UTC(), Data: raw}
+	if len(b.buffer) < b.capacity {
+		b.buffer = append(b.buffer, e)
+	} else {
+		b.buffer[b.next] = e
+		b.next = (b.next + 1) % b.capacity
+	}
+	for s := range b.subs[userID] {
+		select {
+		case s.events <- e:
+		default:
+			// slow subscriber will reconnect and replay missed events
+			delete(b.subs[userID], s)
+			s.stop()
+		}
+	}
+}
+
+// Subscribe - starts new subscription of the user to events published after the event with given stream ID,
+// which is empty for the first subscription; returns false if the bus is closed.
+// Subscription is not complete if the event was published before restart or the ID is unknown,
+// then all buffered events of the user are replayed.
+func (b *Bus) Subscribe(userID uint64, lastEventID string) (*Subscription, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, false
+	}
+	s := &Subscription{
+		Complete: true,
+		userID:   userID,
+		events:   make(chan Event, b.queue),
+		bus:      b,
+	}
+	if lastEventID != "" {
+		last, known := b.sequence(lastEventID)
+		if !known {
+			last = 0
+		}
+		if !known || (len(b.buffer) > 0 && b.oldest().ID > last+1) {
+			s.Complete = false
+		}
+		for i := 0; i < len(b.buffer); i++ {
+			e := b.buffer[(b.next+i)%len(b.buffer)]
+			if e.ID > last && e.UserID == userID {
+				s.Replay = append(s.Replay, e)
+			}
+		}
+	}
+	if b.subs[userID] == nil {
+		b.subs[userID] = map[*Subscription]struct{}{}
+	}
+	b.subs[userID][s] = struct{}{}
+	return s, true
+}
+
+// sequence - parses stream ID of the event published by this bus.
+func (b *Bus) sequence(streamID string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(streamID, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || id > b.seq {
+		return 0, false
+	}
+	return id, true
+}
+
+// oldest - returns the oldest buffered event, buffer must not be empty.
+func (b *Bus) oldest() Event {
+	if len(b.buffer) < b.capacity {
+		return b.buffer[0]
+	}
+	return b.buffer[b.next]
+}
+
+func (b *Bus) unsubscribe(s *Subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if subs, ok := b.subs[s.userID]; ok {
+		delete(subs, s)
+		if len(subs) == 0 {
+			delete(b.subs, s.userID)
+		}
+	}
+	s.stop()
+}
+
+// Close - stops all subscriptions, events published after closing are ignored.
+// Suitable to be registered with http.Server.RegisterOnShutdown to finish streaming responses.
+func (b *Bus) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return
+	}
+	b.closed = true
+	for _, subs := range b.subs {
+		for s := range subs {
+			s.stop()
+		}
+	}
+	b.subs = map[uint64]map[*Subscription]struct{}{}
+}
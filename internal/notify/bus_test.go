@@ -0,0 +1,91 @@
+package notify
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestPublishToSubscriber(t *testing.T) {
+	b := NewBus(10, 10)
+	s, ok := b.Subscribe(1, "")
+	if !ok {
+		t.Fatalf("Unable to subscribe")
+	}
+	defer s.Close()
+	b.Publish(2, "test", "not for subscriber")
+	b.Publish(1, "test", map[string]int{"n": 1})
+	e := <-s.Events()
+	if e.UserID != 1 || e.Type != "test" || string(e.Data) != `{"n":1}` || e.ID != 2 || e.StreamID() != b.epoch+"-2" {
+		t.Errorf("Unexpected event %+v", e)
+	}
+	if len(s.Replay) != 0 || !s.Complete {
+		t.Errorf("Unexpected replay of new subscription")
+	}
+}
+
+func TestReplay(t *testing.T) {
+	b := NewBus(4, 10)
+	for i := 0; i < 6; i++ {
+		b.Publish(uint64(i%2+1), "test", i)
+	}
+	// buffer keeps events #3-#6, user 1 has got #1, #3, #5
+	id := func(seq uint64) string { return b.epoch + "-" + strconv.FormatUint(seq, 10) }
+	cases := []struct {
+		lastEventID string
+		replay      []uint64
+		complete    bool
+	}{
+		{"", nil, true},
+		{id(6), nil, true},
+		{id(3), []uint64{5}, true},
+		{id(2), []uint64{3, 5}, true},
+		{id(1), []uint64{3, 5}, false},
+		// events of previous process or unknown ones
+		{id(10), []uint64{3, 5}, false},
+		{"previous-6", []uint64{3, 5}, false},
+		{"6", []uint64{3, 5}, false},
+	}
+	for _, c := range cases {
+		s, _ := b.Subscribe(1, c.lastEventID)
+		if len(s.Replay) != len(c.replay) || s.Complete != c.complete {
+			t.Errorf("Last event %q: unexpected replay %+v, complete %t", c.lastEventID, s.Replay, s.Complete)
+			s.Close()
+			continue
+		}
+		for i, e := range s.Replay {
+			if e.ID != c.replay[i] || e.UserID != 1 {
+				t.Errorf("Last event %q: unexpected replayed event %+v", c.lastEventID, e)
+			}
+		}
+		s.Close()
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	b := NewBus(10, 1)
+	s, _ := b.Subscribe(1, "")
+	b.Publish(1, "test", 1)
+	b.Publish(1, "test", 2)
+	if e, ok := <-s.Events(); !ok || e.ID != 1 {
+		t.Errorf("Unexpected first event %+v", e)
+	}
+	if _, ok := <-s.Events(); ok {
+		t.Errorf("Subscription of slow subscriber must be closed")
+	}
+	s.Close() // must not panic
+}
+
+func TestClose(t *testing.T) {
+	b := NewBus(10, 10)
+	s, _ := b.Subscribe(1, "")
+	b.Close()
+	if _, ok := <-s.Events(); ok {
+		t.Errorf("Subscription must be closed with bus")
+	}
+	s.Close()
+	b.Close()
+	if _, ok := b.Subscribe(1, ""); ok {
+		t.Errorf("Unexpected subscription to closed bus")
+	}
+	b.Publish(1, "test", 1) // must not panic
+}
@@ -0,0 +1,77 @@
+// Package operator provides maintenance operations of server operators, which are not available via API.
+package operator
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/pkg/email"
+)
+
+// ErrUserNotFound - user is not found by given reference
+var ErrUserNotFound = errors.New("user not found")
+
+// Store - storage of entities managed by operators
+type Store interface {
+	audit.Recorder
+	GetUserByID(userID uint64) (*model.User, error)
+	GetUserByEmail(address string) (*model.User, error)
+	CreateUser(user model.User, password string) (*model.User, error)
+	SetUserRole(userID uint64, role model.UserRole) (*model.User, error)
+	SetUserFrozen(userID uint64, frozen bool) (*model.User, error)
+	GetInternalTransferByID(transferID uint64) (*model.InternalTransfer, error)
+	FindLastInternalTransfers(userID uint64, currency model.Currency, limit int) ([]model.InternalTransfer, error)
+}
+
+var roles = []struct {
+	name string
+	role model.UserRole
+}{
+	{"regular", model.RoleRegular},
+	{"trusted", model.RoleTrusted},
+	{"admin", model.RoleAdmin},
+}
+
+// ParseRole - returns role by its name: regular, trusted or admin.
+func ParseRole(name string) (model.UserRole, error) {
+	for _, r := range roles {
+		if strings.EqualFold(name, r.name) {
+			return r.role, nil
+		}
+	}
+	return 0, fmt.Errorf("operator.ParseRole: unknown role %q, expected regular, trusted or admin", name)
+}
+
+// RoleName - returns name of the role or its number if role is unknown.
+func RoleName(role model.UserRole) string {
+	for _, r := range roles {
+		if r.role == role {
+			return r.name
+		}
+	}
+	return strconv.Itoa(int(role))
+}
+
+// FindUser - finds user by ID or email address.
+func FindUser(s Store, ref string) (*model.User, error) {
+	var (
+		user *model.User
+		err  error
+	)
+	if id, perr := strconv.ParseUint(ref, 10, 64); perr == nil {
+		user, err = s.GetUserByID(id)
+	} else {
+		user, err = s.GetUserByEmail(email.NewAddress(ref).Get())
+	}
+	if err != nil {
+		return nil, fmt.Errorf("operator.FindUser: %s", err.Error())
+	}
+	if user == nil {
+		return nil, fmt.Errorf("operator.FindUser: %w: %s", ErrUserNotFound, ref)
+	}
+	return user, nil
+}
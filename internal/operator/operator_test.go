@@ -0,0 +1,57 @@
+package operator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+type fakeStore struct {
+	Store
+	users []model.User
+}
+
+func (s *fakeStore) GetUserByID(userID uint64) (*model.User, error) {
+	for i := range s.users {
+		if s.users[i].ID == userID {
+			return &s.users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *fakeStore) GetUserByEmail(address string) (*model.User, error) {
+	for i := range s.users {
+		if s.users[i].Email == address {
+			return &s.users[i], nil
+		}
+	}
+	return nil, nil
+}
+
+func TestFindUser(t *testing.T) {
+	s := &fakeStore{users: []model.User{{ID: 1, Email: "john@example.com"}, {ID: 2, Email: "jane@example.com"}}}
+	for ref, id := range map[string]uint64{"2": 2, "john@example.com": 1, " john@example.com ": 1} {
+		if u, err := FindUser(s, ref); err != nil || u.ID != id {
+			t.Errorf("Unexpected user by %q: %+v, %v", ref, u, err)
+		}
+	}
+	for _, ref := range []string{"3", "bob@example.com", "invalid"} {
+		if _, err := FindUser(s, ref); !errors.Is(err, ErrUserNotFound) {
+			t.Errorf("Unexpected error by %q: %v", ref, err)
+		}
+	}
+}
+
+func TestRoles(t *testing.T) {
+	if role, err := ParseRole("Admin"); err != nil || role != model.RoleAdmin {
+		t.Errorf("Unexpected role: %v, %v", role, err)
+	}
+	if _, err := ParseRole("root"); err == nil {
+		t.Errorf("Unknown role is parsed")
+	}
+	if RoleName(model.RoleTrusted) != "trusted" || RoleName(9) != "9" {
+		t.Errorf("Unexpected role names")
+	}
+}
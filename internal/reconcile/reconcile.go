@@ -0,0 +1,315 @@
+// Package reconcile verifies wallet balances against the history of transfers and conversions.
+// Every movement of funds stores balances of the wallet before and after it,
+// so replaying the history reveals lost updates, edited logs and money, which appeared from nowhere.
+package reconcile
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// Tolerance - max difference of amounts, which are considered equal
+const Tolerance = 1e-6
+
+// Kind - type of the discrepancy
+type Kind string
+
+const (
+	// InvalidMovement - balance after the movement differs from balance before it by wrong amount
+	InvalidMovement Kind = "invalid_movement"
+	// BrokenChain - balance before the movement differs from balance after the previous one
+	BrokenChain Kind = "broken_chain"
+	// BalanceMismatch - wallet balance differs from balance after the last movement
+	BalanceMismatch Kind = "balance_mismatch"
+	// MissingWallet - movement refers to the wallet, which does not exist
+	MissingWallet Kind = "missing_wallet"
+	// NegativeBalance - wallet balance is below zero
+	NegativeBalance Kind = "negative_balance"
+	// InvalidHeld - reserved part of the wallet is negative or exceeds its balance
+	InvalidHeld Kind = "invalid_held"
+	// MoneyNotConserved - total of balances in the currency differs from total of opening balances and conversions
+	MoneyNotConserved Kind = "money_not_conserved"
+)
+
+// Ledger - snapshot of wallets and history of their movements
+type Ledger struct {
+	Wallets     []model.Wallet
+	Transfers   []model.InternalTransfer
+	Conversions []model.Conversion
+}
+
+// Store - source of the ledger
+type Store interface {
+	// ReadLedger - reads all wallets, transfers and conversions as a consistent snapshot
+	ReadLedger() (*Ledger, error)
+}
+
+// Discrepancy - single problem found by the check
+type Discrepancy struct {
+	Kind         Kind           `json:"kind"`
+	UserID       uint64         `json:"user_id,string,omitempty"`
+	Currency     model.Currency `json:"currency"`
+	TransferID   uint64         `json:"transfer_id,string,omitempty"`
+	ConversionID uint64         `json:"conversion_id,string,omitempty"`
+	Expected     float64        `json:"expected,string"`
+	Actual       float64        `json:"actual,string"`
+}
+
+// Total - money of the currency: opening balances of wallets are the balances before their first movements
+type Total struct {
+	Currency     model.Currency `json:"currency"`
+	Opening      float64        `json:"opening,string"`
+	ConvertedIn  float64        `json:"converted_in,string"`
+	ConvertedOut float64        `json:"converted_out,string"`
+	Expected     float64        `json:"expected,string"`
+	Actual       float64        `json:"actual,string"`
+}
+
+// Report - result of the check
+type Report struct {
+	CheckedAt     time.Time     `json:"checked_at"`
+	Wallets       int           `json:"wallets"`
+	Transfers     int           `json:"transfers"`
+	Conversions   int           `json:"conversions"`
+	Totals        []Total       `json:"totals"`
+	Discrepancies []Discrepancy `json:"discrepancies"`
+}
+
+// movement - change of the single wallet caused by transfer or conversion
+type movement struct {
+	createdAt    time.Time
+	transferID   uint64
+	conversionID uint64
+	delta        float64
+	before       float64
+	after        float64
+}
+
+// walletKey - wallet is unique per user and currency
+type walletKey struct {
+	userID   uint64
+	currency model.Currency
+}
+
+// history - movements of the wallet, transfers and conversions are ordered by ID separately
+type history struct {
+	transfers, conversions []movement
+}
+
+// next - removes and returns the next movement of the wallet with given running balance.
+// Transfers and conversions are merged by time, but rows written within the same second may be stored
+// with equal time, so then the movement continuing the chain is preferred.
+func (h *history) next(balance float64, started bool) movement {
+	takeTransfer := len(h.conversions) == 0
+	if len(h.transfers) > 0 && len(h.conversions) > 0 {
+		t, c := h.transfers[0], h.conversions[0]
+		tContinues, cContinues := equal(t.before, balance), equal(c.before, balance)
+		tPrecedes, cPrecedes := equal(t.after, c.before), equal(c.after, t.before)
+		switch {
+		case !t.createdAt.Equal(c.createdAt):
+			takeTransfer = t.createdAt.Before(c.createdAt)
+		case started && tContinues != cContinues:
+			takeTransfer = tContinues
+		case tPrecedes != cPrecedes:
+			takeTransfer = tPrecedes
+		default:
+			takeTransfer = true
+		}
+	}
+	var m movement
+	if takeTransfer {
+		m, h.transfers = h.transfers[0], h.transfers[1:]
+	} else {
+		m, h.conversions = h.conversions[0], h.conversions[1:]
+	}
+	return m
+}
+
+func equal(a, b float64) bool {
+	return math.Abs(a-b) <= Tolerance
+}
+
+// Check - replays history of every wallet and compares it with the current balances.
+func Check(l *Ledger, now time.Time) *Report {
+	report := &Report{
+		CheckedAt:     now,
+		Wallets:       len(l.Wallets),
+		Transfers:     len(l.Transfers),
+		Conversions:   len(l.Conversions),
+		Totals:        []Total{},
+		Discrepancies: []Discrepancy{},
+	}
+	histories := map[walletKey]*history{}
+	get := func(k walletKey) *history {
+		h := histories[k]
+		if h == nil {
+			h = &history{}
+			histories[k] = h
+		}
+		return h
+	}
+	transfers := append([]model.InternalTransfer{}, l.Transfers...)
+	sort.Slice(transfers, func(i, j int) bool { return transfers[i].ID < transfers[j].ID })
+	for _, t := range transfers {
+		sender := get(walletKey{t.UserID, t.Currency})
+		sender.transfers = append(sender.transfers, movement{
+			createdAt: t.CreatedAt, transferID: t.ID, delta: -t.Sum, before: t.UserBalanceBefore, after: t.UserBalanceAfter,
+		})
+		recipient := get(walletKey{t.RecipientID, t.Currency})
+		recipient.transfers = append(recipient.transfers, movement{
+			createdAt: t.CreatedAt, transferID: t.ID, delta: t.Sum, before: t.RecipientBalanceBefore, after: t.RecipientBalanceAfter,
+		})
+	}
+	conversions := append([]model.Conversion{}, l.Conversions...)
+	sort.Slice(conversions, func(i, j int) bool { return conversions[i].ID < conversions[j].ID })
+	totals := map[model.Currency]*Total{}
+	total := func(c model.Currency) *Total {
+		t := totals[c]
+		if t == nil {
+			t = &Total{Currency: c}
+			totals[c] = t
+		}
+		return t
+	}
+	for _, c := range conversions {
+		from := get(walletKey{c.UserID, c.From})
+		from.conversions = append(from.conversions, movement{
+			createdAt: c.CreatedAt, conversionID: c.ID, delta: -c.Sum, before: c.FromBalanceBefore, after: c.FromBalanceAfter,
+		})
+		to := get(walletKey{c.UserID, c.To})
+		to.conversions = append(to.conversions, movement{
+			createdAt: c.CreatedAt, conversionID: c.ID, delta: c.Result, before: c.ToBalanceBefore, after: c.ToBalanceAfter,
+		})
+		total(c.From).ConvertedOut += c.Sum
+		total(c.To).ConvertedIn += c.Result
+	}
+
+	wallets := map[walletKey]model.Wallet{}
+	for _, w := range l.Wallets {
+		wallets[walletKey{w.UserID, w.Currency}] = w
+	}
+	keys := make([]walletKey, 0, len(histories)+len(wallets))
+	for k := range wallets {
+		keys = append(keys, k)
+	}
+	for k := range histories {
+		if _, ok := wallets[k]; !ok {
+			keys = append(keys, k)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].userID != keys[j].userID {
+			return keys[i].userID < keys[j].userID
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	for _, k := range keys {
+		report.Discrepancies = append(report.Discrepancies, checkWallet(k, wallets, histories[k], total(k.currency))...)
+	}
+
+	for _, t := range totals {
+		t.Expected = t.Opening + t.ConvertedIn - t.ConvertedOut
+		report.Totals = append(report.Totals, *t)
+		if !equal(t.Expected, t.Actual) {
+			report.Discrepancies = append(report.Discrepancies, Discrepancy{
+				Kind: MoneyNotConserved, Currency: t.Currency, Expected: t.Expected, Actual: t.Actual,
+			})
+		}
+	}
+	sort.Slice(report.Totals, func(i, j int) bool { return report.Totals[i].Currency < report.Totals[j].Currency })
+	return report
+}
+
+// checkWallet - replays movements of the single wallet and adds its balances to the total of the currency.
+func checkWallet(k walletKey, wallets map[walletKey]model.Wallet, h *history, total *Total) []Discrepancy {
+	found := []Discrepancy{}
+	add := func(kind Kind, m movement, expected, actual float64) {
+		found = append(found, Discrepancy{
+			Kind:         kind,
+			UserID:       k.userID,
+			Currency:     k.currency,
+			TransferID:   m.transferID,
+			ConversionID: m.conversionID,
+			Expected:     expected,
+			Actual:       actual,
+		})
+	}
+	w, exists := wallets[k]
+	balance, started := w.Balance, false
+	if h != nil {
+		for len(h.transfers) > 0 || len(h.conversions) > 0 {
+			m := h.next(balance, started)
+			if !started {
+				total.Opening += m.before
+			} else if !equal(m.before, balance) {
+				add(BrokenChain, m, balance, m.before)
+			}
+			if !equal(m.after-m.before, m.delta) {
+				add(InvalidMovement, m, m.before+m.delta, m.after)
+			}
+			balance, started = m.after, true
+		}
+	}
+	if !started {
+		total.Opening += w.Balance
+	}
+	if !exists {
+		add(MissingWallet, movement{}, balance, 0)
+		return found
+	}
+	total.Actual += w.Balance
+	if !equal(w.Balance, balance) {
+		add(BalanceMismatch, movement{}, balance, w.Balance)
+	}
+	if w.Balance < -Tolerance {
+		add(NegativeBalance, movement{}, 0, w.Balance)
+	}
+	if w.Held < -Tolerance || w.Held-w.Balance > Tolerance {
+		add(InvalidHeld, movement{}, w.Balance, w.Held)
+	}
+	return found
+}
+
+// Checker - runs the check periodically and keeps results of the last run for monitoring
+type Checker struct {
+	store         Store
+	discrepancies atomic.Int64
+	lastRun       atomic.Int64
+}
+
+// NewChecker - creates checker of the ledger read from the given store.
+func NewChecker(store Store) *Checker {
+	if store == nil {
+		panic(errors.New("reconcile.NewChecker: Store is nil"))
+	}
+	return &Checker{store: store}
+}
+
+// Run - reads the ledger and checks it, suitable to be used as background job.
+func (c *Checker) Run(now time.Time) (*Report, error) {
+	l, err := c.store.ReadLedger()
+	if err != nil {
+		return nil, fmt.Errorf("reconcile.Checker.Run: %s", err.Error())
+	}
+	report := Check(l, now)
+	c.discrepancies.Store(int64(len(report.Discrepancies)))
+	c.lastRun.Store(now.Unix())
+	return report, nil
+}
+
+// Discrepancies - returns number of discrepancies found by the last run.
+func (c *Checker) Discrepancies() float64 {
+	return float64(c.discrepancies.Load())
+}
+
+// LastRun - returns Unix time of the last successful run or 0.
+func (c *Checker) LastRun() float64 {
+	return float64(c.lastRun.Load())
+}
@@ -0,0 +1,169 @@
+package reconcile
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+var t0 = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// consistentLedger - users 1 and 2 got 500 PW on registration, then
+// 1 sent 100 PW to 2, 2 converted 200 PW into 20 USD, 2 sent 5 USD to 3 and 1 sent 50 PW to 2.
+func consistentLedger() *Ledger {
+	return &Ledger{
+		Wallets: []model.Wallet{
+			{UserID: 1, Currency: "PW", Balance: 350},
+			{UserID: 2, Currency: "PW", Balance: 450, Held: 100},
+			{UserID: 2, Currency: "USD", Balance: 15},
+			{UserID: 3, Currency: "USD", Balance: 5},
+		},
+		Transfers: []model.InternalTransfer{
+			{
+				ID: 1, CreatedAt: t0, UserID: 1, RecipientID: 2, Currency: "PW", Sum: 100,
+				UserBalanceBefore: 500, UserBalanceAfter: 400, RecipientBalanceBefore: 500, RecipientBalanceAfter: 600,
+			},
+			// stored within the same second as the conversion
+			{
+				ID: 3, CreatedAt: t0.Add(time.Second), UserID: 1, RecipientID: 2, Currency: "PW", Sum: 50,
+				UserBalanceBefore: 400, UserBalanceAfter: 350, RecipientBalanceBefore: 400, RecipientBalanceAfter: 450,
+			},
+			{
+				ID: 2, CreatedAt: t0.Add(time.Second), UserID: 2, RecipientID: 3, Currency: "USD", Sum: 5,
+				UserBalanceBefore: 20, UserBalanceAfter: 15, RecipientBalanceBefore: 0, RecipientBalanceAfter: 5,
+			},
+		},
+		Conversions: []model.Conversion{
+			{
+				ID: 1, CreatedAt: t0.Add(time.Second), UserID: 2, From: "PW", To: "USD", Rate: 0.1, Sum: 200, Result: 20,
+				FromBalanceBefore: 600, FromBalanceAfter: 400, ToBalanceBefore: 0, ToBalanceAfter: 20,
+			},
+		},
+	}
+}
+
+func TestCheckConsistent(t *testing.T) {
+	r := Check(consistentLedger(), t0)
+	if len(r.Discrepancies) != 0 {
+		t.Fatalf("Unexpected discrepancies: %+v", r.Discrepancies)
+	}
+	expected := []Total{
+		{Currency: "PW", Opening: 1000, ConvertedOut: 200, Expected: 800, Actual: 800},
+		{Currency: "USD", ConvertedIn: 20, Expected: 20, Actual: 20},
+	}
+	if len(r.Totals) != len(expected) {
+		t.Fatalf("Unexpected totals: %+v", r.Totals)
+	}
+	for i := range expected {
+		if r.Totals[i] != expected[i] {
+			t.Errorf("Unexpected total %+v, expected %+v", r.Totals[i], expected[i])
+		}
+	}
+	if r.Wallets != 4 || r.Transfers != 3 || r.Conversions != 1 {
+		t.Errorf("Unexpected counters: %+v", r)
+	}
+}
+
+func TestCheckDiscrepancies(t *testing.T) {
+	cases := []struct {
+		name     string
+		corrupt  func(l *Ledger)
+		expected []Discrepancy
+	}{
+		{
+			"balance updated without transfer",
+			func(l *Ledger) { l.Wallets[0].Balance = 1350 },
+			[]Discrepancy{
+				{Kind: BalanceMismatch, UserID: 1, Currency: "PW", Expected: 350, Actual: 1350},
+				{Kind: MoneyNotConserved, Currency: "PW", Expected: 800, Actual: 1800},
+			},
+		},
+		{
+			"sum of transfer edited",
+			func(l *Ledger) { l.Transfers[0].Sum = 10 },
+			[]Discrepancy{
+				{Kind: InvalidMovement, UserID: 1, Currency: "PW", TransferID: 1, Expected: 490, Actual: 400},
+				{Kind: InvalidMovement, UserID: 2, Currency: "PW", TransferID: 1, Expected: 510, Actual: 600},
+			},
+		},
+		{
+			"transfer removed",
+			func(l *Ledger) { l.Transfers = append(l.Transfers[:1], l.Transfers[2]) },
+			[]Discrepancy{
+				{Kind: BalanceMismatch, UserID: 1, Currency: "PW", Expected: 400, Actual: 350},
+				{Kind: BalanceMismatch, UserID: 2, Currency: "PW", Expected: 400, Actual: 450},
+			},
+		},
+		{
+			"conversion removed",
+			func(l *Ledger) { l.Conversions = nil },
+			[]Discrepancy{
+				{Kind: BrokenChain, UserID: 2, Currency: "PW", TransferID: 3, Expected: 600, Actual: 400},
+				{Kind: MoneyNotConserved, Currency: "PW", Expected: 1000, Actual: 800},
+			},
+		},
+		{
+			"wallet removed",
+			func(l *Ledger) { l.Wallets = l.Wallets[:3] },
+			[]Discrepancy{
+				{Kind: MissingWallet, UserID: 3, Currency: "USD", Expected: 5},
+				{Kind: MoneyNotConserved, Currency: "USD", Expected: 20, Actual: 15},
+			},
+		},
+		{
+			"overdraft",
+			func(l *Ledger) {
+				l.Wallets = append(l.Wallets, model.Wallet{UserID: 4, Currency: "PW", Balance: -1, Held: 1})
+			},
+			[]Discrepancy{
+				{Kind: NegativeBalance, UserID: 4, Currency: "PW", Actual: -1},
+				{Kind: InvalidHeld, UserID: 4, Currency: "PW", Expected: -1, Actual: 1},
+			},
+		},
+	}
+	for _, c := range cases {
+		l := consistentLedger()
+		c.corrupt(l)
+		r := Check(l, t0)
+		if len(r.Discrepancies) != len(c.expected) {
+			t.Errorf("%s: unexpected discrepancies %+v", c.name, r.Discrepancies)
+			continue
+		}
+		for i := range c.expected {
+			if r.Discrepancies[i] != c.expected[i] {
+				t.Errorf("%s: unexpected discrepancy %+v, expected %+v", c.name, r.Discrepancies[i], c.expected[i])
+			}
+		}
+	}
+}
+
+type fakeStore struct {
+	ledger *Ledger
+	err    error
+}
+
+func (s *fakeStore) ReadLedger() (*Ledger, error) {
+	return s.ledger, s.err
+}
+
+func TestChecker(t *testing.T) {
+	l := consistentLedger()
+	l.Wallets[0].Balance = 0
+	s := &fakeStore{ledger: l}
+	c := NewChecker(s)
+	if _, err := c.Run(t0); err != nil {
+		t.Fatal(err)
+	}
+	if c.Discrepancies() != 2 || c.LastRun() != float64(t0.Unix()) {
+		t.Errorf("Unexpected results of the last run: %v at %v", c.Discrepancies(), c.LastRun())
+	}
+	s.err = errors.New("connection refused")
+	if _, err := c.Run(t0.Add(time.Hour)); err == nil {
+		t.Error("Error of the store is not returned")
+	}
+	if c.Discrepancies() != 2 || c.LastRun() != float64(t0.Unix()) {
+		t.Errorf("Results of the last run are lost: %v at %v", c.Discrepancies(), c.LastRun())
+	}
+}
@@ -0,0 +1,134 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// KeyringIterations - PBKDF2 iterations to derive encryption key from the master key
+const KeyringIterations = 600000
+
+// keyringFile - format of the keyring file, secrets are encrypted with AES-256-GCM
+type keyringFile struct {
+	Version    int    `json:"version"`
+	KDF        string `json:"kdf"`
+	Iterations int    `json:"iterations"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Ciphertext []byte `json:"ciphertext"`
+}
+
+// Keyring - secrets of local encrypted file unlocked by master key
+type Keyring struct {
+	secrets map[string]string
+}
+
+// OpenKeyring - decrypts keyring file, missing file is an error.
+func OpenKeyring(path, masterKey string) (*Keyring, error) {
+	if masterKey == "" {
+		return nil, errors.New("secret.OpenKeyring: master key is empty")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// keep os.ErrNotExist to let caller create new keyring
+		return nil, fmt.Errorf("secret.OpenKeyring: %w", err)
+	}
+	f := keyringFile{}
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("secret.OpenKeyring: %s", err.Error())
+	}
+	if f.Version != 1 || f.KDF != "pbkdf2-sha256" || f.Iterations < 1 {
+		return nil, errors.New("secret.OpenKeyring: unsupported keyring format")
+	}
+	aead, err := keyringCipher(masterKey, f.Salt, f.Iterations)
+	if err != nil {
+		return nil, fmt.Errorf("secret.OpenKeyring: %s", err.Error())
+	}
+	if len(f.Nonce) != aead.NonceSize() {
+		return nil, errors.New("secret.OpenKeyring: invalid nonce")
+	}
+	plain, err := aead.Open(nil, f.Nonce, f.Ciphertext, nil)
+	if err != nil {
+		return nil, errors.New("secret.OpenKeyring: wrong master key or keyring is corrupted")
+	}
+	k := &Keyring{secrets: map[string]string{}}
+	if err := json.Unmarshal(plain, &k.secrets); err != nil {
+		return nil, fmt.Errorf("secret.OpenKeyring: %s", err.Error())
+	}
+	return k, nil
+}
+
+// NewKeyring - builds empty keyring.
+func NewKeyring() *Keyring {
+	return &Keyring{secrets: map[string]string{}}
+}
+
+// Secret - returns decrypted secret.
+func (k *Keyring) Secret(name string) (string, error) {
+	s, ok := k.secrets[name]
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s, nil
+}
+
+// Set - adds or replaces the secret, keyring must be saved to keep it.
+func (k *Keyring) Set(name, value string) {
+	k.secrets[name] = value
+}
+
+// Save - encrypts keyring with master key into the file with new salt and nonce.
+func (k *Keyring) Save(path, masterKey string) error {
+	if masterKey == "" {
+		return errors.New("secret.Keyring.Save: master key is empty")
+	}
+	f := keyringFile{
+		Version:    1,
+		KDF:        "pbkdf2-sha256",
+		Iterations: KeyringIterations,
+		Salt:       make([]byte, 16),
+	}
+	if _, err := rand.Read(f.Salt); err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	aead, err := keyringCipher(masterKey, f.Salt, f.Iterations)
+	if err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	f.Nonce = make([]byte, aead.NonceSize())
+	if _, err := rand.Read(f.Nonce); err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	plain, err := json.Marshal(k.secrets)
+	if err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	f.Ciphertext = aead.Seal(nil, f.Nonce, plain, nil)
+	data, err := json.MarshalIndent(&f, "", "\t")
+	if err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return fmt.Errorf("secret.Keyring.Save: %s", err.Error())
+	}
+	return nil
+}
+
+func keyringCipher(masterKey string, salt []byte, iterations int) (cipher.AEAD, error) {
+	key, err := pbkdf2.Key(sha256.New, masterKey, salt, iterations, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
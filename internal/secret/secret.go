@@ -0,0 +1,91 @@
+// Package secret reads sensitive configuration values from mounted files, environment and encrypted keyring.
+package secret
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrNotFound - provider has no secret with requested name
+var ErrNotFound = errors.New("secret not found")
+
+// Provider - source of secrets by name
+type Provider interface {
+	Secret(name string) (string, error)
+}
+
+// ReadFile - reads secret from file, trailing line break is removed.
+func ReadFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("secret.ReadFile: %w", err)
+	}
+	return strings.TrimRight(string(b), "\r\n"), nil
+}
+
+// FileProvider - reads every secret from file named after it in the directory,
+// like Docker and Kubernetes secrets mounted into /run/secrets
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider - builds provider of secrets in the directory.
+func NewFileProvider(dir string) *FileProvider {
+	return &FileProvider{dir: dir}
+}
+
+// Secret - reads the file of the secret.
+func (p *FileProvider) Secret(name string) (string, error) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") {
+		return "", fmt.Errorf("secret.FileProvider: invalid name %q", name)
+	}
+	s, err := ReadFile(filepath.Join(p.dir, name))
+	if errors.Is(err, os.ErrNotExist) {
+		return "", ErrNotFound
+	}
+	return s, err
+}
+
+// EnvProvider - takes every secret from environment variable named after it with prefix,
+// like APP_SECRET_USER_PASSWORD for user_password secret and APP_SECRET_ prefix
+type EnvProvider struct {
+	prefix string
+	lookup func(string) (string, bool)
+}
+
+// NewEnvProvider - builds provider of secrets in the process environment.
+func NewEnvProvider(prefix string) *EnvProvider {
+	return &EnvProvider{prefix: prefix, lookup: os.LookupEnv}
+}
+
+// Secret - returns value of the environment variable.
+func (p *EnvProvider) Secret(name string) (string, error) {
+	s, ok := p.lookup(p.prefix + strings.ToUpper(name))
+	if !ok {
+		return "", ErrNotFound
+	}
+	return s, nil
+}
+
+// Entropy - estimates entropy of the secret in bits by frequency of its characters,
+// so repeated and predictable patterns score lower than random strings of the same length.
+func Entropy(s string) float64 {
+	if s == "" {
+		return 0
+	}
+	freq, n := map[rune]int{}, 0
+	for _, c := range s {
+		freq[c]++
+		n++
+	}
+	perChar := 0.0
+	for _, f := range freq {
+		p := float64(f) / float64(n)
+		perChar -= p * math.Log2(p)
+	}
+	return perChar * float64(n)
+}
@@ -0,0 +1,80 @@
+package secret
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileProvider(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "auth_bearer"), []byte("s3cr3t\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	p := NewFileProvider(dir)
+	if s, err := p.Secret("auth_bearer"); err != nil || s != "s3cr3t" {
+		t.Errorf("Unexpected secret %q: %v", s, err)
+	}
+	if _, err := p.Secret("user_password"); err != ErrNotFound {
+		t.Errorf("Missing secret is found: %v", err)
+	}
+	if _, err := p.Secret("../auth_bearer"); err == nil || err == ErrNotFound {
+		t.Errorf("Secret out of directory is accessible: %v", err)
+	}
+}
+
+func TestEnvProvider(t *testing.T) {
+	p := NewEnvProvider("APP_SECRET_")
+	p.lookup = func(name string) (string, bool) {
+		if name == "APP_SECRET_AUTH_BEARER" {
+			return "s3cr3t", true
+		}
+		return "", false
+	}
+	if s, err := p.Secret("auth_bearer"); err != nil || s != "s3cr3t" {
+		t.Errorf("Unexpected secret %q: %v", s, err)
+	}
+	if _, err := p.Secret("user_password"); err != ErrNotFound {
+		t.Errorf("Missing secret is found: %v", err)
+	}
+}
+
+func TestKeyring(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "keyring.json")
+	k := NewKeyring()
+	k.Set("auth_bearer", "s3cr3t")
+	if err := k.Save(path, "master"); err != nil {
+		t.Fatal(err)
+	}
+	k, err := OpenKeyring(path, "master")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, err := k.Secret("auth_bearer"); err != nil || s != "s3cr3t" {
+		t.Errorf("Unexpected secret %q: %v", s, err)
+	}
+	if _, err := k.Secret("user_password"); err != ErrNotFound {
+		t.Errorf("Missing secret is found: %v", err)
+	}
+	if _, err := OpenKeyring(path, "wrong"); err == nil {
+		t.Error("Keyring is opened with wrong master key")
+	}
+	data, _ := os.ReadFile(path)
+	data[len(data)-10] ^= 1
+	os.WriteFile(path, data, 0600)
+	if _, err := OpenKeyring(path, "master"); err == nil {
+		t.Error("Corrupted keyring is opened")
+	}
+}
+
+func TestEntropy(t *testing.T) {
+	if e := Entropy("aaaaaaaaaaaaaaaaaaaaaaaa"); e != 0 {
+		t.Errorf("Repeated character has entropy %f", e)
+	}
+	if e := Entropy("abab"); e != 4 {
+		t.Errorf("Unexpected entropy %f", e)
+	}
+	if weak, strong := Entropy("password"), Entropy("q8Zr2vLx0Tn5Wd7K"); weak >= strong || strong < 64 {
+		t.Errorf("Unexpected entropy of weak %f and strong %f secrets", weak, strong)
+	}
+}
@@ -0,0 +1,35 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrSchemaBehind - database schema has pending migrations
+	ErrSchemaBehind = errors.New("schema is behind, run migrate up")
+	// ErrSchemaAhead - database schema is migrated by newer version of the server
+	ErrSchemaAhead = errors.New("schema is ahead of the server, upgrade the server")
+)
+
+// Migration - versioned change of the database schema
+type Migration struct {
+	Version uint64 `json:"version"`
+	Name    string `json:"name"`
+	// AppliedAt - time of applying, nil for pending migrations
+	AppliedAt *time.Time `json:"applied_at"`
+	// Unknown - migration is applied by newer version of the server and can't be reverted by this one
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+// Migrator - applies ordered migrations embedded into the binary;
+// migrations are serialized between instances sharing the database.
+type Migrator interface {
+	// Status - returns known and applied migrations ordered by version
+	Status(ctx context.Context) ([]Migration, error)
+	// Up - applies pending migrations and returns them
+	Up(ctx context.Context) ([]Migration, error)
+	// Down - reverts the last applied migration and returns it, or nil if nothing is applied
+	Down(ctx context.Context) (*Migration, error)
+}
@@ -0,0 +1,15 @@
+DROP TABLE IF EXISTS `{{prefix}}audit_chain_head`;
+DROP TABLE IF EXISTS `{{prefix}}audit_entry`;
+DROP TABLE IF EXISTS `{{prefix}}conversion`;
+DROP TABLE IF EXISTS `{{prefix}}exchange_rate`;
+DROP TABLE IF EXISTS `{{prefix}}webhook_delivery`;
+DROP TABLE IF EXISTS `{{prefix}}webhook_subscription`;
+DROP TABLE IF EXISTS `{{prefix}}event_offset`;
+DROP TABLE IF EXISTS `{{prefix}}outbox_event`;
+DROP TABLE IF EXISTS `{{prefix}}payment_request`;
+DROP TABLE IF EXISTS `{{prefix}}split`;
+DROP TABLE IF EXISTS `{{prefix}}escrow`;
+DROP TABLE IF EXISTS `{{prefix}}hold`;
+DROP TABLE IF EXISTS `{{prefix}}internal_transfer`;
+DROP TABLE IF EXISTS `{{prefix}}wallet`;
+DROP TABLE IF EXISTS `{{prefix}}user`;
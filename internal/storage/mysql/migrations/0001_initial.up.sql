@@ -0,0 +1,220 @@
+-- Schema created by AutoMigrate of previous releases, so existing databases are adopted as is.
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}user` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`role` tinyint unsigned NOT NULL DEFAULT '1',
+	`email` varchar(255) NOT NULL,
+	`name` varchar(255) NOT NULL,
+	`p_hash` varchar(255) NOT NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}user_name` (`name`),
+	UNIQUE INDEX `uix_{{prefix}}user_email` (`email`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}wallet` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`balance` double NOT NULL DEFAULT '0',
+	`held` double NOT NULL DEFAULT '0',
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `wallet_user_currency` (`user_id`, `currency`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}internal_transfer` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`recipient_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`sum` double NOT NULL,
+	`memo` varchar(255) NOT NULL DEFAULT '',
+	`user_balance_before` double NOT NULL,
+	`user_balance_after` double NOT NULL,
+	`recipient_balance_before` double NOT NULL,
+	`recipient_balance_after` double NOT NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}internal_transfer_user_id` (`user_id`),
+	INDEX `idx_{{prefix}}internal_transfer_recipient_id` (`recipient_id`),
+	INDEX `idx_{{prefix}}internal_transfer_currency` (`currency`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}hold` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`recipient_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`sum` double NOT NULL,
+	`captured` double NOT NULL DEFAULT '0',
+	`status` varchar(16) NOT NULL,
+	`expires_at` timestamp NOT NULL,
+	`transfer_id` bigint unsigned NOT NULL DEFAULT '0',
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}hold_user_id` (`user_id`),
+	INDEX `idx_{{prefix}}hold_recipient_id` (`recipient_id`),
+	INDEX `idx_{{prefix}}hold_status` (`status`),
+	INDEX `idx_{{prefix}}hold_expires_at` (`expires_at`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}escrow` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`recipient_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`sum` double NOT NULL,
+	`memo` varchar(255) NOT NULL DEFAULT '',
+	`status` varchar(16) NOT NULL,
+	`deadline` timestamp NOT NULL,
+	`on_deadline` varchar(16) NOT NULL,
+	`disputed_by` bigint unsigned NOT NULL DEFAULT '0',
+	`resolved_by` bigint unsigned NOT NULL DEFAULT '0',
+	`note` varchar(255) NOT NULL DEFAULT '',
+	`transfer_id` bigint unsigned NOT NULL DEFAULT '0',
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}escrow_user_id` (`user_id`),
+	INDEX `idx_{{prefix}}escrow_recipient_id` (`recipient_id`),
+	INDEX `idx_{{prefix}}escrow_status` (`status`),
+	INDEX `idx_{{prefix}}escrow_deadline` (`deadline`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}split` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`total` double NOT NULL,
+	`memo` varchar(255) NOT NULL DEFAULT '',
+	`status` varchar(16) NOT NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}split_user_id` (`user_id`),
+	INDEX `idx_{{prefix}}split_status` (`status`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}payment_request` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`split_id` bigint unsigned NOT NULL DEFAULT '0',
+	`requester_id` bigint unsigned NOT NULL,
+	`payer_id` bigint unsigned NOT NULL,
+	`currency` varchar(8) NOT NULL,
+	`sum` double NOT NULL,
+	`memo` varchar(255) NOT NULL DEFAULT '',
+	`status` varchar(16) NOT NULL,
+	`transfer_id` bigint unsigned NOT NULL DEFAULT '0',
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}payment_request_payer_id` (`payer_id`),
+	INDEX `idx_{{prefix}}payment_request_status` (`status`),
+	INDEX `idx_{{prefix}}payment_request_split_id` (`split_id`),
+	INDEX `idx_{{prefix}}payment_request_requester_id` (`requester_id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}outbox_event` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`type` varchar(64) NOT NULL,
+	`payload` text NOT NULL,
+	PRIMARY KEY (`id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}event_offset` (
+	`subscriber` varchar(64),
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`event_id` bigint unsigned NOT NULL,
+	PRIMARY KEY (`subscriber`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}webhook_subscription` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`url` varchar(2048) NOT NULL,
+	`events` varchar(255) NOT NULL,
+	`secret` varchar(255) NOT NULL,
+	`active` boolean NOT NULL DEFAULT '1',
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}webhook_subscription_user_id` (`user_id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}webhook_delivery` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`subscription_id` bigint unsigned NOT NULL,
+	`event_id` bigint unsigned NOT NULL,
+	`event` varchar(255) NOT NULL,
+	`payload` text NOT NULL,
+	`status` varchar(16) NOT NULL,
+	`attempts` int NOT NULL DEFAULT '0',
+	`next_attempt_at` timestamp NOT NULL,
+	`last_attempt_at` timestamp NULL,
+	`response_status` int NOT NULL DEFAULT '0',
+	`last_error` varchar(1024) NOT NULL DEFAULT '',
+	PRIMARY KEY (`id`),
+	INDEX `webhook_delivery_due` (`status`, `next_attempt_at`),
+	UNIQUE INDEX `webhook_delivery_event` (`subscription_id`, `event_id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}exchange_rate` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`updated_at` timestamp NOT NULL DEFAULT current_timestamp on update current_timestamp,
+	`from_currency` varchar(8) NOT NULL,
+	`to_currency` varchar(8) NOT NULL,
+	`rate` double NOT NULL,
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `exchange_rate_pair` (`from_currency`, `to_currency`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}conversion` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`user_id` bigint unsigned NOT NULL,
+	`from_currency` varchar(8) NOT NULL,
+	`to_currency` varchar(8) NOT NULL,
+	`rate` double NOT NULL,
+	`sum` double NOT NULL,
+	`result` double NOT NULL,
+	`from_balance_before` double NOT NULL,
+	`from_balance_after` double NOT NULL,
+	`to_balance_before` double NOT NULL,
+	`to_balance_after` double NOT NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}conversion_user_id` (`user_id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}audit_entry` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`actor_id` bigint unsigned NOT NULL,
+	`action` varchar(64) NOT NULL,
+	`target` varchar(255) NOT NULL DEFAULT '',
+	`client_ip` varchar(64) NOT NULL DEFAULT '',
+	`user_agent` varchar(255) NOT NULL DEFAULT '',
+	`request_id` varchar(64) NOT NULL DEFAULT '',
+	`outcome` varchar(16) NOT NULL,
+	`prev_hash` char(64) NOT NULL DEFAULT '',
+	`hash` char(64) NOT NULL,
+	PRIMARY KEY (`id`),
+	INDEX `idx_{{prefix}}audit_entry_created_at` (`created_at`),
+	INDEX `idx_{{prefix}}audit_entry_actor_id` (`actor_id`),
+	INDEX `idx_{{prefix}}audit_entry_action` (`action`),
+	INDEX `idx_{{prefix}}audit_entry_outcome` (`outcome`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}audit_chain_head` (
+	`id` bigint unsigned,
+	`entry_id` bigint unsigned NOT NULL,
+	`hash` char(64) NOT NULL DEFAULT '',
+	PRIMARY KEY (`id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+INSERT IGNORE INTO `{{prefix}}audit_chain_head` (`id`, `entry_id`, `hash`) VALUES (1, 0, '');
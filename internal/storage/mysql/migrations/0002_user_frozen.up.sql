@@ -0,0 +1,10 @@
+-- databases adopted by the initial migration may already have the column created by previous versions
+SET @pwsrv_stmt = IF(
+	(SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = '{{prefix}}user' AND column_name = 'frozen') = 0,
+	'ALTER TABLE `{{prefix}}user` ADD COLUMN `frozen` boolean NOT NULL DEFAULT false AFTER `p_hash`',
+	'DO 0'
+);
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
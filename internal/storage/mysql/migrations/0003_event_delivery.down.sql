@@ -0,0 +1,9 @@
+DROP INDEX `idx_{{prefix}}outbox_event_created_at` ON `{{prefix}}outbox_event`;
+
+DROP TABLE IF EXISTS `{{prefix}}event_dead_letter`;
+
+ALTER TABLE `{{prefix}}event_offset`
+	DROP COLUMN `last_error`,
+	DROP COLUMN `retry_at`,
+	DROP COLUMN `attempts`,
+	DROP COLUMN `failed_event_id`;
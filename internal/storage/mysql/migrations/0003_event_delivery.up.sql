@@ -0,0 +1,21 @@
+ALTER TABLE `{{prefix}}event_offset`
+	ADD COLUMN `failed_event_id` bigint unsigned NOT NULL DEFAULT '0',
+	ADD COLUMN `attempts` int NOT NULL DEFAULT '0',
+	ADD COLUMN `retry_at` timestamp NULL DEFAULT NULL,
+	ADD COLUMN `last_error` varchar(1024) NOT NULL DEFAULT '';
+
+CREATE TABLE IF NOT EXISTS `{{prefix}}event_dead_letter` (
+	`id` bigint unsigned AUTO_INCREMENT,
+	`created_at` timestamp NOT NULL DEFAULT current_timestamp,
+	`subscriber` varchar(64) NOT NULL,
+	`event_id` bigint unsigned NOT NULL,
+	`type` varchar(64) NOT NULL,
+	`payload` text NOT NULL,
+	`attempts` int NOT NULL,
+	`reason` varchar(1024) NOT NULL,
+	PRIMARY KEY (`id`),
+	UNIQUE INDEX `event_dead_letter_event` (`subscriber`, `event_id`)
+) COLLATE='utf8_general_ci' ENGINE=InnoDB;
+
+-- handled events are pruned by creation time
+CREATE INDEX `idx_{{prefix}}outbox_event_created_at` ON `{{prefix}}outbox_event` (`created_at`);
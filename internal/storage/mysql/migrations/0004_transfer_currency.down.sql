@@ -0,0 +1 @@
+-- columns are part of the initial schema of later releases, so they are not dropped
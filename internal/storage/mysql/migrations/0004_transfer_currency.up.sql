@@ -0,0 +1,35 @@
+-- transfers table of the first release has neither currency nor memo,
+-- tables created by later releases have them already;
+-- transfers made before currencies were introduced are in default currency
+SET @pwsrv_stmt = IF(
+	(SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = '{{prefix}}internal_transfer' AND column_name = 'currency') = 0,
+	'ALTER TABLE `{{prefix}}internal_transfer` ADD COLUMN `currency` varchar(8) NOT NULL DEFAULT ''PW'' AFTER `recipient_id`',
+	'DO 0'
+);
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
+-- default is needed for existing rows only
+ALTER TABLE `{{prefix}}internal_transfer` ALTER COLUMN `currency` DROP DEFAULT;
+
+SET @pwsrv_stmt = IF(
+	(SELECT COUNT(*) FROM information_schema.columns
+		WHERE table_schema = DATABASE() AND table_name = '{{prefix}}internal_transfer' AND column_name = 'memo') = 0,
+	'ALTER TABLE `{{prefix}}internal_transfer` ADD COLUMN `memo` varchar(255) NOT NULL DEFAULT '''' AFTER `sum`',
+	'DO 0'
+);
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
+
+SET @pwsrv_stmt = IF(
+	(SELECT COUNT(*) FROM information_schema.statistics
+		WHERE table_schema = DATABASE() AND table_name = '{{prefix}}internal_transfer'
+		AND index_name = 'idx_{{prefix}}internal_transfer_currency') = 0,
+	'CREATE INDEX `idx_{{prefix}}internal_transfer_currency` ON `{{prefix}}internal_transfer` (`currency`)',
+	'DO 0'
+);
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
@@ -0,0 +1 @@
+-- balances are kept in wallets, legacy column is not restored
@@ -0,0 +1,20 @@
+-- legacy single balance of users is moved into wallets of default currency;
+-- every statement is idempotent, so failed migration may be applied again
+SET @pwsrv_legacy = (SELECT COUNT(*) FROM information_schema.columns
+	WHERE table_schema = DATABASE() AND table_name = '{{prefix}}user' AND column_name = 'balance');
+
+SET @pwsrv_stmt = IF(
+	@pwsrv_legacy > 0,
+	'INSERT IGNORE INTO `{{prefix}}wallet` (user_id, currency, balance) SELECT id, ''PW'', balance FROM `{{prefix}}user`',
+	'DO 0'
+);
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
+
+UPDATE `{{prefix}}internal_transfer` SET currency = 'PW' WHERE currency = '';
+
+SET @pwsrv_stmt = IF(@pwsrv_legacy > 0, 'ALTER TABLE `{{prefix}}user` DROP COLUMN `balance`', 'DO 0');
+PREPARE pwsrv_stmt FROM @pwsrv_stmt;
+EXECUTE pwsrv_stmt;
+DEALLOCATE PREPARE pwsrv_stmt;
@@ -0,0 +1,76 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/wtask/pwsrv/internal/archive"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func (s *mysqlstorage) ArchiveStore() archive.Store {
+	if s.db == nil {
+		return nil
+	}
+	return s
+}
+
+// ReadDataset - reads dataset within single transaction, so InnoDB returns rows of the same snapshot.
+func (s *mysqlstorage) ReadDataset() (*archive.Dataset, error) {
+	d := &archive.Dataset{}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		for _, rows := range []interface{}{&d.Users, &d.Wallets, &d.Transfers, &d.Conversions} {
+			if err := tx.Order("id").Find(rows).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ReadDataset: %s", err.Error())
+	}
+	return d, nil
+}
+
+// ImportDataset - inserts rows with their IDs without domain events, so webhooks are not sent for imported data.
+func (s *mysqlstorage) ImportDataset(d *archive.Dataset) error {
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		for _, table := range []interface{}{&model.User{}, &model.Wallet{}, &model.InternalTransfer{}, &model.Conversion{}} {
+			count := 0
+			if err := tx.Model(table).Count(&count).Error; err != nil {
+				return err
+			}
+			if count > 0 {
+				return fmt.Errorf("table %s is not empty", tx.NewScope(table).TableName())
+			}
+		}
+		for _, u := range d.Users {
+			u.Wallets = nil
+			if err := tx.Create(&u).Error; err != nil {
+				return fmt.Errorf("user #%d: %s", u.ID, err.Error())
+			}
+		}
+		for _, w := range d.Wallets {
+			// holds and escrows are not imported, so nothing is reserved
+			w.Held = 0
+			if err := tx.Create(&w).Error; err != nil {
+				return fmt.Errorf("wallet #%d: %s", w.ID, err.Error())
+			}
+		}
+		for _, t := range d.Transfers {
+			if err := tx.Create(&t).Error; err != nil {
+				return fmt.Errorf("transfer #%d: %s", t.ID, err.Error())
+			}
+		}
+		for _, c := range d.Conversions {
+			if err := tx.Create(&c).Error; err != nil {
+				return fmt.Errorf("conversion #%d: %s", c.ID, err.Error())
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("mysql.ImportDataset: %s", err.Error())
+	}
+	return nil
+}
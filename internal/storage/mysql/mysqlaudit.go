@@ -0,0 +1,83 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/audit"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// auditChainHeadID - ID of the single row of audit chain head, which is created by initial migration
+const auditChainHeadID = 1
+
+func (s *mysqlstorage) AppendAuditEntry(e model.AuditEntry) (*model.AuditEntry, error) {
+	if e.ID != 0 || e.Action == "" || e.Outcome == "" || e.CreatedAt.IsZero() {
+		return nil, errors.New("mysql.AppendAuditEntry: existed ID or required field is empty")
+	}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		head := model.AuditChainHead{}
+		if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&head, auditChainHeadID).Error; err != nil {
+			return err
+		}
+		e.PrevHash = head.Hash
+		e.Hash = audit.Hash(e.PrevHash, &e)
+		if err := tx.Create(&e).Error; err != nil {
+			return err
+		}
+		return tx.Model(&head).Updates(map[string]interface{}{"entry_id": e.ID, "hash": e.Hash}).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.AppendAuditEntry: %s", err.Error())
+	}
+	return &e, nil
+}
+
+func (s *mysqlstorage) FindAuditEntries(f audit.Filter, limit int) ([]model.AuditEntry, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	q := s.db
+	if f.ActorID != 0 {
+		q = q.Where("actor_id = ?", f.ActorID)
+	}
+	if f.Action != "" {
+		q = q.Where("action = ?", f.Action)
+	}
+	if f.Outcome != "" {
+		q = q.Where("outcome = ?", f.Outcome)
+	}
+	if !f.Since.IsZero() {
+		q = q.Where("created_at >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		q = q.Where("created_at < ?", f.Until)
+	}
+	if f.BeforeID != 0 {
+		q = q.Where("id < ?", f.BeforeID)
+	}
+	entries := []model.AuditEntry{}
+	if err := q.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		return nil, fmt.Errorf("mysql.FindAuditEntries: %s", err.Error())
+	}
+	return entries, nil
+}
+
+func (s *mysqlstorage) ReadAuditChain(afterID uint64, limit int) ([]model.AuditEntry, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	entries := []model.AuditEntry{}
+	err := s.db.
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entries).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ReadAuditChain: %s", err.Error())
+	}
+	return entries, nil
+}
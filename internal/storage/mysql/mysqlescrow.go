@@ -0,0 +1,203 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// lockEscrow - selects escrow for update within given transaction, returns nil if escrow is not found.
+func lockEscrow(tx *gorm.DB, escrowID uint64) (*model.Escrow, error) {
+	e := model.Escrow{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&e, escrowID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &e, nil
+}
+
+// moveEscrow - changes escrow status within transaction and settles reserved funds for final statuses.
+func moveEscrow(tx *gorm.DB, e *model.Escrow, status model.EscrowStatus) error {
+	if !e.Status.CanBecome(status) {
+		return fmt.Errorf("escrow #%d is %s and can not become %s", e.ID, e.Status, status)
+	}
+	if status.IsFinal() {
+		if err := releaseFunds(tx, e.UserID, e.Currency, e.Sum); err != nil {
+			return err
+		}
+	}
+	if status == model.EscrowCompleted {
+		itm, err := transferFunds(tx, e.UserID, e.RecipientID, e.Currency, e.Sum, e.Memo)
+		if err != nil {
+			return err
+		}
+		e.TransferID = itm.ID
+	}
+	e.Status = status
+	return tx.Model(e).UpdateColumns(map[string]interface{}{
+		"status":      e.Status,
+		"transfer_id": e.TransferID,
+		"disputed_by": e.DisputedBy,
+		"resolved_by": e.ResolvedBy,
+		"note":        e.Note,
+	}).Error
+}
+
+func (s *mysqlstorage) CreateEscrow(e model.Escrow) (*model.Escrow, error) {
+	if e.ID != 0 || e.UserID == 0 || e.RecipientID == 0 {
+		return nil, errors.New("mysql.CreateEscrow: existed ID or required field is empty")
+	}
+	if e.UserID == e.RecipientID {
+		return nil, errors.New("mysql.CreateEscrow: user and recipient are the same")
+	}
+	if e.Sum <= 0 {
+		return nil, errors.New("mysql.CreateEscrow: sum must be positive")
+	}
+	if !e.OnDeadline.IsFinal() {
+		return nil, fmt.Errorf("mysql.CreateEscrow: unsupported deadline rule %q", e.OnDeadline)
+	}
+	e.CreatedAt = time.Now().UTC()
+	e.Deadline = e.Deadline.UTC()
+	e.Status = model.EscrowPending
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		if err := tx.First(&model.User{}, e.RecipientID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("recipient #%d not found", e.RecipientID)
+			}
+			return err
+		}
+		if err := reserveFunds(tx, e.UserID, e.Currency, e.Sum); err != nil {
+			return err
+		}
+		return tx.Create(&e).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.CreateEscrow: %s", err.Error())
+	}
+	return &e, nil
+}
+
+func (s *mysqlstorage) GetEscrowByID(escrowID uint64) (*model.Escrow, error) {
+	e := model.Escrow{}
+	if err := s.db.First(&e, escrowID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("mysql.GetEscrowByID: %s", err.Error())
+	}
+	return &e, nil
+}
+
+func (s *mysqlstorage) FindLastEscrows(userID uint64, limit int) ([]model.Escrow, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	escrows := []model.Escrow{}
+	err := s.db.
+		Where("user_id = ? OR recipient_id = ?", userID, userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&escrows).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastEscrows: %s", err.Error())
+	}
+	return escrows, nil
+}
+
+func (s *mysqlstorage) FindEscrowsByStatus(status model.EscrowStatus, limit int) ([]model.Escrow, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	escrows := []model.Escrow{}
+	err := s.db.
+		Where("status = ?", status).
+		Order("id").
+		Limit(limit).
+		Find(&escrows).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindEscrowsByStatus: %s", err.Error())
+	}
+	return escrows, nil
+}
+
+func (s *mysqlstorage) ChangeEscrowStatus(
+	escrowID uint64,
+	status model.EscrowStatus,
+	actorID uint64,
+	note string,
+) (*model.Escrow, error) {
+	var e *model.Escrow
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		if e, err = lockEscrow(tx, escrowID); err != nil {
+			return err
+		}
+		if e == nil {
+			return fmt.Errorf("escrow #%d not found", escrowID)
+		}
+		if status == model.EscrowDisputed {
+			e.DisputedBy = actorID
+		}
+		if e.Status == model.EscrowDisputed {
+			e.ResolvedBy = actorID
+		}
+		if note != "" {
+			e.Note = note
+		}
+		return moveEscrow(tx, e, status)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ChangeEscrowStatus: %s", err.Error())
+	}
+	return e, nil
+}
+
+func (s *mysqlstorage) ExpireEscrows(now time.Time) ([]model.Escrow, error) {
+	ids := []uint64{}
+	err := s.db.
+		Model(&model.Escrow{}).
+		Where("status = ? AND deadline <= ?", model.EscrowPending, now.UTC()).
+		Order("id").
+		Pluck("id", &ids).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ExpireEscrows: %s", err.Error())
+	}
+	expired, failed := []model.Escrow{}, []error{}
+	for _, id := range ids {
+		var processed *model.Escrow
+		err = s.inTransaction(func(tx *gorm.DB) error {
+			e, err := lockEscrow(tx, id)
+			if err != nil || e == nil || e.Status != model.EscrowPending {
+				// already processed concurrently
+				return err
+			}
+			if err = moveEscrow(tx, e, e.OnDeadline); err != nil {
+				return err
+			}
+			processed = e
+			return nil
+		})
+		if err != nil {
+			// failed escrow is retried on the next run and does not block others
+			failed = append(failed, fmt.Errorf("escrow #%d: %s", id, err.Error()))
+			continue
+		}
+		if processed != nil {
+			expired = append(expired, *processed)
+		}
+	}
+	if len(failed) > 0 {
+		return expired, fmt.Errorf("mysql.ExpireEscrows: %w", errors.Join(failed...))
+	}
+	return expired, nil
+}
@@ -0,0 +1,148 @@
+package mysql
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// writeOutbox - stores domain event within given transaction.
+func writeOutbox(tx *gorm.DB, kind string, payload interface{}) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	return tx.Create(&model.OutboxEvent{
+		CreatedAt: time.Now().UTC(),
+		Type:      kind,
+		Payload:   string(b),
+	}).Error
+}
+
+func (s *mysqlstorage) ReadEvents(afterID uint64, limit int) ([]event.Event, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	stored := []model.OutboxEvent{}
+	err := s.db.
+		Where("id > ?", afterID).
+		Order("id").
+		Limit(limit).
+		Find(&stored).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ReadEvents: %s", err.Error())
+	}
+	events := make([]event.Event, len(stored))
+	for i, e := range stored {
+		events[i] = event.Event{
+			ID:        e.ID,
+			Type:      e.Type,
+			CreatedAt: e.CreatedAt,
+			Payload:   json.RawMessage(e.Payload),
+		}
+	}
+	return events, nil
+}
+
+func (s *mysqlstorage) GetEventOffset(subscriber string) (event.Offset, error) {
+	o := model.EventOffset{}
+	if err := s.db.Where("subscriber = ?", subscriber).First(&o).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return event.Offset{}, nil
+		}
+		return event.Offset{}, fmt.Errorf("mysql.GetEventOffset: %s", err.Error())
+	}
+	offset := event.Offset{
+		EventID:       o.EventID,
+		FailedEventID: o.FailedEventID,
+		Attempts:      o.Attempts,
+		LastError:     o.LastError,
+	}
+	if o.RetryAt != nil {
+		offset.RetryAt = *o.RetryAt
+	}
+	return offset, nil
+}
+
+// saveOffset - creates or updates offset of the subscriber within given transaction.
+func saveOffset(tx *gorm.DB, subscriber string, o event.Offset) error {
+	var retryAt *time.Time
+	if !o.RetryAt.IsZero() {
+		at := o.RetryAt.UTC()
+		retryAt = &at
+	}
+	// map is used, because zero values of struct fields are not assigned
+	return tx.
+		Where(model.EventOffset{Subscriber: subscriber}).
+		Assign(map[string]interface{}{
+			"event_id":        o.EventID,
+			"failed_event_id": o.FailedEventID,
+			"attempts":        o.Attempts,
+			"retry_at":        retryAt,
+			"last_error":      o.LastError,
+		}).
+		FirstOrCreate(&model.EventOffset{}).
+		Error
+}
+
+func (s *mysqlstorage) SaveEventOffset(subscriber string, o event.Offset) error {
+	if err := saveOffset(s.db, subscriber, o); err != nil {
+		return fmt.Errorf("mysql.SaveEventOffset: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *mysqlstorage) DeadLetterEvent(subscriber string, e *event.Event, attempts int, reason string) error {
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		err := tx.Create(&model.EventDeadLetter{
+			CreatedAt:  time.Now().UTC(),
+			Subscriber: subscriber,
+			EventID:    e.ID,
+			Type:       e.Type,
+			Payload:    string(e.Payload),
+			Attempts:   attempts,
+			Reason:     reason,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return saveOffset(tx, subscriber, event.Offset{EventID: e.ID})
+	})
+	if err != nil {
+		return fmt.Errorf("mysql.DeadLetterEvent: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *mysqlstorage) PruneEvents(before time.Time, subscribers []string) (int, error) {
+	if len(subscribers) == 0 {
+		return 0, nil
+	}
+	offsets := []model.EventOffset{}
+	if err := s.db.Where("subscriber IN (?)", subscribers).Find(&offsets).Error; err != nil {
+		return 0, fmt.Errorf("mysql.PruneEvents: %s", err.Error())
+	}
+	if len(offsets) < len(subscribers) {
+		// some subscriber has not handled any event yet
+		return 0, nil
+	}
+	handled := offsets[0].EventID
+	for _, o := range offsets[1:] {
+		if o.EventID < handled {
+			handled = o.EventID
+		}
+	}
+	result := s.db.
+		Where("id <= ? AND created_at < ?", handled, before.UTC()).
+		Delete(&model.OutboxEvent{})
+	if result.Error != nil {
+		return 0, fmt.Errorf("mysql.PruneEvents: %s", result.Error.Error())
+	}
+	return int(result.RowsAffected), nil
+}
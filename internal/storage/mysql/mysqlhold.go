@@ -0,0 +1,203 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// lockHold - selects hold for update within given transaction, returns nil if hold is not found.
+func lockHold(tx *gorm.DB, holdID uint64) (*model.Hold, error) {
+	h := model.Hold{}
+	err := tx.Set("gorm:query_option", "FOR UPDATE").First(&h, holdID).Error
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return &h, nil
+}
+
+// finishHold - releases reserved funds of the active hold and sets its final status.
+func finishHold(tx *gorm.DB, h *model.Hold, status model.HoldStatus) error {
+	if err := releaseFunds(tx, h.UserID, h.Currency, h.Sum); err != nil {
+		return err
+	}
+	h.Status = status
+	return tx.Model(h).UpdateColumn("status", status).Error
+}
+
+func (s *mysqlstorage) CreateHold(
+	userID, recipientID uint64,
+	currency model.Currency,
+	sum float64,
+	expiresAt time.Time,
+) (*model.Hold, error) {
+	if userID == recipientID {
+		return nil, errors.New("mysql.CreateHold: user and recipient are the same")
+	}
+	if sum <= 0 {
+		return nil, errors.New("mysql.CreateHold: sum must be positive")
+	}
+	h := model.Hold{
+		CreatedAt:   time.Now().UTC(),
+		UserID:      userID,
+		RecipientID: recipientID,
+		Currency:    currency,
+		Sum:         sum,
+		Status:      model.HoldActive,
+		ExpiresAt:   expiresAt.UTC(),
+	}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		if err := tx.First(&model.User{}, recipientID).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return fmt.Errorf("recipient #%d not found", recipientID)
+			}
+			return err
+		}
+		if err := reserveFunds(tx, userID, currency, sum); err != nil {
+			return err
+		}
+		return tx.Create(&h).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.CreateHold: %s", err.Error())
+	}
+	return &h, nil
+}
+
+func (s *mysqlstorage) GetHoldByID(holdID uint64) (*model.Hold, error) {
+	h := model.Hold{}
+	if err := s.db.First(&h, holdID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("mysql.GetHoldByID: %s", err.Error())
+	}
+	return &h, nil
+}
+
+func (s *mysqlstorage) FindLastHolds(userID uint64, limit int) ([]model.Hold, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	holds := []model.Hold{}
+	err := s.db.
+		Where("user_id = ? OR recipient_id = ?", userID, userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&holds).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastHolds: %s", err.Error())
+	}
+	return holds, nil
+}
+
+func (s *mysqlstorage) CaptureHold(holdID uint64, sum float64) (*model.Hold, *model.InternalTransfer, error) {
+	var (
+		h   *model.Hold
+		itm *model.InternalTransfer
+	)
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		if h, err = lockHold(tx, holdID); err != nil {
+			return err
+		}
+		if h == nil {
+			return fmt.Errorf("hold #%d not found", holdID)
+		}
+		if h.Status != model.HoldActive {
+			return fmt.Errorf("hold #%d is %s", holdID, h.Status)
+		}
+		if !h.ExpiresAt.After(time.Now()) {
+			return fmt.Errorf("hold #%d is expired", holdID)
+		}
+		if sum <= 0 || sum > h.Sum {
+			return fmt.Errorf("capture sum must be positive and not exceed %f", h.Sum)
+		}
+		// whole reservation is released, only captured part is transferred
+		if err = finishHold(tx, h, model.HoldCaptured); err != nil {
+			return err
+		}
+		if itm, err = transferFunds(tx, h.UserID, h.RecipientID, h.Currency, sum, fmt.Sprintf("hold #%d", h.ID)); err != nil {
+			return err
+		}
+		h.Captured, h.TransferID = sum, itm.ID
+		return tx.Model(h).UpdateColumns(map[string]interface{}{
+			"captured":    h.Captured,
+			"transfer_id": h.TransferID,
+		}).Error
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("mysql.CaptureHold: %s", err.Error())
+	}
+	return h, itm, nil
+}
+
+func (s *mysqlstorage) ReleaseHold(holdID uint64) (*model.Hold, error) {
+	var h *model.Hold
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		if h, err = lockHold(tx, holdID); err != nil {
+			return err
+		}
+		if h == nil {
+			return fmt.Errorf("hold #%d not found", holdID)
+		}
+		if h.Status != model.HoldActive {
+			return fmt.Errorf("hold #%d is %s", holdID, h.Status)
+		}
+		return finishHold(tx, h, model.HoldReleased)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ReleaseHold: %s", err.Error())
+	}
+	return h, nil
+}
+
+func (s *mysqlstorage) ExpireHolds(now time.Time) ([]model.Hold, error) {
+	ids := []uint64{}
+	err := s.db.
+		Model(&model.Hold{}).
+		Where("status = ? AND expires_at <= ?", model.HoldActive, now.UTC()).
+		Order("id").
+		Pluck("id", &ids).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ExpireHolds: %s", err.Error())
+	}
+	expired, failed := []model.Hold{}, []error{}
+	for _, id := range ids {
+		var processed *model.Hold
+		err = s.inTransaction(func(tx *gorm.DB) error {
+			h, err := lockHold(tx, id)
+			if err != nil || h == nil || h.Status != model.HoldActive {
+				// already processed concurrently
+				return err
+			}
+			if err = finishHold(tx, h, model.HoldExpired); err != nil {
+				return err
+			}
+			processed = h
+			return nil
+		})
+		if err != nil {
+			// failed hold is retried on the next run and does not block others
+			failed = append(failed, fmt.Errorf("hold #%d: %s", id, err.Error()))
+			continue
+		}
+		if processed != nil {
+			expired = append(expired, *processed)
+		}
+	}
+	if len(failed) > 0 {
+		return expired, fmt.Errorf("mysql.ExpireHolds: %w", errors.Join(failed...))
+	}
+	return expired, nil
+}
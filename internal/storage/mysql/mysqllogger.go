@@ -0,0 +1,31 @@
+package mysql
+
+import (
+	"fmt"
+	"log/slog"
+	"time"
+)
+
+// gormLogger - adapts structured logger to gorm, which prints values in format depending on the first one:
+// ("sql", source, duration, query, vars, rows), ("log", source, values...) or (source, error).
+type gormLogger struct {
+	l *slog.Logger
+}
+
+func (g gormLogger) Print(v ...interface{}) {
+	if len(v) < 2 {
+		return
+	}
+	switch v[0] {
+	case "sql":
+		if len(v) < 6 {
+			return
+		}
+		duration, _ := v[2].(time.Duration)
+		g.l.Debug("SQL", "source", v[1], "duration", duration, "query", v[3], "rows", v[5])
+	case "log":
+		g.l.Error("Storage error", "source", v[1], "error", fmt.Sprint(v[2:]...))
+	default:
+		g.l.Error("Storage error", "source", v[0], "error", fmt.Sprint(v[1:]...))
+	}
+}
@@ -0,0 +1,357 @@
+package mysql
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"embed"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/storage"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockTimeout - max duration of waiting for another instance, which is migrating the schema
+const migrationLockTimeout = 60 * time.Second
+
+// migrationLockName - SQL expression of the lock name for the table of migrations given as argument;
+// it is hashed, because length of the name is limited by 64 characters
+const migrationLockName = "SHA1(CONCAT(DATABASE(), '.', ?))"
+
+// prefixPlaceholder - replaced with table prefix in migrations
+const prefixPlaceholder = "{{prefix}}"
+
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// migration - pair of SQL scripts, checksum is taken from up script
+type migration struct {
+	version  uint64
+	name     string
+	up, down string
+	checksum string
+}
+
+// appliedMigration - row of schema_migrations table
+type appliedMigration struct {
+	version   uint64
+	name      string
+	checksum  string
+	appliedAt time.Time
+}
+
+// loadMigrations - reads migrations named like 0001_name.up.sql and 0001_name.down.sql;
+// versions must start with 1 and have no gaps.
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[uint64]*migration{}
+	for _, e := range entries {
+		m := migrationFileName.FindStringSubmatch(e.Name())
+		if m == nil {
+			return nil, fmt.Errorf("unexpected migration file %s", e.Name())
+		}
+		version, _ := strconv.ParseUint(m[1], 10, 64)
+		content, err := fs.ReadFile(fsys, path.Join(dir, e.Name()))
+		if err != nil {
+			return nil, err
+		}
+		item := byVersion[version]
+		if item == nil {
+			item = &migration{version: version, name: m[2]}
+			byVersion[version] = item
+		}
+		if item.name != m[2] {
+			return nil, fmt.Errorf("migration %d has different names %s and %s", version, item.name, m[2])
+		}
+		if m[3] == "up" {
+			sum := sha256.Sum256(content)
+			item.up, item.checksum = string(content), hex.EncodeToString(sum[:])
+		} else {
+			item.down = string(content)
+		}
+	}
+	migrations := []migration{}
+	for v := uint64(1); v <= uint64(len(byVersion)); v++ {
+		item := byVersion[v]
+		if item == nil {
+			return nil, fmt.Errorf("migration %d is missing", v)
+		}
+		if item.up == "" || item.down == "" {
+			return nil, fmt.Errorf("migration %d must have both up and down scripts", v)
+		}
+		migrations = append(migrations, *item)
+	}
+	return migrations, nil
+}
+
+// statements - splits script into statements ending with semicolon at the end of line,
+// comment lines are skipped and placeholder is replaced with table prefix.
+func statements(script, prefix string) []string {
+	result, current := []string{}, []string{}
+	for _, line := range strings.Split(strings.ReplaceAll(script, prefixPlaceholder, prefix), "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "--") {
+			continue
+		}
+		current = append(current, line)
+		if strings.HasSuffix(trimmed, ";") {
+			result = append(result, strings.TrimSuffix(strings.TrimSpace(strings.Join(current, "\n")), ";"))
+			current = current[:0]
+		}
+	}
+	if len(current) > 0 {
+		result = append(result, strings.TrimSpace(strings.Join(current, "\n")))
+	}
+	return result
+}
+
+// verifyMigrations - checks applied migrations are known ones in the same order with the same checksums;
+// returns count of applied known migrations, error wraps storage.ErrSchemaAhead if unknown migrations are applied.
+func verifyMigrations(applied []appliedMigration, known []migration) (int, error) {
+	for i, a := range applied {
+		if i >= len(known) {
+			return i, fmt.Errorf(
+				"%w: version %d is applied, but version %d is the last known",
+				storage.ErrSchemaAhead, applied[len(applied)-1].version, len(known),
+			)
+		}
+		if a.version != known[i].version {
+			return i, fmt.Errorf("migration %d is applied without migration %d", a.version, known[i].version)
+		}
+		if a.checksum != known[i].checksum {
+			return i, fmt.Errorf("checksum of applied migration %d %s differs from the known one", a.version, a.name)
+		}
+	}
+	return len(applied), nil
+}
+
+// migrator - storage.Migrator implementation keeping applied versions in schema_migrations table
+type migrator struct {
+	db         *sql.DB
+	prefix     string
+	migrations []migration
+}
+
+func (s *mysqlstorage) Migrator() storage.Migrator {
+	if s.db == nil {
+		return nil
+	}
+	return s.migrator()
+}
+
+func (s *mysqlstorage) migrator() *migrator {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		// embedded files are verified by tests
+		panic(fmt.Errorf("mysql.Migrator: %s", err.Error()))
+	}
+	return &migrator{db: s.db.DB(), prefix: s.tablePrefix, migrations: migrations}
+}
+
+func (m *migrator) table() string {
+	return m.prefix + "schema_migrations"
+}
+
+// queryer - database or single connection
+type queryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// applied - returns applied migrations ordered by version, table of migrations may be missing.
+func (m *migrator) applied(ctx context.Context, q queryer) ([]appliedMigration, error) {
+	exists := 0
+	err := q.QueryRowContext(
+		ctx,
+		"SELECT COUNT(*) FROM information_schema.tables WHERE table_schema = DATABASE() AND table_name = ?",
+		m.table(),
+	).Scan(&exists)
+	if err != nil || exists == 0 {
+		return nil, err
+	}
+	rows, err := q.QueryContext(
+		ctx,
+		fmt.Sprintf("SELECT version, name, checksum, applied_at FROM `%s` ORDER BY version", m.table()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	applied := []appliedMigration{}
+	for rows.Next() {
+		a := appliedMigration{}
+		if err := rows.Scan(&a.version, &a.name, &a.checksum, &a.appliedAt); err != nil {
+			return nil, err
+		}
+		applied = append(applied, a)
+	}
+	return applied, rows.Err()
+}
+
+// withLock - runs fn on the connection holding named lock of the schema,
+// so concurrent instances wait for each other instead of migrating simultaneously.
+// Locks are server-wide, so the name includes the database to not block other databases of the server.
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	acquired := sql.NullInt64{}
+	err = conn.QueryRowContext(
+		ctx,
+		"SELECT GET_LOCK("+migrationLockName+", ?)",
+		m.table(), int(migrationLockTimeout.Seconds()),
+	).Scan(&acquired)
+	if err != nil {
+		return err
+	}
+	if acquired.Int64 != 1 {
+		return fmt.Errorf("schema is locked by another instance for more than %s", migrationLockTimeout)
+	}
+	defer conn.ExecContext(context.Background(), "DO RELEASE_LOCK("+migrationLockName+")", m.table())
+	return fn(conn)
+}
+
+func (m *migrator) Status(ctx context.Context) ([]storage.Migration, error) {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return nil, fmt.Errorf("mysql.Migrator.Status: %s", err.Error())
+	}
+	status := []storage.Migration{}
+	for i, a := range applied {
+		appliedAt := a.appliedAt
+		status = append(status, storage.Migration{
+			Version:   a.version,
+			Name:      a.name,
+			AppliedAt: &appliedAt,
+			Unknown:   i >= len(m.migrations) || m.migrations[i].checksum != a.checksum,
+		})
+	}
+	for _, known := range m.migrations[min(len(applied), len(m.migrations)):] {
+		status = append(status, storage.Migration{Version: known.version, Name: known.name})
+	}
+	sort.SliceStable(status, func(i, j int) bool { return status[i].Version < status[j].Version })
+	return status, nil
+}
+
+// check - returns error if schema is not up to date.
+func (m *migrator) check(ctx context.Context) error {
+	applied, err := m.applied(ctx, m.db)
+	if err != nil {
+		return err
+	}
+	count, err := verifyMigrations(applied, m.migrations)
+	if err != nil {
+		return err
+	}
+	if count < len(m.migrations) {
+		return fmt.Errorf(
+			"%w: version %d is applied, but version %d is the last known",
+			storage.ErrSchemaBehind, count, len(m.migrations),
+		)
+	}
+	return nil
+}
+
+func (m *migrator) Up(ctx context.Context) ([]storage.Migration, error) {
+	done := []storage.Migration{}
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		_, err := conn.ExecContext(ctx, fmt.Sprintf(
+			"CREATE TABLE IF NOT EXISTS `%s` ("+
+				"`version` bigint unsigned NOT NULL,"+
+				"`name` varchar(255) NOT NULL,"+
+				"`checksum` char(64) NOT NULL,"+
+				"`applied_at` timestamp NOT NULL DEFAULT current_timestamp,"+
+				"PRIMARY KEY (`version`)"+
+				") COLLATE='utf8_general_ci' ENGINE=InnoDB",
+			m.table(),
+		))
+		if err != nil {
+			return err
+		}
+		// applied migrations are read under lock, so migrations of another instance are seen
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		count, err := verifyMigrations(applied, m.migrations)
+		if err != nil {
+			return err
+		}
+		for _, pending := range m.migrations[count:] {
+			for i, stmt := range statements(pending.up, m.prefix) {
+				if _, err := conn.ExecContext(ctx, stmt); err != nil {
+					// DDL statements are not transactional in MySQL
+					return fmt.Errorf(
+						"migration %d %s failed on statement %d, schema may require manual repair: %s",
+						pending.version, pending.name, i+1, err.Error(),
+					)
+				}
+			}
+			_, err := conn.ExecContext(
+				ctx,
+				fmt.Sprintf("INSERT INTO `%s` (version, name, checksum) VALUES (?, ?, ?)", m.table()),
+				pending.version, pending.name, pending.checksum,
+			)
+			if err != nil {
+				return err
+			}
+			appliedAt := time.Now().UTC().Truncate(time.Second)
+			done = append(done, storage.Migration{Version: pending.version, Name: pending.name, AppliedAt: &appliedAt})
+		}
+		return nil
+	})
+	if err != nil {
+		return done, fmt.Errorf("mysql.Migrator.Up: %w", err)
+	}
+	return done, nil
+}
+
+func (m *migrator) Down(ctx context.Context) (*storage.Migration, error) {
+	var reverted *storage.Migration
+	err := m.withLock(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			return nil
+		}
+		count, err := verifyMigrations(applied, m.migrations)
+		if err != nil {
+			return err
+		}
+		last := m.migrations[count-1]
+		for i, stmt := range statements(last.down, m.prefix) {
+			if _, err := conn.ExecContext(ctx, stmt); err != nil {
+				return fmt.Errorf(
+					"migration %d %s failed to revert on statement %d, schema may require manual repair: %s",
+					last.version, last.name, i+1, err.Error(),
+				)
+			}
+		}
+		if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM `%s` WHERE version = ?", m.table()), last.version); err != nil {
+			return err
+		}
+		reverted = &storage.Migration{Version: last.version, Name: last.name}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.Migrator.Down: %w", err)
+	}
+	return reverted, nil
+}
@@ -0,0 +1,259 @@
+package mysql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/storage"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) < 2 || migrations[0].name != "initial" {
+		t.Fatalf("Unexpected migrations: %+v", migrations)
+	}
+	for _, m := range migrations {
+		for _, stmt := range append(statements(m.up, "pwsrv_"), statements(m.down, "pwsrv_")...) {
+			if strings.Contains(stmt, prefixPlaceholder) || strings.Contains(stmt, ";") {
+				t.Errorf("Migration %d has unexpected statement: %s", m.version, stmt)
+			}
+			if strings.Contains(stmt, "`") && !strings.Contains(stmt, "`pwsrv_") {
+				t.Errorf("Migration %d has statement without table prefix: %s", m.version, stmt)
+			}
+		}
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	files := fstest.MapFS{
+		"m/0001_init.up.sql":     {Data: []byte("CREATE TABLE a (id int);")},
+		"m/0001_init.down.sql":   {Data: []byte("DROP TABLE a;")},
+		"m/0002_column.up.sql":   {Data: []byte("ALTER TABLE a ADD b int;")},
+		"m/0002_column.down.sql": {Data: []byte("ALTER TABLE a DROP b;")},
+	}
+	migrations, err := loadMigrations(files, "m")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 || migrations[1].version != 2 || migrations[1].name != "column" ||
+		migrations[0].checksum == "" || migrations[0].checksum == migrations[1].checksum {
+		t.Errorf("Unexpected migrations: %+v", migrations)
+	}
+
+	broken := []fstest.MapFS{
+		{"m/0001_init.up.sql": {Data: []byte("CREATE TABLE a (id int);")}},
+		{"m/0001_init.up.sql": {Data: []byte("x")}, "m/0001_init.down.sql": {Data: []byte("x")}, "m/0003_gap.up.sql": {Data: []byte("x")}},
+		{"m/0001_init.up.sql": {Data: []byte("x")}, "m/0001_other.down.sql": {Data: []byte("x")}},
+		{"m/readme.md": {Data: []byte("x")}},
+	}
+	for _, files := range broken {
+		if _, err := loadMigrations(files, "m"); err == nil {
+			t.Errorf("Broken migrations are loaded: %v", files)
+		}
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := "-- comment\nCREATE TABLE `{{prefix}}a` (\n\tid int\n);\n\nINSERT INTO `{{prefix}}a` VALUES (1);\nDROP TABLE b"
+	s := statements(script, "p_")
+	if len(s) != 3 || s[0] != "CREATE TABLE `p_a` (\n\tid int\n)" || s[1] != "INSERT INTO `p_a` VALUES (1)" || s[2] != "DROP TABLE b" {
+		t.Errorf("Unexpected statements: %q", s)
+	}
+}
+
+func TestVerifyMigrations(t *testing.T) {
+	known := []migration{{version: 1, name: "init", checksum: "a"}, {version: 2, name: "column", checksum: "b"}}
+	if n, err := verifyMigrations(nil, known); n != 0 || err != nil {
+		t.Errorf("Unexpected result of empty schema: %d, %v", n, err)
+	}
+	if n, err := verifyMigrations([]appliedMigration{{version: 1, checksum: "a"}}, known); n != 1 || err != nil {
+		t.Errorf("Unexpected result of behind schema: %d, %v", n, err)
+	}
+	applied := []appliedMigration{{version: 1, checksum: "a"}, {version: 2, checksum: "b"}, {version: 3, checksum: "c"}}
+	if _, err := verifyMigrations(applied, known); !errors.Is(err, storage.ErrSchemaAhead) {
+		t.Errorf("Ahead schema is not detected: %v", err)
+	}
+	if _, err := verifyMigrations([]appliedMigration{{version: 1, checksum: "changed"}}, known); err == nil {
+		t.Errorf("Changed migration is not detected")
+	}
+	if _, err := verifyMigrations([]appliedMigration{{version: 2, checksum: "b"}}, known); err == nil {
+		t.Errorf("Gap of migrations is not detected")
+	}
+}
+
+// baselineUser and baselineTransfer - models of the first release, which migrated schema with AutoMigrate
+type baselineUser struct {
+	ID        uint64    `gorm:"primary_key"`
+	CreatedAt time.Time `gorm:"not null;default:current_timestamp"`
+	UpdatedAt time.Time `gorm:"not null;default:current_timestamp on update current_timestamp"`
+	Role      uint8     `gorm:"not null;default:'1'"`
+	Email     string    `gorm:"not null;unique_index"`
+	Name      string    `gorm:"not null;index"`
+	PHash     string    `gorm:"not null"`
+	Balance   float64   `gorm:"not null;default:'0'"`
+}
+
+type baselineTransfer struct {
+	ID                     uint64    `gorm:"primary_key"`
+	CreatedAt              time.Time `gorm:"not null;default:current_timestamp"`
+	UserID                 uint64    `gorm:"not null;index"`
+	RecipientID            uint64    `gorm:"not null;index"`
+	Sum                    float64   `gorm:"not null"`
+	UserBalanceBefore      float64   `gorm:"not null"`
+	UserBalanceAfter       float64   `gorm:"not null"`
+	RecipientBalanceBefore float64   `gorm:"not null"`
+	RecipientBalanceAfter  float64   `gorm:"not null"`
+}
+
+// testDB - connects to database of PWSRV_TEST_MYSQL_DSN, test is skipped if it is not set
+func testDB(t *testing.T) *gorm.DB {
+	dsn := os.Getenv("PWSRV_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("PWSRV_TEST_MYSQL_DSN is not set")
+	}
+	db, err := gorm.Open("mysql", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+// schemaOf - column and index names of the table in order of definition
+func schemaOf(t *testing.T, db *gorm.DB, table, prefix string) []string {
+	rows, err := db.DB().Query(
+		"SELECT column_name FROM information_schema.columns WHERE table_schema = DATABASE() AND table_name = ? ORDER BY ordinal_position",
+		prefix+table,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	schema := []string{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, name)
+	}
+	indexes, err := db.DB().Query(
+		"SELECT DISTINCT index_name FROM information_schema.statistics WHERE table_schema = DATABASE() AND table_name = ? ORDER BY index_name",
+		prefix+table,
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer indexes.Close()
+	for indexes.Next() {
+		var name string
+		if err := indexes.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		schema = append(schema, "index "+strings.Replace(name, prefix, "{{prefix}}", 1))
+	}
+	return schema
+}
+
+// migrateDown - reverts all migrations of the prefix
+func migrateDown(t *testing.T, db *gorm.DB, prefix string) {
+	m := (&mysqlstorage{db: db, tablePrefix: prefix}).migrator()
+	for {
+		reverted, err := m.Down(context.Background())
+		if err != nil {
+			t.Error(err)
+			break
+		}
+		if reverted == nil {
+			break
+		}
+	}
+	db.Exec(fmt.Sprintf("DROP TABLE IF EXISTS `%s`", m.table()))
+}
+
+func TestMigrateBaseline(t *testing.T) {
+	db := testDB(t)
+	ctx := context.Background()
+	suffix := time.Now().UnixNano() % 1000000
+	baseline, fresh := fmt.Sprintf("b%d_", suffix), fmt.Sprintf("f%d_", suffix)
+	t.Cleanup(func() {
+		migrateDown(t, db, baseline)
+		migrateDown(t, db, fresh)
+	})
+
+	if err := db.Table(baseline + "user").AutoMigrate(&baselineUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Table(baseline + "internal_transfer").AutoMigrate(&baselineTransfer{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	users := []baselineUser{
+		{Email: "a@example.com", Name: "a", PHash: "x", Balance: 400},
+		{Email: "b@example.com", Name: "b", PHash: "x", Balance: 600},
+	}
+	for i := range users {
+		if err := db.Table(baseline + "user").Create(&users[i]).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	transfer := baselineTransfer{
+		UserID: users[0].ID, RecipientID: users[1].ID, Sum: 100,
+		UserBalanceBefore: 500, UserBalanceAfter: 400, RecipientBalanceBefore: 500, RecipientBalanceAfter: 600,
+	}
+	if err := db.Table(baseline + "internal_transfer").Create(&transfer).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	upgraded := (&mysqlstorage{db: db, tablePrefix: baseline}).migrator()
+	if _, err := upgraded.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := upgraded.check(ctx); err != nil {
+		t.Fatal(err)
+	}
+	created := (&mysqlstorage{db: db, tablePrefix: fresh}).migrator()
+	if _, err := created.Up(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, table := range []string{"user", "internal_transfer"} {
+		got, want := schemaOf(t, db, table, baseline), schemaOf(t, db, table, fresh)
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Errorf("Table %s of upgraded schema differs from created one:\n%v\n%v", table, got, want)
+		}
+	}
+
+	var balance float64
+	for _, u := range users {
+		row := db.DB().QueryRow(
+			fmt.Sprintf("SELECT balance FROM `%swallet` WHERE user_id = ? AND currency = 'PW'", baseline), u.ID,
+		)
+		if err := row.Scan(&balance); err != nil || balance != u.Balance {
+			t.Errorf("Unexpected wallet of user #%d: %v, %v", u.ID, balance, err)
+		}
+	}
+	var currency, memo string
+	row := db.DB().QueryRow(
+		fmt.Sprintf("SELECT currency, memo FROM `%sinternal_transfer` WHERE id = ?", baseline), transfer.ID,
+	)
+	if err := row.Scan(&currency, &memo); err != nil || currency != "PW" || memo != "" {
+		t.Errorf("Unexpected transfer: %q, %q, %v", currency, memo, err)
+	}
+	if _, err := db.DB().Exec(
+		fmt.Sprintf("INSERT INTO `%sinternal_transfer` (user_id, recipient_id, currency, sum, user_balance_before, user_balance_after, recipient_balance_before, recipient_balance_after) VALUES (?, ?, 'PW', 1, 0, 0, 0, 0)", baseline),
+		users[0].ID, users[1].ID,
+	); err != nil {
+		t.Errorf("Transfer is not inserted into upgraded schema: %v", err)
+	}
+}
@@ -0,0 +1,29 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/operator"
+)
+
+func (s *mysqlstorage) OperatorStore() operator.Store {
+	if s.db == nil {
+		return nil
+	}
+	return s
+}
+
+func (s *mysqlstorage) SetUserRole(userID uint64, role model.UserRole) (*model.User, error) {
+	if err := s.db.Model(&model.User{ID: userID}).Update("role", role).Error; err != nil {
+		return nil, fmt.Errorf("mysql.SetUserRole: %s", err.Error())
+	}
+	return s.GetUserByID(userID)
+}
+
+func (s *mysqlstorage) SetUserFrozen(userID uint64, frozen bool) (*model.User, error) {
+	if err := s.db.Model(&model.User{ID: userID}).Update("frozen", frozen).Error; err != nil {
+		return nil, fmt.Errorf("mysql.SetUserFrozen: %s", err.Error())
+	}
+	return s.GetUserByID(userID)
+}
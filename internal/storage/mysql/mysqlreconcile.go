@@ -0,0 +1,33 @@
+package mysql
+
+import (
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/wtask/pwsrv/internal/reconcile"
+)
+
+func (s *mysqlstorage) ReconcileStore() reconcile.Store {
+	if s.db == nil {
+		return nil
+	}
+	return s
+}
+
+// ReadLedger - reads ledger within single transaction, so InnoDB returns rows of the same snapshot.
+func (s *mysqlstorage) ReadLedger() (*reconcile.Ledger, error) {
+	l := &reconcile.Ledger{}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		if err := tx.Order("id").Find(&l.Wallets).Error; err != nil {
+			return err
+		}
+		if err := tx.Order("id").Find(&l.Transfers).Error; err != nil {
+			return err
+		}
+		return tx.Order("id").Find(&l.Conversions).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ReadLedger: %s", err.Error())
+	}
+	return l, nil
+}
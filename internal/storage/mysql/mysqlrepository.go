@@ -3,17 +3,18 @@ package mysql
 import (
 	"errors"
 	"fmt"
+	"sort"
 	"strings"
-	"time"
 
 	"github.com/jinzhu/gorm"
 
+	"github.com/wtask/pwsrv/internal/event"
 	"github.com/wtask/pwsrv/internal/model"
 )
 
 func (s *mysqlstorage) GetUserByID(userID uint64) (*model.User, error) {
 	user := model.User{}
-	if err := s.db.First(&user, userID).Error; err != nil {
+	if err := s.db.Preload("Wallets").First(&user, userID).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -24,7 +25,7 @@ func (s *mysqlstorage) GetUserByID(userID uint64) (*model.User, error) {
 
 func (s *mysqlstorage) GetUserByEmail(address string) (*model.User, error) {
 	u := &model.User{Email: address}
-	if err := s.db.Where(u).First(u).Error; err != nil {
+	if err := s.db.Preload("Wallets").Where(u).First(u).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			return nil, nil
 		}
@@ -62,7 +63,13 @@ func (s *mysqlstorage) CreateUser(u model.User, password string) (*model.User, e
 		return nil, errors.New("mysql.CreateUser: already exists")
 	}
 	u.PHash = s.passwordHasher.Hash(password)
-	if err := s.db.Create(&u).Error; err != nil {
+	err = s.inTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&u).Error; err != nil {
+			return err
+		}
+		return writeOutbox(tx, event.UserRegistered, &u)
+	})
+	if err != nil {
 		return nil, fmt.Errorf("mysql.CreateUser: %s", err.Error())
 	}
 	return &u, nil
@@ -74,87 +81,94 @@ func (s *mysqlstorage) FindUsersHavePrefix(prefix string, limit int) ([]model.Us
 	}
 	users := []model.User{}
 	prefix = strings.NewReplacer(`%`, `\%`, `_`, `\_`).Replace(prefix)
-	err := s.db.Where("name LIKE ? OR email LIKE ?", prefix+"%", prefix+"%").Limit(limit).Find(&users).Error
+	err := s.db.
+		Preload("Wallets").
+		Where("name LIKE ? OR email LIKE ?", prefix+"%", prefix+"%").
+		Limit(limit).
+		Find(&users).
+		Error
 	if err != nil {
 		return nil, fmt.Errorf("mysql.FindUsersHavePrefix: %s", err.Error())
 	}
 	return users, nil
 }
 
-func (s *mysqlstorage) CreateInternalTransfer(userID, recipientID uint64, sum float64) (*model.InternalTransfer, error) {
-	u, r := model.User{}, model.User{}
-	tx := s.db.Begin()
-	err := tx.Where("id = ? and balance - ? > 0", userID, sum).First(&u).Error
-	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
-	}
-	if u.ID == 0 {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: user #%d not found or insufficient funds", userID)
+func (s *mysqlstorage) FindUsersByIDs(ids []uint64) ([]model.User, error) {
+	if len(ids) == 0 {
+		return nil, nil
 	}
-	if err = tx.First(&r, recipientID).Error; err != nil {
-		tx.Rollback()
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("mysql.CreateInternalTransfer: recipient #%d not found", recipientID)
-		}
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
+	users := []model.User{}
+	if err := s.db.Where("id IN (?)", ids).Find(&users).Error; err != nil {
+		return nil, fmt.Errorf("mysql.FindUsersByIDs: %s", err.Error())
 	}
+	return users, nil
+}
 
-	uBalance, rBalance := u.Balance, r.Balance
-	// transfer
-	// debit first
-	err = tx.Model(&u).Where("balance - ? > 0", sum).UpdateColumn("balance", gorm.Expr("balance - ?", sum)).Error
+func (s *mysqlstorage) CreateInternalTransfer(
+	userID, recipientID uint64,
+	currency model.Currency,
+	sum float64,
+	memo string,
+) (*model.InternalTransfer, error) {
+	var itm *model.InternalTransfer
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		itm, err = transferFunds(tx, userID, recipientID, currency, sum, memo)
+		return err
+	})
 	if err != nil {
-		tx.Rollback()
 		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
 	}
-	if err = tx.First(&u, userID).Error; err != nil {
-		tx.Rollback()
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("mysql.CreateInternalTransfer: user #%d is missing", recipientID)
+	return itm, nil
+}
+
+// lockBatchWallets - locks wallets of the sender and all recipients of the batch before any transfer,
+// in ascending order of users as transferFunds does, so batches and single transfers don't deadlock;
+// missing wallets of recipients are created.
+func lockBatchWallets(tx *gorm.DB, userID uint64, currency model.Currency, orders []model.TransferOrder) error {
+	users := map[uint64]bool{userID: true}
+	ids := []uint64{userID}
+	for _, o := range orders {
+		if !users[o.RecipientID] {
+			users[o.RecipientID] = true
+			ids = append(ids, o.RecipientID)
 		}
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
-	}
-	if u.Balance < 0 {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: debit processing causes insufficient funds")
-	}
-	// credit
-	err = tx.Model(&r).UpdateColumn("balance", gorm.Expr("balance + ?", sum)).Error
-	if err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
 	}
-	if err = tx.First(&r, r.ID).Error; err != nil {
-		tx.Rollback()
-		if err == gorm.ErrRecordNotFound {
-			return nil, fmt.Errorf("mysql.CreateInternalTransfer: recipient #%d is missing", recipientID)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	for _, id := range ids {
+		if _, err := lockWallet(tx, id, currency, id != userID); err != nil {
+			return err
 		}
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
-	}
-	// transaction log
-	itm := model.InternalTransfer{
-		CreatedAt:              time.Now().UTC(),
-		UserID:                 u.ID,
-		RecipientID:            r.ID,
-		Sum:                    sum,
-		UserBalanceBefore:      uBalance,
-		UserBalanceAfter:       u.Balance,
-		RecipientBalanceBefore: rBalance,
-		RecipientBalanceAfter:  r.Balance,
-	}
-	if err = tx.Create(&itm).Error; err != nil {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: %s", err.Error())
 	}
-	if itm.ID == 0 {
-		tx.Rollback()
-		return nil, fmt.Errorf("mysql.CreateInternalTransfer: cannot finish transaction (#%d, %f) -> #%d", u.ID, sum, r.ID)
-	}
-	tx.Commit()
+	return nil
+}
 
-	return &itm, nil
+func (s *mysqlstorage) CreateInternalTransferBatch(
+	userID uint64,
+	currency model.Currency,
+	orders []model.TransferOrder,
+) ([]model.InternalTransfer, error) {
+	if len(orders) == 0 {
+		return nil, errors.New("mysql.CreateInternalTransferBatch: batch is empty")
+	}
+	transfers := make([]model.InternalTransfer, 0, len(orders))
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		if err := lockBatchWallets(tx, userID, currency, orders); err != nil {
+			return err
+		}
+		for i, o := range orders {
+			itm, err := transferFunds(tx, userID, o.RecipientID, currency, o.Sum, o.Memo)
+			if err != nil {
+				return fmt.Errorf("item %d: %s", i, err.Error())
+			}
+			transfers = append(transfers, *itm)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.CreateInternalTransferBatch: %s", err.Error())
+	}
+	return transfers, nil
 }
 
 func (s *mysqlstorage) GetInternalTransferByID(transferID uint64) (*model.InternalTransfer, error) {
@@ -176,16 +190,23 @@ func (s *mysqlstorage) RepeatInternalTransfer(transferID uint64) (*model.Interna
 	if t == nil {
 		return nil, fmt.Errorf("mysql.RepeatInternalTransfer: transfer not found #%d", transferID)
 	}
-	return s.CreateInternalTransfer(t.UserID, t.RecipientID, t.Sum)
+	return s.CreateInternalTransfer(t.UserID, t.RecipientID, t.Currency, t.Sum, t.Memo)
 }
 
-func (s *mysqlstorage) FindLastInternalTransfers(userID uint64, limit int) ([]model.InternalTransfer, error) {
+func (s *mysqlstorage) FindLastInternalTransfers(
+	userID uint64,
+	currency model.Currency,
+	limit int,
+) ([]model.InternalTransfer, error) {
 	if limit <= 0 {
 		return nil, nil
 	}
 	transfers := []model.InternalTransfer{}
-	err := s.db.
-		Where("user_id = ? OR recipient_id = ?", userID, userID).
+	q := s.db.Where("user_id = ? OR recipient_id = ?", userID, userID)
+	if currency != "" {
+		q = q.Where("currency = ?", currency)
+	}
+	err := q.
 		Order("id DESC").
 		Limit(limit).
 		Find(&transfers).
@@ -0,0 +1,233 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+func (s *mysqlstorage) CreateSplit(
+	split model.Split,
+	requests []model.PaymentRequest,
+) (*model.Split, []model.PaymentRequest, error) {
+	if split.ID != 0 || split.UserID == 0 || len(requests) == 0 {
+		return nil, nil, errors.New("mysql.CreateSplit: existed ID or required field is empty")
+	}
+	split.CreatedAt = time.Now().UTC()
+	split.Status = model.SplitOpen
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&split).Error; err != nil {
+			return err
+		}
+		for i := range requests {
+			requests[i].ID = 0
+			requests[i].CreatedAt = split.CreatedAt
+			requests[i].SplitID = split.ID
+			requests[i].RequesterID = split.UserID
+			requests[i].Currency = split.Currency
+			requests[i].Status = model.PaymentRequestPending
+			if err := tx.Create(&requests[i]).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("mysql.CreateSplit: %s", err.Error())
+	}
+	return &split, requests, nil
+}
+
+func (s *mysqlstorage) GetSplitByID(splitID uint64) (*model.Split, error) {
+	split := model.Split{}
+	if err := s.db.First(&split, splitID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("mysql.GetSplitByID: %s", err.Error())
+	}
+	return &split, nil
+}
+
+func (s *mysqlstorage) FindLastSplits(userID uint64, limit int) ([]model.Split, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	splits := []model.Split{}
+	err := s.db.
+		Where("user_id = ?", userID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&splits).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastSplits: %s", err.Error())
+	}
+	return splits, nil
+}
+
+func (s *mysqlstorage) CancelSplit(splitID uint64) (*model.Split, error) {
+	split := model.Split{}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		err := tx.Set("gorm:query_option", "FOR UPDATE").First(&split, splitID).Error
+		if err != nil {
+			return err
+		}
+		if split.Status != model.SplitOpen {
+			return fmt.Errorf("split #%d is %s", splitID, split.Status)
+		}
+		err = tx.
+			Model(&model.PaymentRequest{}).
+			Where("split_id = ? AND status = ?", splitID, model.PaymentRequestPending).
+			UpdateColumn("status", model.PaymentRequestCancelled).
+			Error
+		if err != nil {
+			return err
+		}
+		split.Status = model.SplitCancelled
+		return tx.Model(&split).UpdateColumn("status", split.Status).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.CancelSplit: %s", err.Error())
+	}
+	return &split, nil
+}
+
+func (s *mysqlstorage) GetPaymentRequestByID(requestID uint64) (*model.PaymentRequest, error) {
+	pr := model.PaymentRequest{}
+	if err := s.db.First(&pr, requestID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("mysql.GetPaymentRequestByID: %s", err.Error())
+	}
+	return &pr, nil
+}
+
+func (s *mysqlstorage) FindPaymentRequestsBySplit(splitID uint64) ([]model.PaymentRequest, error) {
+	requests := []model.PaymentRequest{}
+	if err := s.db.Where("split_id = ?", splitID).Order("id").Find(&requests).Error; err != nil {
+		return nil, fmt.Errorf("mysql.FindPaymentRequestsBySplit: %s", err.Error())
+	}
+	return requests, nil
+}
+
+func (s *mysqlstorage) FindLastPaymentRequests(payerID uint64, limit int) ([]model.PaymentRequest, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	requests := []model.PaymentRequest{}
+	err := s.db.
+		Where("payer_id = ?", payerID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&requests).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastPaymentRequests: %s", err.Error())
+	}
+	return requests, nil
+}
+
+// lockPendingPaymentRequest - selects pending payment request for update within given transaction.
+func lockPendingPaymentRequest(tx *gorm.DB, requestID uint64) (*model.PaymentRequest, error) {
+	pr := model.PaymentRequest{}
+	if err := tx.Set("gorm:query_option", "FOR UPDATE").First(&pr, requestID).Error; err != nil {
+		return nil, err
+	}
+	if pr.Status != model.PaymentRequestPending {
+		return nil, fmt.Errorf("payment request #%d is %s", requestID, pr.Status)
+	}
+	return &pr, nil
+}
+
+// closeSplit - settles open split within given transaction when none of its payment requests is pending,
+// split is declined if some of requests are declined.
+func closeSplit(tx *gorm.DB, splitID uint64) error {
+	if splitID == 0 {
+		return nil
+	}
+	pending, declined := 0, 0
+	err := tx.
+		Model(&model.PaymentRequest{}).
+		Where("split_id = ? AND status = ?", splitID, model.PaymentRequestPending).
+		Count(&pending).
+		Error
+	if err != nil || pending > 0 {
+		return err
+	}
+	err = tx.
+		Model(&model.PaymentRequest{}).
+		Where("split_id = ? AND status = ?", splitID, model.PaymentRequestDeclined).
+		Count(&declined).
+		Error
+	if err != nil {
+		return err
+	}
+	status := model.SplitSettled
+	if declined > 0 {
+		status = model.SplitDeclined
+	}
+	return tx.
+		Model(&model.Split{}).
+		Where("id = ? AND status = ?", splitID, model.SplitOpen).
+		UpdateColumn("status", status).
+		Error
+}
+
+func (s *mysqlstorage) PayPaymentRequest(requestID uint64) (*model.PaymentRequest, *model.InternalTransfer, error) {
+	var (
+		pr  *model.PaymentRequest
+		itm *model.InternalTransfer
+	)
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		if pr, err = lockPendingPaymentRequest(tx, requestID); err != nil {
+			return err
+		}
+		memo := pr.Memo
+		if memo == "" {
+			memo = fmt.Sprintf("payment request #%d", pr.ID)
+		}
+		itm, err = transferFunds(tx, pr.PayerID, pr.RequesterID, pr.Currency, pr.Sum, memo)
+		if err != nil {
+			return err
+		}
+		pr.Status, pr.TransferID = model.PaymentRequestPaid, itm.ID
+		err = tx.Model(pr).UpdateColumns(map[string]interface{}{
+			"status":      pr.Status,
+			"transfer_id": pr.TransferID,
+		}).Error
+		if err != nil {
+			return err
+		}
+		return closeSplit(tx, pr.SplitID)
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("mysql.PayPaymentRequest: %s", err.Error())
+	}
+	return pr, itm, nil
+}
+
+func (s *mysqlstorage) DeclinePaymentRequest(requestID uint64) (*model.PaymentRequest, error) {
+	var pr *model.PaymentRequest
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		if pr, err = lockPendingPaymentRequest(tx, requestID); err != nil {
+			return err
+		}
+		pr.Status = model.PaymentRequestDeclined
+		if err := tx.Model(pr).UpdateColumn("status", pr.Status).Error; err != nil {
+			return err
+		}
+		return closeSplit(tx, pr.SplitID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.DeclinePaymentRequest: %s", err.Error())
+	}
+	return pr, nil
+}
@@ -1,8 +1,11 @@
 package mysql
 
 import (
+	"context"
+	"database/sql"
 	"errors"
 	"fmt"
+	"log/slog"
 	"strings"
 
 	"github.com/jinzhu/gorm"
@@ -11,8 +14,11 @@ import (
 
 	"github.com/wtask/pwsrv/internal/core"
 	"github.com/wtask/pwsrv/internal/encryption/hasher"
-	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/logging"
 	"github.com/wtask/pwsrv/internal/storage"
+	"github.com/wtask/pwsrv/internal/tracing"
+	"github.com/wtask/pwsrv/internal/webhook"
 )
 
 type mysqlstorage struct {
@@ -20,6 +26,10 @@ type mysqlstorage struct {
 	dsn            string
 	tablePrefix    string
 	passwordHasher hasher.StringHasher
+	logger         *slog.Logger
+	tracer         *tracing.Tracer
+	// migrate - pending migrations are applied on opening, otherwise schema is only checked by CheckSchema
+	migrate bool
 }
 
 type storageOption func(*mysqlstorage)
@@ -48,6 +58,23 @@ func WithPasswordHasher(h hasher.StringHasher) storageOption {
 	}
 }
 
+func WithLogger(l *slog.Logger) storageOption {
+	if l == nil {
+		panic(errors.New("mysql.WithLogger: logger is nil"))
+	}
+	return func(s *mysqlstorage) {
+		s.logger = l
+	}
+}
+
+// WithMigration - enables or disables migration of the schema on opening (enabled by default);
+// tools, which only read or update data, open storage as is.
+func WithMigration(enabled bool) storageOption {
+	return func(s *mysqlstorage) {
+		s.migrate = enabled
+	}
+}
+
 func (s *mysqlstorage) alter(options ...storageOption) *mysqlstorage {
 	if s == nil {
 		return nil
@@ -61,13 +88,16 @@ func (s *mysqlstorage) alter(options ...storageOption) *mysqlstorage {
 }
 
 func NewStorage(options ...storageOption) (storage.Interface, error) {
-	s := (&mysqlstorage{}).alter(options...)
+	s := (&mysqlstorage{migrate: true}).alter(options...)
 	if s.dsn == "" {
 		return nil, errors.New("mysql.NewStorage: DSN is empty")
 	}
 	if s.passwordHasher == nil {
 		return nil, errors.New("mysql.NewStorage: password hasher is nil")
 	}
+	if s.logger == nil {
+		s.logger = logging.Discard()
+	}
 	if s.tablePrefix != "" {
 		gorm.DefaultTableNameHandler = func(db *gorm.DB, defaultTableName string) string {
 			return s.tablePrefix + defaultTableName
@@ -79,19 +109,44 @@ func NewStorage(options ...storageOption) (storage.Interface, error) {
 		return nil, fmt.Errorf("mysql.NewStorage(): %s", err.Error())
 	}
 	s.db = db
+	s.db.SetLogger(gormLogger{s.logger})
+	// otherwise gorm reports errors only; queries are logged on debug level,
+	// which may be enabled at runtime
+	s.db.LogMode(true)
+	if s.tracer != nil {
+		s.registerTracing()
+	}
 
 	s.db.SingularTable(true) // do not use plural form of table name
-	err = s.db.
-		Set("gorm:table_options", "COLLATE='utf8_general_ci' ENGINE=InnoDB").
-		AutoMigrate(&model.User{}, &model.InternalTransfer{}).
-		Error
+	if !s.migrate {
+		return s, nil
+	}
+	applied, err := s.migrator().Up(context.Background())
 	if err != nil {
-		return nil, err
+		s.db.Close()
+		return nil, fmt.Errorf("mysql.NewStorage(): %s", err.Error())
+	}
+	for _, m := range applied {
+		s.logger.Info("Schema migration applied", "version", m.Version, "name", m.Name)
 	}
 
 	return s, nil
 }
 
+// inTransaction - runs fn within DB transaction;
+// commits if fn succeeded and rolls back otherwise.
+func (s *mysqlstorage) inTransaction(fn func(tx *gorm.DB) error) error {
+	tx := s.db.Begin()
+	if tx.Error != nil {
+		return tx.Error
+	}
+	if err := fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
 func (s *mysqlstorage) CoreRepository() core.Repository {
 	if s.db == nil {
 		return nil
@@ -99,6 +154,48 @@ func (s *mysqlstorage) CoreRepository() core.Repository {
 	return s
 }
 
+func (s *mysqlstorage) EventStore() event.Store {
+	if s.db == nil {
+		return nil
+	}
+	return s
+}
+
+func (s *mysqlstorage) WebhookStore() webhook.Store {
+	if s.db == nil {
+		return nil
+	}
+	return s
+}
+
+func (s *mysqlstorage) DBStats() sql.DBStats {
+	if s.db == nil {
+		return sql.DBStats{}
+	}
+	return s.db.DB().Stats()
+}
+
+func (s *mysqlstorage) Ping(ctx context.Context) error {
+	if s.db == nil {
+		return errors.New("mysql.Ping(): storage is not initialized")
+	}
+	if err := s.db.DB().PingContext(ctx); err != nil {
+		return fmt.Errorf("mysql.Ping(): %s", err.Error())
+	}
+	return nil
+}
+
+// CheckSchema - checks applied migrations match migrations known by the server.
+func (s *mysqlstorage) CheckSchema(ctx context.Context) error {
+	if s.db == nil {
+		return errors.New("mysql.CheckSchema(): storage is not initialized")
+	}
+	if err := s.migrator().check(ctx); err != nil {
+		return fmt.Errorf("mysql.CheckSchema(): %w", err)
+	}
+	return nil
+}
+
 func (s *mysqlstorage) Close() error {
 	if s.db == nil {
 		return errors.New("mysql.Close(): storage is not initialized")
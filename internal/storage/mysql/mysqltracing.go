@@ -0,0 +1,91 @@
+package mysql
+
+import (
+	"context"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/core"
+	"github.com/wtask/pwsrv/internal/tracing"
+)
+
+const (
+	// tracingContextKey - gorm setting holding context of the parent span,
+	// gorm v1 has no context support, so it is passed along with settings
+	tracingContextKey = "pwsrv:tracing_context"
+	tracingSpanKey    = "pwsrv:tracing_span"
+)
+
+// WithTracer - enables tracing of SQL statements, nil tracer leaves tracing disabled.
+func WithTracer(t *tracing.Tracer) storageOption {
+	return func(s *mysqlstorage) {
+		s.tracer = t
+	}
+}
+
+// WithContext - returns repository bound to the context,
+// SQL statements are traced as children of the context span.
+func (s *mysqlstorage) WithContext(ctx context.Context) core.Repository {
+	if s.db == nil || s.tracer == nil {
+		return s
+	}
+	bound := *s
+	bound.db = s.db.Set(tracingContextKey, ctx)
+	return &bound
+}
+
+// registerTracing - registers gorm callbacks starting a span right before SQL statement is executed
+// and ending it right after.
+func (s *mysqlstorage) registerTracing() {
+	cb := s.db.Callback()
+	cb.Create().Before("gorm:create").Register("pwsrv:trace_create", s.startSQLSpan)
+	cb.Create().After("gorm:create").Register("pwsrv:trace_create_end", endSQLSpan("INSERT"))
+	cb.Query().Before("gorm:query").Register("pwsrv:trace_query", s.startSQLSpan)
+	cb.Query().After("gorm:query").Register("pwsrv:trace_query_end", endSQLSpan("SELECT"))
+	cb.RowQuery().Before("gorm:row_query").Register("pwsrv:trace_row_query", s.startSQLSpan)
+	cb.RowQuery().After("gorm:row_query").Register("pwsrv:trace_row_query_end", endSQLSpan("SELECT"))
+	cb.Update().Before("gorm:update").Register("pwsrv:trace_update", s.startSQLSpan)
+	cb.Update().After("gorm:update").Register("pwsrv:trace_update_end", endSQLSpan("UPDATE"))
+	cb.Delete().Before("gorm:delete").Register("pwsrv:trace_delete", s.startSQLSpan)
+	cb.Delete().After("gorm:delete").Register("pwsrv:trace_delete_end", endSQLSpan("DELETE"))
+}
+
+func (s *mysqlstorage) startSQLSpan(scope *gorm.Scope) {
+	v, ok := scope.Get(tracingContextKey)
+	if !ok {
+		// statements outside of traced repository calls, e.g. migrations
+		return
+	}
+	ctx, ok := v.(context.Context)
+	if !ok {
+		return
+	}
+	_, span := s.tracer.Start(ctx, "SQL", tracing.SpanKindClient)
+	scope.InstanceSet(tracingSpanKey, span)
+}
+
+func endSQLSpan(operation string) func(*gorm.Scope) {
+	return func(scope *gorm.Scope) {
+		v, ok := scope.InstanceGet(tracingSpanKey)
+		if !ok {
+			return
+		}
+		span, ok := v.(*tracing.Span)
+		if !ok {
+			return
+		}
+		table := scope.TableName()
+		span.SetName(operation + " " + table)
+		span.SetAttribute("db.system", "mysql")
+		span.SetAttribute("db.operation.name", operation)
+		span.SetAttribute("db.collection.name", table)
+		span.SetAttribute("db.query.text", scope.SQL)
+		if operation != "SELECT" {
+			span.SetAttribute("db.rows_affected", scope.DB().RowsAffected)
+		}
+		if err := scope.DB().Error; err != nil && !gorm.IsRecordNotFoundError(err) {
+			span.SetError(err)
+		}
+		span.End()
+	}
+}
@@ -0,0 +1,317 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+// lockWallet - selects user's wallet for update within given transaction.
+// If wallet is missing and create flag is set, the new empty wallet will be created,
+// otherwise nil is returned.
+func lockWallet(tx *gorm.DB, userID uint64, currency model.Currency, create bool) (*model.Wallet, error) {
+	w := model.Wallet{}
+	err := tx.
+		Set("gorm:query_option", "FOR UPDATE").
+		Where("user_id = ? AND currency = ?", userID, currency).
+		First(&w).
+		Error
+	if err == nil {
+		return &w, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+	if !create {
+		return nil, nil
+	}
+	w = model.Wallet{UserID: userID, Currency: currency}
+	if err = tx.Create(&w).Error; err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// changeBalance - adds delta to the wallet balance and reloads the wallet.
+func changeBalance(tx *gorm.DB, w *model.Wallet, delta float64) error {
+	err := tx.Model(w).UpdateColumn("balance", gorm.Expr("balance + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+	return tx.First(w, w.ID).Error
+}
+
+// changeHeld - adds delta to the reserved part of the wallet balance and reloads the wallet.
+func changeHeld(tx *gorm.DB, w *model.Wallet, delta float64) error {
+	err := tx.Model(w).UpdateColumn("held", gorm.Expr("held + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+	return tx.First(w, w.ID).Error
+}
+
+// reserveFunds - moves sum from available to held part of the user's wallet.
+func reserveFunds(tx *gorm.DB, userID uint64, currency model.Currency, sum float64) error {
+	w, err := lockWallet(tx, userID, currency, false)
+	if err != nil {
+		return err
+	}
+	if w == nil || w.Balance-w.Held-sum < 0 {
+		return fmt.Errorf("user #%d has no %s wallet or insufficient funds", userID, currency)
+	}
+	return changeHeld(tx, w, sum)
+}
+
+// releaseFunds - returns previously reserved sum back to available part of the user's wallet.
+func releaseFunds(tx *gorm.DB, userID uint64, currency model.Currency, sum float64) error {
+	w, err := lockWallet(tx, userID, currency, false)
+	if err != nil {
+		return err
+	}
+	if w == nil {
+		return fmt.Errorf("%s wallet of user #%d is missing", currency, userID)
+	}
+	return changeHeld(tx, w, -sum)
+}
+
+// transferFunds - moves sum between wallets of the given users within transaction and logs the transfer.
+func transferFunds(
+	tx *gorm.DB,
+	userID, recipientID uint64,
+	currency model.Currency,
+	sum float64,
+	memo string,
+) (*model.InternalTransfer, error) {
+	if userID == recipientID {
+		return nil, errors.New("sender and recipient are the same")
+	}
+	if sum <= 0 {
+		return nil, errors.New("sum must be positive")
+	}
+	r := model.User{}
+	if err := tx.First(&r, recipientID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, fmt.Errorf("recipient #%d not found", recipientID)
+		}
+		return nil, err
+	}
+	// lock wallets always in the same order to avoid deadlocks
+	var (
+		uw, rw *model.Wallet
+		err    error
+	)
+	if userID < recipientID {
+		if uw, err = lockWallet(tx, userID, currency, false); err == nil {
+			rw, err = lockWallet(tx, recipientID, currency, true)
+		}
+	} else {
+		if rw, err = lockWallet(tx, recipientID, currency, true); err == nil {
+			uw, err = lockWallet(tx, userID, currency, false)
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	// held funds are not available to transfer
+	if uw == nil || uw.Balance-uw.Held-sum < 0 {
+		return nil, fmt.Errorf("user #%d has no %s wallet or insufficient funds", userID, currency)
+	}
+
+	uBalance, rBalance := uw.Balance, rw.Balance
+	// debit first
+	if err = changeBalance(tx, uw, -sum); err != nil {
+		return nil, err
+	}
+	if uw.Balance < 0 {
+		return nil, errors.New("debit processing causes insufficient funds")
+	}
+	// credit
+	if err = changeBalance(tx, rw, sum); err != nil {
+		return nil, err
+	}
+	// transaction log
+	itm := model.InternalTransfer{
+		CreatedAt:              time.Now().UTC(),
+		UserID:                 userID,
+		RecipientID:            recipientID,
+		Currency:               currency,
+		Sum:                    sum,
+		Memo:                   memo,
+		UserBalanceBefore:      uBalance,
+		UserBalanceAfter:       uw.Balance,
+		RecipientBalanceBefore: rBalance,
+		RecipientBalanceAfter:  rw.Balance,
+	}
+	if err = tx.Create(&itm).Error; err != nil {
+		return nil, err
+	}
+	if itm.ID == 0 {
+		return nil, fmt.Errorf("cannot finish transaction (#%d, %f %s) -> #%d", userID, sum, currency, recipientID)
+	}
+	if err = writeOutbox(tx, event.TransferCreated, &itm); err != nil {
+		return nil, err
+	}
+	return &itm, nil
+}
+
+func (s *mysqlstorage) GetUserWallets(userID uint64) ([]model.Wallet, error) {
+	wallets := []model.Wallet{}
+	if err := s.db.Where("user_id = ?", userID).Order("id").Find(&wallets).Error; err != nil {
+		return nil, fmt.Errorf("mysql.GetUserWallets: %s", err.Error())
+	}
+	return wallets, nil
+}
+
+func (s *mysqlstorage) CreateWallet(userID uint64, currency model.Currency) (*model.Wallet, error) {
+	if !currency.IsValid() {
+		return nil, fmt.Errorf("mysql.CreateWallet: invalid currency %q", currency)
+	}
+	var w *model.Wallet
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		var err error
+		w, err = lockWallet(tx, userID, currency, true)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.CreateWallet: %s", err.Error())
+	}
+	return w, nil
+}
+
+func (s *mysqlstorage) GetExchangeRates() ([]model.ExchangeRate, error) {
+	rates := []model.ExchangeRate{}
+	if err := s.db.Order("from_currency, to_currency").Find(&rates).Error; err != nil {
+		return nil, fmt.Errorf("mysql.GetExchangeRates: %s", err.Error())
+	}
+	return rates, nil
+}
+
+func (s *mysqlstorage) SetExchangeRate(from, to model.Currency, rate float64) (*model.ExchangeRate, error) {
+	if !from.IsValid() || !to.IsValid() || from == to {
+		return nil, errors.New("mysql.SetExchangeRate: invalid currency pair")
+	}
+	if rate <= 0 {
+		return nil, errors.New("mysql.SetExchangeRate: rate must be positive")
+	}
+	r := model.ExchangeRate{}
+	err := s.db.
+		Where(model.ExchangeRate{From: from, To: to}).
+		Assign(model.ExchangeRate{Rate: rate}).
+		FirstOrCreate(&r).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.SetExchangeRate: %s", err.Error())
+	}
+	return &r, nil
+}
+
+// exchangeRate - looks up the rate to convert from one currency to another;
+// reverse rate is used if direct one is not defined. Returns zero if there is no rate.
+func exchangeRate(tx *gorm.DB, from, to model.Currency) (float64, error) {
+	rates := []model.ExchangeRate{}
+	err := tx.
+		Where("(from_currency = ? AND to_currency = ?) OR (from_currency = ? AND to_currency = ?)", from, to, to, from).
+		Find(&rates).
+		Error
+	if err != nil {
+		return 0, err
+	}
+	rate := 0.0
+	for _, r := range rates {
+		if r.Rate <= 0 {
+			continue
+		}
+		if r.From == from {
+			return r.Rate, nil
+		}
+		rate = 1 / r.Rate
+	}
+	return rate, nil
+}
+
+func (s *mysqlstorage) ConvertFunds(userID uint64, from, to model.Currency, sum float64) (*model.Conversion, error) {
+	if from == to || !from.IsValid() || !to.IsValid() {
+		return nil, errors.New("mysql.ConvertFunds: invalid currency pair")
+	}
+	if sum <= 0 {
+		return nil, errors.New("mysql.ConvertFunds: sum must be positive")
+	}
+	c := model.Conversion{}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		rate, err := exchangeRate(tx, from, to)
+		if err != nil {
+			return err
+		}
+		if rate == 0 {
+			return fmt.Errorf("no exchange rate %s/%s", from, to)
+		}
+		var fw, tw *model.Wallet
+		if from < to {
+			if fw, err = lockWallet(tx, userID, from, false); err == nil {
+				tw, err = lockWallet(tx, userID, to, true)
+			}
+		} else {
+			if tw, err = lockWallet(tx, userID, to, true); err == nil {
+				fw, err = lockWallet(tx, userID, from, false)
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if fw == nil || fw.Balance-fw.Held-sum < 0 {
+			return fmt.Errorf("user #%d has no %s wallet or insufficient funds", userID, from)
+		}
+		c = model.Conversion{
+			CreatedAt:         time.Now().UTC(),
+			UserID:            userID,
+			From:              from,
+			To:                to,
+			Rate:              rate,
+			Sum:               sum,
+			Result:            sum * rate,
+			FromBalanceBefore: fw.Balance,
+			ToBalanceBefore:   tw.Balance,
+		}
+		if err = changeBalance(tx, fw, -c.Sum); err != nil {
+			return err
+		}
+		if err = changeBalance(tx, tw, c.Result); err != nil {
+			return err
+		}
+		c.FromBalanceAfter, c.ToBalanceAfter = fw.Balance, tw.Balance
+		return tx.Create(&c).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("mysql.ConvertFunds: %s", err.Error())
+	}
+	return &c, nil
+}
+
+func (s *mysqlstorage) FindLastConversions(
+	userID uint64,
+	currency model.Currency,
+	limit int,
+) ([]model.Conversion, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	conversions := []model.Conversion{}
+	q := s.db.Where("user_id = ?", userID)
+	if currency != "" {
+		q = q.Where("from_currency = ? OR to_currency = ?", currency, currency)
+	}
+	err := q.
+		Order("id DESC").
+		Limit(limit).
+		Find(&conversions).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastConversions: %s", err.Error())
+	}
+	return conversions, nil
+}
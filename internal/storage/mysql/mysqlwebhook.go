@@ -0,0 +1,192 @@
+package mysql
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jinzhu/gorm"
+
+	"github.com/wtask/pwsrv/internal/core"
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/model"
+	"github.com/wtask/pwsrv/internal/webhook"
+)
+
+// enqueueWebhooks - writes deliveries of the domain event for every subscription of the user within given transaction.
+// Deliveries already enqueued for the same domain event are skipped, so the event may be handled repeatedly.
+func enqueueWebhooks(tx *gorm.DB, eventID, userID uint64, kind string, data interface{}) error {
+	subs := []model.WebhookSubscription{}
+	if err := tx.Where("user_id = ? AND active = ?", userID, true).Find(&subs).Error; err != nil {
+		return err
+	}
+	payload := ""
+	for _, sub := range subs {
+		if !sub.Subscribed(kind) {
+			continue
+		}
+		existed := 0
+		err := tx.Model(&model.WebhookDelivery{}).
+			Where("subscription_id = ? AND event_id = ?", sub.ID, eventID).
+			Count(&existed).
+			Error
+		if err != nil {
+			return err
+		}
+		if existed > 0 {
+			continue
+		}
+		if payload == "" {
+			if payload, err = webhook.NewPayload(kind, data); err != nil {
+				return err
+			}
+		}
+		now := time.Now().UTC()
+		d := model.WebhookDelivery{
+			CreatedAt:      now,
+			SubscriptionID: sub.ID,
+			EventID:        eventID,
+			Event:          kind,
+			Payload:        payload,
+			Status:         model.WebhookPending,
+			NextAttemptAt:  now,
+		}
+		if err := tx.Create(&d).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EnqueueWebhooks - handles domain event from outbox and enqueues webhook deliveries for the users it affects.
+func (s *mysqlstorage) EnqueueWebhooks(e *event.Event) error {
+	if e == nil || e.Type != event.TransferCreated {
+		return nil
+	}
+	itm := model.InternalTransfer{}
+	if err := e.Decode(&itm); err != nil {
+		return fmt.Errorf("mysql.EnqueueWebhooks: %s", err.Error())
+	}
+	err := s.inTransaction(func(tx *gorm.DB) error {
+		err := enqueueWebhooks(tx, e.ID, itm.UserID, core.EventTransferDebited, core.CensorInternalTransfer(itm.UserID, &itm))
+		if err != nil {
+			return err
+		}
+		return enqueueWebhooks(tx, e.ID, itm.RecipientID, core.EventTransferCredited, core.CensorInternalTransfer(itm.RecipientID, &itm))
+	})
+	if err != nil {
+		return fmt.Errorf("mysql.EnqueueWebhooks: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *mysqlstorage) CreateWebhookSubscription(sub model.WebhookSubscription) (*model.WebhookSubscription, error) {
+	if sub.ID != 0 || sub.UserID == 0 || sub.URL == "" || sub.Events == "" || sub.Secret == "" {
+		return nil, errors.New("mysql.CreateWebhookSubscription: existed ID or required field is empty")
+	}
+	sub.CreatedAt = time.Now().UTC()
+	sub.Active = true
+	if err := s.db.Create(&sub).Error; err != nil {
+		return nil, fmt.Errorf("mysql.CreateWebhookSubscription: %s", err.Error())
+	}
+	return &sub, nil
+}
+
+func (s *mysqlstorage) GetWebhookSubscriptionByID(subscriptionID uint64) (*model.WebhookSubscription, error) {
+	sub := model.WebhookSubscription{}
+	if err := s.db.First(&sub, subscriptionID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("mysql.GetWebhookSubscriptionByID: %s", err.Error())
+	}
+	return &sub, nil
+}
+
+func (s *mysqlstorage) FindWebhookSubscriptions(userID uint64) ([]model.WebhookSubscription, error) {
+	subs := []model.WebhookSubscription{}
+	err := s.db.
+		Where("user_id = ? AND active = ?", userID, true).
+		Order("id").
+		Find(&subs).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindWebhookSubscriptions: %s", err.Error())
+	}
+	return subs, nil
+}
+
+// DeactivateWebhookSubscription - stops deliveries for the subscription, its delivery log is kept.
+func (s *mysqlstorage) DeactivateWebhookSubscription(subscriptionID uint64) error {
+	err := s.db.
+		Model(&model.WebhookSubscription{ID: subscriptionID}).
+		UpdateColumn("active", false).
+		Error
+	if err != nil {
+		return fmt.Errorf("mysql.DeactivateWebhookSubscription: %s", err.Error())
+	}
+	return nil
+}
+
+func (s *mysqlstorage) FindLastWebhookDeliveries(subscriptionID uint64, limit int) ([]model.WebhookDelivery, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	deliveries := []model.WebhookDelivery{}
+	err := s.db.
+		Where("subscription_id = ?", subscriptionID).
+		Order("id DESC").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindLastWebhookDeliveries: %s", err.Error())
+	}
+	return deliveries, nil
+}
+
+func (s *mysqlstorage) FindDueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+	deliveries := []model.WebhookDelivery{}
+	err := s.db.
+		Where("status = ? AND next_attempt_at <= ?", model.WebhookPending, now.UTC()).
+		Order("next_attempt_at, id").
+		Limit(limit).
+		Find(&deliveries).
+		Error
+	if err != nil {
+		return nil, fmt.Errorf("mysql.FindDueWebhookDeliveries: %s", err.Error())
+	}
+	return deliveries, nil
+}
+
+func (s *mysqlstorage) ClaimWebhookDelivery(deliveryID uint64, attempts int, until time.Time) (bool, error) {
+	q := s.db.
+		Model(&model.WebhookDelivery{}).
+		Where("id = ? AND status = ? AND attempts = ?", deliveryID, model.WebhookPending, attempts).
+		UpdateColumn("next_attempt_at", until.UTC())
+	if q.Error != nil {
+		return false, fmt.Errorf("mysql.ClaimWebhookDelivery: %s", q.Error.Error())
+	}
+	return q.RowsAffected == 1, nil
+}
+
+func (s *mysqlstorage) SaveWebhookDeliveryAttempt(d *model.WebhookDelivery) error {
+	if d == nil || d.ID == 0 {
+		return errors.New("mysql.SaveWebhookDeliveryAttempt: delivery is not stored")
+	}
+	err := s.db.Model(d).UpdateColumns(map[string]interface{}{
+		"status":          d.Status,
+		"attempts":        d.Attempts,
+		"next_attempt_at": d.NextAttemptAt.UTC(),
+		"last_attempt_at": d.LastAttemptAt,
+		"response_status": d.ResponseStatus,
+		"last_error":      d.LastError,
+	}).Error
+	if err != nil {
+		return fmt.Errorf("mysql.SaveWebhookDeliveryAttempt: %s", err.Error())
+	}
+	return nil
+}
@@ -1,11 +1,32 @@
 package storage
 
 import (
+	"context"
+	"database/sql"
+
+	"github.com/wtask/pwsrv/internal/archive"
 	"github.com/wtask/pwsrv/internal/core"
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/operator"
+	"github.com/wtask/pwsrv/internal/reconcile"
+	"github.com/wtask/pwsrv/internal/webhook"
 )
 
 // Interface - common data storage access interface in accordance with the requirements of internal packages.
 type Interface interface {
 	CoreRepository() core.Repository
+	EventStore() event.Store
+	WebhookStore() webhook.Store
+	OperatorStore() operator.Store
+	ReconcileStore() reconcile.Store
+	ArchiveStore() archive.Store
+	Migrator() Migrator
+	// DBStats - connection pool statistics of the underlying database
+	DBStats() sql.DBStats
+	// Ping - checks the database is available
+	Ping(ctx context.Context) error
+	// CheckSchema - checks all known migrations are applied to the database,
+	// returns ErrSchemaBehind or ErrSchemaAhead if versions differ
+	CheckSchema(ctx context.Context) error
 	Close() error
 }
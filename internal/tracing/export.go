@@ -0,0 +1,202 @@
+package tracing
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Exporter - sends batch of ended spans to the tracing backend
+type Exporter interface {
+	Export(spans []SpanData) error
+}
+
+// OTLPExporter - exports spans with OTLP/HTTP protocol in JSON encoding
+type OTLPExporter struct {
+	url     string
+	service string
+	client  *http.Client
+}
+
+// NewOTLPExporter - builds exporter to OTLP/HTTP endpoint of collector, like http://localhost:4318;
+// default /v1/traces path is used when endpoint has no path.
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	url := strings.TrimRight(endpoint, "/")
+	if i := strings.Index(url, "://"); i < 0 || !strings.Contains(url[i+3:], "/") {
+		url += "/v1/traces"
+	}
+	return &OTLPExporter{
+		url:     url,
+		service: service,
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export - posts spans to the collector.
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	body, err := json.Marshal(encodeOTLP(e.service, spans))
+	if err != nil {
+		return fmt.Errorf("tracing.OTLPExporter: %s", err.Error())
+	}
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("tracing.OTLPExporter: %s", err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("tracing.OTLPExporter: collector responded %s", resp.Status)
+	}
+	return nil
+}
+
+// FileExporter - writes every batch as a line of OTLP/JSON, like file exporter of OpenTelemetry Collector
+type FileExporter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	service string
+}
+
+// NewFileExporter - builds exporter writing into w.
+func NewFileExporter(w io.Writer, service string) *FileExporter {
+	return &FileExporter{w: w, service: service}
+}
+
+// Export - writes spans.
+func (e *FileExporter) Export(spans []SpanData) error {
+	line, err := json.Marshal(encodeOTLP(e.service, spans))
+	if err != nil {
+		return fmt.Errorf("tracing.FileExporter: %s", err.Error())
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, err := e.w.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("tracing.FileExporter: %s", err.Error())
+	}
+	return nil
+}
+
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              SpanKind        `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	// otlpValue - one of fields is set; 64-bit integers are strings in OTLP/JSON
+	otlpValue struct {
+		StringValue *string  `json:"stringValue,omitempty"`
+		BoolValue   *bool    `json:"boolValue,omitempty"`
+		IntValue    *string  `json:"intValue,omitempty"`
+		DoubleValue *float64 `json:"doubleValue,omitempty"`
+	}
+
+	otlpStatus struct {
+		Code    int    `json:"code,omitempty"` // 0 - unset, 2 - error
+		Message string `json:"message,omitempty"`
+	}
+)
+
+func encodeOTLP(service string, spans []SpanData) *otlpRequest {
+	encoded := make([]otlpSpan, len(spans))
+	for i, s := range spans {
+		encoded[i] = otlpSpan{
+			TraceID:           s.TraceID.String(),
+			SpanID:            s.SpanID.String(),
+			Name:              s.Name,
+			Kind:              s.Kind,
+			StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+		}
+		if s.ParentID.IsValid() {
+			encoded[i].ParentSpanID = s.ParentID.String()
+		}
+		for _, a := range s.Attributes {
+			encoded[i].Attributes = append(encoded[i].Attributes, otlpAttribute{Key: a.Key, Value: encodeValue(a.Value)})
+		}
+		if s.Error {
+			encoded[i].Status = otlpStatus{Code: 2, Message: s.Message}
+		}
+	}
+	return &otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource: otlpResource{
+				Attributes: []otlpAttribute{{Key: "service.name", Value: encodeValue(service)}},
+			},
+			ScopeSpans: []otlpScopeSpans{{
+				Scope: otlpScope{Name: "github.com/wtask/pwsrv/internal/tracing"},
+				Spans: encoded,
+			}},
+		}},
+	}
+}
+
+func encodeValue(v interface{}) otlpValue {
+	var i string
+	switch v := v.(type) {
+	case string:
+		return otlpValue{StringValue: &v}
+	case bool:
+		return otlpValue{BoolValue: &v}
+	case float64:
+		return otlpValue{DoubleValue: &v}
+	case float32:
+		f := float64(v)
+		return otlpValue{DoubleValue: &f}
+	case int:
+		i = strconv.FormatInt(int64(v), 10)
+	case int64:
+		i = strconv.FormatInt(v, 10)
+	case int32:
+		i = strconv.FormatInt(int64(v), 10)
+	case uint:
+		i = strconv.FormatUint(uint64(v), 10)
+	case uint64:
+		i = strconv.FormatUint(v, 10)
+	case uint32:
+		i = strconv.FormatUint(uint64(v), 10)
+	default:
+		s := fmt.Sprint(v)
+		return otlpValue{StringValue: &s}
+	}
+	return otlpValue{IntValue: &i}
+}
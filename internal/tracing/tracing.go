@@ -0,0 +1,374 @@
+// Package tracing records spans compatible with OpenTelemetry data model,
+// propagates them with W3C Trace Context headers and exports them in OTLP/JSON format.
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HeaderTraceparent - W3C Trace Context header
+const HeaderTraceparent = "traceparent"
+
+// TraceID - identifier of the trace
+type TraceID [16]byte
+
+// SpanID - identifier of the span within trace
+type SpanID [8]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid - checks ID is not zero.
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// IsValid - checks ID is not zero.
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext - identity of the span, which is propagated across process boundaries
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid - checks both IDs are set.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// Traceparent - formats span context as value of traceparent header.
+func (sc SpanContext) Traceparent() string {
+	flags := "00"
+	if sc.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", sc.TraceID, sc.SpanID, flags)
+}
+
+// ParseTraceparent - parses value of traceparent header, returns false if it is invalid.
+func ParseTraceparent(value string) (SpanContext, bool) {
+	sc := SpanContext{}
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" ||
+		// version 00 has exactly 4 fields, future versions may add more
+		(parts[0] == "00" && len(parts) != 4) {
+		return sc, false
+	}
+	if len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.TraceID[:], []byte(parts[1])); err != nil {
+		return sc, false
+	}
+	if _, err := hex.Decode(sc.SpanID[:], []byte(parts[2])); err != nil {
+		return sc, false
+	}
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil || strings.ToLower(parts[1]) != parts[1] || strings.ToLower(parts[2]) != parts[2] {
+		return sc, false
+	}
+	sc.Sampled = flags[0]&1 == 1
+	return sc, sc.IsValid()
+}
+
+// SpanKind - role of the span in the trace, values are the same as in OTLP
+type SpanKind int
+
+const (
+	SpanKindInternal SpanKind = 1
+	SpanKindServer   SpanKind = 2
+	SpanKindClient   SpanKind = 3
+)
+
+// Attribute - key-value pair describing the span
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// SpanData - recorded span
+type SpanData struct {
+	TraceID    TraceID
+	SpanID     SpanID
+	ParentID   SpanID
+	Name       string
+	Kind       SpanKind
+	Start      time.Time
+	End        time.Time
+	Attributes []Attribute
+	Error      bool
+	Message    string
+}
+
+// Span - operation within the trace, methods are safe to call on nil span
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// Context - returns identity of the span.
+func (s *Span) Context() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return SpanContext{TraceID: s.data.TraceID, SpanID: s.data.SpanID, Sampled: true}
+}
+
+// SetName - replaces name of the span, when it becomes more specific.
+func (s *Span) SetName(name string) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Name = name
+	s.mu.Unlock()
+}
+
+// SetAttribute - adds attribute of the span, value must be string, bool, integer or float.
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Attributes = append(s.data.Attributes, Attribute{Key: key, Value: value})
+	s.mu.Unlock()
+}
+
+// SetError - marks the span failed if error is not nil.
+func (s *Span) SetError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	s.data.Error = true
+	s.data.Message = err.Error()
+	s.mu.Unlock()
+}
+
+// End - completes the span and passes it to the exporter, next calls are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	s.mu.Unlock()
+	s.tracer.export(&data)
+}
+
+type contextKey int
+
+const (
+	_ contextKey = iota
+	spanKey
+	remoteKey
+)
+
+// SpanFromContext - returns current span of the context or nil.
+func SpanFromContext(ctx context.Context) *Span {
+	s, _ := ctx.Value(spanKey).(*Span)
+	return s
+}
+
+// ContextWithRemote - returns copy of the context with parent span received from another process.
+func ContextWithRemote(ctx context.Context, parent SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey, parent)
+}
+
+// TraceIDFromContext - returns ID of the current trace or empty string.
+func TraceIDFromContext(ctx context.Context) string {
+	if s := SpanFromContext(ctx); s != nil {
+		return s.data.TraceID.String()
+	}
+	return ""
+}
+
+func newID(b []byte) {
+	for {
+		if _, err := rand.Read(b); err != nil {
+			panic(fmt.Errorf("tracing: %s", err.Error()))
+		}
+		for _, c := range b {
+			if c != 0 {
+				return
+			}
+		}
+	}
+}
+
+// Option - changes default tracer settings
+type Option func(*Tracer)
+
+// WithLogger - sets logger to report export failures.
+func WithLogger(l *slog.Logger) Option {
+	return func(t *Tracer) {
+		if l != nil {
+			t.logger = l
+		}
+	}
+}
+
+// WithBatch - sets max number of spans exported at once and max delay of the export.
+func WithBatch(size int, interval time.Duration) Option {
+	return func(t *Tracer) {
+		if size > 0 {
+			t.batchSize = size
+		}
+		if interval > 0 {
+			t.interval = interval
+		}
+	}
+}
+
+// Tracer - starts spans and exports ended ones in background batches;
+// nil tracer is valid and does not record anything.
+type Tracer struct {
+	exporter  Exporter
+	logger    *slog.Logger
+	batchSize int
+	interval  time.Duration
+	mu        sync.RWMutex
+	closed    bool
+	queue     chan *SpanData
+	done      chan struct{}
+	dropped   uint64
+}
+
+// NewTracer - builds tracer which passes ended spans to the exporter.
+func NewTracer(e Exporter, options ...Option) *Tracer {
+	if e == nil {
+		panic(errors.New("tracing.NewTracer: exporter is nil"))
+	}
+	t := &Tracer{
+		exporter:  e,
+		logger:    slog.New(slog.DiscardHandler),
+		batchSize: 512,
+		interval:  5 * time.Second,
+		done:      make(chan struct{}),
+	}
+	for _, alter := range options {
+		alter(t)
+	}
+	t.queue = make(chan *SpanData, 4*t.batchSize)
+	go t.run()
+	return t
+}
+
+// Start - starts the span as a child of the current span of the context
+// or the remote parent, otherwise a new trace is started.
+// Returns context with started span, which must be ended by caller.
+func (t *Tracer) Start(ctx context.Context, name string, kind SpanKind) (context.Context, *Span) {
+	if t == nil {
+		return ctx, nil
+	}
+	s := &Span{
+		tracer: t,
+		data: SpanData{
+			Name:  name,
+			Kind:  kind,
+			Start: time.Now(),
+		},
+	}
+	if parent := SpanFromContext(ctx); parent != nil {
+		s.data.TraceID, s.data.ParentID = parent.data.TraceID, parent.data.SpanID
+	} else if remote, ok := ctx.Value(remoteKey).(SpanContext); ok && remote.IsValid() {
+		s.data.TraceID, s.data.ParentID = remote.TraceID, remote.SpanID
+	} else {
+		newID(s.data.TraceID[:])
+	}
+	newID(s.data.SpanID[:])
+	return context.WithValue(ctx, spanKey, s), s
+}
+
+// Shutdown - exports queued spans and stops the tracer, spans ended later are dropped.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	if t == nil {
+		return nil
+	}
+	t.mu.Lock()
+	if !t.closed {
+		t.closed = true
+		close(t.queue)
+	}
+	t.mu.Unlock()
+	select {
+	case <-t.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (t *Tracer) export(data *SpanData) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	if t.closed {
+		return
+	}
+	select {
+	case t.queue <- data:
+	default:
+		// exporter can not keep up, spans are not worth to slow down requests
+		atomic.AddUint64(&t.dropped, 1)
+	}
+}
+
+func (t *Tracer) run() {
+	defer close(t.done)
+	ticker := time.NewTicker(t.interval)
+	defer ticker.Stop()
+	batch := make([]SpanData, 0, t.batchSize)
+	flush := func() {
+		if dropped := atomic.SwapUint64(&t.dropped, 0); dropped > 0 {
+			t.logger.Warn("Spans dropped", "count", dropped)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		if err := t.exporter.Export(batch); err != nil {
+			t.logger.Error("Spans export failed", "count", len(batch), "error", err)
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case data, ok := <-t.queue:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, *data)
+			if len(batch) >= t.batchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	value := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	sc, ok := ParseTraceparent(value)
+	if !ok || !sc.Sampled {
+		t.Fatalf("Valid traceparent is not parsed: %+v", sc)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" || sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected span context: %s %s", sc.TraceID, sc.SpanID)
+	}
+	if sc.Traceparent() != value {
+		t.Errorf("Unexpected traceparent: %s", sc.Traceparent())
+	}
+	invalid := []string{
+		"",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	}
+	for _, v := range invalid {
+		if _, ok := ParseTraceparent(v); ok {
+			t.Errorf("Invalid traceparent is accepted: %q", v)
+		}
+	}
+	if _, ok := ParseTraceparent("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra"); !ok {
+		t.Error("Traceparent of future version is not accepted")
+	}
+}
+
+func TestNilTracer(t *testing.T) {
+	var tracer *Tracer
+	ctx, span := tracer.Start(context.Background(), "noop", SpanKindInternal)
+	span.SetAttribute("key", "value")
+	span.SetError(errors.New("failed"))
+	span.End()
+	if span != nil || TraceIDFromContext(ctx) != "" {
+		t.Error("Nil tracer records span")
+	}
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestFileExporter(t *testing.T) {
+	buf := bytes.Buffer{}
+	tracer := NewTracer(NewFileExporter(&buf, "test"), WithBatch(10, time.Hour))
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := tracer.Start(ContextWithRemote(context.Background(), remote), "GET /", SpanKindServer)
+	_, child := tracer.Start(ctx, "SQL", SpanKindClient)
+	child.SetName("SELECT user")
+	child.SetAttribute("db.rows_affected", int64(1))
+	child.SetError(errors.New("deadlock"))
+	child.End()
+	child.End()
+	root.SetAttribute("http.response.status_code", 200)
+	root.End()
+	if err := tracer.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := otlpRequest{}
+	if err := json.Unmarshal(buf.Bytes(), &req); err != nil {
+		t.Fatalf("Unexpected output %q: %s", buf.String(), err)
+	}
+	if len(req.ResourceSpans) != 1 || *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue != "test" {
+		t.Fatalf("Unexpected resource: %+v", req)
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 2 {
+		t.Fatalf("Unexpected number of spans: %d", len(spans))
+	}
+	c, r := spans[0], spans[1]
+	if r.TraceID != remote.TraceID.String() || r.ParentSpanID != remote.SpanID.String() || r.Kind != SpanKindServer {
+		t.Errorf("Root span does not continue remote trace: %+v", r)
+	}
+	if c.TraceID != r.TraceID || c.ParentSpanID != r.SpanID || c.Name != "SELECT user" {
+		t.Errorf("Unexpected child span: %+v", c)
+	}
+	if c.Status.Code != 2 || c.Status.Message != "deadlock" || *c.Attributes[0].Value.IntValue != "1" {
+		t.Errorf("Unexpected child status or attributes: %+v", c)
+	}
+	if *r.Attributes[0].Value.IntValue != "200" || r.Status.Code != 0 {
+		t.Errorf("Unexpected root status or attributes: %+v", r)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	received := make(chan otlpRequest, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" || r.Header.Get("Content-Type") != "application/json" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		req := otlpRequest{}
+		json.NewDecoder(r.Body).Decode(&req)
+		received <- req
+	}))
+	defer collector.Close()
+
+	spans := []SpanData{{Name: "span", Kind: SpanKindInternal, Start: time.Now(), End: time.Now()}}
+	newID(spans[0].TraceID[:])
+	newID(spans[0].SpanID[:])
+	if err := NewOTLPExporter(collector.URL, "test").Export(spans); err != nil {
+		t.Fatal(err)
+	}
+	req := <-received
+	if s := req.ResourceSpans[0].ScopeSpans[0].Spans[0]; s.SpanID != spans[0].SpanID.String() || s.ParentSpanID != "" {
+		t.Errorf("Unexpected span: %+v", s)
+	}
+	if err := NewOTLPExporter(collector.URL+"/unknown", "test").Export(spans); err == nil {
+		t.Error("Collector error is not reported")
+	}
+}
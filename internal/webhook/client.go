@@ -0,0 +1,100 @@
+package webhook
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"syscall"
+	"time"
+)
+
+var errForbiddenAddress = errors.New("address is not allowed")
+
+// reservedNetworks - special purpose networks, which are not covered by methods of net.IP
+var reservedNetworks = func() []*net.IPNet {
+	cidrs := []string{
+		"0.0.0.0/8",       // "this" network
+		"100.64.0.0/10",   // shared address space (carrier-grade NAT)
+		"192.0.0.0/24",    // IETF protocol assignments
+		"192.0.2.0/24",    // documentation
+		"198.18.0.0/15",   // benchmarking
+		"198.51.100.0/24", // documentation
+		"203.0.113.0/24",  // documentation
+		"240.0.0.0/4",     // reserved and broadcast
+		"64:ff9b::/96",    // NAT64, may be translated into internal IPv4
+		"2001:db8::/32",   // documentation
+	}
+	networks := make([]*net.IPNet, 0, len(cidrs))
+	for _, c := range cidrs {
+		_, n, err := net.ParseCIDR(c)
+		if err != nil {
+			panic(err)
+		}
+		networks = append(networks, n)
+	}
+	return networks
+}()
+
+// PublicIP - checks the address is routable in the Internet; webhooks are never sent into loopback,
+// private, link-local (including cloud metadata endpoint) and other special networks.
+func PublicIP(ip net.IP) bool {
+	if ip == nil ||
+		ip.IsUnspecified() ||
+		ip.IsLoopback() ||
+		ip.IsPrivate() ||
+		ip.IsLinkLocalUnicast() ||
+		ip.IsMulticast() {
+		return false
+	}
+	for _, n := range reservedNetworks {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// PublicHost - checks host of the webhook URL is not a local name or non-public IP;
+// names are resolved at the moment of delivery, so they are checked by the client only.
+func PublicHost(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" || host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return false
+	}
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil {
+		return PublicIP(ip)
+	}
+	return true
+}
+
+// denyNonPublic - rejects connection to non-public address after the name is resolved,
+// so DNS records pointing into internal networks are useless too.
+func denyNonPublic(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	if !PublicIP(net.ParseIP(host)) {
+		return errForbiddenAddress
+	}
+	return nil
+}
+
+// NewClient - creates HTTP client, which connects to public addresses only, does not follow redirects
+// and ignores proxy settings of the environment.
+func NewClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: timeout, Control: denyNonPublic}
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+			MaxIdleConns:        100,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
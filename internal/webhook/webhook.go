@@ -0,0 +1,245 @@
+// Package webhook delivers queued event payloads to subscribers' endpoints
+// signing them with HMAC and retrying failed attempts with exponential backoff.
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+const (
+	// HeaderEvent - header with the event type
+	HeaderEvent = "X-Pwsrv-Event"
+	// HeaderDelivery - header with the delivery ID, the same for every attempt
+	HeaderDelivery = "X-Pwsrv-Delivery"
+	// HeaderTimestamp - header with Unix time of the attempt, which is signed together with the body
+	HeaderTimestamp = "X-Pwsrv-Timestamp"
+	// HeaderSignature - header with signature in format "v1=<hex of HMAC-SHA256(secret, timestamp + "." + body)>"
+	HeaderSignature = "X-Pwsrv-Signature"
+)
+
+var (
+	errInactive = errors.New("subscription is not active")
+	errStatus   = errors.New("unexpected response status")
+)
+
+// Envelope - common format of the webhook payload
+type Envelope struct {
+	Event     string      `json:"event"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// NewPayload - encodes event data into payload.
+func NewPayload(event string, data interface{}) (string, error) {
+	b, err := json.Marshal(&Envelope{Event: event, CreatedAt: time.Now().UTC(), Data: data})
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// Sign - calculates signature of the payload sent at given timestamp.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify - checks signature of the payload, helps receivers to authenticate requests.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Store - queue of deliveries
+type Store interface {
+	FindDueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error)
+	// ClaimWebhookDelivery - postpones pending delivery until given time if it has expected number of attempts,
+	// so other dispatchers will skip it; returns false if delivery is already claimed.
+	ClaimWebhookDelivery(deliveryID uint64, attempts int, until time.Time) (bool, error)
+	GetWebhookSubscriptionByID(subscriptionID uint64) (*model.WebhookSubscription, error)
+	SaveWebhookDeliveryAttempt(d *model.WebhookDelivery) error
+	// EnqueueWebhooks - handles domain event, must skip deliveries which are already enqueued for the event
+	EnqueueWebhooks(e *event.Event) error
+}
+
+// Dispatcher - sends due deliveries
+type Dispatcher struct {
+	store       Store
+	client      *http.Client
+	batchSize   int
+	maxAttempts int
+	backoff     time.Duration
+	maxBackoff  time.Duration
+}
+
+type dispatcherOption func(*Dispatcher)
+
+// WithHTTPClient - sets custom HTTP client to send requests instead of the one created by NewClient,
+// it is responsible to protect internal networks.
+func WithHTTPClient(c *http.Client) dispatcherOption {
+	return func(d *Dispatcher) {
+		if c != nil {
+			d.client = c
+		}
+	}
+}
+
+// WithRetries - sets max number of attempts and backoff interval, which is doubled after every failure
+// until it reaches max value.
+func WithRetries(maxAttempts int, backoff, maxBackoff time.Duration) dispatcherOption {
+	return func(d *Dispatcher) {
+		d.maxAttempts, d.backoff, d.maxBackoff = maxAttempts, backoff, maxBackoff
+	}
+}
+
+// NewDispatcher - creates dispatcher of deliveries from the given store.
+func NewDispatcher(store Store, options ...dispatcherOption) *Dispatcher {
+	if store == nil {
+		panic(errors.New("webhook.NewDispatcher: Store is nil"))
+	}
+	d := &Dispatcher{
+		store:       store,
+		client:      NewClient(10 * time.Second),
+		batchSize:   100,
+		maxAttempts: 10,
+		backoff:     30 * time.Second,
+		maxBackoff:  6 * time.Hour,
+	}
+	for _, o := range options {
+		if o != nil {
+			o(d)
+		}
+	}
+	return d
+}
+
+// Backoff - returns delay before the next attempt after given number of failed attempts.
+func (d *Dispatcher) Backoff(attempts int) time.Duration {
+	delay := d.backoff
+	for i := 1; i < attempts && delay < d.maxBackoff; i++ {
+		delay *= 2
+	}
+	if delay > d.maxBackoff {
+		delay = d.maxBackoff
+	}
+	return delay
+}
+
+// Dispatch - sends all due deliveries, suitable to be used as background job.
+// Returns number of processed deliveries.
+func (d *Dispatcher) Dispatch(now time.Time) (int, error) {
+	deliveries, err := d.store.FindDueWebhookDeliveries(now, d.batchSize)
+	if err != nil {
+		return 0, fmt.Errorf("webhook.Dispatch: %s", err.Error())
+	}
+	processed := 0
+	for i := range deliveries {
+		delivery := &deliveries[i]
+		claimed, err := d.store.ClaimWebhookDelivery(
+			delivery.ID,
+			delivery.Attempts,
+			now.Add(d.client.Timeout+time.Minute),
+		)
+		if err != nil {
+			return processed, fmt.Errorf("webhook.Dispatch: %s", err.Error())
+		}
+		if !claimed {
+			continue
+		}
+		d.attempt(delivery, now)
+		if err = d.store.SaveWebhookDeliveryAttempt(delivery); err != nil {
+			return processed, fmt.Errorf("webhook.Dispatch: %s", err.Error())
+		}
+		processed++
+	}
+	return processed, nil
+}
+
+// attempt - sends delivery and updates its state according with the result.
+func (d *Dispatcher) attempt(delivery *model.WebhookDelivery, now time.Time) {
+	delivery.Attempts++
+	at := now.UTC()
+	delivery.LastAttemptAt = &at
+	delivery.ResponseStatus = 0
+	delivery.LastError = ""
+
+	status, err := d.send(delivery, now)
+	delivery.ResponseStatus = status
+	switch {
+	case err == nil:
+		delivery.Status = model.WebhookDelivered
+	case err == errInactive || delivery.Attempts >= d.maxAttempts:
+		delivery.Status = model.WebhookFailed
+		delivery.LastError = failure(err)
+	default:
+		delivery.Status = model.WebhookPending
+		delivery.LastError = failure(err)
+		delivery.NextAttemptAt = at.Add(d.Backoff(delivery.Attempts))
+	}
+}
+
+// failure - describes failed attempt for the owner of subscription;
+// details of the network and of the storage are never exposed.
+func failure(err error) string {
+	var netErr net.Error
+	switch {
+	case err == errInactive, errors.Is(err, errStatus):
+		return err.Error()
+	case errors.Is(err, errForbiddenAddress):
+		return "address of the receiver is not allowed"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "request timed out"
+	default:
+		return "request failed"
+	}
+}
+
+// send - posts signed payload, returns status of response.
+func (d *Dispatcher) send(delivery *model.WebhookDelivery, now time.Time) (int, error) {
+	sub, err := d.store.GetWebhookSubscriptionByID(delivery.SubscriptionID)
+	if err != nil {
+		return 0, err
+	}
+	if sub == nil || !sub.Active {
+		return 0, errInactive
+	}
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest(http.MethodPost, sub.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	ts := now.Unix()
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req.Header.Set("User-Agent", "pwsrv-webhook/1")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, strconv.FormatUint(delivery.ID, 10))
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(ts, 10))
+	req.Header.Set(HeaderSignature, Sign(sub.Secret, ts, body))
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64*1024))
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("%w %d", errStatus, resp.StatusCode)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,264 @@
+package webhook
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/model"
+)
+
+type memoryStore struct {
+	mu            sync.Mutex
+	subscriptions map[uint64]*model.WebhookSubscription
+	deliveries    map[uint64]*model.WebhookDelivery
+}
+
+func (s *memoryStore) FindDueWebhookDeliveries(now time.Time, limit int) ([]model.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	due := []model.WebhookDelivery{}
+	for _, d := range s.deliveries {
+		if d.Status == model.WebhookPending && !d.NextAttemptAt.After(now) && len(due) < limit {
+			due = append(due, *d)
+		}
+	}
+	return due, nil
+}
+
+func (s *memoryStore) ClaimWebhookDelivery(id uint64, attempts int, until time.Time) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok || d.Status != model.WebhookPending || d.Attempts != attempts {
+		return false, nil
+	}
+	d.NextAttemptAt = until
+	return true, nil
+}
+
+func (s *memoryStore) GetWebhookSubscriptionByID(id uint64) (*model.WebhookSubscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.subscriptions[id], nil
+}
+
+func (s *memoryStore) SaveWebhookDeliveryAttempt(d *model.WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := *d
+	s.deliveries[d.ID] = &c
+	return nil
+}
+
+func (s *memoryStore) EnqueueWebhooks(e *event.Event) error {
+	return nil
+}
+
+func TestSignature(t *testing.T) {
+	body := []byte(`{"event":"test"}`)
+	sig := Sign("secret", 1550000000, body)
+	if !Verify("secret", 1550000000, body, sig) {
+		t.Errorf("Signature %q is not verified", sig)
+	}
+	if Verify("other", 1550000000, body, sig) ||
+		Verify("secret", 1550000001, body, sig) ||
+		Verify("secret", 1550000000, []byte(`{}`), sig) {
+		t.Errorf("Signature %q is verified with wrong data", sig)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	d := NewDispatcher(&memoryStore{}, WithRetries(10, time.Second, 5*time.Second))
+	expected := []time.Duration{time.Second, time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for attempts, delay := range expected {
+		if d.Backoff(attempts) != delay {
+			t.Errorf("Unexpected backoff %s after %d attempts, expected %s", d.Backoff(attempts), attempts, delay)
+		}
+	}
+}
+
+func TestDispatch(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		received []*http.Request
+		bodies   [][]byte
+		fail     = true
+	)
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		body, _ := ioutil.ReadAll(r.Body)
+		received = append(received, r)
+		bodies = append(bodies, body)
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer receiver.Close()
+
+	now := time.Now()
+	store := &memoryStore{
+		subscriptions: map[uint64]*model.WebhookSubscription{
+			1: {ID: 1, URL: receiver.URL, Events: "transfer.credited", Secret: "secret", Active: true},
+			2: {ID: 2, URL: receiver.URL, Events: "transfer.credited", Secret: "secret", Active: false},
+		},
+		deliveries: map[uint64]*model.WebhookDelivery{
+			10: {ID: 10, SubscriptionID: 1, Event: "transfer.credited", Payload: `{"n":1}`,
+				Status: model.WebhookPending, NextAttemptAt: now},
+			20: {ID: 20, SubscriptionID: 2, Event: "transfer.credited", Payload: `{"n":2}`,
+				Status: model.WebhookPending, NextAttemptAt: now},
+		},
+	}
+	// test receiver listens on loopback, which is denied by default client
+	d := NewDispatcher(store, WithRetries(2, time.Minute, time.Hour), WithHTTPClient(receiver.Client()))
+
+	// first attempt fails
+	if n, err := d.Dispatch(now); err != nil || n != 2 {
+		t.Fatalf("Unexpected dispatch result %d, %v", n, err)
+	}
+	if len(received) != 1 {
+		t.Fatalf("Unexpected number of requests %d", len(received))
+	}
+	r := received[0]
+	ts, _ := strconv.ParseInt(r.Header.Get(HeaderTimestamp), 10, 64)
+	if ts != now.Unix() ||
+		r.Header.Get(HeaderEvent) != "transfer.credited" ||
+		r.Header.Get(HeaderDelivery) != "10" ||
+		!Verify("secret", ts, bodies[0], r.Header.Get(HeaderSignature)) ||
+		string(bodies[0]) != `{"n":1}` {
+		t.Errorf("Unexpected request: %v, %s", r.Header, bodies[0])
+	}
+	if dl := store.deliveries[10]; dl.Status != model.WebhookPending ||
+		dl.Attempts != 1 ||
+		dl.ResponseStatus != http.StatusServiceUnavailable ||
+		!dl.NextAttemptAt.Equal(now.UTC().Add(time.Minute)) {
+		t.Errorf("Unexpected state of failed delivery %+v", dl)
+	}
+	if dl := store.deliveries[20]; dl.Status != model.WebhookFailed || dl.Attempts != 1 {
+		t.Errorf("Delivery of inactive subscription must fail without retries: %+v", dl)
+	}
+
+	// retry is not due yet
+	if n, _ := d.Dispatch(now.Add(30 * time.Second)); n != 0 {
+		t.Errorf("Unexpected dispatch of not due delivery")
+	}
+
+	// second attempt succeeds
+	fail = false
+	if n, err := d.Dispatch(now.Add(time.Minute)); err != nil || n != 1 {
+		t.Fatalf("Unexpected dispatch result %d, %v", n, err)
+	}
+	if dl := store.deliveries[10]; dl.Status != model.WebhookDelivered ||
+		dl.Attempts != 2 ||
+		dl.ResponseStatus != http.StatusNoContent ||
+		dl.LastError != "" {
+		t.Errorf("Unexpected state of delivered delivery %+v", dl)
+	}
+}
+
+func TestDispatchGivesUp(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer receiver.Close()
+	now := time.Now()
+	store := &memoryStore{
+		subscriptions: map[uint64]*model.WebhookSubscription{
+			1: {ID: 1, URL: receiver.URL, Secret: "secret", Active: true},
+		},
+		deliveries: map[uint64]*model.WebhookDelivery{
+			1: {ID: 1, SubscriptionID: 1, Payload: `{}`, Status: model.WebhookPending, NextAttemptAt: now},
+		},
+	}
+	d := NewDispatcher(store, WithRetries(3, time.Second, time.Second), WithHTTPClient(receiver.Client()))
+	for i := 0; i < 5; i++ {
+		d.Dispatch(now.Add(time.Duration(i) * time.Second))
+	}
+	if dl := store.deliveries[1]; dl.Status != model.WebhookFailed ||
+		dl.Attempts != 3 ||
+		dl.LastError != "unexpected response status 500" {
+		t.Errorf("Unexpected state of exhausted delivery %+v", dl)
+	}
+}
+
+func TestPublicHost(t *testing.T) {
+	cases := []struct {
+		host   string
+		public bool
+	}{
+		{"example.com", true},
+		{"93.184.216.34", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]", true},
+		{"localhost", false},
+		{"api.localhost.", false},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"255.255.255.255", false},
+		{"[::1]", false},
+		{"[fd00::1]", false},
+		{"[fe80::1]", false},
+		{"[::ffff:127.0.0.1]", false},
+		{"[64:ff9b::a00:1]", false},
+	}
+	for _, c := range cases {
+		if PublicHost(c.host) != c.public {
+			t.Errorf("Unexpected result for %q, expected %t", c.host, c.public)
+		}
+	}
+}
+
+func TestDefaultClientDeniesInternalAddress(t *testing.T) {
+	received := false
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = true
+	}))
+	defer receiver.Close()
+	now := time.Now()
+	store := &memoryStore{
+		subscriptions: map[uint64]*model.WebhookSubscription{
+			1: {ID: 1, URL: receiver.URL, Secret: "secret", Active: true},
+		},
+		deliveries: map[uint64]*model.WebhookDelivery{
+			1: {ID: 1, SubscriptionID: 1, Payload: `{}`, Status: model.WebhookPending, NextAttemptAt: now},
+		},
+	}
+	if _, err := NewDispatcher(store).Dispatch(now); err != nil {
+		t.Fatal(err)
+	}
+	if dl := store.deliveries[1]; received ||
+		dl.Status != model.WebhookPending ||
+		dl.LastError != "address of the receiver is not allowed" {
+		t.Errorf("Unexpected delivery to internal address: %+v", dl)
+	}
+}
+
+func TestClientDoesNotFollowRedirects(t *testing.T) {
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://169.254.169.254/latest/meta-data/", http.StatusFound)
+	}))
+	defer receiver.Close()
+	c := NewClient(time.Second)
+	// test receiver listens on loopback, so only redirect policy is checked here
+	c.Transport = http.DefaultTransport
+	resp, err := c.Post(receiver.URL, "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Errorf("Redirect is followed, status %d", resp.StatusCode)
+	}
+}
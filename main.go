@@ -2,56 +2,50 @@ package main
 
 import (
 	"context"
-	"flag"
+	"crypto/tls"
 	"fmt"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
-	"sync"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
+	"github.com/wtask/pwsrv/internal/background"
+	"github.com/wtask/pwsrv/internal/certs"
 	"github.com/wtask/pwsrv/internal/encryption/hasher"
 	"github.com/wtask/pwsrv/internal/encryption/token"
+	"github.com/wtask/pwsrv/internal/event"
+	"github.com/wtask/pwsrv/internal/health"
+	"github.com/wtask/pwsrv/internal/lifecycle"
+	"github.com/wtask/pwsrv/internal/listener"
+	"github.com/wtask/pwsrv/internal/logging"
+	"github.com/wtask/pwsrv/internal/metrics"
+	"github.com/wtask/pwsrv/internal/notify"
+	"github.com/wtask/pwsrv/internal/reconcile"
 
 	"github.com/wtask/pwsrv/internal/storage"
+	"github.com/wtask/pwsrv/internal/tracing"
+	"github.com/wtask/pwsrv/internal/webhook"
 
 	"github.com/wtask/pwsrv/internal/storage/mysql"
 
 	"github.com/wtask/pwsrv/internal/core"
+	"github.com/wtask/pwsrv/internal/core/middleware"
 )
 
 const (
 	AppConfigPathnameEnv = "PWSRV_CONFIG"
 )
 
-var (
-	AppConfigPathname = ""
-)
-
-// startServer - launches given server to listen and serve in background;
-// writes into fail channel an error (or nil) as reason of startup fall
-// or termination.
-func startServer(s *http.Server, fail chan<- error) {
-	fmt.Printf("Starting server (%s) ...\n", s.Addr)
-	go func() {
-		fail <- s.ListenAndServe()
-	}()
-}
-
-// waitServerStop - waiting for a value in the channel and stopping the server;
-// writes shutdown error or nil into the fail channel.
-func waitServerStop(s *http.Server, stop <-chan bool, fail chan<- error) {
-	go func() {
-		<-stop
-		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
-		defer cancel()
-		s.SetKeepAlivesEnabled(false)
-		fail <- s.Shutdown(ctx)
-	}()
-}
+// Version - server version, set at build time with -ldflags "-X main.Version=..."
+var Version = "dev"
 
-// newStorage - storage factory
-func newStorage(cfg *Configuration) (storage.Interface, error) {
+// newStorage - storage factory; tracer is optional, schema is migrated on opening if migrate is true.
+func newStorage(cfg *Configuration, l *slog.Logger, t *tracing.Tracer, migrate bool) (storage.Interface, error) {
 	var (
 		storage storage.Interface
 		err     error
@@ -64,6 +58,9 @@ func newStorage(cfg *Configuration) (storage.Interface, error) {
 			mysql.WithPasswordHasher(
 				hasher.NewMD5DigestHasher(cfg.Secret.UserPassword),
 			),
+			mysql.WithLogger(l.With("component", "storage")),
+			mysql.WithTracer(t),
+			mysql.WithMigration(migrate),
 		)
 		if err != nil {
 			return nil, fmt.Errorf("Storage factory: %s", err.Error())
@@ -74,84 +71,412 @@ func newStorage(cfg *Configuration) (storage.Interface, error) {
 	return storage, nil
 }
 
-func init() {
-	descr := fmt.Sprintf(
-		"Absolute file path to JSON config in case, if config location is not defined with %q environment's var.",
-		AppConfigPathnameEnv,
+// newBearer - authorization tokens factory.
+func newBearer(cfg *Configuration, l *slog.Logger) token.AuthBearer {
+	ttl, _ := time.ParseDuration(cfg.Token.TTL) // verified on loading
+	return token.NewMD5DigestBearer(
+		token.WithTTL(ttl),
+		token.WithSignatureSecret(cfg.Secret.AuthBearer),
+		token.WithVerificationSecrets(cfg.Secret.AuthBearerPrevious...),
+		token.WithIssuer(cfg.Token.Issuer),
+		token.WithLogger(l.With("component", "bearer")),
+	)
+}
+
+// newTracer - tracer factory, returns nil tracer if tracing is off.
+// Returns function to flush spans and close exporter output.
+func newTracer(cfg *Configuration, l *slog.Logger) (*tracing.Tracer, func() error, error) {
+	var (
+		exporter tracing.Exporter
+		closer   = func() error { return nil }
 	)
-	AppConfigPathname, _ = os.LookupEnv(AppConfigPathnameEnv) // will initialize from env
-	flag.StringVar(&AppConfigPathname, "config", AppConfigPathname, descr)
-	flag.Parse()
+	switch cfg.Tracing.Exporter {
+	case TracingOTLP:
+		exporter = tracing.NewOTLPExporter(cfg.Tracing.Endpoint, cfg.Tracing.ServiceName)
+	case TracingFile:
+		w, err := logging.Open(cfg.Tracing.Output)
+		if err != nil {
+			return nil, nil, err
+		}
+		exporter, closer = tracing.NewFileExporter(w, cfg.Tracing.ServiceName), w.Close
+	default:
+		return nil, closer, nil
+	}
+	t := tracing.NewTracer(exporter, tracing.WithLogger(l.With("component", "tracing")))
+	return t, func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		err := t.Shutdown(ctx)
+		if cerr := closer(); err == nil {
+			err = cerr
+		}
+		return err
+	}, nil
+}
+
+// newHandler - wraps router with middleware, which must see every request including not routed ones;
+// metrics handler is served by the same handler if it is not nil.
+// Returns function to close access log output.
+func newHandler(cfg *Configuration, router, metricsHandler http.Handler) (http.Handler, func() error, error) {
+	proxies, err := middleware.ParseTrustedProxies(cfg.Server.TrustedProxies)
+	if err != nil {
+		return nil, nil, err
+	}
+	handler, closeAccessLog := router, func() error { return nil }
+	if metricsHandler != nil {
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == cfg.Metrics.Path {
+				metricsHandler.ServeHTTP(w, r)
+				return
+			}
+			router.ServeHTTP(w, r)
+		})
+	}
+	if cfg.Server.TLS.ClientCAFile != "" {
+		routes, admin := handler, middleware.ClientCertificateRequired()(handler)
+		handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if strings.HasPrefix(r.URL.Path, "/admin/") {
+				admin.ServeHTTP(w, r)
+				return
+			}
+			routes.ServeHTTP(w, r)
+		})
+	}
+	handler = middleware.MaxBodySize(cfg.Server.MaxBodyBytes)(handler)
+	if cfg.Server.TLS.HSTSMaxAge != "" {
+		maxAge, _ := time.ParseDuration(cfg.Server.TLS.HSTSMaxAge)
+		handler = middleware.StrictTransportSecurity(maxAge)(handler)
+	}
+	if format := cfg.Log.Access.Format; format != AccessLogOff {
+		if format == "" {
+			format = middleware.AccessLogCombined
+		}
+		output := cfg.Log.Access.Output
+		if output == "" {
+			output = "stdout"
+		}
+		w, err := logging.Open(output)
+		if err != nil {
+			return nil, nil, err
+		}
+		handler, closeAccessLog = middleware.AccessLog(w, format)(handler), w.Close
+	}
+	return middleware.RequestID()(middleware.RealIP(proxies)(handler)), closeAccessLog, nil
+}
+
+// newTLSConfig - TLS config of the API server, which certificate is reloaded by returned reloader;
+// returns nil config if TLS is off.
+func newTLSConfig(cfg *Configuration, l *slog.Logger) (*tls.Config, *certs.Reloader, error) {
+	params := cfg.Server.TLS
+	if params.CertFile == "" {
+		return nil, nil, nil
+	}
+	reloader, err := certs.NewReloader(params.CertFile, params.KeyFile, l.With("component", "certs"))
+	if err != nil {
+		return nil, nil, err
+	}
+	tlsConfig, err := certs.Config(reloader, params.MinVersion, params.Ciphers)
+	if err != nil {
+		return nil, nil, err
+	}
+	if params.ClientCAFile != "" {
+		if err := certs.WithClientCA(tlsConfig, params.ClientCAFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	return tlsConfig, reloader, nil
+}
 
-	if AppConfigPathname == "" {
-		fmt.Println("Startup error: config location is not defined.")
-		flag.PrintDefaults()
-		os.Exit(1)
+// newListeners - opens configured socket listeners of the API server besides TCP one.
+func newListeners(cfg *Configuration) ([]net.Listener, error) {
+	switch cfg.Server.Socket {
+	case "":
+		return nil, nil
+	case SocketSystemd:
+		return listener.Systemd()
+	}
+	l, err := listener.Unix(cfg.Server.Socket)
+	if err != nil {
+		return nil, err
 	}
+	return []net.Listener{l}, nil
+}
+
+// newRedirectHandler - redirects every request to the same URL over HTTPS on given port.
+func newRedirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = strings.Trim(r.Host, "[]")
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		} else if strings.Contains(host, ":") {
+			host = "[" + host + "]"
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// newMetricsHandler - serves metrics on given path of the admin listener.
+func newMetricsHandler(path string, metricsHandler http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != path {
+			http.NotFound(w, r)
+			return
+		}
+		metricsHandler.ServeHTTP(w, r)
+	})
 }
 
 func main() {
-	cfg, err := loadJSONConfig(AppConfigPathname)
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr, os.Environ()))
+}
+
+// serve - runs the server until it is stopped, returns exit code of the process;
+// configuration is loaded again by the app on SIGHUP. Pending migrations are applied if migrate is true,
+// otherwise server refuses to start with schema, which is behind or ahead.
+func serve(a *app, cfg *Configuration, migrate bool) int {
+	logOutput, err := logging.Open(cfg.Log.Output)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Unable to open log output: %s\n", err.Error())
+		return lifecycle.ExitRunFailed
+	}
+	defer logOutput.Close()
+	logLevel := new(slog.LevelVar)
+	if level, err := logging.ParseLevel(cfg.Log.Level); err == nil {
+		logLevel.Set(level)
+	}
+	logger, err := logging.NewWithLeveler(logOutput, cfg.Log.Format, logLevel)
+	if err != nil {
+		fmt.Fprintf(a.stderr, "Unable to init logger: %s\n", err.Error())
+		return lifecycle.ExitRunFailed
+	}
+	shutdownTimeout, _ := time.ParseDuration(cfg.Server.ShutdownTimeout)
+	lc := lifecycle.New(
+		lifecycle.WithTimeout(shutdownTimeout),
+		lifecycle.WithLogger(logger),
+	)
+
+	tlsConfig, certificates, err := newTLSConfig(cfg, logger)
+	if err != nil {
+		logger.Error("TLS initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
+	}
+	if certificates != nil {
+		lc.Add(lifecycle.Worker("certificates", func(ctx context.Context) {
+			certificates.Run(ctx, 10*time.Second)
+		}))
+	}
+	sockets, err := newListeners(cfg)
+	if err != nil {
+		logger.Error("Socket initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
+	}
+
+	tracer, closeTracer, err := newTracer(cfg, logger)
 	if err != nil {
-		fmt.Printf("Unable to load config (%s): %s\n", AppConfigPathname, err.Error())
-		os.Exit(1)
+		logger.Error("Tracing initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
 	}
+	// spans of other components are flushed on stop
+	lc.Add(lifecycle.Closer("tracer", closeTracer))
 
-	storage, err := newStorage(cfg)
+	storage, err := newStorage(cfg, logger, tracer, migrate)
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+		closeTracer()
+		logger.Error("Storage initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
 	}
-	if storage == nil {
-		fmt.Println("Storage interface was not properly initialized <nil>")
-		os.Exit(1)
+	if err := storage.CheckSchema(context.Background()); err != nil {
+		storage.Close()
+		closeTracer()
+		logger.Error("Database schema is not compatible, run migrate command or serve -migrate", "error", err)
+		return lifecycle.ExitRunFailed
 	}
-	defer storage.Close()
+	lc.Add(lifecycle.Closer("storage", storage.Close))
 
-	authBearer := token.NewMD5DigestBearer(
-		token.WithTTL(1*time.Hour),
-		token.WithSignatureSecret(cfg.Secret.AuthBearer),
-		token.WithIssuer("PW demo API server"),
+	authBearer := newBearer(cfg, logger)
+	events := notify.NewBus(1000, 64)
+	registry := metrics.NewRegistry()
+	registry.RegisterRuntime()
+	registry.RegisterDBStats("pwsrv_db_", storage.DBStats)
+	instruments := core.NewMetrics(registry)
+	monitor := health.NewMonitor(
+		Version,
+		health.Check{Name: "database", Run: storage.Ping},
+		health.Check{Name: "schema", Run: storage.CheckSchema},
+	)
+	service, err := core.NewHTTPService(
+		core.TraceRepository(storage.CoreRepository(), tracer),
+		authBearer,
+		events,
+		logger,
+		instruments,
+		monitor,
 	)
-	service, err := core.NewHTTPService(storage.CoreRepository(), authBearer)
 	if err != nil {
-		fmt.Println(err.Error())
-		os.Exit(1)
+		storage.Close()
+		closeTracer()
+		logger.Error("Service initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
 	}
-	server := &http.Server{
-		Addr:    fmt.Sprintf("%s:%d", cfg.Server.Address, cfg.Server.Port),
-		Handler: core.NewRouter(service, authBearer),
-	}
-
-	once := sync.Once{}
-	startFail := make(chan error, 1)
-	stopFail := make(chan error, 1)
-	stop := make(chan bool, 1)
-	sig := make(chan os.Signal, 1)
-	signal.Notify(sig, os.Interrupt)
-
-	startServer(server, startFail)
-	waitServerStop(server, stop, stopFail)
-
-	for {
-		select {
-		case <-sig:
-			stop <- true
-		case err := <-startFail:
-			if err != nil && err != http.ErrServerClosed {
-				// any startup errors here...
-				fmt.Printf("Server (%s) failed to run %q\n", server.Addr, err.Error())
-				os.Exit(1)
+	var apiMetrics http.Handler
+	if cfg.Metrics.Enabled && cfg.Metrics.Port == 0 {
+		apiMetrics = registry.Handler()
+	}
+	handler, closeAccessLog, err := newHandler(
+		cfg,
+		core.NewRouter(service, authBearer, storage.CoreRepository(), logger, instruments, tracer),
+		apiMetrics,
+	)
+	if err != nil {
+		storage.Close()
+		closeTracer()
+		logger.Error("Handler initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
+	}
+	defer closeAccessLog()
+
+	expirer, err := core.NewExpirer(core.TraceRepository(storage.CoreRepository(), tracer), events, instruments)
+	if err != nil {
+		storage.Close()
+		closeTracer()
+		logger.Error("Expiration initialization failed", "error", err)
+		return lifecycle.ExitRunFailed
+	}
+	lc.Add(lifecycle.Worker("expiration", func(ctx context.Context) {
+		background.Run(ctx, 1*time.Minute, func(now time.Time) {
+			if err := expirer.Run(now); err != nil {
+				logger.Error("Expiration failed", "error", err)
 			}
-		case err := <-stopFail:
-			if err != nil {
-				fmt.Printf("Server (%s) stopped with an error %q\n", server.Addr, err.Error())
-			} else {
-				fmt.Printf("Server (%s) successfully stopped\n", server.Addr)
+		})
+	}))
+	// domain events are delivered from the outbox to every subscriber at least once,
+	// events failed to be handled are dead-lettered after retries
+	outbox := event.NewDispatcher(storage.EventStore(), 100)
+	outbox.Subscribe("webhooks", storage.WebhookStore().EnqueueWebhooks)
+	lc.Add(lifecycle.Worker("outbox", func(ctx context.Context) {
+		background.Run(ctx, 1*time.Second, func(now time.Time) {
+			if _, err := outbox.Dispatch(now); err != nil {
+				logger.Error("Event dispatching failed", "error", err)
 			}
-			return
-		default:
-			once.Do(func() { fmt.Println("Server is running!") })
+		})
+	}))
+	lc.Add(lifecycle.Worker("outbox-retention", func(ctx context.Context) {
+		background.Run(ctx, 1*time.Hour, func(now time.Time) {
+			if n, err := outbox.Prune(now); err != nil {
+				logger.Error("Event pruning failed", "error", err)
+			} else if n > 0 {
+				logger.Info("Handled events pruned", "count", n)
+			}
+		})
+	}))
+	webhooks := webhook.NewDispatcher(storage.WebhookStore())
+	lc.Add(lifecycle.Worker("webhooks", func(ctx context.Context) {
+		background.Run(ctx, 5*time.Second, func(now time.Time) {
+			if _, err := webhooks.Dispatch(now); err != nil {
+				logger.Error("Webhook dispatching failed", "error", err)
+			}
+		})
+	}))
+
+	if cfg.Reconcile.Interval != ReconcileOff {
+		interval, _ := time.ParseDuration(cfg.Reconcile.Interval)
+		checker := reconcile.NewChecker(storage.ReconcileStore())
+		registry.NewGaugeFunc(
+			"pwsrv_reconcile_discrepancies",
+			"Number of discrepancies found by the last balance reconciliation.",
+			checker.Discrepancies,
+		)
+		registry.NewGaugeFunc(
+			"pwsrv_reconcile_last_run_timestamp_seconds",
+			"Unix time of the last successful balance reconciliation.",
+			checker.LastRun,
+		)
+		lc.Add(lifecycle.Worker("reconcile", func(ctx context.Context) {
+			background.Run(ctx, interval, func(now time.Time) {
+				report, err := checker.Run(now.UTC())
+				if err != nil {
+					logger.Error("Balance reconciliation failed", "error", err)
+					return
+				}
+				for _, d := range report.Discrepancies {
+					logger.Error(
+						"Balance discrepancy",
+						"kind", d.Kind, "user_id", d.UserID, "currency", d.Currency,
+						"transfer_id", d.TransferID, "conversion_id", d.ConversionID,
+						"expected", d.Expected, "actual", d.Actual,
+					)
+				}
+			})
+		}))
+	}
+
+	reloader := &reloader{cfg: cfg, level: logLevel, bearer: authBearer, logger: logger}
+	lc.Add(lifecycle.Worker("reload", func(ctx context.Context) {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-hup:
+				next, err := a.config()
+				if err != nil {
+					logger.Error("Config reload failed, current config is kept", "error", err)
+					continue
+				}
+				reloader.reload(next)
+			}
+		}
+	}))
+
+	if cfg.Metrics.Enabled && cfg.Metrics.Port > 0 {
+		admin := &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", cfg.Metrics.Address, cfg.Metrics.Port),
+			Handler: newMetricsHandler(cfg.Metrics.Path, registry.Handler()),
 		}
+		logger.Info("Starting metrics server", "address", admin.Addr)
+		lc.Add(lifecycle.Server("metrics server", admin, nil))
+	}
+	// timeouts are verified on loading
+	readHeaderTimeout, _ := time.ParseDuration(cfg.Server.ReadHeaderTimeout)
+	readTimeout, _ := time.ParseDuration(cfg.Server.ReadTimeout)
+	writeTimeout, _ := time.ParseDuration(cfg.Server.WriteTimeout)
+	idleTimeout, _ := time.ParseDuration(cfg.Server.IdleTimeout)
+	server := &http.Server{
+		Addr:              fmt.Sprintf("%s:%d", cfg.Server.Address, cfg.Server.Port),
+		Handler:           handler,
+		TLSConfig:         tlsConfig,
+		ReadHeaderTimeout: readHeaderTimeout,
+		ReadTimeout:       readTimeout,
+		WriteTimeout:      writeTimeout,
+		IdleTimeout:       idleTimeout,
+		MaxHeaderBytes:    cfg.Server.MaxHeaderBytes,
 	}
+	// finish event streams, otherwise shutdown waits for them until timeout
+	server.RegisterOnShutdown(events.Close)
+	if cfg.Server.Port > 0 {
+		logger.Info("Starting server", "address", server.Addr, "tls", tlsConfig != nil)
+		lc.Add(lifecycle.Server("server", server, nil))
+	}
+	for _, l := range sockets {
+		logger.Info("Starting server", "socket", l.Addr().String(), "tls", tlsConfig != nil)
+		lc.Add(lifecycle.Server("server "+l.Addr().String(), server, l))
+	}
+	if port := cfg.Server.TLS.RedirectPort; port > 0 {
+		redirect := &http.Server{
+			Addr:    fmt.Sprintf("%s:%d", cfg.Server.Address, port),
+			Handler: newRedirectHandler(cfg.Server.Port),
+		}
+		logger.Info("Starting redirect server", "address", redirect.Addr)
+		lc.Add(lifecycle.Server("redirect server", redirect, nil))
+	}
+	// readiness probe fails from now on, servers are stopped after the drain delay
+	drainDelay, _ := time.ParseDuration(cfg.Server.DrainDelay)
+	lc.Add(lifecycle.Drain("readiness", monitor.Drain, drainDelay))
+
+	return lc.Run(context.Background())
 }
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/wtask/pwsrv/internal/config"
+	"github.com/wtask/pwsrv/internal/encryption/token"
+	"github.com/wtask/pwsrv/internal/logging"
+)
+
+// reloadable - keys of parameters applied to the running server on SIGHUP;
+// secret source parameters are only used to resolve secret.auth_bearer,
+// user password is used by the hasher created on start, so its secret and file require restart.
+var reloadable = map[string]bool{
+	"log.level":                   true,
+	"token.ttl":                   true,
+	"token.issuer":                true,
+	"secret.auth_bearer":          true,
+	"secret.auth_bearer_file":     true,
+	"secret.auth_bearer_previous": true,
+	"secret.provider":             true,
+	"secret.dir":                  true,
+	"secret.env_prefix":           true,
+	"secret.keyring":              true,
+	"secret.master_key":           true,
+	"secret.master_key_file":      true,
+	"secret.min_entropy":          true,
+}
+
+// reloader - applies reloaded configuration to the running components.
+type reloader struct {
+	cfg    *Configuration
+	level  *slog.LevelVar
+	bearer token.AuthBearer
+	logger *slog.Logger
+	// replaced - bearer secret replaced by the last reload, tokens signed with it are valid until they expire
+	replaced string
+}
+
+// reload - swaps reloadable parameters of the valid configuration,
+// changes of other parameters require restart and are ignored with warning.
+func (r *reloader) reload(next *Configuration) {
+	applied, ignored := []string{}, []string{}
+	for _, key := range config.Diff(r.cfg, next) {
+		if reloadable[key] {
+			applied = append(applied, key)
+		} else {
+			ignored = append(ignored, key)
+		}
+	}
+	if len(ignored) > 0 {
+		r.logger.Warn("Config changes require restart and are ignored", "keys", strings.Join(ignored, ","))
+	}
+
+	// values are verified on loading
+	level, _ := logging.ParseLevel(next.Log.Level)
+	ttl, _ := time.ParseDuration(next.Token.TTL)
+	if next.Secret.AuthBearer != r.cfg.Secret.AuthBearer {
+		r.replaced = r.cfg.Secret.AuthBearer
+	}
+	previous := next.Secret.AuthBearerPrevious
+	if r.replaced != "" {
+		previous = append([]string{r.replaced}, previous...)
+	}
+	r.level.Set(level)
+	r.bearer.Reconfigure(
+		token.WithTTL(ttl),
+		token.WithIssuer(next.Token.Issuer),
+		token.WithSignatureSecret(next.Secret.AuthBearer),
+		token.WithVerificationSecrets(previous...),
+	)
+
+	cfg := *r.cfg
+	cfg.Log.Level = next.Log.Level
+	cfg.Token = next.Token
+	userPassword, userPasswordFile := cfg.Secret.UserPassword, cfg.Secret.UserPasswordFile
+	cfg.Secret = next.Secret
+	cfg.Secret.UserPassword, cfg.Secret.UserPasswordFile = userPassword, userPasswordFile
+	r.cfg = &cfg
+	r.logger.Info("Config reloaded", "keys", strings.Join(applied, ","))
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/wtask/pwsrv/internal/encryption/token"
+)
+
+func TestReloadUserPasswordFile(t *testing.T) {
+	cfg := defaultConfiguration()
+	cfg.Secret.UserPassword, cfg.Secret.UserPasswordFile = "old-password", "/run/secrets/old"
+	next := *cfg
+	next.Secret.UserPassword, next.Secret.UserPasswordFile = "new-password", "/run/secrets/new"
+	next.Token.Issuer = "reloaded"
+
+	out := bytes.Buffer{}
+	r := &reloader{
+		cfg:    cfg,
+		level:  &slog.LevelVar{},
+		bearer: token.NewMD5DigestBearer(),
+		logger: slog.New(slog.NewTextHandler(&out, nil)),
+	}
+	r.reload(&next)
+
+	log := out.String()
+	if !strings.Contains(log, "Config changes require restart and are ignored") ||
+		!strings.Contains(log, "secret.user_password_file") {
+		t.Errorf("Ignored change is not reported: %s", log)
+	}
+	if !strings.Contains(log, "Config reloaded") || !strings.Contains(log, "keys=token.issuer\n") {
+		t.Errorf("Unexpected reloaded keys: %s", log)
+	}
+	if r.cfg.Secret.UserPassword != "old-password" || r.cfg.Secret.UserPasswordFile != "/run/secrets/old" {
+		t.Errorf("User password is reloaded: %+v", r.cfg.Secret)
+	}
+	if r.cfg.Token.Issuer != "reloaded" {
+		t.Errorf("Token issuer is not reloaded: %q", r.cfg.Token.Issuer)
+	}
+}